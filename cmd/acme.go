@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/acme"
+	"github.com/markussiebert/homeddns/internal/dnsclient"
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/updater"
+)
+
+// ACMEConfig configures obtaining the certificate of the HTTPS listener
+// with the ACME DNS-01 challenge. ACME is disabled if Domains is empty.
+type ACMEConfig struct {
+	// Domains are the names of the certificate, e.g. *.example.com
+	Domains   []string
+	Email     string
+	Directory string
+	// Dir stores the account key and the certificate
+	Dir string
+	// CAFile holds additional root CAs of the ACME server, e.g. of a
+	// private CA
+	CAFile      string
+	RenewBefore time.Duration
+}
+
+// loadACMEConfig reads the ACME_* settings from the environment or the
+// configuration file. All invalid settings are reported, joined.
+func loadACMEConfig(env provider.Settings) (ACMEConfig, error) {
+	config := ACMEConfig{
+		Email:       env.Get("ACME_EMAIL"),
+		Directory:   env.Get("ACME_DIRECTORY"),
+		Dir:         env.Get("ACME_DIR"),
+		CAFile:      env.Get("ACME_CA_FILE"),
+		RenewBefore: acme.DefaultRenewBefore,
+	}
+	for _, domain := range strings.Split(env.Get("ACME_DOMAINS"), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			config.Domains = append(config.Domains, domain)
+		}
+	}
+	if config.Directory == "" {
+		config.Directory = acme.LetsEncrypt
+	}
+	if config.Dir == "" {
+		config.Dir = acme.DefaultDir()
+	}
+
+	var errs []error
+	if u, err := url.Parse(config.Directory); err != nil || u.Scheme != "https" || u.Host == "" {
+		errs = append(errs, invalidSetting("ACME_DIRECTORY", "invalid ACME_DIRECTORY %q (expected an https URL)", config.Directory))
+	}
+	if value := env.Get("ACME_RENEW_BEFORE"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			errs = append(errs, invalidSetting("ACME_RENEW_BEFORE", "invalid ACME_RENEW_BEFORE: %q", value))
+		} else {
+			config.RenewBefore = d
+		}
+	}
+	if config.CAFile != "" {
+		if _, err := os.Stat(config.CAFile); err != nil {
+			errs = append(errs, invalidSetting("ACME_CA_FILE", "ACME CA file not found: %s", config.CAFile))
+		}
+	}
+	return config, errors.Join(errs...)
+}
+
+// newACMEManager returns a manager for the certificate of config that
+// publishes the challenges through the public provider of upd
+func newACMEManager(config *Config, upd *updater.Updater) (*acme.Manager, error) {
+	client := http.DefaultClient
+	if config.ACME.CAFile != "" {
+		pem, err := os.ReadFile(config.ACME.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in ACME CA file %s", config.ACME.CAFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		client = &http.Client{Transport: transport}
+	}
+	return acme.New(acme.Config{
+		DirectoryURL: config.ACME.Directory,
+		Email:        config.ACME.Email,
+		Domains:      config.ACME.Domains,
+		Zones:        configZones(config),
+		Dir:          config.ACME.Dir,
+		RenewBefore:  config.ACME.RenewBefore,
+		HTTPClient:   client,
+		DNS:          &dnsclient.Client{Nameservers: config.Nameservers},
+	}, upd.Views()[0].Provider), nil
+}
+
+// obtainCertificate gets a certificate if there is none or it is due for
+// renewal. On errors a stored certificate is kept, so that the server can
+// start and renew it later.
+func obtainCertificate(ctx context.Context, manager *acme.Manager, config *Config) error {
+	reason := manager.RenewalDue(time.Now())
+	if reason == "" {
+		return nil
+	}
+	logger.Info("Obtaining certificate for %s from %s: %s", strings.Join(config.ACME.Domains, ", "), config.ACME.Directory, reason)
+	err := manager.Obtain(ctx)
+	if err == nil {
+		return nil
+	}
+	if _, loadErr := tls.LoadX509KeyPair(manager.CertFile(), manager.KeyFile()); loadErr != nil {
+		return fmt.Errorf("obtain certificate: %w", err)
+	}
+	logger.Error("Certificate renewal failed, serving the stored certificate: %v", err)
+	return nil
+}
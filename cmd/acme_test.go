@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/acme"
+)
+
+func TestLoadConfig_ACME(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, "homeddns.yaml", "acme:\n  domains: [example.com, \"*.example.com\"]\n  email: admin@example.com\n")
+	t.Setenv("AUTH_USERNAME", "admin")
+	t.Setenv("AUTH_PASSWORD", "secret")
+	t.Setenv("DOMAIN", "example.com")
+	t.Setenv("DNS_PROVIDER", "netcup_ccp")
+	t.Setenv("ACME_DIR", dir)
+	// The certificate files are replaced by those of ACME_DIR
+	t.Setenv("CERTFILE", "/missing/fullchain.pem")
+
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "*.example.com"}, config.ACME.Domains)
+	assert.Equal(t, "admin@example.com", config.ACME.Email)
+	assert.Equal(t, acme.LetsEncrypt, config.ACME.Directory)
+	assert.Equal(t, acme.DefaultRenewBefore, config.ACME.RenewBefore)
+	assert.True(t, config.SSL)
+	assert.Equal(t, filepath.Join(dir, "fullchain.pem"), config.CertFile)
+	assert.Equal(t, filepath.Join(dir, "privkey.pem"), config.KeyFile)
+
+	// The doctor warns until the server obtained the certificate
+	result := checkCertificate(config, time.Now())
+	assert.Equal(t, checkWarn, result.status)
+	assert.Equal(t, "not obtained yet", result.detail)
+
+	t.Setenv("ACME_DIRECTORY", "http://localhost:14000/dir")
+	t.Setenv("ACME_RENEW_BEFORE", "a month")
+	_, problems := loadConfig(path)
+	var settings []string
+	for _, problem := range problems.problems {
+		settings = append(settings, problem.Setting)
+	}
+	assert.Equal(t, []string{"ACME_DIRECTORY", "ACME_RENEW_BEFORE"}, settings)
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/audit"
+)
+
+// AuditOptions selects the audit log entries to print
+type AuditOptions struct {
+	Hostname string
+	Since    string // time or duration before now
+	Until    string // time or duration before now
+	Limit    int    // only the most recent entries; 0 for all
+	JSON     bool   // print JSON lines instead of a table
+}
+
+// RunAudit prints the entries of the audit log matching the options,
+// oldest first
+func RunAudit(w io.Writer, options AuditOptions) error {
+	now := time.Now()
+	filter := audit.Filter{Hostname: options.Hostname}
+	var err error
+	if filter.Since, err = parseTimeArg(options.Since, now); err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	if filter.Until, err = parseTimeArg(options.Until, now); err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+
+	path := AuditLogPath()
+	entries, err := audit.Read(path, filter)
+	if err != nil {
+		return err
+	}
+	if options.Limit > 0 && len(entries) > options.Limit {
+		entries = entries[len(entries)-options.Limit:]
+	}
+
+	if options.JSON {
+		enc := json.NewEncoder(w)
+		for _, entry := range entries {
+			if err := enc.Encode(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(entries) == 0 {
+		fmt.Fprintf(w, "No matching entries in %s\n", path)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tHOSTNAME\tTYPE\tVIEW\tPREVIOUS\tVALUE\tCLIENT\tUSER\tREQUEST")
+	for _, e := range entries {
+		if e.Action == audit.ActionDelete {
+			e.Value = "(deleted)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Time.Local().Format(time.DateTime), e.Hostname, e.Type, orDash(e.View),
+			orDash(e.Previous), e.Value, orDash(e.Client), orDash(e.User), orDash(e.RequestID))
+	}
+	return tw.Flush()
+}
+
+// parseTimeArg parses an RFC 3339 time, a local date or date and time, or a
+// duration before now such as "24h". An empty value yields the zero time.
+func parseTimeArg(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{time.DateTime, "2006-01-02T15:04:05", "2006-01-02 15:04", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a time (e.g. 2024-05-01 or 2024-05-01T12:00:00Z) nor a duration (e.g. 24h)", value)
+}
@@ -1,161 +1,290 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
+	"maps"
+	"net"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/markussiebert/homeddns/internal/acme"
+	"github.com/markussiebert/homeddns/internal/audit"
+	"github.com/markussiebert/homeddns/internal/auth"
 	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/state"
 	"github.com/markussiebert/homeddns/internal/util"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Port       int
-	Username   string
-	Password   string
-	Provider   string
-	Domain     string
-	DefaultTTL int
-	SSL        bool
-	CertFile   string
-	KeyFile    string
+	// File is the configuration file, if any
+	File string
+	// ConfigWatchInterval is how often the configuration files are checked
+	// for changes to reload them (0 disables it)
+	ConfigWatchInterval time.Duration
+
+	Port     int
+	Username string
+	Password util.Secret
+	Provider string
+	Domain   string
+	// Users are additional accounts from the configuration file
+	Users []auth.User
+	// Zones, if set, limits updates to these zones
+	Zones []string
+	// ProviderSettings are the provider settings of the configuration file
+	ProviderSettings provider.Settings
+	DefaultTTL       int
+	SSL              bool
+	CertFile         string
+	KeyFile          string
+	// ACME obtains the certificate from an ACME CA instead of the files
+	ACME ACMEConfig
+
+	// AuthMode selects Basic auth and/or client certificates, which are
+	// verified against ClientCAFile and ClientCRLFile
+	AuthMode      auth.Mode
+	ClientCAFile  string
+	ClientCRLFile string
+
+	// Split-horizon: optional LAN view published to a local resolver
+	LANProvider         string
+	LANProviderSettings provider.Settings
+	LANAddressSource    string
+	LANHosts            map[string][]string
+
+	// CoalesceWindow is how long updates to a zone are collected before
+	// they are written in one provider call
+	CoalesceWindow time.Duration
+
+	// Record cache: entries live for CacheTTL (0 disables the cache) and are
+	// compared with the provider every CacheRevalidateInterval
+	CacheTTL                time.Duration
+	CacheRevalidateInterval time.Duration
+
+	// StateFile persists the last applied records and their history
+	StateFile         string
+	StateHistoryLimit int
+
+	// AuditLog is the append-only log of all record updates. It is rotated
+	// once it exceeds AuditMaxSize bytes (0 disables rotation), keeping
+	// AuditMaxFiles old files.
+	AuditLog      string
+	AuditMaxSize  int64
+	AuditMaxFiles int
+
+	// Drift detection against the authoritative nameservers (0 disables it)
+	DriftCheckInterval time.Duration
+	DriftAutoRepair    bool
+
+	// Nameservers overrides the NS discovery for drift checks and waiting
+	Nameservers []string
+	// WaitTimeout bounds how long a wait=1 update waits for propagation
+	WaitTimeout time.Duration
+
+	// Prometheus metrics: served on MetricsListenAddr if set, otherwise on
+	// the DynDNS port when metrics credentials are configured
+	MetricsListenAddr string
+	MetricsUsername   string
+	MetricsPassword   util.Secret
+
+	// PublicIPURLs are asked for the public IP in order until one answers
+	PublicIPURLs []string
+	// TrustedProxies may set the client address with X-Forwarded-For
+	TrustedProxies []*net.IPNet
+
+	// LogLevel and LogFormat configure the logger
+	LogLevel  string
+	LogFormat string
+
+	// Notify configures notifications of changed records
+	Notify NotifyConfig
+	// MQTT configures publishing to Home Assistant
+	MQTT MQTTConfig
+	// HomeAssistantIngress serves Home Assistant ingress requests without
+	// authentication; it is only set when running as the add-on
+	HomeAssistantIngress bool
 }
 
-func LoadHomeAssistantConfig() error {
-	optionsPath := os.Getenv("ADDON_OPTIONS_PATH")
-	if optionsPath == "" {
-		logger.Debug("ADDON_OPTIONS_PATH not set, skipping Home Assistant config loading")
-		return nil
+// LoadConfig loads the configuration from the Home Assistant options, the
+// configuration file at path (if set) and the environment. All problems are
+// reported in a *ConfigError.
+func LoadConfig(path string) (*Config, error) {
+	config, problems := loadConfig(path)
+	if err := problems.err(); err != nil {
+		return nil, err
 	}
+	return config, nil
+}
 
-	logger.Info("Loading Home Assistant configuration from: %s", optionsPath)
-
-	info, err := os.Stat(optionsPath)
-	if err != nil {
-		return logger.Errorf("failed to stat options file %s: %w", optionsPath, err)
-	}
-	if info.IsDir() {
-		return logger.Errorf("options path %s is a directory", optionsPath)
-	}
+// loadConfig is LoadConfig, but also returns the configuration if it has
+// problems, so that they can be checked further
+func loadConfig(path string) (*Config, *configProblems) {
+	logger.Debug("Loading application configuration")
 
-	logger.Debug("Reading options file (size: %d bytes, mode: %s, uid/gid: owner info)", info.Size(), info.Mode())
-	data, err := os.ReadFile(optionsPath)
-	if err != nil {
-		if os.IsPermission(err) {
-			logger.Info("Permission denied reading options file - Home Assistant addon may need 'hassio_api: true' or file permissions fix")
-			logger.Info("Current process UID: %d, file mode: %s", os.Getuid(), info.Mode())
+	// Settings of the configuration file, overridden by the options of the
+	// Home Assistant add-on and then by environment variables. Problems are
+	// collected, so that all of them are reported at once.
+	env := provider.Settings{}
+	file := &fileConfig{}
+	problems := &configProblems{file: path}
+	if path != "" {
+		logger.Info("Loading configuration file: %s", path)
+		if f, err := loadConfigFile(path); err != nil {
+			problems.addFile(err)
+		} else {
+			file = f
+			problems.fileEnv = file.env()
+			maps.Copy(env, problems.fileEnv)
 		}
-		return logger.Errorf("failed to read options file %s: %w", optionsPath, err)
 	}
-
-	logger.Debug("Raw JSON content: %s", string(data))
-
-	var raw map[string]any
-	if err := json.Unmarshal(data, &raw); err != nil {
-		logger.Debug("Invalid JSON content was: %s", string(data))
-		return logger.Errorf("failed to parse options.json: %w", err)
-	}
-
-	logger.Info("Successfully parsed options.json with %d keys", len(raw))
-	logger.Debug("Parsed JSON keys: %v", getKeys(raw))
-
-	envVarsSet := 0
-	for key, value := range raw {
-		envKey := strings.ToUpper(strings.ReplaceAll(key, " ", "_"))
-		if envKey == "" {
-			logger.Warn("Skipping empty key in options.json")
-			continue
-		}
-		envValue := fmt.Sprintf("%v", value)
-
-		// Mask sensitive values in logs
-		logValue := envValue
-		if util.IsSensitiveKey(key) {
-			logValue = util.MaskSensitive(envValue)
+	options := &homeAssistantOptions{}
+	var optionsPublic, optionsLAN provider.Settings
+	if optionsPath := os.Getenv("ADDON_OPTIONS_PATH"); optionsPath != "" {
+		logger.Info("Loading Home Assistant options: %s", optionsPath)
+		if o, err := loadHomeAssistantOptions(optionsPath); err != nil {
+			problems.addHomeAssistant(err)
+		} else {
+			options = o
+			problems.optionsEnv, optionsPublic, optionsLAN = options.settings()
+			maps.Copy(env, problems.optionsEnv)
 		}
-
-		logger.Debug("Setting env var: %s=%s (from JSON key: %s)", envKey, logValue, key)
-		os.Setenv(envKey, envValue)
-		envVarsSet++
 	}
 
-	logger.Info("Set %d environment variables from Home Assistant config", envVarsSet)
-	return nil
-}
+	config := &Config{
+		File:           path,
+		Port:           8053,
+		DefaultTTL:     60,
+		Provider:       "netcup_ccp", // default provider
+		CoalesceWindow: 500 * time.Millisecond,
 
-// getKeys returns the keys of a map
-func getKeys(m map[string]any) []string {
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
-	}
-	return keys
-}
+		CacheTTL:                time.Hour,
+		CacheRevalidateInterval: 10 * time.Minute,
 
-func LoadConfig() (*Config, error) {
-	logger.Debug("Loading application configuration")
+		StateFile:         StateFilePath(),
+		StateHistoryLimit: state.DefaultHistoryLimit,
 
-	if err := LoadHomeAssistantConfig(); err != nil {
-		logger.Warn("Failed to load Home Assistant config: %v", err)
-	}
+		AuditLog:      AuditLogPath(),
+		AuditMaxFiles: audit.DefaultMaxFiles,
 
-	config := &Config{
-		Port:       8053,
-		DefaultTTL: 60,
-		Provider:   "netcup_ccp", // default provider
+		DriftCheckInterval: 15 * time.Minute,
+		DriftAutoRepair:    true,
+
+		WaitTimeout: 2 * time.Minute,
 	}
 
 	logger.Debug("Default config: port=%d, ttl=%d, provider=%s", config.Port, config.DefaultTTL, config.Provider)
 
 	// Port
-	if port := os.Getenv("PORT"); port != "" {
+	if port := env.Get("PORT"); port != "" {
 		logger.Debug("Reading PORT from env: %s", port)
 		p, err := strconv.Atoi(port)
 		if err != nil {
-			return nil, logger.Errorf("invalid PORT: %w", err)
+			problems.add(invalidSetting("PORT", "invalid PORT: %w", err))
 		}
 		config.Port = p
 		logger.Debug("Set port to: %d", p)
 	}
 
-	// Auth credentials
-	config.Username = os.Getenv("AUTH_USERNAME")
-	if config.Username == "" {
-		return nil, logger.Errorf("AUTH_USERNAME is required")
+	// Authentication mode
+	config.AuthMode = auth.Mode(strings.ToLower(env.Get("AUTH_MODE")))
+	if config.AuthMode == "" {
+		config.AuthMode = auth.ModeBasic
+	}
+	if !slices.Contains(auth.Modes, config.AuthMode) {
+		problems.add(invalidSetting("AUTH_MODE", "invalid AUTH_MODE %q (expected basic, cert, cert_or_basic or cert_and_basic)", config.AuthMode))
 	}
-	logger.Debug("Auth username: %s", config.Username)
 
-	config.Password = os.Getenv("AUTH_PASSWORD")
-	if config.Password == "" {
-		return nil, logger.Errorf("AUTH_PASSWORD is required")
+	// Auth credentials; the configuration file may replace the single
+	// account with a list of users. Client certificates need no password.
+	config.Users = file.users()
+	if users, err := options.users(); err != nil {
+		problems.addHomeAssistant(err)
+	} else {
+		config.Users = append(config.Users, users...)
 	}
+	config.Username = env.Get("AUTH_USERNAME")
+	password, err := env.Secret("AUTH_PASSWORD")
+	if err != nil {
+		problems.add(invalidSetting("AUTH_PASSWORD", "%w", err))
+	} else if config.AuthMode.Basic() && (len(config.Users) == 0 || config.Username != "" || password != "") {
+		if config.Username == "" {
+			problems.add(invalidSetting("AUTH_USERNAME", "AUTH_USERNAME is required"))
+		}
+		if password == "" {
+			problems.add(invalidSetting("AUTH_PASSWORD", "AUTH_PASSWORD is required"))
+		}
+	}
+	config.Password = password
+	logger.Debug("Auth username: %s, additional users: %d", config.Username, len(config.Users))
 	logger.Debug("Password loaded (length: %d)", len(config.Password))
 
 	// Provider selection
-	if provider := os.Getenv("DNS_PROVIDER"); provider != "" {
+	config.ProviderSettings = mergeSettings(file.providerSettings("public"), optionsPublic)
+	if provider := env.Get("DNS_PROVIDER"); provider != "" {
 		logger.Debug("Reading DNS_PROVIDER from env: %s", provider)
 		config.Provider = strings.ToLower(provider)
 		logger.Debug("Set DNS provider to: %s", config.Provider)
 	} else {
 		logger.Debug("DNS_PROVIDER not set, using default: %s", config.Provider)
 	}
+	problems.add(checkProvider("DNS_PROVIDER", config.Provider))
 
 	// Domain
-	config.Domain = os.Getenv("DOMAIN")
+	config.Domain = env.Get("DOMAIN")
 	if config.Domain == "" {
-		return nil, logger.Errorf("DOMAIN is required")
+		problems.add(invalidSetting("DOMAIN", "DOMAIN is required"))
 	}
 	logger.Debug("Domain: %s", config.Domain)
 
+	// Zones that may be updated (all if unset)
+	for _, zone := range strings.Split(env.Get("ZONES"), ",") {
+		if zone = strings.ToLower(strings.TrimSpace(zone)); zone != "" {
+			config.Zones = append(config.Zones, zone)
+		}
+	}
+
+	// Public IP detection
+	for _, u := range strings.Split(env.Get("PUBLIC_IP_URLS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			config.PublicIPURLs = append(config.PublicIPURLs, u)
+		}
+	}
+	if len(config.PublicIPURLs) == 0 {
+		config.PublicIPURLs = []string{defaultPublicIPURL}
+	}
+
+	// Reverse proxies whose X-Forwarded-For header is trusted
+	for _, proxy := range strings.Split(env.Get("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		}
+		network, err := parseNetwork(proxy)
+		if err != nil {
+			problems.add(invalidSetting("TRUSTED_PROXIES", "invalid TRUSTED_PROXIES entry %q (expected an address or CIDR)", proxy))
+			continue
+		}
+		config.TrustedProxies = append(config.TrustedProxies, network)
+	}
+
+	// The Supervisor provides a token to add-ons only, which cannot come
+	// from the configuration file or the options
+	config.HomeAssistantIngress = os.Getenv("SUPERVISOR_TOKEN") != ""
+
+	// Logging
+	config.LogLevel = env.Get("LOG_LEVEL")
+	config.LogFormat = env.Get("LOG_FORMAT")
+
 	// TTL
-	if ttl := os.Getenv("DNS_TTL"); ttl != "" {
+	if ttl := env.Get("DNS_TTL"); ttl != "" {
 		logger.Debug("Reading DNS_TTL from env: %s", ttl)
 		t, err := strconv.Atoi(ttl)
 		if err != nil {
-			return nil, logger.Errorf("invalid DNS_TTL: %w", err)
+			problems.add(invalidSetting("DNS_TTL", "invalid DNS_TTL: %w", err))
 		}
 		config.DefaultTTL = t
 		logger.Debug("Set TTL to: %d", t)
@@ -163,15 +292,112 @@ func LoadConfig() (*Config, error) {
 		logger.Debug("DNS_TTL not set, using default: %d", config.DefaultTTL)
 	}
 
+	// Update coalescing and record cache
+	for _, setting := range []struct {
+		env   string
+		value *time.Duration
+	}{
+		{"UPDATE_COALESCE_WINDOW", &config.CoalesceWindow},
+		{"CACHE_TTL", &config.CacheTTL},
+		{"CACHE_REVALIDATE_INTERVAL", &config.CacheRevalidateInterval},
+		{"DRIFT_CHECK_INTERVAL", &config.DriftCheckInterval},
+		{"WAIT_TIMEOUT", &config.WaitTimeout},
+		{"CONFIG_WATCH_INTERVAL", &config.ConfigWatchInterval},
+	} {
+		if value := env.Get(setting.env); value != "" {
+			logger.Debug("Reading %s from env: %s", setting.env, value)
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				problems.add(invalidSetting(setting.env, "invalid %s: %q", setting.env, value))
+				continue
+			}
+			*setting.value = d
+		}
+	}
+
+	// Drift detection
+	if repair := env.Get("DRIFT_AUTO_REPAIR"); repair != "" {
+		logger.Debug("Reading DRIFT_AUTO_REPAIR from env: %s", repair)
+		b, err := strconv.ParseBool(repair)
+		if err != nil {
+			problems.add(invalidSetting("DRIFT_AUTO_REPAIR", "invalid DRIFT_AUTO_REPAIR: %q", repair))
+		}
+		config.DriftAutoRepair = b
+	}
+
+	// Authoritative nameservers for drift checks and waiting
+	for _, server := range strings.Split(env.Get("NAMESERVERS"), ",") {
+		if server = strings.TrimSpace(server); server == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		config.Nameservers = append(config.Nameservers, server)
+	}
+
+	// Metrics
+	config.MetricsListenAddr = env.Get("METRICS_LISTEN_ADDR")
+	config.MetricsUsername = env.Get("METRICS_USERNAME")
+	metricsPassword, err := env.Secret("METRICS_PASSWORD")
+	if err != nil {
+		problems.add(invalidSetting("METRICS_PASSWORD", "%w", err))
+	} else if (config.MetricsUsername == "") != (metricsPassword == "") {
+		problems.add(invalidSetting("METRICS_PASSWORD", "METRICS_USERNAME and METRICS_PASSWORD must be set together"))
+	}
+	config.MetricsPassword = metricsPassword
+
+	// State store
+	if limit := env.Get("STATE_HISTORY_LIMIT"); limit != "" {
+		logger.Debug("Reading STATE_HISTORY_LIMIT from env: %s", limit)
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 {
+			problems.add(invalidSetting("STATE_HISTORY_LIMIT", "invalid STATE_HISTORY_LIMIT: %q", limit))
+		} else {
+			config.StateHistoryLimit = l
+		}
+	}
+	logger.Debug("State file: %s (history limit %d)", config.StateFile, config.StateHistoryLimit)
+
+	// Audit log
+	if size := env.Get("AUDIT_MAX_SIZE"); size != "" {
+		logger.Debug("Reading AUDIT_MAX_SIZE from env: %s", size)
+		s, err := parseSize(size)
+		if err != nil {
+			problems.add(invalidSetting("AUDIT_MAX_SIZE", "invalid AUDIT_MAX_SIZE: %w", err))
+		}
+		config.AuditMaxSize = s
+	}
+	if files := env.Get("AUDIT_MAX_FILES"); files != "" {
+		logger.Debug("Reading AUDIT_MAX_FILES from env: %s", files)
+		f, err := strconv.Atoi(files)
+		if err != nil || f < 1 {
+			problems.add(invalidSetting("AUDIT_MAX_FILES", "invalid AUDIT_MAX_FILES: %q", files))
+		} else {
+			config.AuditMaxFiles = f
+		}
+	}
+	logger.Debug("Audit log: %s (max size %d, max files %d)", config.AuditLog, config.AuditMaxSize, config.AuditMaxFiles)
+
+	// Change notifications
+	notifyConfig, err := loadNotifyConfig(env)
+	problems.add(err)
+	config.Notify = notifyConfig
+
+	// MQTT
+	mqttConfig, err := loadMQTTConfig(env)
+	problems.add(err)
+	config.MQTT = mqttConfig
+
 	// SSL Configuration
-	if ssl := os.Getenv("SSL"); ssl != "" {
+	if ssl := env.Get("SSL"); ssl != "" {
 		logger.Debug("Reading SSL from env: %s", ssl)
 		config.SSL = ssl == "true" || ssl == "1"
 		logger.Debug("Set SSL enabled to: %v", config.SSL)
 	}
 
 	// Certificate files (only relevant if SSL is enabled)
-	if certFile := os.Getenv("CERTFILE"); certFile != "" {
+	if certFile := env.Get("CERTFILE"); certFile != "" {
 		logger.Debug("Reading CERTFILE from env: %s", certFile)
 		// Prepend /ssl/ if path is relative
 		if !strings.HasPrefix(certFile, "/") {
@@ -184,7 +410,7 @@ func LoadConfig() (*Config, error) {
 		config.CertFile = "/ssl/fullchain.pem" // Home Assistant default
 	}
 
-	if keyFile := os.Getenv("KEYFILE"); keyFile != "" {
+	if keyFile := env.Get("KEYFILE"); keyFile != "" {
 		logger.Debug("Reading KEYFILE from env: %s", keyFile)
 		// Prepend /ssl/ if path is relative
 		if !strings.HasPrefix(keyFile, "/") {
@@ -197,21 +423,168 @@ func LoadConfig() (*Config, error) {
 		config.KeyFile = "/ssl/privkey.pem" // Home Assistant default
 	}
 
+	// Certificate from an ACME CA, which implies SSL
+	acmeConfig, err := loadACMEConfig(env)
+	problems.add(err)
+	config.ACME = acmeConfig
+	if len(config.ACME.Domains) > 0 {
+		config.SSL = true
+		config.CertFile = acme.CertFile(config.ACME.Dir)
+		config.KeyFile = acme.KeyFile(config.ACME.Dir)
+		logger.Debug("ACME: domains=%v, directory=%s, dir=%s", config.ACME.Domains, config.ACME.Directory, config.ACME.Dir)
+	}
+
 	logger.Debug("SSL config: enabled=%v, certfile=%s, keyfile=%s", config.SSL, config.CertFile, config.KeyFile)
 
-	// Validate SSL certificate files exist if SSL is enabled
-	if config.SSL {
+	// Validate SSL certificate files exist if SSL is enabled; ACME
+	// certificates are obtained at startup
+	if config.SSL && len(config.ACME.Domains) == 0 {
 		if _, err := os.Stat(config.CertFile); err != nil {
-			return nil, logger.Errorf("SSL certificate file not found: %s", config.CertFile)
+			problems.add(invalidSetting("CERTFILE", "SSL certificate file not found: %s", config.CertFile))
 		}
 		if _, err := os.Stat(config.KeyFile); err != nil {
-			return nil, logger.Errorf("SSL key file not found: %s", config.KeyFile)
+			problems.add(invalidSetting("KEYFILE", "SSL key file not found: %s", config.KeyFile))
 		}
-		logger.Info("SSL certificate files validated successfully")
 	}
 
+	// Client certificates, verified by the TLS listener
+	config.ClientCAFile = env.Get("CLIENT_CA_FILE")
+	config.ClientCRLFile = env.Get("CLIENT_CRL_FILE")
+	if config.AuthMode.Certificates() {
+		if !config.SSL {
+			problems.add(invalidSetting("AUTH_MODE", "AUTH_MODE %s needs SSL or ACME_DOMAINS", config.AuthMode))
+		}
+		if config.ClientCAFile == "" {
+			problems.add(invalidSetting("CLIENT_CA_FILE", "CLIENT_CA_FILE is required for AUTH_MODE %s", config.AuthMode))
+		}
+		for _, file := range []struct{ env, path string }{
+			{"CLIENT_CA_FILE", config.ClientCAFile},
+			{"CLIENT_CRL_FILE", config.ClientCRLFile},
+		} {
+			if file.path == "" {
+				continue
+			}
+			if _, err := os.Stat(file.path); err != nil {
+				problems.add(invalidSetting(file.env, "%s not found: %s", file.env, file.path))
+			}
+		}
+	}
+
+	// Split-horizon LAN view
+	if lanProvider := env.Get("LAN_DNS_PROVIDER"); lanProvider != "" {
+		config.LANProvider = strings.ToLower(lanProvider)
+		config.LANProviderSettings = mergeSettings(file.providerSettings("lan"), optionsLAN)
+		problems.add(checkProvider("LAN_DNS_PROVIDER", config.LANProvider))
+		hosts, err := parseHostMap(env.Get("LAN_HOSTS"))
+		if err != nil {
+			problems.add(invalidSetting("LAN_HOSTS", "invalid LAN_HOSTS: %w", err))
+		}
+		config.LANHosts = hosts
+
+		config.LANAddressSource = strings.ToLower(env.Get("LAN_ADDRESS_SOURCE"))
+		if config.LANAddressSource == "" {
+			config.LANAddressSource = "static"
+			if len(hosts) == 0 {
+				config.LANAddressSource = "client"
+			}
+		}
+		if config.LANAddressSource != "static" && config.LANAddressSource != "client" {
+			problems.add(invalidSetting("LAN_ADDRESS_SOURCE", "invalid LAN_ADDRESS_SOURCE %q (expected static or client)", config.LANAddressSource))
+		}
+		logger.Debug("LAN view: provider=%s, source=%s, hosts=%d", config.LANProvider, config.LANAddressSource, len(hosts))
+	}
+
+	if len(problems.problems) > 0 {
+		return config, problems
+	}
 	logger.Info("Configuration loaded successfully: provider=%s, domain=%s, port=%d, ttl=%d, ssl=%v",
 		config.Provider, config.Domain, config.Port, config.DefaultTTL, config.SSL)
 
-	return config, nil
+	return config, problems
+}
+
+// StateFilePath returns STATE_FILE or the default state file path
+func StateFilePath() string {
+	if path := os.Getenv("STATE_FILE"); path != "" {
+		return path
+	}
+	return state.DefaultPath()
+}
+
+// AuditLogPath returns AUDIT_LOG or the default audit log path
+func AuditLogPath() string {
+	if path := os.Getenv("AUDIT_LOG"); path != "" {
+		return path
+	}
+	return audit.DefaultPath()
+}
+
+// mergeSettings returns the settings of base overridden by those of
+// overrides, or nil if there are none
+func mergeSettings(base, overrides provider.Settings) provider.Settings {
+	if len(base)+len(overrides) == 0 {
+		return nil
+	}
+	merged := make(provider.Settings, len(base)+len(overrides))
+	maps.Copy(merged, base)
+	maps.Copy(merged, overrides)
+	return merged
+}
+
+// parseSize parses a byte count with an optional K, M or G suffix (powers
+// of 1024), e.g. "10M" or "512KB"
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	value = strings.TrimSuffix(value, "B")
+	multiplier := int64(1)
+	for suffix, m := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if strings.HasSuffix(value, suffix) {
+			value = strings.TrimSuffix(value, suffix)
+			multiplier = m
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size", value)
+	}
+	return n * multiplier, nil
+}
+
+// parseHostMap parses "host=ip,host=ip" into a hostname to addresses map.
+// A hostname may appear more than once, e.g. with an IPv4 and an IPv6 address.
+func parseHostMap(value string) (map[string][]string, error) {
+	hosts := make(map[string][]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, ip, ok := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		ip = strings.TrimSpace(ip)
+		if !ok || host == "" || net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("expected hostname=ip, got %q", entry)
+		}
+		hosts[host] = append(hosts[host], ip)
+	}
+	return hosts, nil
+}
+
+// parseNetwork parses a CIDR or a single address, which becomes a network
+// of one address
+func parseNetwork(value string) (*net.IPNet, error) {
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		return network, err
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("%q is not an address", value)
+	}
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
 }
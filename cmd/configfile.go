@@ -0,0 +1,371 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/markussiebert/homeddns/internal/auth"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+// scalar is a string, number or boolean setting of the configuration file,
+// kept in the form of its environment variable
+type scalar string
+
+// UnmarshalJSON accepts strings, numbers and booleans
+func (s *scalar) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case string:
+		*s = scalar(v)
+	case float64:
+		*s = scalar(strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		*s = scalar(strconv.FormatBool(v))
+	case nil:
+		*s = ""
+	default:
+		return fmt.Errorf("expected a string, number or boolean")
+	}
+	return nil
+}
+
+// fileConfig is the configuration file. Settings tagged with env are
+// defaults for the environment variable of that name, which overrides them.
+type fileConfig struct {
+	Server    fileServer              `json:"server"`
+	Auth      fileAuth                `json:"auth"`
+	Providers map[string]fileProvider `json:"providers"`
+	Zones     []string                `json:"zones"`
+	Hosts     []fileHost              `json:"hosts"`
+	IPSources fileIPSources           `json:"ip_sources"`
+	Notify    fileNotify              `json:"notify"`
+	MQTT      fileMQTT                `json:"mqtt"`
+	ACME      fileACME                `json:"acme"`
+}
+
+type fileServer struct {
+	Port      scalar `json:"port" env:"PORT"`
+	TTL       scalar `json:"ttl" env:"DNS_TTL"`
+	SSL       scalar `json:"ssl" env:"SSL"`
+	CertFile  scalar `json:"certfile" env:"CERTFILE"`
+	KeyFile   scalar `json:"keyfile" env:"KEYFILE"`
+	LogLevel  scalar `json:"log_level" env:"LOG_LEVEL"`
+	LogFormat scalar `json:"log_format" env:"LOG_FORMAT"`
+
+	CoalesceWindow          scalar   `json:"coalesce_window" env:"UPDATE_COALESCE_WINDOW"`
+	CacheTTL                scalar   `json:"cache_ttl" env:"CACHE_TTL"`
+	CacheRevalidateInterval scalar   `json:"cache_revalidate_interval" env:"CACHE_REVALIDATE_INTERVAL"`
+	DriftCheckInterval      scalar   `json:"drift_check_interval" env:"DRIFT_CHECK_INTERVAL"`
+	DriftAutoRepair         scalar   `json:"drift_auto_repair" env:"DRIFT_AUTO_REPAIR"`
+	Nameservers             []string `json:"nameservers" env:"NAMESERVERS"`
+	TrustedProxies          []string `json:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	WaitTimeout             scalar   `json:"wait_timeout" env:"WAIT_TIMEOUT"`
+	ConfigWatchInterval     scalar   `json:"config_watch_interval" env:"CONFIG_WATCH_INTERVAL"`
+
+	StateHistoryLimit scalar `json:"state_history_limit" env:"STATE_HISTORY_LIMIT"`
+	AuditMaxSize      scalar `json:"audit_max_size" env:"AUDIT_MAX_SIZE"`
+	AuditMaxFiles     scalar `json:"audit_max_files" env:"AUDIT_MAX_FILES"`
+
+	MetricsListenAddr scalar `json:"metrics_listen_addr" env:"METRICS_LISTEN_ADDR"`
+	MetricsUsername   scalar `json:"metrics_username" env:"METRICS_USERNAME"`
+	MetricsPassword   scalar `json:"metrics_password" env:"METRICS_PASSWORD"`
+}
+
+type fileAuth struct {
+	Mode     scalar `json:"mode" env:"AUTH_MODE"`
+	Username scalar `json:"username" env:"AUTH_USERNAME"`
+	Password scalar `json:"password" env:"AUTH_PASSWORD"`
+	// Client certificates for the cert modes
+	ClientCAFile  scalar `json:"client_ca_file" env:"CLIENT_CA_FILE"`
+	ClientCRLFile scalar `json:"client_crl_file" env:"CLIENT_CRL_FILE"`
+	// Users are additional accounts, optionally limited to hostnames
+	Users []fileUser `json:"users"`
+}
+
+type fileUser struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Hosts    []string `json:"hosts"`
+}
+
+// fileProvider configures the provider of a view ("public" or "lan")
+type fileProvider struct {
+	Type     string            `json:"type"`
+	Settings map[string]scalar `json:"settings"`
+}
+
+// fileHost is a hostname with its static LAN addresses
+type fileHost struct {
+	Name string   `json:"name"`
+	LAN  []string `json:"lan"`
+}
+
+type fileIPSources struct {
+	// Public are the URLs asked for the public IP, in order
+	Public []string `json:"public" env:"PUBLIC_IP_URLS"`
+	// LAN is the address source of the LAN view: static or client
+	LAN scalar `json:"lan" env:"LAN_ADDRESS_SOURCE"`
+}
+
+type fileNotify struct {
+	WebhookURL      scalar `json:"webhook_url" env:"NOTIFY_WEBHOOK_URL"`
+	WebhookTemplate scalar `json:"webhook_template" env:"NOTIFY_WEBHOOK_TEMPLATE"`
+
+	NtfyURL      scalar `json:"ntfy_url" env:"NOTIFY_NTFY_URL"`
+	NtfyToken    scalar `json:"ntfy_token" env:"NOTIFY_NTFY_TOKEN"`
+	NtfyPriority scalar `json:"ntfy_priority" env:"NOTIFY_NTFY_PRIORITY"`
+
+	GotifyURL      scalar `json:"gotify_url" env:"NOTIFY_GOTIFY_URL"`
+	GotifyToken    scalar `json:"gotify_token" env:"NOTIFY_GOTIFY_TOKEN"`
+	GotifyPriority scalar `json:"gotify_priority" env:"NOTIFY_GOTIFY_PRIORITY"`
+
+	SMTPHost     scalar   `json:"smtp_host" env:"NOTIFY_SMTP_HOST"`
+	SMTPPort     scalar   `json:"smtp_port" env:"NOTIFY_SMTP_PORT"`
+	SMTPTLS      scalar   `json:"smtp_tls" env:"NOTIFY_SMTP_TLS"`
+	SMTPUsername scalar   `json:"smtp_username" env:"NOTIFY_SMTP_USERNAME"`
+	SMTPPassword scalar   `json:"smtp_password" env:"NOTIFY_SMTP_PASSWORD"`
+	SMTPFrom     scalar   `json:"smtp_from" env:"NOTIFY_SMTP_FROM"`
+	SMTPTo       []string `json:"smtp_to" env:"NOTIFY_SMTP_TO"`
+
+	MaxAttempts scalar `json:"max_attempts" env:"NOTIFY_MAX_ATTEMPTS"`
+}
+
+type fileMQTT struct {
+	Broker          scalar `json:"broker" env:"MQTT_BROKER"`
+	Username        scalar `json:"username" env:"MQTT_USERNAME"`
+	Password        scalar `json:"password" env:"MQTT_PASSWORD"`
+	ClientID        scalar `json:"client_id" env:"MQTT_CLIENT_ID"`
+	DiscoveryPrefix scalar `json:"discovery_prefix" env:"MQTT_DISCOVERY_PREFIX"`
+	BaseTopic       scalar `json:"base_topic" env:"MQTT_BASE_TOPIC"`
+}
+
+type fileACME struct {
+	Domains     []string `json:"domains" env:"ACME_DOMAINS"`
+	Email       scalar   `json:"email" env:"ACME_EMAIL"`
+	Directory   scalar   `json:"directory" env:"ACME_DIRECTORY"`
+	Dir         scalar   `json:"dir" env:"ACME_DIR"`
+	CAFile      scalar   `json:"ca_file" env:"ACME_CA_FILE"`
+	RenewBefore scalar   `json:"renew_before" env:"ACME_RENEW_BEFORE"`
+}
+
+// loadConfigFile reads a YAML (.yaml, .yml) or TOML (.toml) configuration
+// file. ${VAR} in values is replaced by the environment variable VAR, and a
+// secret key with the suffix _file (e.g. password_file) is replaced by the
+// key without it, set to the trimmed content of the named file.
+func loadConfigFile(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	var raw map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q (expected .yaml, .yml or .toml)", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	resolved, err := resolveReferences(raw, "")
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	// Decode through JSON so that both formats share the struct tags and
+	// unknown keys are reported
+	data, err = json.Marshal(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	config := &fileConfig{}
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	for view, p := range config.Providers {
+		if view != "public" && view != "lan" {
+			return nil, fmt.Errorf("config file %s: unknown view %q in providers (expected public or lan)", path, view)
+		}
+		if p.Type == "" {
+			return nil, fmt.Errorf("config file %s: providers.%s.type is required", path, view)
+		}
+	}
+	for i, user := range config.Auth.Users {
+		if user.Username == "" || user.Password == "" {
+			return nil, fmt.Errorf("config file %s: auth.users[%d] needs a username and password", path, i)
+		}
+	}
+	return config, nil
+}
+
+// envReference matches ${VAR}
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// resolveReferences expands ${VAR} in all strings of value and replaces
+// secret keys ending in _file by the content of the file they name. Other
+// keys ending in _file, like dnsmasq_hosts_file, are kept as they are.
+func resolveReferences(value any, path string) (any, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		resolved := make(map[string]any, len(v))
+		for key, item := range v {
+			item, err := resolveReferences(item, joinKey(path, key))
+			if err != nil {
+				return nil, err
+			}
+			name, isFile := strings.CutSuffix(key, "_file")
+			if !isFile || !util.IsSensitiveKey(name) {
+				resolved[key] = item
+				continue
+			}
+			file, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected a file path", joinKey(path, key))
+			}
+			if _, ok := v[name]; ok {
+				return nil, fmt.Errorf("%s and %s are both set", joinKey(path, name), joinKey(path, key))
+			}
+			secret, err := util.ReadSecretFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", joinKey(path, key), err)
+			}
+			resolved[name] = secret.Value()
+		}
+		return resolved, nil
+	case []any:
+		resolved := make([]any, len(v))
+		for i, item := range v {
+			item, err := resolveReferences(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = item
+		}
+		return resolved, nil
+	case string:
+		var missing []string
+		expanded := envReference.ReplaceAllStringFunc(v, func(ref string) string {
+			name := envReference.FindStringSubmatch(ref)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return value
+		})
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("%s: environment variable %s is not set", path, strings.Join(missing, ", "))
+		}
+		return expanded, nil
+	default:
+		return value, nil
+	}
+}
+
+// joinKey joins the keys of a nested setting for error messages
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// env returns the settings with an environment variable, keyed by the
+// variable name in lower case as expected by provider.Settings
+func (c *fileConfig) env() provider.Settings {
+	env := provider.Settings{}
+	collectEnv(reflect.ValueOf(*c), env)
+
+	if len(c.Zones) > 0 {
+		env["domain"] = c.Zones[0]
+		env["zones"] = strings.Join(c.Zones, ",")
+	}
+	if public, ok := c.Providers["public"]; ok {
+		env["dns_provider"] = public.Type
+	}
+	if lan, ok := c.Providers["lan"]; ok {
+		env["lan_dns_provider"] = lan.Type
+	}
+
+	var hosts []string
+	for _, host := range c.Hosts {
+		for _, ip := range host.LAN {
+			hosts = append(hosts, host.Name+"="+ip)
+		}
+	}
+	if len(hosts) > 0 {
+		env["lan_hosts"] = strings.Join(hosts, ",")
+	}
+	return env
+}
+
+// collectEnv adds all fields of v tagged with env to settings
+func collectEnv(v reflect.Value, settings provider.Settings) {
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		if value.Kind() == reflect.Struct {
+			collectEnv(value, settings)
+			continue
+		}
+		key := strings.ToLower(field.Tag.Get("env"))
+		if key == "" {
+			continue
+		}
+		switch value := value.Interface().(type) {
+		case scalar:
+			if value != "" {
+				settings[key] = string(value)
+			}
+		case []string:
+			if len(value) > 0 {
+				settings[key] = strings.Join(value, ",")
+			}
+		}
+	}
+}
+
+// providerSettings returns the settings of the provider of a view
+func (c *fileConfig) providerSettings(view string) provider.Settings {
+	p, ok := c.Providers[view]
+	if !ok || len(p.Settings) == 0 {
+		return nil
+	}
+	settings := make(provider.Settings, len(p.Settings))
+	for key, value := range p.Settings {
+		settings[strings.ToLower(key)] = string(value)
+	}
+	return settings
+}
+
+// users returns the additional accounts of the configuration file
+func (c *fileConfig) users() []auth.User {
+	users := make([]auth.User, 0, len(c.Auth.Users))
+	for _, user := range c.Auth.Users {
+		users = append(users, auth.User{
+			Username: user.Username,
+			Password: util.Secret(user.Password),
+			Hosts:    user.Hosts,
+		})
+	}
+	return users
+}
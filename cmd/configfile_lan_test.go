@@ -0,0 +1,86 @@
+//go:build !netcup_ccp && !aws_route53
+// +build !netcup_ccp,!aws_route53
+
+package cmd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/auth"
+	"github.com/markussiebert/homeddns/internal/provider"
+)
+
+const testYAML = `
+server:
+  port: 9000
+  ttl: 120
+  cache_ttl: 5m
+  nameservers: [ns1.example.com, "192.0.2.53:5353"]
+auth:
+  username: admin
+  password: ${TEST_ADMIN_PASSWORD}
+  users:
+    - username: router
+      password_file: %s
+      hosts: [home.example.com, "*.lan.example.com"]
+providers:
+  public:
+    type: netcup_ccp
+    settings:
+      netcup_customer_number: 12345
+      netcup_api_key: key
+      netcup_api_password_file: %s
+  lan:
+    type: dnsmasq
+    settings:
+      dnsmasq_hosts_file: /etc/hosts.d/homeddns
+zones: [example.com, example.co.uk]
+hosts:
+  - name: nas.example.com
+    lan: [192.168.1.10]
+ip_sources:
+  public: [https://ip.example.com]
+  lan: static
+notify:
+  ntfy_url: https://ntfy.example.com/homeddns
+mqtt:
+  broker: mqtt://broker:1883
+`
+
+// The LAN provider of the fixture is only built with all providers
+func TestLoadConfig_YAML(t *testing.T) {
+	userPassword := writeFile(t, "router", "router-secret\n")
+	apiPassword := writeFile(t, "netcup", "api-secret")
+	path := writeFile(t, "homeddns.yaml", fmt.Sprintf(testYAML, userPassword, apiPassword))
+	t.Setenv("TEST_ADMIN_PASSWORD", "admin-secret")
+	// Environment variables override the file
+	t.Setenv("DNS_TTL", "300")
+
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 9000, config.Port)
+	assert.Equal(t, 300, config.DefaultTTL)
+	assert.Equal(t, 5*time.Minute, config.CacheTTL)
+	assert.Equal(t, []string{"ns1.example.com:53", "192.0.2.53:5353"}, config.Nameservers)
+	assert.Equal(t, "admin", config.Username)
+	assert.Equal(t, "admin-secret", config.Password.Value())
+	assert.Equal(t, []auth.User{{Username: "router", Password: "router-secret", Hosts: []string{"home.example.com", "*.lan.example.com"}}}, config.Users)
+	assert.Equal(t, "netcup_ccp", config.Provider)
+	assert.Equal(t, provider.Settings{
+		"netcup_customer_number": "12345",
+		"netcup_api_key":         "key",
+		"netcup_api_password":    "api-secret",
+	}, config.ProviderSettings)
+	assert.Equal(t, "dnsmasq", config.LANProvider)
+	assert.Equal(t, provider.Settings{"dnsmasq_hosts_file": "/etc/hosts.d/homeddns"}, config.LANProviderSettings)
+	assert.Equal(t, "static", config.LANAddressSource)
+	assert.Equal(t, map[string][]string{"nas.example.com": {"192.168.1.10"}}, config.LANHosts)
+	assert.Equal(t, "example.com", config.Domain)
+	assert.Equal(t, []string{"example.com", "example.co.uk"}, config.Zones)
+	assert.Equal(t, []string{"https://ip.example.com"}, config.PublicIPURLs)
+	assert.Equal(t, "https://ntfy.example.com/homeddns", config.Notify.NtfyURL)
+	assert.Equal(t, "mqtt://broker:1883", config.MQTT.Broker)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/provider"
+)
+
+const testTOML = `
+zones = ["example.com"]
+
+[server]
+port = 9000
+drift_auto_repair = false
+
+[auth]
+username = "admin"
+password = "secret"
+
+[providers.public]
+type = "aws_route53"
+settings = { aws_region = "eu-central-1" }
+`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadConfig_TOML(t *testing.T) {
+	path := writeFile(t, "homeddns.toml", testTOML)
+	t.Setenv("DNS_PROVIDER", "")
+
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 9000, config.Port)
+	assert.Equal(t, false, config.DriftAutoRepair)
+	assert.Equal(t, "aws_route53", config.Provider)
+	assert.Equal(t, provider.Settings{"aws_region": "eu-central-1"}, config.ProviderSettings)
+	assert.Equal(t, "example.com", config.Domain)
+	assert.Equal(t, []string{defaultPublicIPURL}, config.PublicIPURLs)
+}
+
+func TestLoadConfig_EnvOnly(t *testing.T) {
+	t.Setenv("AUTH_USERNAME", "admin")
+	t.Setenv("AUTH_PASSWORD", "secret")
+	t.Setenv("DOMAIN", "example.com")
+
+	config, err := LoadConfig("")
+	assert.NoError(t, err)
+	assert.Equal(t, "netcup_ccp", config.Provider)
+	assert.Equal(t, 8053, config.Port)
+	assert.Equal(t, 0, len(config.Users))
+	assert.Equal(t, 0, len(config.Zones))
+	assert.Equal(t, provider.Settings(nil), config.ProviderSettings)
+}
+
+func TestLoadConfigFile_Errors(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown.yaml":    "server:\n  prot: 9000\n",
+		"view.yaml":       "providers:\n  dmz:\n    type: pihole\n",
+		"type.yaml":       "providers:\n  public:\n    settings: {}\n",
+		"user.yaml":       "auth:\n  users:\n    - username: router\n",
+		"missing.yaml":    "auth:\n  password: ${TEST_UNSET_VARIABLE}\n",
+		"both.yaml":       "auth:\n  password: x\n  password_file: /dev/null\n",
+		"list.yaml":       "server:\n  port: [1, 2]\n",
+		"homeddns.json":   "{}",
+		"invalid.toml":    "[server\n",
+		"unreadable.yaml": "auth:\n  password_file: /nonexistent/secret\n",
+	} {
+		_, err := loadConfigFile(writeFile(t, name, content))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestLoadConfig_SecretFiles(t *testing.T) {
+	t.Setenv("AUTH_USERNAME", "admin")
+	t.Setenv("AUTH_PASSWORD_FILE", writeFile(t, "password", "admin-secret\n"))
+	t.Setenv("MQTT_BROKER", "mqtt://broker:1883")
+	t.Setenv("MQTT_PASSWORD_FILE", writeFile(t, "mqtt", "mqtt-secret"))
+	t.Setenv("DOMAIN", "example.com")
+
+	config, err := LoadConfig("")
+	assert.NoError(t, err)
+	assert.Equal(t, "admin-secret", config.Password.Value())
+	assert.Equal(t, "mqtt-secret", config.MQTT.Password.Value())
+
+	// A secret must not be given twice
+	t.Setenv("AUTH_PASSWORD", "other")
+	_, err = LoadConfig("")
+	assert.EqualError(t, err, "AUTH_PASSWORD and AUTH_PASSWORD_FILE are both set")
+}
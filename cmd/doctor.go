@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/dnsclient"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/tlscert"
+)
+
+// doctorTimeout bounds each check that talks to a provider or the network
+const doctorTimeout = 20 * time.Second
+
+// certExpiryWarning is how long before expiry a certificate is reported
+const certExpiryWarning = 14 * 24 * time.Hour
+
+// checkStatus is the outcome of a doctor check
+type checkStatus string
+
+const (
+	checkOK   checkStatus = "ok"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "FAIL"
+	checkSkip checkStatus = "skip"
+)
+
+// checkResult is the outcome of one doctor check with advice on failure
+type checkResult struct {
+	check  string
+	status checkStatus
+	detail string
+	hint   string
+}
+
+// RunDoctor checks the configuration, the provider credentials, the zones,
+// the public IP detection and the TLS certificate, and prints a report with
+// advice for every problem. It returns an error if a check failed.
+func RunDoctor(w io.Writer, path string) error {
+	ctx := context.Background()
+	config, problems := validateConfig(ctx, path)
+
+	var results []checkResult
+	for _, problem := range problems {
+		check := "config"
+		if problem.Setting != "" {
+			check = "config " + problem.Setting
+		}
+		hint := "Fix the configuration"
+		if problem.Source != "" && problem.Source != "not set" {
+			hint = fmt.Sprintf("Fix the setting in the %s", problem.Source)
+		} else if problem.Setting != "" {
+			hint = fmt.Sprintf("Set %s in the environment, the config file or the Home Assistant options", problem.Setting)
+		}
+		results = append(results, checkResult{check, checkFail, problem.Err.Error(), hint})
+	}
+	if len(problems) == 0 {
+		results = append(results, checkResult{check: "config", status: checkOK, detail: "valid"})
+	}
+
+	results = append(results, checkProviders(ctx, config)...)
+	results = append(results, checkPublicIP(config.PublicIPURLs)...)
+	results = append(results, checkCertificate(config, time.Now()))
+	results = append(results, checkClientCertificates(config, time.Now()))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAIL")
+	failed := 0
+	var hints []string
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.check, result.status, orDash(result.detail))
+		if result.status == checkFail {
+			failed++
+		}
+		if result.hint != "" {
+			hints = append(hints, fmt.Sprintf("%s: %s", result.check, result.hint))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(hints) > 0 {
+		fmt.Fprintln(w, "\nWhat to do:")
+		for _, hint := range hints {
+			fmt.Fprintf(w, "  - %s\n", hint)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// checkProviders checks the credentials of the providers of all views and
+// that the zones exist at the public provider and are delegated to it
+func checkProviders(ctx context.Context, config *Config) []checkResult {
+	var results []checkResult
+	for _, view := range []struct {
+		name     string
+		provider string
+		settings provider.Settings
+	}{
+		{"public", config.Provider, config.ProviderSettings},
+		{"lan", config.LANProvider, config.LANProviderSettings},
+	} {
+		factory, ok := provider.GetFactory(view.provider)
+		if !ok {
+			continue
+		}
+		// Creation errors are reported by the configuration check
+		p, err := factory(ctx, view.settings)
+		if err != nil {
+			continue
+		}
+		check := fmt.Sprintf("provider %s (%s)", view.name, view.provider)
+		results = append(results, checkCredentials(ctx, check, p))
+		if view.name == "public" {
+			for _, zone := range configZones(config) {
+				results = append(results, checkZone(ctx, p, zone), checkDelegation(ctx, config, zone))
+			}
+		}
+		_ = p.Close(ctx)
+	}
+	return results
+}
+
+// configZones returns the zones that may be updated
+func configZones(config *Config) []string {
+	if len(config.Zones) > 0 {
+		return config.Zones
+	}
+	if config.Domain != "" {
+		return []string{config.Domain}
+	}
+	return nil
+}
+
+// checkCredentials runs the health check of a provider
+func checkCredentials(ctx context.Context, check string, p provider.Provider) checkResult {
+	checker, ok := provider.As[provider.HealthChecker](p)
+	if !ok {
+		return checkResult{check: check, status: checkSkip, detail: "provider has no health check"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	if err := checker.HealthCheck(ctx); err != nil {
+		return checkResult{check, checkFail, err.Error(),
+			fmt.Sprintf("Check the credentials and address of the %s provider", p.Name())}
+	}
+	return checkResult{check: check, status: checkOK, detail: "health check passed"}
+}
+
+// checkZone lists the records of zone to verify that the provider manages it
+func checkZone(ctx context.Context, p provider.Provider, zone string) checkResult {
+	check := "zone " + zone
+	lister, ok := provider.As[provider.RecordLister](p)
+	if !ok {
+		return checkResult{check: check, status: checkSkip, detail: p.Name() + " cannot list records"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	records, err := lister.ListRecords(ctx, zone)
+	if err != nil {
+		return checkResult{check, checkFail, err.Error(),
+			fmt.Sprintf("Check that %s is a zone of your %s account, or fix DOMAIN and ZONES", zone, p.Name())}
+	}
+	return checkResult{check: check, status: checkOK, detail: fmt.Sprintf("%d records at %s", len(records), p.Name())}
+}
+
+// checkDelegation looks up the authoritative nameservers of zone, which
+// drift checks and waiting for propagation ask
+func checkDelegation(ctx context.Context, config *Config, zone string) checkResult {
+	check := "nameservers " + zone
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	client := &dnsclient.Client{Nameservers: config.Nameservers}
+	servers, err := client.AuthoritativeServers(ctx, zone)
+	if err != nil {
+		return checkResult{check, checkWarn, err.Error(),
+			"Delegate the zone to the provider's nameservers, or set NAMESERVERS for a private zone"}
+	}
+	return checkResult{check: check, status: checkOK, detail: strings.Join(servers, ", ")}
+}
+
+// checkPublicIP asks every public IP URL
+func checkPublicIP(urls []string) []checkResult {
+	var results []checkResult
+	working := 0
+	for _, u := range urls {
+		check := "public ip " + u
+		ip, err := fetchPublicIP(u)
+		if err != nil {
+			results = append(results, checkResult{check: check, status: checkWarn, detail: err.Error()})
+			continue
+		}
+		working++
+		results = append(results, checkResult{check: check, status: checkOK, detail: ip})
+	}
+	if working == 0 {
+		for i := range results {
+			results[i].status = checkFail
+		}
+		if len(results) > 0 {
+			results[len(results)-1].hint = "Check the internet connection of homeddns, or set PUBLIC_IP_URLS to services that answer with the plain IP"
+		}
+	}
+	return results
+}
+
+// checkCertificate checks that the TLS certificate loads, is trusted,
+// covers the domain and does not expire soon
+func checkCertificate(config *Config, now time.Time) checkResult {
+	check := "certificate"
+	if !config.SSL {
+		return checkResult{check: check, status: checkSkip, detail: "SSL disabled"}
+	}
+	check = "certificate " + config.CertFile
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil && len(config.ACME.Domains) > 0 {
+		if errors.Is(err, os.ErrNotExist) {
+			return checkResult{check, checkWarn, "not obtained yet", "Start the server to obtain the certificate from " + config.ACME.Directory}
+		}
+		return checkResult{check, checkFail, err.Error(), "Remove the files in ACME_DIR to obtain a new certificate"}
+	}
+	if err != nil {
+		return checkResult{check, checkFail, err.Error(), "Check CERTFILE and KEYFILE"}
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return checkResult{check, checkFail, err.Error(), "Check CERTFILE"}
+		}
+	}
+
+	until := leaf.NotAfter.Format(time.DateOnly)
+	switch {
+	case now.After(leaf.NotAfter):
+		return checkResult{check, checkFail, "expired on " + until, "Renew the certificate"}
+	case now.Before(leaf.NotBefore):
+		return checkResult{check, checkFail, "not valid before " + leaf.NotBefore.Format(time.DateOnly), "Check the system clock"}
+	}
+	if config.Domain != "" {
+		if err := leaf.VerifyHostname(config.Domain); err != nil {
+			return checkResult{check, checkWarn, err.Error(),
+				"Use a certificate for " + config.Domain + ", or routers may reject the connection"}
+		}
+	}
+	intermediates := x509.NewCertPool()
+	for _, der := range cert.Certificate[1:] {
+		if c, err := x509.ParseCertificate(der); err == nil {
+			intermediates.AddCert(c)
+		}
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Intermediates: intermediates, CurrentTime: now}); err != nil {
+		return checkResult{check, checkWarn, err.Error(),
+			"Use a certificate of a public CA, or import its CA into the router"}
+	}
+	if left := leaf.NotAfter.Sub(now); left < certExpiryWarning {
+		return checkResult{check, checkWarn, fmt.Sprintf("expires in %d days (%s)", int(left.Hours()/24), until),
+			"Renew the certificate"}
+	}
+	return checkResult{check: check, status: checkOK, detail: "valid until " + until}
+}
+
+// checkClientCertificates checks that the client CA and the CRL load and
+// that the CRL is current
+func checkClientCertificates(config *Config, now time.Time) checkResult {
+	check := "client certificates"
+	if !config.AuthMode.Certificates() {
+		return checkResult{check: check, status: checkSkip, detail: "AUTH_MODE " + string(config.AuthMode)}
+	}
+	verifier, err := tlscert.NewClientVerifier(config.ClientCAFile, config.ClientCRLFile)
+	if err != nil {
+		return checkResult{check, checkFail, err.Error(), "Check CLIENT_CA_FILE and CLIENT_CRL_FILE"}
+	}
+	detail := fmt.Sprintf("%d CA certificate(s)", verifier.CAs())
+	if config.ClientCRLFile == "" {
+		return checkResult{check: check, status: checkOK, detail: detail + ", no CRL"}
+	}
+	revoked, nextUpdate := verifier.Revoked()
+	detail += fmt.Sprintf(", %d revoked", revoked)
+	if !nextUpdate.IsZero() && now.After(nextUpdate) {
+		return checkResult{check, checkWarn, detail + ", CRL outdated since " + nextUpdate.Format(time.DateOnly),
+			"Publish a new CRL to CLIENT_CRL_FILE"}
+	}
+	return checkResult{check: check, status: checkOK, detail: detail}
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// writeSelfSigned writes a self-signed certificate for name, valid until
+// notAfter, and returns the certificate and key file
+func writeSelfSigned(t *testing.T, name string, notAfter time.Time) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "fullchain.pem"), filepath.Join(dir, "privkey.pem")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestCheckCertificate(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, checkSkip, checkCertificate(&Config{}, now).status)
+
+	certFile, keyFile := writeSelfSigned(t, "home.example.com", now.Add(90*24*time.Hour))
+	config := &Config{SSL: true, CertFile: certFile, KeyFile: keyFile, Domain: "home.example.com"}
+	// Self-signed certificates are not trusted by routers
+	result := checkCertificate(config, now)
+	assert.Equal(t, checkWarn, result.status)
+	assert.Contains(t, result.hint, "public CA")
+
+	config.Domain = "other.example.com"
+	assert.Contains(t, checkCertificate(config, now).hint, "certificate for other.example.com")
+
+	config.Domain = "home.example.com"
+	result = checkCertificate(config, now.Add(100*24*time.Hour))
+	assert.Equal(t, checkFail, result.status)
+	assert.Contains(t, result.detail, "expired on")
+
+	config.KeyFile = filepath.Join(t.TempDir(), "missing.pem")
+	assert.Equal(t, checkFail, checkCertificate(config, now).status)
+}
+
+func TestCheckPublicIP(t *testing.T) {
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("192.0.2.1\n"))
+	}))
+	defer working.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	results := checkPublicIP([]string{broken.URL, working.URL})
+	assert.Equal(t, checkWarn, results[0].status)
+	assert.Equal(t, checkOK, results[1].status)
+	assert.Equal(t, "192.0.2.1", results[1].detail)
+
+	results = checkPublicIP([]string{broken.URL})
+	assert.Equal(t, checkFail, results[0].status)
+	assert.Contains(t, results[0].hint, "PUBLIC_IP_URLS")
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/state"
+)
+
+// RunHistory prints the most recent record changes from the state file
+func RunHistory(w io.Writer, hostname string, limit int) error {
+	store, err := state.Open(StateFilePath(), 0)
+	if err != nil {
+		return err
+	}
+
+	changes := store.History(hostname, limit)
+	if len(changes) == 0 {
+		fmt.Fprintf(w, "No changes recorded in %s\n", store.Path())
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tHOSTNAME\tTYPE\tVIEW\tPREVIOUS\tVALUE\tCLIENT\tUSER")
+	for _, c := range changes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			c.Time.Local().Format(time.DateTime), c.Hostname, c.Type, orDash(c.View),
+			orDash(c.Previous), c.Value, orDash(c.Client), orDash(c.User))
+	}
+	return tw.Flush()
+}
+
+// orDash returns "-" for empty table cells
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
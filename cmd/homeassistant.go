@@ -0,0 +1,327 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/markussiebert/homeddns/internal/auth"
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/util"
+)
+
+// homeAssistantOptions are the options of the Home Assistant add-on. The
+// struct is the single definition of the options: the decoder uses it, and
+// homeassistant/config.yaml must match the schema generated from it (see
+// homeAssistantSchema). The tags are:
+//
+//   - json: the option
+//   - schema: its type in the add-on schema; lists use the type of an item
+//   - env: the setting it maps to (the environment variable name)
+//   - provider: "public" or "lan" if it is a setting of that view's provider
+//   - default: its value in the options section, if it has one
+type homeAssistantOptions struct {
+	AuthUsername scalar `json:"auth_username" schema:"str" env:"AUTH_USERNAME" default:"dyndns"`
+	AuthPassword scalar `json:"auth_password" schema:"password" env:"AUTH_PASSWORD" default:""`
+	DNSProvider  scalar `json:"dns_provider" schema:"list(netcup_ccp|aws_route53)" env:"DNS_PROVIDER" default:"netcup_ccp"`
+	Domain       scalar `json:"domain" schema:"str" env:"DOMAIN" default:""`
+	DNSTTL       scalar `json:"dns_ttl" schema:"int(30,86400)" env:"DNS_TTL" default:"60"`
+	Port         scalar `json:"port" schema:"int(1024,65535)" env:"PORT" default:"8053"`
+	LogLevel     scalar `json:"log_level" schema:"list(debug|info|warn|error)?" env:"LOG_LEVEL" default:"info"`
+	LogFormat    scalar `json:"log_format" schema:"list(text|json)?" env:"LOG_FORMAT" default:"text"`
+	SSL          scalar `json:"ssl" schema:"bool" env:"SSL" default:"false"`
+	CertFile     scalar `json:"certfile" schema:"str" env:"CERTFILE" default:"fullchain.pem"`
+	KeyFile      scalar `json:"keyfile" schema:"str" env:"KEYFILE" default:"privkey.pem"`
+
+	ACMEDomains   scalar `json:"acme_domains" schema:"str?" env:"ACME_DOMAINS"`
+	ACMEEmail     scalar `json:"acme_email" schema:"email?" env:"ACME_EMAIL"`
+	ACMEDirectory scalar `json:"acme_directory" schema:"url?" env:"ACME_DIRECTORY"`
+
+	AuthMode      scalar `json:"auth_mode" schema:"list(basic|cert|cert_or_basic|cert_and_basic)?" env:"AUTH_MODE"`
+	ClientCAFile  scalar `json:"client_ca_file" schema:"str?" env:"CLIENT_CA_FILE"`
+	ClientCRLFile scalar `json:"client_crl_file" schema:"str?" env:"CLIENT_CRL_FILE"`
+
+	NetcupCustomerNumber scalar `json:"netcup_customer_number" schema:"str?" env:"NETCUP_CUSTOMER_NUMBER" provider:"public" default:""`
+	NetcupAPIKey         scalar `json:"netcup_api_key" schema:"password?" env:"NETCUP_API_KEY" provider:"public" default:""`
+	NetcupAPIPassword    scalar `json:"netcup_api_password" schema:"password?" env:"NETCUP_API_PASSWORD" provider:"public" default:""`
+
+	AWSAccessKeyID     scalar `json:"aws_access_key_id" schema:"password?" env:"AWS_ACCESS_KEY_ID" provider:"public" default:""`
+	AWSSecretAccessKey scalar `json:"aws_secret_access_key" schema:"password?" env:"AWS_SECRET_ACCESS_KEY" provider:"public" default:""`
+	AWSRegion          scalar `json:"aws_region" schema:"str?" env:"AWS_REGION" provider:"public" default:""`
+
+	MQTTBroker   scalar `json:"mqtt_broker" schema:"str?" env:"MQTT_BROKER"`
+	MQTTUsername scalar `json:"mqtt_username" schema:"str?" env:"MQTT_USERNAME"`
+	MQTTPassword scalar `json:"mqtt_password" schema:"password?" env:"MQTT_PASSWORD"`
+
+	NotifyNtfyURL      scalar `json:"notify_ntfy_url" schema:"url?" env:"NOTIFY_NTFY_URL"`
+	NotifyNtfyToken    scalar `json:"notify_ntfy_token" schema:"password?" env:"NOTIFY_NTFY_TOKEN"`
+	NotifyGotifyURL    scalar `json:"notify_gotify_url" schema:"url?" env:"NOTIFY_GOTIFY_URL"`
+	NotifyGotifyToken  scalar `json:"notify_gotify_token" schema:"password?" env:"NOTIFY_GOTIFY_TOKEN"`
+	NotifyWebhookURL   scalar `json:"notify_webhook_url" schema:"url?" env:"NOTIFY_WEBHOOK_URL"`
+	NotifySMTPHost     scalar `json:"notify_smtp_host" schema:"str?" env:"NOTIFY_SMTP_HOST"`
+	NotifySMTPPort     scalar `json:"notify_smtp_port" schema:"port?" env:"NOTIFY_SMTP_PORT"`
+	NotifySMTPUsername scalar `json:"notify_smtp_username" schema:"str?" env:"NOTIFY_SMTP_USERNAME"`
+	NotifySMTPPassword scalar `json:"notify_smtp_password" schema:"password?" env:"NOTIFY_SMTP_PASSWORD"`
+	NotifySMTPFrom     scalar `json:"notify_smtp_from" schema:"email?" env:"NOTIFY_SMTP_FROM"`
+	NotifySMTPTo       scalar `json:"notify_smtp_to" schema:"str?" env:"NOTIFY_SMTP_TO"`
+
+	// Zones that may be updated, in addition to the domain
+	Zones []string `json:"zones" schema:"str" env:"ZONES" default:"[]"`
+	// Users are additional accounts, optionally limited to hostnames
+	Users []homeAssistantUser `json:"users" default:"[]"`
+	// Hosts are hostnames with static LAN addresses
+	Hosts []homeAssistantHost `json:"hosts" default:"[]"`
+	// LAN configures the split-horizon LAN view
+	LAN homeAssistantLAN `json:"lan"`
+}
+
+// homeAssistantUser is an additional account. The add-on schema allows
+// only two levels of nesting, so lists within items are comma-separated.
+type homeAssistantUser struct {
+	Username string `json:"username" schema:"str"`
+	Password string `json:"password" schema:"password"`
+	Hosts    string `json:"hosts" schema:"str?"`
+}
+
+// homeAssistantHost is a hostname with comma-separated static LAN addresses
+type homeAssistantHost struct {
+	Name string `json:"name" schema:"str"`
+	LAN  string `json:"lan" schema:"str"`
+}
+
+type homeAssistantLAN struct {
+	Provider      scalar `json:"provider" schema:"list(pihole|adguard_home|dnsmasq)?" env:"LAN_DNS_PROVIDER"`
+	AddressSource scalar `json:"address_source" schema:"list(static|client)?" env:"LAN_ADDRESS_SOURCE"`
+
+	PiholeURL      scalar `json:"pihole_url" schema:"url?" env:"PIHOLE_URL" provider:"lan"`
+	PiholePassword scalar `json:"pihole_password" schema:"password?" env:"PIHOLE_PASSWORD" provider:"lan"`
+
+	AdGuardURL      scalar `json:"adguard_url" schema:"url?" env:"ADGUARD_URL" provider:"lan"`
+	AdGuardUsername scalar `json:"adguard_username" schema:"str?" env:"ADGUARD_USERNAME" provider:"lan"`
+	AdGuardPassword scalar `json:"adguard_password" schema:"password?" env:"ADGUARD_PASSWORD" provider:"lan"`
+
+	DnsmasqHostsFile     scalar `json:"dnsmasq_hosts_file" schema:"str?" env:"DNSMASQ_HOSTS_FILE" provider:"lan"`
+	DnsmasqReloadCommand scalar `json:"dnsmasq_reload_command" schema:"str?" env:"DNSMASQ_RELOAD_COMMAND" provider:"lan"`
+}
+
+// loadHomeAssistantOptions reads the options.json of the add-on. Options
+// that are not in the schema are an error; empty options are logged and
+// left unset, so that they do not override other settings.
+func loadHomeAssistantOptions(path string) (*homeAssistantOptions, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat options file %s: %w", path, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("options path %s is a directory", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsPermission(err) {
+			logger.Info("Permission denied reading options file - Home Assistant addon may need 'hassio_api: true' or file permissions fix")
+			logger.Info("Current process UID: %d, file mode: %s", os.Getuid(), info.Mode())
+		}
+		return nil, fmt.Errorf("failed to read options file %s: %w", path, err)
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	var unknown, empty []string
+	checkOptions(raw, reflect.TypeOf(homeAssistantOptions{}), "", &unknown, &empty)
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown options in %s: %s", path, strings.Join(unknown, ", "))
+	}
+	if len(empty) > 0 {
+		logger.Info("Home Assistant options not set: %s", strings.Join(empty, ", "))
+	}
+
+	options := &homeAssistantOptions{}
+	if err := json.Unmarshal(data, options); err != nil {
+		return nil, fmt.Errorf("invalid options in %s: %w", path, err)
+	}
+	logger.Info("Loaded %d Home Assistant options from %s", len(raw)-len(empty), path)
+	return options, nil
+}
+
+// checkOptions collects the options in raw that t does not define and the
+// options without a value, with their path (e.g. lan.pihole_url)
+func checkOptions(raw map[string]any, t reflect.Type, path string, unknown, empty *[]string) {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fields[field.Tag.Get("json")] = field.Type
+	}
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := joinKey(path, key)
+		fieldType, ok := fields[key]
+		if !ok {
+			*unknown = append(*unknown, name)
+			continue
+		}
+		switch value := raw[key].(type) {
+		case nil:
+			*empty = append(*empty, name)
+		case string:
+			if value == "" {
+				*empty = append(*empty, name)
+			}
+		case map[string]any:
+			if fieldType.Kind() == reflect.Struct {
+				checkOptions(value, fieldType, name, unknown, empty)
+			}
+		case []any:
+			if fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() == reflect.Struct {
+				for i, item := range value {
+					if item, ok := item.(map[string]any); ok {
+						checkOptions(item, fieldType.Elem(), fmt.Sprintf("%s[%d]", name, i), unknown, empty)
+					}
+				}
+			}
+		}
+	}
+}
+
+// settings returns the options that map to settings, keyed by the variable
+// name in lower case like the settings of the configuration file, and the
+// provider settings of the public and LAN view
+func (o *homeAssistantOptions) settings() (env, public, lan provider.Settings) {
+	env, public, lan = provider.Settings{}, provider.Settings{}, provider.Settings{}
+	targets := map[string]provider.Settings{"": env, "public": public, "lan": lan}
+	collectOptions(reflect.ValueOf(*o), targets)
+
+	var hosts []string
+	for _, host := range o.Hosts {
+		for _, ip := range splitList(host.LAN) {
+			hosts = append(hosts, host.Name+"="+ip)
+		}
+	}
+	if len(hosts) > 0 {
+		env["lan_hosts"] = strings.Join(hosts, ",")
+	}
+	return env, public, lan
+}
+
+// collectOptions adds the fields of v tagged with env to the settings of
+// their provider tag
+func collectOptions(v reflect.Value, targets map[string]provider.Settings) {
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		if value.Kind() == reflect.Struct {
+			collectOptions(value, targets)
+			continue
+		}
+		key := strings.ToLower(field.Tag.Get("env"))
+		if key == "" {
+			continue
+		}
+		settings := targets[field.Tag.Get("provider")]
+		switch value := value.Interface().(type) {
+		case scalar:
+			if value != "" {
+				settings[key] = string(value)
+			}
+		case []string:
+			if len(value) > 0 {
+				settings[key] = strings.Join(value, ",")
+			}
+		}
+	}
+}
+
+// users returns the additional accounts of the options
+func (o *homeAssistantOptions) users() ([]auth.User, error) {
+	users := make([]auth.User, 0, len(o.Users))
+	for i, user := range o.Users {
+		if user.Username == "" || user.Password == "" {
+			return nil, fmt.Errorf("users[%d] needs a username and password", i)
+		}
+		users = append(users, auth.User{
+			Username: user.Username,
+			Password: util.Secret(user.Password),
+			Hosts:    splitList(user.Hosts),
+		})
+	}
+	return users, nil
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// homeAssistantSchema returns the options and schema sections of the
+// add-on's config.yaml as defined by homeAssistantOptions
+func homeAssistantSchema() (options, schema map[string]any) {
+	options, schema = make(map[string]any), make(map[string]any)
+	t := reflect.TypeOf(homeAssistantOptions{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("json")
+		schema[name] = schemaOf(field)
+		if value, ok := field.Tag.Lookup("default"); ok {
+			options[name] = defaultOf(field, value)
+		}
+	}
+	return options, schema
+}
+
+// schemaOf returns the schema of an option: a type, a list of one item
+// schema, or a map of the schemas of a nested option
+func schemaOf(field reflect.StructField) any {
+	switch field.Type.Kind() {
+	case reflect.Slice:
+		if field.Type.Elem().Kind() == reflect.Struct {
+			return []any{structSchema(field.Type.Elem())}
+		}
+		return []any{field.Tag.Get("schema")}
+	case reflect.Struct:
+		return structSchema(field.Type)
+	}
+	return field.Tag.Get("schema")
+}
+
+// structSchema returns the schema of the fields of t
+func structSchema(t reflect.Type) map[string]any {
+	schema := make(map[string]any, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		schema[t.Field(i).Tag.Get("json")] = schemaOf(t.Field(i))
+	}
+	return schema
+}
+
+// defaultOf converts the default tag of an option to the YAML type of its
+// schema
+func defaultOf(field reflect.StructField, value string) any {
+	if field.Type.Kind() == reflect.Slice {
+		return []any{}
+	}
+	schema := field.Tag.Get("schema")
+	switch {
+	case strings.HasPrefix(schema, "int"):
+		n, _ := strconv.Atoi(value)
+		return n
+	case strings.HasPrefix(schema, "bool"):
+		b, _ := strconv.ParseBool(value)
+		return b
+	}
+	return value
+}
@@ -0,0 +1,59 @@
+//go:build !netcup_ccp && !aws_route53
+// +build !netcup_ccp,!aws_route53
+
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/auth"
+	"github.com/markussiebert/homeddns/internal/provider"
+)
+
+const testOptions = `{
+	"auth_username": "dyndns",
+	"auth_password": "secret",
+	"dns_provider": "netcup_ccp",
+	"domain": "example.com",
+	"dns_ttl": 120,
+	"port": 9000,
+	"ssl": false,
+	"netcup_customer_number": "12345",
+	"netcup_api_key": "key",
+	"netcup_api_password": "",
+	"aws_region": "",
+	"zones": ["example.com", "example.org"],
+	"users": [{"username": "router", "password": "router-secret", "hosts": "home.example.com, *.lan.example.com"}],
+	"hosts": [{"name": "nas.example.com", "lan": "192.168.1.10,fd00::10"}],
+	"lan": {"provider": "pihole", "pihole_url": "http://pi.hole", "pihole_password": "pi"}
+}`
+
+// The LAN provider of the fixture is only built with all providers
+func TestLoadConfig_HomeAssistantOptions(t *testing.T) {
+	t.Setenv("ADDON_OPTIONS_PATH", writeFile(t, "options.json", testOptions))
+	t.Setenv("DNS_PROVIDER", "")
+	t.Setenv("NETCUP_API_PASSWORD", "from-env")
+	// Environment variables override the options
+	t.Setenv("DNS_TTL", "300")
+
+	config, err := LoadConfig("")
+	assert.NoError(t, err)
+	assert.Equal(t, 9000, config.Port)
+	assert.Equal(t, 300, config.DefaultTTL)
+	assert.Equal(t, "dyndns", config.Username)
+	assert.Equal(t, "secret", config.Password.Value())
+	assert.Equal(t, []auth.User{{Username: "router", Password: "router-secret", Hosts: []string{"home.example.com", "*.lan.example.com"}}}, config.Users)
+	assert.Equal(t, "example.com", config.Domain)
+	assert.Equal(t, []string{"example.com", "example.org"}, config.Zones)
+	// Empty options do not hide the environment
+	assert.Equal(t, provider.Settings{"netcup_customer_number": "12345", "netcup_api_key": "key"}, config.ProviderSettings)
+	assert.Equal(t, "from-env", config.ProviderSettings.Get("NETCUP_API_PASSWORD"))
+	assert.Equal(t, "pihole", config.LANProvider)
+	assert.Equal(t, provider.Settings{"pihole_url": "http://pi.hole", "pihole_password": "pi"}, config.LANProviderSettings)
+	assert.Equal(t, map[string][]string{"nas.example.com": {"192.168.1.10", "fd00::10"}}, config.LANHosts)
+	assert.Equal(t, "static", config.LANAddressSource)
+	// Options are not exported to the environment
+	assert.Equal(t, "", os.Getenv("DOMAIN"))
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// The add-on schema must match homeAssistantOptions, which decodes it
+func TestHomeAssistantSchema(t *testing.T) {
+	data, err := os.ReadFile("../homeassistant/config.yaml")
+	assert.NoError(t, err)
+	var addon struct {
+		Options map[string]any `yaml:"options"`
+		Schema  map[string]any `yaml:"schema"`
+	}
+	assert.NoError(t, yaml.Unmarshal(data, &addon))
+
+	options, schema := homeAssistantSchema()
+	expected, _ := yaml.Marshal(map[string]any{"options": options, "schema": schema})
+	assert.Equal(t, options, addon.Options, "homeassistant/config.yaml should be:\n%s", expected)
+	assert.Equal(t, schema, addon.Schema, "homeassistant/config.yaml should be:\n%s", expected)
+}
+
+func TestLoadConfig_HomeAssistantOptionsInvalid(t *testing.T) {
+	t.Setenv("ADDON_OPTIONS_PATH", writeFile(t, "options.json",
+		`{"auth_password": "x", "netcup_pasword": "typo", "lan": {"pihole_uri": "http://pi.hole"}, "users": [{"username": "a"}]}`))
+
+	_, problems := validateConfig(t.Context(), "")
+	assert.Equal(t, "Home Assistant options", problems[0].Source)
+	assert.Contains(t, problems[0].Err.Error(), "unknown options in")
+	assert.Contains(t, problems[0].Err.Error(), ": lan.pihole_uri, netcup_pasword")
+
+	t.Setenv("ADDON_OPTIONS_PATH", writeFile(t, "options.json", `{"users": [{"username": "a"}], "domain": "example.com"}`))
+	_, problems = validateConfig(t.Context(), "")
+	assert.Equal(t, "users[0] needs a username and password", problems[0].Err.Error())
+	assert.Equal(t, "Home Assistant options", problems[0].Source)
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/auth"
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/metrics"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/updater"
+)
+
+// loginCounter is implemented by providers that count their API logins
+type loginCounter interface {
+	LoginCount() int
+}
+
+// observeProvider records the latency and errors of provider calls
+func observeProvider(name, operation string, duration time.Duration, err error) {
+	metrics.ProviderDuration.Observe(duration.Seconds(), name, operation)
+	if err != nil {
+		metrics.ProviderErrors.Inc(name, operation, provider.KindOf(err).String())
+	}
+}
+
+// registerProviderMetrics exposes the cache statistics and login counts of
+// the providers of all views
+func registerProviderMetrics(upd *updater.Updater) {
+	collect := func(value func(view updater.View) (float64, bool)) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, view := range upd.Views() {
+				if v, ok := value(view); ok {
+					samples = append(samples, metrics.Sample{LabelValues: []string{view.Name, view.Provider.Name()}, Value: v})
+				}
+			}
+			return samples
+		}
+	}
+	cacheStats := func(stat func(provider.CacheStats) float64) func() []metrics.Sample {
+		return collect(func(view updater.View) (float64, bool) {
+			cache, ok := provider.As[*provider.CachingProvider](view.Provider)
+			if !ok {
+				return 0, false
+			}
+			return stat(cache.Stats()), true
+		})
+	}
+
+	metrics.Default.NewCounterFunc("homeddns_cache_hits_total", "Record lookups answered from the cache.",
+		cacheStats(func(s provider.CacheStats) float64 { return float64(s.Hits) }), "view", "provider")
+	metrics.Default.NewCounterFunc("homeddns_cache_misses_total", "Record lookups forwarded to the provider.",
+		cacheStats(func(s provider.CacheStats) float64 { return float64(s.Misses) }), "view", "provider")
+	metrics.Default.NewGaugeFunc("homeddns_cache_entries", "Records held in the cache.",
+		cacheStats(func(s provider.CacheStats) float64 { return float64(s.Entries) }), "view", "provider")
+	metrics.Default.NewCounterFunc("homeddns_provider_logins_total", "API logins performed by the provider.",
+		collect(func(view updater.View) (float64, bool) {
+			counter, ok := provider.As[loginCounter](view.Provider)
+			if !ok {
+				return 0, false
+			}
+			return float64(counter.LoginCount()), true
+		}), "view", "provider")
+}
+
+// metricsHandler returns the /metrics handler, protected by the metrics
+// credentials if configured
+func metricsHandler(config *Config) http.Handler {
+	if config.MetricsUsername == "" {
+		return metrics.Default
+	}
+	return auth.Middleware(auth.Config{
+		Username: config.MetricsUsername,
+		Password: config.MetricsPassword,
+	})(metrics.Default)
+}
+
+// startMetricsServer serves /metrics on a dedicated listener
+func startMetricsServer(config *Config) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsHandler(config))
+	server := &http.Server{
+		Addr:         config.MetricsListenAddr,
+		Handler:      mux,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+	}
+	go func() {
+		logger.Info("Serving metrics on %s/metrics", config.MetricsListenAddr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatal("Metrics server error: %v", err)
+		}
+	}()
+	return server
+}
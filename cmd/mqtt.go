@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/markussiebert/homeddns/internal/health"
+	"github.com/markussiebert/homeddns/internal/homeassistant"
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/mqtt"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/updater"
+	"github.com/markussiebert/homeddns/internal/util"
+)
+
+// Version is reported to Home Assistant; it is set by main
+var Version = "dev"
+
+// MQTTConfig configures publishing to Home Assistant over MQTT. MQTT is
+// disabled if Broker is empty.
+type MQTTConfig struct {
+	Broker          string
+	Username        string
+	Password        util.Secret
+	ClientID        string
+	DiscoveryPrefix string
+	BaseTopic       string
+}
+
+// loadMQTTConfig reads the MQTT_* settings from the environment or the
+// configuration file. All invalid settings are reported, joined.
+func loadMQTTConfig(env provider.Settings) (MQTTConfig, error) {
+	config := MQTTConfig{
+		Broker:          env.Get("MQTT_BROKER"),
+		Username:        env.Get("MQTT_USERNAME"),
+		ClientID:        env.Get("MQTT_CLIENT_ID"),
+		DiscoveryPrefix: env.Get("MQTT_DISCOVERY_PREFIX"),
+		BaseTopic:       env.Get("MQTT_BASE_TOPIC"),
+	}
+	var errs []error
+	password, err := env.Secret("MQTT_PASSWORD")
+	if err != nil {
+		errs = append(errs, invalidSetting("MQTT_PASSWORD", "%w", err))
+	}
+	config.Password = password
+	if config.Broker != "" {
+		if _, err := mqtt.NewClient(mqtt.Options{Broker: config.Broker}); err != nil {
+			errs = append(errs, invalidSetting("MQTT_BROKER", "invalid MQTT_BROKER: %w", err))
+		}
+	}
+	return config, errors.Join(errs...)
+}
+
+// startMQTT connects to the MQTT broker and publishes the state of all
+// records, update results and provider health to Home Assistant until ctx
+// is done. It returns nil if MQTT is disabled.
+func startMQTT(ctx context.Context, upd *updater.Updater, config *Config, readiness *health.Checker) (*homeassistant.Bridge, error) {
+	if config.MQTT.Broker == "" {
+		return nil, nil
+	}
+
+	views := upd.Views()
+	bridge := homeassistant.New(homeassistant.Config{
+		DiscoveryPrefix: config.MQTT.DiscoveryPrefix,
+		BaseTopic:       config.MQTT.BaseTopic,
+		View:            views[0].Name,
+		Version:         Version,
+		Health:          readiness,
+		Update: func(ctx context.Context, hostname string) string {
+			return forceUpdate(ctx, upd, config, hostname, "", "mqtt")
+		},
+	})
+	client, err := mqtt.NewClient(mqtt.Options{
+		Broker:    config.MQTT.Broker,
+		ClientID:  config.MQTT.ClientID,
+		Username:  config.MQTT.Username,
+		Password:  config.MQTT.Password,
+		Will:      bridge.Will(),
+		OnConnect: func(c *mqtt.Client) { bridge.Connected(c) },
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bridge.Seed(upd.Store().Records())
+	upd.Store().Subscribe(bridge.Change)
+	logger.Info("Publishing to Home Assistant via MQTT broker %s", config.MQTT.Broker)
+
+	go client.Run(ctx)
+	go func() {
+		if err := bridge.Run(ctx, client); err != nil {
+			logger.Error("MQTT bridge stopped: %v", err)
+		}
+	}()
+	return bridge, nil
+}
+
+// forceUpdate publishes the current public IP for hostname on behalf of
+// user and returns the DynDNS status of the primary view. Hostnames outside
+// the configured zones (or the domain) are rejected with nohost.
+func forceUpdate(ctx context.Context, upd *updater.Updater, config *Config, hostname, client, user string) string {
+	// Hostnames are split at the longest configured zone like DynDNS updates
+	domain, ok := updater.ZoneOf(configZones(config), hostname)
+	if !ok {
+		logger.WarnContext(ctx, "Update of %s requested by %s rejected: not in a configured zone", hostname, user)
+		return "nohost"
+	}
+	publicIP, err := getPublicIP(config.PublicIPURLs)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to get public IP: %v", err)
+		return "911"
+	}
+	results := upd.Update(ctx, updater.Request{
+		Hostname: hostname,
+		Domain:   domain,
+		Address:  publicIP,
+		Client:   client,
+		User:     user,
+	})
+
+	primary := upd.Views()[0].Name
+	status := "911"
+	for _, result := range results {
+		if result.View != primary {
+			continue
+		}
+		if result.Err != nil {
+			logger.ErrorContext(ctx, "Update of %s requested by %s failed: %v", hostname, user, result.Err)
+			return "911"
+		}
+		status = "good"
+	}
+	return status
+}
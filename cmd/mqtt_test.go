@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/updater"
+)
+
+// zoneProvider records the zone of every update
+type zoneProvider struct {
+	staticProvider
+	zones []string
+}
+
+func (p *zoneProvider) UpdateRecord(ctx context.Context, domain string, record *provider.DNSRecord) error {
+	p.zones = append(p.zones, domain)
+	return nil
+}
+
+func TestForceUpdate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("203.0.113.7\n"))
+	}))
+	defer server.Close()
+	p := &zoneProvider{}
+	upd := updater.New(60, updater.View{Name: "public", Provider: p})
+	config := &Config{Domain: "example.com", Zones: []string{"example.com", "lan.example.com"}, PublicIPURLs: []string{server.URL}}
+
+	assert.Equal(t, "good", forceUpdate(context.Background(), upd, config, "nas.lan.example.com", "", "mqtt"))
+	assert.Equal(t, []string{"lan.example.com"}, p.zones)
+
+	// Hostnames outside the zones are not updated
+	assert.Equal(t, "nohost", forceUpdate(context.Background(), upd, config, "nas.example.org", "", "mqtt"))
+	config.Zones = nil
+	assert.Equal(t, "nohost", forceUpdate(context.Background(), upd, config, "badexample.com", "", "mqtt"))
+	assert.Equal(t, []string{"lan.example.com"}, p.zones)
+}
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/notify"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/updater"
+	"github.com/markussiebert/homeddns/internal/util"
+)
+
+// NotifyConfig configures the notifications sent when a record value
+// changes. Backends without a URL or host are disabled.
+type NotifyConfig struct {
+	WebhookURL      string
+	WebhookTemplate string
+
+	NtfyURL      string
+	NtfyToken    util.Secret
+	NtfyPriority string
+
+	GotifyURL      string
+	GotifyToken    util.Secret
+	GotifyPriority int
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPTLS      bool
+	SMTPUsername string
+	SMTPPassword util.Secret
+	SMTPFrom     string
+	SMTPTo       []string
+
+	// MaxAttempts is the number of attempts per notification and backend
+	MaxAttempts int
+}
+
+// loadNotifyConfig reads the NOTIFY_* settings from the environment or the
+// configuration file. All invalid settings are reported, joined.
+func loadNotifyConfig(env provider.Settings) (NotifyConfig, error) {
+	config := NotifyConfig{
+		WebhookURL:      env.Get("NOTIFY_WEBHOOK_URL"),
+		WebhookTemplate: env.Get("NOTIFY_WEBHOOK_TEMPLATE"),
+		NtfyURL:         env.Get("NOTIFY_NTFY_URL"),
+		NtfyPriority:    env.Get("NOTIFY_NTFY_PRIORITY"),
+		GotifyURL:       env.Get("NOTIFY_GOTIFY_URL"),
+		SMTPHost:        env.Get("NOTIFY_SMTP_HOST"),
+		SMTPUsername:    env.Get("NOTIFY_SMTP_USERNAME"),
+		SMTPFrom:        env.Get("NOTIFY_SMTP_FROM"),
+		MaxAttempts:     notify.DefaultRetryPolicy().MaxAttempts,
+	}
+	var errs []error
+	for _, secret := range []struct {
+		env   string
+		value *util.Secret
+	}{
+		{"NOTIFY_NTFY_TOKEN", &config.NtfyToken},
+		{"NOTIFY_GOTIFY_TOKEN", &config.GotifyToken},
+		{"NOTIFY_SMTP_PASSWORD", &config.SMTPPassword},
+	} {
+		value, err := env.Secret(secret.env)
+		if err != nil {
+			errs = append(errs, invalidSetting(secret.env, "%w", err))
+			continue
+		}
+		*secret.value = value
+	}
+
+	for _, setting := range []struct {
+		env   string
+		value string
+	}{
+		{"NOTIFY_WEBHOOK_URL", config.WebhookURL},
+		{"NOTIFY_NTFY_URL", config.NtfyURL},
+		{"NOTIFY_GOTIFY_URL", config.GotifyURL},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		if u, err := url.Parse(setting.value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, invalidSetting(setting.env, "invalid %s: must be an http or https URL", setting.env))
+		}
+	}
+	if config.WebhookTemplate != "" {
+		if _, err := notify.NewWebhook(config.WebhookURL, config.WebhookTemplate); err != nil {
+			errs = append(errs, invalidSetting("NOTIFY_WEBHOOK_TEMPLATE", "invalid NOTIFY_WEBHOOK_TEMPLATE: %w", err))
+		}
+	}
+	if config.GotifyURL != "" && config.GotifyToken == "" {
+		errs = append(errs, invalidSetting("NOTIFY_GOTIFY_TOKEN", "NOTIFY_GOTIFY_TOKEN is required with NOTIFY_GOTIFY_URL"))
+	}
+
+	for _, setting := range []struct {
+		env   string
+		value *int
+	}{
+		{"NOTIFY_GOTIFY_PRIORITY", &config.GotifyPriority},
+		{"NOTIFY_SMTP_PORT", &config.SMTPPort},
+		{"NOTIFY_MAX_ATTEMPTS", &config.MaxAttempts},
+	} {
+		if value := env.Get(setting.env); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				errs = append(errs, invalidSetting(setting.env, "invalid %s: %q", setting.env, value))
+				continue
+			}
+			*setting.value = n
+		}
+	}
+	if tls := env.Get("NOTIFY_SMTP_TLS"); tls != "" {
+		b, err := strconv.ParseBool(tls)
+		if err != nil {
+			errs = append(errs, invalidSetting("NOTIFY_SMTP_TLS", "invalid NOTIFY_SMTP_TLS: %q", tls))
+		}
+		config.SMTPTLS = b
+	}
+	for _, to := range strings.Split(env.Get("NOTIFY_SMTP_TO"), ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			config.SMTPTo = append(config.SMTPTo, to)
+		}
+	}
+	if config.SMTPHost != "" && (config.SMTPFrom == "" || len(config.SMTPTo) == 0) {
+		errs = append(errs, invalidSetting("NOTIFY_SMTP_HOST", "NOTIFY_SMTP_FROM and NOTIFY_SMTP_TO are required with NOTIFY_SMTP_HOST"))
+	}
+	return config, errors.Join(errs...)
+}
+
+// notifiers returns the enabled notification backends
+func (c NotifyConfig) notifiers() []notify.Notifier {
+	var notifiers []notify.Notifier
+	if c.WebhookURL != "" {
+		// The template was validated by loadNotifyConfig
+		webhook, _ := notify.NewWebhook(c.WebhookURL, c.WebhookTemplate)
+		notifiers = append(notifiers, webhook)
+	}
+	if c.NtfyURL != "" {
+		notifiers = append(notifiers, &notify.Ntfy{URL: c.NtfyURL, Token: c.NtfyToken, Priority: c.NtfyPriority})
+	}
+	if c.GotifyURL != "" {
+		notifiers = append(notifiers, &notify.Gotify{URL: c.GotifyURL, Token: c.GotifyToken, Priority: c.GotifyPriority})
+	}
+	if c.SMTPHost != "" {
+		notifiers = append(notifiers, &notify.SMTP{
+			Host:     c.SMTPHost,
+			Port:     c.SMTPPort,
+			TLS:      c.SMTPTLS,
+			Username: c.SMTPUsername,
+			Password: c.SMTPPassword,
+			From:     c.SMTPFrom,
+			To:       c.SMTPTo,
+		})
+	}
+	return notifiers
+}
+
+// startNotifications sends a notification for every changed record value.
+// It returns nil if no backend is configured.
+func startNotifications(upd *updater.Updater, config *Config) *notify.Dispatcher {
+	notifiers := config.Notify.notifiers()
+	if len(notifiers) == 0 {
+		return nil
+	}
+	names := make([]string, len(notifiers))
+	for i, n := range notifiers {
+		names[i] = n.Name()
+	}
+	logger.Info("Change notifications enabled: %s", strings.Join(names, ", "))
+
+	policy := notify.DefaultRetryPolicy()
+	policy.MaxAttempts = config.Notify.MaxAttempts
+	dispatcher := notify.NewDispatcher(policy, notifiers...)
+	upd.Store().Subscribe(dispatcher.Notify)
+	return dispatcher
+}
+
+// stopNotifications sends the queued notifications
+func stopNotifications(ctx context.Context, dispatcher *notify.Dispatcher) {
+	if dispatcher == nil {
+		return
+	}
+	if err := dispatcher.Close(ctx); err != nil {
+		logger.Warn("Pending notifications were not sent: %v", err)
+	}
+}
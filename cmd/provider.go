@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/audit"
+	"github.com/markussiebert/homeddns/internal/dnsclient"
+	"github.com/markussiebert/homeddns/internal/health"
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/state"
+	"github.com/markussiebert/homeddns/internal/updater"
+)
+
+// newProvider creates a provider by its registered name, wrapped with the
+// metrics instrumentation, the default retry and rate-limit policy, the
+// per-zone update queue and the record cache
+func newProvider(ctx context.Context, config *Config, name string, settings provider.Settings) (provider.Provider, error) {
+	factory, ok := provider.GetFactory(name)
+	if !ok {
+		return nil, fmt.Errorf("provider factory not found: %s", name)
+	}
+
+	// Provider handles its own credential loading from the environment and
+	// the settings of the configuration file
+	p, err := factory(ctx, settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create provider %s: %w", name, err)
+	}
+	p = provider.WithInstrumentation(p, observeProvider)
+	p = provider.WithRetry(p, provider.DefaultRetryPolicy(name))
+	p = provider.WithCoalescing(p, config.CoalesceWindow)
+
+	if config.CacheTTL <= 0 {
+		return p, nil
+	}
+	return provider.WithCache(p, config.CacheTTL), nil
+}
+
+// newViews creates the providers of all configured views. The public view
+// is always first; the LAN view is added when LAN_DNS_PROVIDER is set.
+func newViews(ctx context.Context, config *Config) ([]updater.View, []provider.Provider, error) {
+	public, err := newProvider(ctx, config, config.Provider, config.ProviderSettings)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger.Info("Using DNS provider: %s", public.Name())
+
+	views := []updater.View{{
+		Name:     "public",
+		Provider: public,
+		Source:   updater.SourceRequest,
+	}}
+	providers := []provider.Provider{public}
+
+	if config.LANProvider != "" {
+		lan, err := newProvider(ctx, config, config.LANProvider, config.LANProviderSettings)
+		if err != nil {
+			closeProviders(ctx, providers)
+			return nil, nil, err
+		}
+		logger.Info("Using LAN DNS provider: %s (address source: %s)", lan.Name(), config.LANAddressSource)
+
+		views = append(views, updater.View{
+			Name:     "lan",
+			Provider: lan,
+			Source:   updater.AddressSource(config.LANAddressSource),
+			Static:   config.LANHosts,
+		})
+		providers = append(providers, lan)
+	}
+	return views, providers, nil
+}
+
+// newUpdater creates the providers of all configured views and opens the
+// state store and audit log
+func newUpdater(ctx context.Context, config *Config) (*updater.Updater, []provider.Provider, error) {
+	views, providers, err := newViews(ctx, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	store, err := state.Open(config.StateFile, config.StateHistoryLimit)
+	if err != nil {
+		closeProviders(ctx, providers)
+		return nil, nil, err
+	}
+
+	auditLog, err := audit.Open(config.AuditLog, config.AuditMaxSize, config.AuditMaxFiles)
+	if err != nil {
+		closeProviders(ctx, providers)
+		return nil, nil, err
+	}
+
+	upd := updater.New(config.DefaultTTL, views...)
+	upd.UseStore(store)
+	upd.UseAudit(auditLog)
+	upd.UseDNSClient(&dnsclient.Client{Nameservers: config.Nameservers})
+	return upd, providers, nil
+}
+
+// warmCaches seeds the record caches from the state store and starts their
+// revalidation, which also catches changes made while homeddns was stopped.
+// Without revalidation the caches are not seeded, since a record changed or
+// deleted outside homeddns would be hidden until its entry expires.
+func warmCaches(upd *updater.Updater, config *Config) {
+	if config.CacheRevalidateInterval <= 0 {
+		return
+	}
+	for _, view := range upd.Views() {
+		cache, ok := provider.As[*provider.CachingProvider](view.Provider)
+		if !ok {
+			continue
+		}
+		seeded := 0
+		for _, record := range upd.Store().Records() {
+			if record.View != view.Name {
+				continue
+			}
+			cache.Seed(record.Domain, &provider.DNSRecord{
+				Name:  record.Hostname,
+				Type:  record.Type,
+				Value: record.Value,
+				TTL:   config.DefaultTTL,
+			})
+			seeded++
+		}
+		logger.Debug("Seeded %d cached records for view %s", seeded, view.Name)
+
+		cache.StartRevalidation(config.CacheRevalidateInterval)
+	}
+}
+
+// closeProviders closes all providers, logging errors
+func closeProviders(ctx context.Context, providers []provider.Provider) {
+	for _, p := range providers {
+		if err := p.Close(ctx); err != nil {
+			logger.Warn("Error closing provider %s: %v", p.Name(), err)
+		}
+	}
+}
+
+// readyCacheTTL is how long a readiness result is reused, so that frequent
+// probes do not hit the provider APIs
+const readyCacheTTL = 15 * time.Second
+
+// newReadinessChecker checks the providers of all views
+func newReadinessChecker(upd *updater.Updater) *health.Checker {
+	return health.New(readyCacheTTL, readinessTargets(upd)...)
+}
+
+// readinessTargets returns the providers of all views
+func readinessTargets(upd *updater.Updater) []health.Target {
+	var targets []health.Target
+	for _, view := range upd.Views() {
+		targets = append(targets, health.Target{View: view.Name, Provider: view.Provider})
+	}
+	return targets
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/state"
+	"github.com/markussiebert/homeddns/internal/updater"
+)
+
+// staticProvider serves one record that was changed outside homeddns
+type staticProvider struct{}
+
+func (staticProvider) Name() string { return "static" }
+
+func (staticProvider) GetRecord(ctx context.Context, domain, hostname, recordType string) (*provider.DNSRecord, error) {
+	return &provider.DNSRecord{Name: hostname, Type: recordType, Value: "192.0.2.9"}, nil
+}
+
+func (staticProvider) UpdateRecord(ctx context.Context, domain string, record *provider.DNSRecord) error {
+	return nil
+}
+
+func (staticProvider) Close(ctx context.Context) error { return nil }
+
+func TestWarmCaches(t *testing.T) {
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.json"), 0)
+	assert.NoError(t, err)
+	_, err = store.Apply(state.Change{Hostname: "nas.example.com", Domain: "example.com", Type: "A", Value: "192.0.2.1", View: "public"})
+	assert.NoError(t, err)
+
+	newCache := func(config *Config) *provider.CachingProvider {
+		cache := provider.WithCache(staticProvider{}, time.Hour)
+		upd := updater.New(60, updater.View{Name: "public", Provider: cache})
+		upd.UseStore(store)
+		warmCaches(upd, config)
+		t.Cleanup(func() { _ = cache.Close(context.Background()) })
+		return cache
+	}
+
+	// Without revalidation the stale state would hide the provider's value
+	cache := newCache(&Config{DefaultTTL: 60})
+	assert.Equal(t, 0, cache.Stats().Entries)
+	record, err := cache.GetRecord(context.Background(), "example.com", "nas.example.com", "A")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.9", record.Value)
+
+	// With revalidation the seeded entry is checked right away
+	cache = newCache(&Config{DefaultTTL: 60, CacheRevalidateInterval: time.Hour})
+	assert.Equal(t, 1, cache.Stats().Entries)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		record, err = cache.GetRecord(context.Background(), "example.com", "nas.example.com", "A")
+		assert.NoError(t, err)
+		if record.Value == "192.0.2.9" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "192.0.2.9", record.Value)
+}
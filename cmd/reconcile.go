@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/dnsclient"
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/reconcile"
+	"github.com/markussiebert/homeddns/internal/updater"
+)
+
+// driftGrace leaves time for a change to propagate to all nameservers
+// before it is checked
+const driftGrace = 5 * time.Minute
+
+// newReconciler creates the drift reconciler for the public view. Other
+// views are served by local resolvers, not the zone's nameservers.
+func newReconciler(upd *updater.Updater, config *Config) *reconcile.Reconciler {
+	logger.Info("Drift detection enabled: interval=%v, auto-repair=%v", config.DriftCheckInterval, config.DriftAutoRepair)
+	return reconcile.New(reconcile.Config{
+		Store:      upd.Store(),
+		Providers:  driftProviders(upd),
+		Client:     &dnsclient.Client{Nameservers: config.Nameservers},
+		AutoRepair: config.DriftAutoRepair,
+		Grace:      driftGrace,
+		DefaultTTL: config.DefaultTTL,
+	})
+}
+
+// driftProviders returns the provider of the public view by its view name
+func driftProviders(upd *updater.Updater) map[string]provider.Provider {
+	primary := upd.Views()[0]
+	return map[string]provider.Provider{primary.Name: primary.Provider}
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/acme"
+	"github.com/markussiebert/homeddns/internal/health"
+	"github.com/markussiebert/homeddns/internal/homeassistant"
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/reconcile"
+	"github.com/markussiebert/homeddns/internal/tlscert"
+	"github.com/markussiebert/homeddns/internal/updater"
+)
+
+// liveServer serves the HTTP handler of the current configuration. A reload
+// builds a new handler and swaps it atomically: requests in flight finish
+// with the handler they started with, new requests use the new one.
+type liveServer struct {
+	load       func() (*Config, error)
+	upd        *updater.Updater
+	readiness  *health.Checker
+	reconciler *reconcile.Reconciler
+	bridge     *homeassistant.Bridge
+	certs      *tlscert.Reloader
+	acme       *acme.Manager
+
+	// mu serializes reloads and guards providers and watched
+	mu        sync.Mutex
+	providers []provider.Provider
+	watched   map[string]time.Time
+
+	config  atomic.Pointer[Config]
+	handler atomic.Pointer[http.Handler]
+}
+
+// ServeHTTP serves the request with the handler of the current configuration
+func (l *liveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*l.handler.Load()).ServeHTTP(w, r)
+}
+
+// Config returns the current configuration
+func (l *liveServer) Config() *Config {
+	return l.config.Load()
+}
+
+// use makes config the current configuration
+func (l *liveServer) use(config *Config) {
+	h := l.routes(config)
+	l.handler.Store(&h)
+	l.config.Store(config)
+}
+
+// reload loads the configuration again and swaps the credentials, ACLs,
+// zones and providers. On error the current configuration is kept.
+// Settings that are only read at startup are reported and keep their value.
+func (l *liveServer) reload(ctx context.Context) error {
+	if l.load == nil {
+		return errors.New("configuration reload is not supported")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	config, err := l.load()
+	if err != nil {
+		return err
+	}
+	old := l.Config()
+	for _, name := range restartRequired(old, config) {
+		logger.Warn("Changed setting %s takes effect after a restart", name)
+	}
+	// The handlers must match the state of the running components
+	config.DefaultTTL = old.DefaultTTL
+	config.AuditLog = old.AuditLog
+	config.MetricsListenAddr = old.MetricsListenAddr
+	config.AuthMode, config.ClientCAFile, config.ClientCRLFile = old.AuthMode, old.ClientCAFile, old.ClientCRLFile
+	if l.acme != nil {
+		config.ACME = old.ACME
+		config.SSL, config.CertFile, config.KeyFile = old.SSL, old.CertFile, old.KeyFile
+	}
+
+	views, providers, err := newViews(ctx, config)
+	if err != nil {
+		return err
+	}
+	if l.certs != nil && (config.CertFile != old.CertFile || config.KeyFile != old.KeyFile) {
+		if err := l.certs.SetFiles(config.CertFile, config.KeyFile); err != nil {
+			closeProviders(ctx, providers)
+			return err
+		}
+	}
+
+	l.upd.SetViews(views...)
+	if l.acme != nil {
+		l.acme.SetProvider(views[0].Provider)
+	}
+	warmCaches(l.upd, config)
+	l.readiness.SetTargets(readinessTargets(l.upd)...)
+	if l.reconciler != nil {
+		l.reconciler.SetProviders(driftProviders(l.upd))
+	}
+	logger.SetFormat(config.LogFormat)
+	logger.SetLevelFromString(config.LogLevel)
+	l.use(config)
+
+	// Updates in flight may still use the old providers
+	retired := l.providers
+	l.providers = providers
+	time.AfterFunc(config.WaitTimeout+time.Minute, func() {
+		closeProviders(context.Background(), retired)
+	})
+
+	logger.Info("Configuration reloaded")
+	return nil
+}
+
+// close closes the providers of the current configuration
+func (l *liveServer) close(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	closeProviders(ctx, l.providers)
+	l.providers = nil
+}
+
+// modified reports whether the configuration file or the Home Assistant
+// options changed since the last call
+func (l *liveServer) modified() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	watched := make(map[string]time.Time)
+	for _, file := range []string{l.Config().File, os.Getenv("ADDON_OPTIONS_PATH")} {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			watched[file] = info.ModTime()
+		}
+	}
+	changed := l.watched != nil && !reflect.DeepEqual(watched, l.watched)
+	l.watched = watched
+	return changed
+}
+
+// restartRequired returns the names of the settings that differ between old
+// and config but are only read at startup
+func restartRequired(old, config *Config) []string {
+	var changed []string
+	for _, setting := range []struct {
+		name     string
+		old, new any
+	}{
+		{"PORT", old.Port, config.Port},
+		{"SSL", old.SSL, config.SSL},
+		{"AUTH_MODE", old.AuthMode, config.AuthMode},
+		{"CLIENT_CA_FILE", old.ClientCAFile, config.ClientCAFile},
+		{"CLIENT_CRL_FILE", old.ClientCRLFile, config.ClientCRLFile},
+		{"DNS_TTL", old.DefaultTTL, config.DefaultTTL},
+		{"STATE_FILE", old.StateFile, config.StateFile},
+		{"STATE_HISTORY_LIMIT", old.StateHistoryLimit, config.StateHistoryLimit},
+		{"AUDIT_LOG", old.AuditLog, config.AuditLog},
+		{"AUDIT_MAX_SIZE", old.AuditMaxSize, config.AuditMaxSize},
+		{"AUDIT_MAX_FILES", old.AuditMaxFiles, config.AuditMaxFiles},
+		{"DRIFT_CHECK_INTERVAL", old.DriftCheckInterval, config.DriftCheckInterval},
+		{"DRIFT_AUTO_REPAIR", old.DriftAutoRepair, config.DriftAutoRepair},
+		{"NAMESERVERS", old.Nameservers, config.Nameservers},
+		{"METRICS_LISTEN_ADDR", old.MetricsListenAddr, config.MetricsListenAddr},
+		{"CONFIG_WATCH_INTERVAL", old.ConfigWatchInterval, config.ConfigWatchInterval},
+		{"MQTT_*", old.MQTT, config.MQTT},
+		{"NOTIFY_*", old.Notify, config.Notify},
+		{"ACME_*", old.ACME, config.ACME},
+	} {
+		if !reflect.DeepEqual(setting.old, setting.new) {
+			changed = append(changed, setting.name)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/api"
+	"github.com/markussiebert/homeddns/internal/provider"
+)
+
+const reloadYAML = `
+auth:
+  username: %s
+  password: secret
+providers:
+  public:
+    type: dnsmasq
+    settings:
+      dnsmasq_hosts_file: %s
+zones: [example.com]
+`
+
+func TestLiveServer_Reload(t *testing.T) {
+	if _, ok := provider.GetFactory("dnsmasq"); !ok {
+		t.Skip("dnsmasq provider not built")
+	}
+	dir := t.TempDir()
+	t.Setenv("STATE_FILE", filepath.Join(dir, "state.json"))
+	t.Setenv("AUDIT_LOG", filepath.Join(dir, "audit.log"))
+	t.Setenv("DNS_PROVIDER", "")
+	path := filepath.Join(dir, "homeddns.yaml")
+	write := func(username string, modTime time.Time) {
+		content := []byte(fmt.Sprintf(reloadYAML, username, filepath.Join(dir, "hosts")))
+		assert.NoError(t, os.WriteFile(path, content, 0o600))
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	start := time.Now().Add(-time.Hour)
+	write("alice", start)
+
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+	upd, providers, err := newUpdater(context.Background(), config)
+	assert.NoError(t, err)
+	live := &liveServer{
+		load:      func() (*Config, error) { return LoadConfig(path) },
+		upd:       upd,
+		readiness: newReadinessChecker(upd),
+		providers: providers,
+	}
+	live.use(config)
+	assert.False(t, live.modified())
+	defer live.close(context.Background())
+
+	status := func(username string) int {
+		req := httptest.NewRequest(http.MethodGet, api.Prefix+"/providers", nil)
+		req.SetBasicAuth(username, "secret")
+		rec := httptest.NewRecorder()
+		live.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, status("alice"))
+
+	// A changed file is reloaded with new credentials
+	write("bob", start.Add(time.Minute))
+	assert.True(t, live.modified())
+	assert.NoError(t, live.reload(context.Background()))
+	assert.Equal(t, http.StatusUnauthorized, status("alice"))
+	assert.Equal(t, http.StatusOK, status("bob"))
+
+	// An invalid file keeps the current configuration
+	assert.NoError(t, os.WriteFile(path, []byte("server:\n  prot: 1\n"), 0o600))
+	assert.Error(t, live.reload(context.Background()))
+	assert.Equal(t, http.StatusOK, status("bob"))
+	assert.Equal(t, "bob", live.Config().Username)
+}
+
+func TestRestartRequired(t *testing.T) {
+	old := &Config{Port: 8053, Username: "alice", AuditLog: "/data/audit.log"}
+	config := &Config{Port: 9000, Username: "bob", AuditLog: "/data/audit.log"}
+	config.MQTT.Broker = "mqtt://broker:1883"
+	assert.Equal(t, []string{"PORT", "MQTT_*"}, restartRequired(old, config))
+	assert.Equal(t, 0, len(restartRequired(old, old)))
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
@@ -9,61 +10,128 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/markussiebert/homeddns/internal/acme"
+	"github.com/markussiebert/homeddns/internal/api"
 	"github.com/markussiebert/homeddns/internal/auth"
 	"github.com/markussiebert/homeddns/internal/handler"
 	"github.com/markussiebert/homeddns/internal/logger"
-	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/metrics"
+	"github.com/markussiebert/homeddns/internal/reconcile"
+	"github.com/markussiebert/homeddns/internal/tlscert"
+	"github.com/markussiebert/homeddns/internal/web"
 )
 
-func RunServer(port int, config *Config) error {
-	prov, ok := provider.GetFactory(config.Provider)
-	if !ok {
-		return fmt.Errorf("provider factory not found: %s", config.Provider)
+// RunServer serves DynDNS updates, the management API and the web UI on
+// port until SIGINT or SIGTERM. If load is set, SIGHUP and changes of the
+// configuration files (with CONFIG_WATCH_INTERVAL) reload the configuration
+// through it.
+func RunServer(port int, config *Config, load func() (*Config, error)) error {
+	upd, providers, err := newUpdater(context.Background(), config)
+	if err != nil {
+		return err
 	}
 
-	// Provider handles its own credential loading
-	p, err := prov(context.Background(), nil)
-	if err != nil {
-		return fmt.Errorf("failed to create provider: %w", err)
+	// Certificate from an ACME CA, published through the public provider
+	var certManager *acme.Manager
+	if len(config.ACME.Domains) > 0 {
+		if certManager, err = newACMEManager(config, upd); err == nil {
+			err = obtainCertificate(context.Background(), certManager, config)
+		}
+		if err != nil {
+			closeProviders(context.Background(), providers)
+			return err
+		}
+	}
+	var certs *tlscert.Reloader
+	if config.SSL {
+		if certs, err = tlscert.New(config.CertFile, config.KeyFile); err != nil {
+			closeProviders(context.Background(), providers)
+			return err
+		}
+	}
+	var clientCerts *tlscert.ClientVerifier
+	if config.AuthMode.Certificates() {
+		if clientCerts, err = tlscert.NewClientVerifier(config.ClientCAFile, config.ClientCRLFile); err != nil {
+			closeProviders(context.Background(), providers)
+			return err
+		}
 	}
 
-	logger.Info("Using DNS provider: %s", p.Name())
+	warmCaches(upd, config)
+	dispatcher := startNotifications(upd, config)
 
-	dyndnsHandler := handler.NewDynDNSHandler(handler.Config{
-		Provider:   p,
-		DefaultTTL: config.DefaultTTL,
-	})
+	// Prometheus metrics on their own listener
+	registerProviderMetrics(upd)
+	var metricsServer *http.Server
+	if config.MetricsListenAddr != "" {
+		metricsServer = startMetricsServer(config)
+	}
 
-	authMiddleware := auth.Middleware(auth.Config{
-		Username: config.Username,
-		Password: config.Password,
-	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	mux := http.NewServeMux()
-	// Health check endpoint (no auth required)
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("OK\n"))
-	})
-	// DynDNS standard format: /nic/update?hostname=...
-	mux.Handle("/nic/update", authMiddleware(dyndnsHandler))
-	// DynDNS UniFi format: /hostname
-	// Use {hostname...} to match any path (wildcard in Go 1.22+)
-	mux.Handle("/{hostname...}", authMiddleware(dyndnsHandler))
+	// Readiness of the providers, also reported to Home Assistant
+	readiness := newReadinessChecker(upd)
+
+	// Home Assistant via MQTT
+	bridge, err := startMQTT(ctx, upd, config, readiness)
+	if err != nil {
+		if metricsServer != nil {
+			_ = metricsServer.Close()
+		}
+		stopNotifications(context.Background(), dispatcher)
+		closeProviders(context.Background(), providers)
+		return err
+	}
+
+	var reconciler *reconcile.Reconciler
+	if config.DriftCheckInterval > 0 {
+		reconciler = newReconciler(upd, config)
+		go reconciler.Run(ctx, config.DriftCheckInterval)
+	}
+
+	// Renewed certificates are served without a restart
+	if certManager != nil {
+		go certManager.Run(ctx, acme.DefaultCheckInterval, func() {
+			if err := certs.Reload(); err != nil {
+				logger.Error("Cannot load the renewed certificate: %v", err)
+			}
+		})
+	}
+
+	live := &liveServer{
+		load:       load,
+		upd:        upd,
+		readiness:  readiness,
+		reconciler: reconciler,
+		bridge:     bridge,
+		certs:      certs,
+		acme:       certManager,
+		providers:  providers,
+	}
+	live.use(config)
+	live.modified()
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
-		Handler:      mux,
+		Handler:      handler.RequestID(live),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
 	go func() {
-		if config.SSL {
+		if certs != nil {
 			logger.Info("Starting DynDNS server with TLS on port %d", port)
 			logger.Debug("Using certfile: %s, keyfile: %s", config.CertFile, config.KeyFile)
-			if err := server.ListenAndServeTLS(config.CertFile, config.KeyFile); err != nil && err != http.ErrServerClosed {
+			// Certificates are read through GetCertificate, so renewals
+			// are served without a restart
+			server.TLSConfig = &tls.Config{GetCertificate: certs.GetCertificate}
+			if clientCerts != nil {
+				logger.Info("Verifying client certificates against %s (AUTH_MODE %s)", config.ClientCAFile, config.AuthMode)
+				server.TLSConfig = clientCerts.Config(server.TLSConfig)
+			}
+			if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
 				logger.Fatal("Server TLS error: %v", err)
 			}
 		} else {
@@ -76,21 +144,128 @@ func RunServer(port int, config *Config) error {
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-	<-stop
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	var watch <-chan time.Time
+	if config.ConfigWatchInterval > 0 && load != nil {
+		ticker := time.NewTicker(config.ConfigWatchInterval)
+		defer ticker.Stop()
+		watch = ticker.C
+	}
+
+wait:
+	for {
+		select {
+		case <-stop:
+			break wait
+		case <-hup:
+			logger.Info("Received SIGHUP, reloading configuration")
+			if err := live.reload(ctx); err != nil {
+				logger.Error("Configuration reload failed, keeping the current configuration: %v", err)
+			}
+		case <-watch:
+			if !live.modified() {
+				continue
+			}
+			logger.Info("Configuration files changed, reloading configuration")
+			if err := live.reload(ctx); err != nil {
+				logger.Error("Configuration reload failed, keeping the current configuration: %v", err)
+			}
+		}
+	}
 
 	logger.Info("Shutting down server...")
+	cancel()
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := p.Close(shutdownCtx); err != nil {
-		logger.Warn("Error closing provider: %v", err)
+	if metricsServer != nil {
+		_ = metricsServer.Shutdown(shutdownCtx)
 	}
-
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		return fmt.Errorf("server shutdown failed: %w", err)
 	}
+	live.close(shutdownCtx)
+	stopNotifications(shutdownCtx, dispatcher)
 
 	logger.Info("Server stopped")
 	return nil
 }
+
+// routes returns the HTTP handler of a configuration. It is rebuilt on
+// every reload, so that credentials, ACLs and zones are swapped at once.
+func (l *liveServer) routes(config *Config) http.Handler {
+	upd := l.upd
+	authMiddleware := auth.Middleware(auth.Config{
+		Mode:     config.AuthMode,
+		Username: config.Username,
+		Password: config.Password,
+		Users:    config.Users,
+		OnFailure: func(r *http.Request) {
+			metrics.AuthFailures.Inc()
+		},
+	})
+
+	mux := http.NewServeMux()
+
+	// Prometheus metrics with their own credentials
+	if config.MetricsListenAddr == "" && config.MetricsUsername != "" {
+		mux.Handle("/metrics", metricsHandler(config))
+	}
+
+	handlerConfig := handler.Config{
+		DefaultTTL:     config.DefaultTTL,
+		Updater:        upd,
+		WaitTimeout:    config.WaitTimeout,
+		Zones:          config.Zones,
+		TrustedProxies: config.TrustedProxies,
+	}
+	if l.bridge != nil {
+		handlerConfig.OnResult = l.bridge.Result
+	}
+	dyndnsHandler := handler.NewDynDNSHandler(handlerConfig)
+
+	if l.reconciler != nil {
+		// Drift events (auth required)
+		mux.Handle("/drift", authMiddleware(l.reconciler))
+	}
+
+	// Health check endpoint (no auth required)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("OK\n"))
+	})
+	// Readiness endpoint checking the providers (no auth required)
+	mux.Handle("/ready", l.readiness)
+	// JSON management API (auth required)
+	mux.Handle(api.Prefix+"/", authMiddleware(api.New(api.Config{
+		Updater:  upd,
+		Health:   l.readiness,
+		AuditLog: config.AuditLog,
+		Zones:    config.Zones,
+	})))
+	// Status UI (auth required; through Home Assistant ingress at the root)
+	ui := web.New(web.Config{
+		Updater:  upd,
+		Health:   l.readiness,
+		AuditLog: config.AuditLog,
+		Version:  Version,
+		Domain:   config.Domain,
+		Zones:    config.Zones,
+		Ingress:  config.HomeAssistantIngress,
+		Prefix:   "/ui",
+		Update: func(ctx context.Context, hostname, client, user string) string {
+			return forceUpdate(ctx, upd, config, hostname, client, user)
+		},
+	})
+	mux.Handle("/ui", http.RedirectHandler("/ui/", http.StatusMovedPermanently))
+	mux.Handle("/ui/", authMiddleware(http.StripPrefix("/ui", ui)))
+	// DynDNS standard format: /nic/update?hostname=...
+	mux.Handle("/nic/update", authMiddleware(dyndnsHandler))
+	// DynDNS UniFi format: /hostname
+	// Use {hostname...} to match any path (wildcard in Go 1.22+)
+	mux.Handle("/{hostname...}", authMiddleware(dyndnsHandler))
+
+	return web.Ingress(ui, mux)
+}
@@ -2,53 +2,119 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/markussiebert/homeddns/internal/logger"
-	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/updater"
 )
 
-func RunUpdate(hostname, recordType string, config *Config) error {
-	publicIP, err := getPublicIP()
+// notifyDrainTimeout bounds how long the update command waits for
+// notifications before exiting
+const notifyDrainTimeout = 30 * time.Second
+
+// RunUpdate publishes the current public IP for hostname, which must be in
+// a configured zone. If wait is set, it waits up to that long for the record
+// to be served.
+func RunUpdate(hostname, recordType string, wait time.Duration, config *Config) error {
+	// Hostnames are split at the longest configured zone like DynDNS updates
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	domain, ok := updater.ZoneOf(configZones(config), hostname)
+	if !ok {
+		return fmt.Errorf("%s is not in a configured zone", hostname)
+	}
+
+	publicIP, err := getPublicIP(config.PublicIPURLs)
 	if err != nil {
 		return fmt.Errorf("failed to get public IP: %w", err)
 	}
 
 	logger.Info("Current public IP: %s", publicIP)
 
-	prov, ok := provider.GetFactory(config.Provider)
-	if !ok {
-		return fmt.Errorf("provider factory not found: %s", config.Provider)
-	}
-
-	// Provider handles its own credential loading
-	p, err := prov(context.Background(), nil)
+	ctx := context.Background()
+	upd, providers, err := newUpdater(ctx, config)
 	if err != nil {
-		return fmt.Errorf("failed to create provider: %w", err)
+		return err
 	}
+	defer closeProviders(ctx, providers)
+
+	dispatcher := startNotifications(upd, config)
+	defer func() {
+		ctx, cancel := context.WithTimeout(ctx, notifyDrainTimeout)
+		defer cancel()
+		stopNotifications(ctx, dispatcher)
+	}()
 
 	logger.Debug("Updating DNS record: hostname=%s, type=%s, ip=%s, ttl=%d", hostname, recordType, publicIP, config.DefaultTTL)
 
-	record := &provider.DNSRecord{
-		Name:  hostname,
-		Type:  recordType,
-		Value: publicIP,
-		TTL:   config.DefaultTTL,
+	results := upd.Update(ctx, updater.Request{
+		Hostname: hostname,
+		Domain:   domain,
+		Address:  publicIP,
+		Client:   getLocalIP(),
+		Type:     recordType,
+		User:     "cli",
+		Wait:     wait,
+	})
+	if len(results) == 0 {
+		return fmt.Errorf("no %s address to publish for %s", recordType, hostname)
 	}
 
-	if err := p.UpdateRecord(context.Background(), config.Domain, record); err != nil {
-		return fmt.Errorf("failed to update DNS record: %w", err)
+	var failed []string
+	for _, result := range results {
+		if result.Err != nil {
+			logger.Error("View %s (%s): %v", result.View, result.Provider, result.Err)
+			failed = append(failed, result.View)
+			continue
+		}
+		logger.Info("Successfully updated %s record for %s to %s (view: %s)", result.Record.Type, hostname, result.Record.Value, result.View)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to update DNS record in views: %s", strings.Join(failed, ", "))
 	}
-
-	logger.Info("Successfully updated %s record for %s to %s", recordType, hostname, publicIP)
 	return nil
 }
 
-func getPublicIP() (string, error) {
-	resp, err := http.Get("https://api.ipify.org")
+// getLocalIP returns the address of the interface used for outbound traffic.
+// No packets are sent; dialing UDP only selects a route.
+func getLocalIP() string {
+	conn, err := net.Dial("udp", "192.0.2.1:53")
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
+
+// defaultPublicIPURL answers with the public IP of the caller
+const defaultPublicIPURL = "https://api.ipify.org"
+
+// getPublicIP asks the URLs for the public IP in order and returns the
+// first valid answer
+func getPublicIP(urls []string) (string, error) {
+	var errs []error
+	for _, u := range urls {
+		ip, err := fetchPublicIP(u)
+		if err == nil {
+			return ip, nil
+		}
+		logger.Debug("Public IP lookup via %s failed: %v", u, err)
+		errs = append(errs, fmt.Errorf("%s: %w", u, err))
+	}
+	return "", errors.Join(errs...)
+}
+
+// fetchPublicIP asks one URL for the public IP
+func fetchPublicIP(u string) (string, error) {
+	resp, err := http.Get(u)
 	if err != nil {
 		return "", fmt.Errorf("HTTP request failed: %w", err)
 	}
@@ -63,7 +129,7 @@ func getPublicIP() (string, error) {
 		return "", fmt.Errorf("failed to read response body: %w", err)
 	}
 
-	ip := string(body)
+	ip := strings.TrimSpace(string(body))
 	if net.ParseIP(ip) == nil {
 		return "", fmt.Errorf("invalid IP address received: %s", ip)
 	}
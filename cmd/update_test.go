@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestRunUpdate_OtherZone(t *testing.T) {
+	config := &Config{Domain: "example.com", Zones: []string{"example.com", "example.org"}}
+	err := RunUpdate("NAS.example.net.", "", 0, config)
+	assert.EqualError(t, err, "nas.example.net is not in a configured zone")
+}
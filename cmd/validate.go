@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/markussiebert/homeddns/internal/provider"
+)
+
+// ConfigProblem is an invalid or missing setting
+type ConfigProblem struct {
+	// Setting is the environment variable of the setting, if known
+	Setting string
+	// Source is where the setting came from: "environment", "Home Assistant
+	// options", "config file <path>" or "not set"
+	Source string
+	Err    error
+}
+
+// ConfigError reports all problems found while loading the configuration
+type ConfigError struct {
+	Problems []ConfigProblem
+}
+
+func (e *ConfigError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		messages[i] = problem.Err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// settingError is an error in the value of a setting
+type settingError struct {
+	setting string
+	err     error
+}
+
+func (e *settingError) Error() string { return e.err.Error() }
+func (e *settingError) Unwrap() error { return e.err }
+
+// invalidSetting returns an error in the value of setting
+func invalidSetting(setting, format string, args ...any) error {
+	return &settingError{setting: setting, err: fmt.Errorf(format, args...)}
+}
+
+// checkProvider reports a provider name without a registered factory
+func checkProvider(setting, name string) error {
+	if _, ok := provider.GetFactory(name); !ok {
+		return invalidSetting(setting, "unknown %s %q (available: %s)", setting, name, strings.Join(provider.List(), ", "))
+	}
+	return nil
+}
+
+// configProblems collects the problems of a configuration
+type configProblems struct {
+	file       string
+	fileEnv    provider.Settings
+	optionsEnv provider.Settings
+	problems   []ConfigProblem
+}
+
+// add records err. Errors joined with errors.Join are recorded one by one.
+func (p *configProblems) add(err error) {
+	if err == nil {
+		return
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			p.add(err)
+		}
+		return
+	}
+	problem := ConfigProblem{Err: err}
+	var setting *settingError
+	if errors.As(err, &setting) {
+		problem.Setting = setting.setting
+		problem.Source = p.source(setting.setting)
+	}
+	p.problems = append(p.problems, problem)
+}
+
+// addFile records an error of the configuration file itself
+func (p *configProblems) addFile(err error) {
+	p.problems = append(p.problems, ConfigProblem{Source: "config file " + p.file, Err: err})
+}
+
+// addHomeAssistant records an error of the Home Assistant options
+func (p *configProblems) addHomeAssistant(err error) {
+	p.problems = append(p.problems, ConfigProblem{Source: "Home Assistant options", Err: err})
+}
+
+// source returns where setting was set. Environment variables override the
+// Home Assistant options, which override the configuration file.
+func (p *configProblems) source(setting string) string {
+	key := strings.ToLower(setting)
+	switch {
+	case os.Getenv(setting) != "" || os.Getenv(setting+"_FILE") != "":
+		return "environment"
+	case p.optionsEnv[key] != "":
+		return "Home Assistant options"
+	case p.fileEnv[key] != "":
+		return "config file " + p.file
+	}
+	return "not set"
+}
+
+// err returns a *ConfigError if there are problems
+func (p *configProblems) err() error {
+	if len(p.problems) == 0 {
+		return nil
+	}
+	return &ConfigError{Problems: p.problems}
+}
+
+// validateConfig loads the configuration and creates its providers without
+// connecting to them, returning all problems found
+func validateConfig(ctx context.Context, path string) (*Config, []ConfigProblem) {
+	config, problems := loadConfig(path)
+
+	// Providers check their own settings when they are created
+	for _, view := range []struct {
+		setting  string
+		name     string
+		settings provider.Settings
+	}{
+		{"DNS_PROVIDER", config.Provider, config.ProviderSettings},
+		{"LAN_DNS_PROVIDER", config.LANProvider, config.LANProviderSettings},
+	} {
+		factory, ok := provider.GetFactory(view.name)
+		if !ok {
+			continue
+		}
+		p, err := factory(ctx, view.settings)
+		if err != nil {
+			problems.add(&settingError{setting: view.setting, err: err})
+			continue
+		}
+		_ = p.Close(ctx)
+	}
+	return config, problems.problems
+}
+
+// RunValidate loads the configuration and reports all problems with the
+// source of the setting. It returns an error if there are problems.
+func RunValidate(w io.Writer, path string) error {
+	config, problems := validateConfig(context.Background(), path)
+	if len(problems) == 0 {
+		fmt.Fprintf(w, "Configuration is valid: provider %s, domain %s, port %d\n", config.Provider, config.Domain, config.Port)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tSOURCE\tPROBLEM")
+	for _, problem := range problems {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", orDash(problem.Setting), orDash(problem.Source), problem.Err)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	return fmt.Errorf("configuration has %d problem(s)", len(problems))
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestValidateConfig_ReportsAllProblems(t *testing.T) {
+	path := writeFile(t, "homeddns.yaml", "server:\n  ttl: soon\n  port: 9000\n")
+	t.Setenv("PORT", "eighty")
+	t.Setenv("DNS_PROVIDER", "bind")
+	t.Setenv("NOTIFY_GOTIFY_URL", "ftp://gotify")
+
+	_, problems := validateConfig(context.Background(), path)
+	type problem struct{ setting, source string }
+	var got []problem
+	for _, p := range problems {
+		got = append(got, problem{p.Setting, p.Source})
+	}
+	assert.Equal(t, []problem{
+		{"PORT", "environment"},
+		{"AUTH_USERNAME", "not set"},
+		{"AUTH_PASSWORD", "not set"},
+		{"DNS_PROVIDER", "environment"},
+		{"DOMAIN", "not set"},
+		{"DNS_TTL", "config file " + path},
+		{"NOTIFY_GOTIFY_URL", "environment"},
+		{"NOTIFY_GOTIFY_TOKEN", "not set"},
+	}, got)
+
+	// LoadConfig fails with all of them
+	_, err := LoadConfig(path)
+	var configErr *ConfigError
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, len(problems), len(configErr.Problems))
+}
+
+func TestValidateConfig_ProviderSettings(t *testing.T) {
+	t.Setenv("AUTH_USERNAME", "admin")
+	t.Setenv("AUTH_PASSWORD", "secret")
+	t.Setenv("DOMAIN", "example.com")
+	t.Setenv("DNS_PROVIDER", "netcup_ccp")
+	t.Setenv("NETCUP_CUSTOMER_NUMBER", "12345")
+	// Keep a credentials file of the user from completing them
+	t.Setenv("HOME", t.TempDir())
+
+	_, problems := validateConfig(context.Background(), "")
+	assert.Equal(t, 1, len(problems))
+	assert.Equal(t, "DNS_PROVIDER", problems[0].Setting)
+	assert.Contains(t, problems[0].Err.Error(), "netcup credentials not found")
+}
+
+func TestRunValidate(t *testing.T) {
+	t.Setenv("AUTH_USERNAME", "admin")
+	t.Setenv("AUTH_PASSWORD", "secret")
+	t.Setenv("DOMAIN", "example.com")
+	// The name used by older releases of the Home Assistant add-on
+	t.Setenv("DNS_PROVIDER", "route53")
+	t.Setenv("AWS_REGION", "eu-central-1")
+
+	var out bytes.Buffer
+	assert.NoError(t, RunValidate(&out, ""))
+	assert.Equal(t, "Configuration is valid: provider route53, domain example.com, port 8053\n", out.String())
+
+	t.Setenv("DNS_TTL", "long")
+	out.Reset()
+	assert.EqualError(t, RunValidate(&out, ""), "configuration has 1 problem(s)")
+	assert.Contains(t, out.String(), "DNS_TTL  environment  invalid DNS_TTL")
+}
+
+func TestValidateConfig_AuthMode(t *testing.T) {
+	t.Setenv("DOMAIN", "example.com")
+	t.Setenv("DNS_PROVIDER", "route53")
+	t.Setenv("AUTH_MODE", "cert")
+
+	// Client certificates need TLS and a CA, but no password
+	_, problems := validateConfig(context.Background(), "")
+	var settings []string
+	for _, p := range problems {
+		settings = append(settings, p.Setting)
+	}
+	assert.Equal(t, []string{"AUTH_MODE", "CLIENT_CA_FILE"}, settings)
+
+	t.Setenv("AUTH_MODE", "mtls")
+	_, problems = validateConfig(context.Background(), "")
+	assert.Equal(t, "AUTH_MODE", problems[0].Setting)
+	assert.Contains(t, problems[0].Err.Error(), "cert_or_basic")
+}
+
+func TestValidateConfig_TrustedProxies(t *testing.T) {
+	t.Setenv("AUTH_USERNAME", "admin")
+	t.Setenv("AUTH_PASSWORD", "secret")
+	t.Setenv("DOMAIN", "example.com")
+	t.Setenv("DNS_PROVIDER", "route53")
+	t.Setenv("TRUSTED_PROXIES", "172.30.32.2, 10.0.0.0/8,fd00::1")
+
+	config, problems := validateConfig(context.Background(), "")
+	assert.Equal(t, 0, len(problems))
+	var proxies []string
+	for _, network := range config.TrustedProxies {
+		proxies = append(proxies, network.String())
+	}
+	assert.Equal(t, []string{"172.30.32.2/32", "10.0.0.0/8", "fd00::1/128"}, proxies)
+
+	t.Setenv("TRUSTED_PROXIES", "proxy.lan")
+	_, problems = validateConfig(context.Background(), "")
+	assert.Equal(t, 1, len(problems))
+	assert.Equal(t, "TRUSTED_PROXIES", problems[0].Setting)
+}
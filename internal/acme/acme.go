@@ -0,0 +1,411 @@
+// Package acme obtains and renews the certificate of the HTTPS listener from
+// an ACME CA such as Let's Encrypt. It answers the DNS-01 challenge with a
+// TXT record published through the configured DNS provider, so homeddns
+// needs no open port 80 and can get wildcard certificates.
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/dnsclient"
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"golang.org/x/crypto/acme"
+)
+
+// LetsEncrypt is the directory URL of the Let's Encrypt production CA
+const LetsEncrypt = acme.LetsEncryptURL
+
+// DefaultRenewBefore is how long before expiry a certificate is renewed
+const DefaultRenewBefore = 30 * 24 * time.Hour
+
+// DefaultCheckInterval is how often Run checks whether to renew
+const DefaultCheckInterval = 12 * time.Hour
+
+// challengeTTL is the TTL of the challenge TXT records
+const challengeTTL = 60
+
+// Files in the directory of a Manager
+const (
+	acmeDir        = ".homeddns/acme"
+	accountKeyFile = "account.key"
+	certFile       = "fullchain.pem"
+	keyFile        = "privkey.pem"
+)
+
+// Config configures a Manager
+type Config struct {
+	// DirectoryURL is the ACME directory of the CA (default LetsEncrypt)
+	DirectoryURL string
+	// Email is the contact of the ACME account (optional)
+	Email string
+	// Domains are the names of the certificate, e.g. example.com and
+	// *.example.com
+	Domains []string
+	// Zones are the zones of the provider; challenge records are created in
+	// the longest zone that contains the name
+	Zones []string
+	// Dir stores the account key, the certificate and its key
+	Dir string
+	// RenewBefore is how long before expiry the certificate is renewed
+	// (default DefaultRenewBefore)
+	RenewBefore time.Duration
+	// HTTPClient talks to the CA, e.g. with a custom root CA for a private
+	// CA (default http.DefaultClient)
+	HTTPClient *http.Client
+	// DNS waits for the challenge records at the authoritative nameservers
+	// of providers that cannot tell when an update is served
+	DNS *dnsclient.Client
+	// PropagationTimeout bounds the wait for each challenge record
+	// (default 5 minutes)
+	PropagationTimeout time.Duration
+}
+
+// Manager obtains and renews a certificate, storing it in Config.Dir
+type Manager struct {
+	config       Config
+	pollInterval time.Duration
+
+	mu       sync.Mutex
+	provider provider.Provider
+}
+
+// New returns a manager publishing challenge records through p
+func New(config Config, p provider.Provider) *Manager {
+	if config.DirectoryURL == "" {
+		config.DirectoryURL = LetsEncrypt
+	}
+	if config.RenewBefore <= 0 {
+		config.RenewBefore = DefaultRenewBefore
+	}
+	if config.DNS == nil {
+		config.DNS = &dnsclient.Client{}
+	}
+	if config.PropagationTimeout <= 0 {
+		config.PropagationTimeout = 5 * time.Minute
+	}
+	return &Manager{config: config, pollInterval: 5 * time.Second, provider: p}
+}
+
+// SetProvider replaces the provider, e.g. after the configuration was
+// reloaded
+func (m *Manager) SetProvider(p provider.Provider) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.provider = p
+}
+
+// CertFile returns the file of the certificate chain
+func (m *Manager) CertFile() string {
+	return CertFile(m.config.Dir)
+}
+
+// KeyFile returns the file of the certificate's private key
+func (m *Manager) KeyFile() string {
+	return KeyFile(m.config.Dir)
+}
+
+// DefaultDir returns ~/.homeddns/acme
+func DefaultDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "acme"
+	}
+	return filepath.Join(homeDir, acmeDir)
+}
+
+// CertFile returns the file of the certificate chain in dir
+func CertFile(dir string) string {
+	return filepath.Join(dir, certFile)
+}
+
+// KeyFile returns the file of the certificate's private key in dir
+func KeyFile(dir string) string {
+	return filepath.Join(dir, keyFile)
+}
+
+// RenewalDue returns why the certificate must be obtained, or "" if the
+// stored one is valid for the domains beyond RenewBefore
+func (m *Manager) RenewalDue(now time.Time) string {
+	cert, err := tls.LoadX509KeyPair(m.CertFile(), m.KeyFile())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "no certificate"
+		}
+		return err.Error()
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err.Error()
+	}
+	for _, domain := range m.config.Domains {
+		if !slices.Contains(leaf.DNSNames, domain) {
+			return domain + " is not in the certificate"
+		}
+	}
+	if now.Add(m.config.RenewBefore).After(leaf.NotAfter) {
+		return "expires on " + leaf.NotAfter.Format(time.DateOnly)
+	}
+	return ""
+}
+
+// Run checks every interval whether the certificate is due for renewal and
+// renews it, calling renewed afterwards, until ctx is done
+func (m *Manager) Run(ctx context.Context, interval time.Duration, renewed func()) {
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reason := m.RenewalDue(time.Now())
+		if reason == "" {
+			continue
+		}
+		logger.Info("Renewing certificate for %s: %s", strings.Join(m.config.Domains, ", "), reason)
+		if err := m.Obtain(ctx); err != nil {
+			logger.Error("Certificate renewal failed, retrying in %v: %v", interval, err)
+			continue
+		}
+		if renewed != nil {
+			renewed()
+		}
+	}
+}
+
+// Obtain gets a new certificate for the domains and stores it
+func (m *Manager) Obtain(ctx context.Context) error {
+	if len(m.config.Domains) == 0 {
+		return errors.New("no domains for the certificate")
+	}
+	m.mu.Lock()
+	p := m.provider
+	m.mu.Unlock()
+
+	accountKey, err := m.accountKey()
+	if err != nil {
+		return err
+	}
+	client := &acme.Client{
+		Key:          accountKey,
+		HTTPClient:   m.config.HTTPClient,
+		DirectoryURL: m.config.DirectoryURL,
+		UserAgent:    "homeddns",
+	}
+	account := &acme.Account{}
+	if m.config.Email != "" {
+		account.Contact = []string{"mailto:" + m.config.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("register ACME account: %w", err)
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(m.config.Domains...))
+	if err != nil {
+		return fmt.Errorf("create order: %w", err)
+	}
+	// Authorizations are solved one by one: the challenges of example.com
+	// and *.example.com share a record name, and not every provider can
+	// hold several values of a record
+	for _, url := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, p, url); err != nil {
+			return err
+		}
+	}
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return fmt.Errorf("wait for order: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.config.Domains[0]},
+		DNSNames: m.config.Domains,
+	}, key)
+	if err != nil {
+		return err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("finalize order: %w", err)
+	}
+	if err := m.store(chain, key); err != nil {
+		return err
+	}
+	logger.Info("Obtained certificate for %s", strings.Join(m.config.Domains, ", "))
+	return nil
+}
+
+// authorize solves the DNS-01 challenge of an authorization
+func (m *Manager) authorize(ctx context.Context, client *acme.Client, p provider.Provider, url string) error {
+	authz, err := client.GetAuthorization(ctx, url)
+	if err != nil {
+		return fmt.Errorf("get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("%s: CA offers no dns-01 challenge", authz.Identifier.Value)
+	}
+	value, err := client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return err
+	}
+
+	record := &provider.DNSRecord{
+		Name:  "_acme-challenge." + authz.Identifier.Value,
+		Type:  "TXT",
+		Value: value,
+		TTL:   challengeTTL,
+	}
+	zone, err := m.zone(record.Name)
+	if err != nil {
+		return err
+	}
+	logger.Info("Publishing ACME challenge %s in zone %s at %s", record.Name, zone, p.Name())
+	if err := p.UpdateRecord(ctx, zone, record); err != nil {
+		return fmt.Errorf("publish challenge record %s: %w", record.Name, err)
+	}
+	defer func() {
+		if err := provider.DeleteRecord(context.WithoutCancel(ctx), p, zone, record); err != nil {
+			logger.Warn("Cannot remove challenge record %s: %v", record.Name, err)
+		}
+	}()
+	if err := m.wait(ctx, p, zone, record); err != nil {
+		return fmt.Errorf("wait for challenge record %s: %w", record.Name, err)
+	}
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("accept challenge: %w", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorize %s: %w", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+// wait blocks until the record is served, using the provider's own status
+// if it has one and the zone's authoritative nameservers otherwise
+func (m *Manager) wait(ctx context.Context, p provider.Provider, zone string, record *provider.DNSRecord) error {
+	ctx, cancel := context.WithTimeout(ctx, m.config.PropagationTimeout)
+	defer cancel()
+	if waiter, ok := provider.As[provider.PropagationWaiter](p); ok {
+		return waiter.WaitForPropagation(ctx, zone, record)
+	}
+	return m.config.DNS.WaitForValue(ctx, zone, record.Name, record.Type, record.Value, m.pollInterval)
+}
+
+// zone returns the longest configured zone that contains name
+func (m *Manager) zone(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	best := ""
+	for _, zone := range m.config.Zones {
+		zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+		if (name == zone || strings.HasSuffix(name, "."+zone)) && len(zone) > len(best) {
+			best = zone
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("%s is in none of the zones %s", name, strings.Join(m.config.Zones, ", "))
+	}
+	return best, nil
+}
+
+// accountKey loads the account key, creating it on first use
+func (m *Manager) accountKey() (crypto.Signer, error) {
+	path := filepath.Join(m.config.Dir, accountKeyFile)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s: no PEM data", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, err
+	}
+	logger.Info("Created ACME account key %s", path)
+	return key, nil
+}
+
+// store writes the certificate chain and its key. The key is written first,
+// so that a reader never sees the new certificate with the old key for long.
+func (m *Manager) store(chain [][]byte, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	var certPEM []byte
+	for _, cert := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})...)
+	}
+	if err := writeFileAtomic(m.KeyFile(), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return err
+	}
+	return writeFileAtomic(m.CertFile(), certPEM)
+}
+
+// writeFile replaces path atomically with a file readable only by the owner
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
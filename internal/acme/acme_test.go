@@ -0,0 +1,178 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/dnsclient"
+	"github.com/markussiebert/homeddns/internal/provider"
+)
+
+// storeCert stores a self-signed certificate for names in the directory of m
+func storeCert(t *testing.T, m *Manager, notAfter time.Time, names ...string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	assert.NoError(t, m.store([][]byte{der}, key))
+}
+
+func TestManager_RenewalDue(t *testing.T) {
+	now := time.Now()
+	m := New(Config{Dir: t.TempDir(), Domains: []string{"example.com", "*.example.com"}}, nil)
+	assert.Equal(t, "no certificate", m.RenewalDue(now))
+
+	storeCert(t, m, now.Add(90*24*time.Hour), "example.com", "*.example.com")
+	assert.Equal(t, "", m.RenewalDue(now))
+	assert.Contains(t, m.RenewalDue(now.Add(70*24*time.Hour)), "expires on")
+
+	storeCert(t, m, now.Add(90*24*time.Hour), "example.com")
+	assert.Equal(t, "*.example.com is not in the certificate", m.RenewalDue(now))
+
+	// The files are readable by the listener
+	_, err := tls.LoadX509KeyPair(m.CertFile(), m.KeyFile())
+	assert.NoError(t, err)
+	info, err := os.Stat(m.KeyFile())
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestManager_Zone(t *testing.T) {
+	m := New(Config{Zones: []string{"example.com", "home.example.com."}}, nil)
+	for name, want := range map[string]string{
+		"_acme-challenge.example.com":      "example.com",
+		"_acme-challenge.nas.example.com":  "example.com",
+		"_acme-challenge.home.example.com": "home.example.com",
+		"_acme-challenge.EXAMPLE.com.":     "example.com",
+	} {
+		zone, err := m.zone(name)
+		assert.NoError(t, err)
+		assert.Equal(t, want, zone, name)
+	}
+	_, err := m.zone("_acme-challenge.example.org")
+	assert.Error(t, err)
+}
+
+func TestManager_AccountKey(t *testing.T) {
+	m := New(Config{Dir: t.TempDir()}, nil)
+	created, err := m.accountKey()
+	assert.NoError(t, err)
+	loaded, err := m.accountKey()
+	assert.NoError(t, err)
+	assert.True(t, created.Public().(*ecdsa.PublicKey).Equal(loaded.Public()))
+}
+
+// challtestsrv publishes TXT records through the management API of
+// pebble-challtestsrv
+type challtestsrv struct {
+	url string
+}
+
+func (c *challtestsrv) Name() string { return "challtestsrv" }
+
+func (c *challtestsrv) GetRecord(ctx context.Context, domain, hostname, recordType string) (*provider.DNSRecord, error) {
+	return nil, provider.ErrNotSupported
+}
+
+func (c *challtestsrv) UpdateRecord(ctx context.Context, domain string, record *provider.DNSRecord) error {
+	return c.post(ctx, "/set-txt", map[string]string{"host": record.Name + ".", "value": record.Value})
+}
+
+func (c *challtestsrv) DeleteRecord(ctx context.Context, domain string, record *provider.DNSRecord) error {
+	return c.post(ctx, "/clear-txt", map[string]string{"host": record.Name + "."})
+}
+
+func (c *challtestsrv) Close(ctx context.Context) error { return nil }
+
+func (c *challtestsrv) post(ctx context.Context, path string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	return nil
+}
+
+// TestManager_Obtain_Pebble obtains a certificate from a local Pebble ACME
+// server. Start pebble-challtestsrv and Pebble with its DNS server, e.g.
+//
+//	pebble-challtestsrv -dns01 :8053 -management :8055
+//	PEBBLE_VA_NOSLEEP=1 pebble -config test/config/pebble-config.json -dnsserver 127.0.0.1:8053
+//
+// and set PEBBLE_DIRECTORY=https://localhost:14000/dir. PEBBLE_CA_FILE
+// (test/certs/pebble.minica.pem), PEBBLE_CHALLTESTSRV and PEBBLE_DNS
+// override the defaults.
+func TestManager_Obtain_Pebble(t *testing.T) {
+	directory := os.Getenv("PEBBLE_DIRECTORY")
+	if directory == "" {
+		t.Skip("PEBBLE_DIRECTORY not set")
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: true} // Pebble uses its own test CA
+	if caFile := os.Getenv("PEBBLE_CA_FILE"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		assert.NoError(t, err)
+		pool := x509.NewCertPool()
+		assert.True(t, pool.AppendCertsFromPEM(pem))
+		tlsConfig = &tls.Config{RootCAs: pool}
+	}
+	challtestsrvURL := os.Getenv("PEBBLE_CHALLTESTSRV")
+	if challtestsrvURL == "" {
+		challtestsrvURL = "http://localhost:8055"
+	}
+	dnsServer := os.Getenv("PEBBLE_DNS")
+	if dnsServer == "" {
+		dnsServer = "127.0.0.1:8053"
+	}
+
+	m := New(Config{
+		DirectoryURL: directory,
+		Email:        "admin@example.com",
+		Domains:      []string{"example.com", "*.example.com"},
+		Zones:        []string{"example.com"},
+		Dir:          t.TempDir(),
+		RenewBefore:  time.Hour,
+		HTTPClient:   &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+		DNS:          &dnsclient.Client{Nameservers: []string{dnsServer}},
+	}, &challtestsrv{url: challtestsrvURL})
+	m.pollInterval = 100 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	assert.NoError(t, m.Obtain(ctx))
+	assert.Equal(t, "", m.RenewalDue(time.Now()))
+
+	// The account is reused for renewals
+	assert.NoError(t, m.Obtain(ctx))
+	assert.Equal(t, "", m.RenewalDue(time.Now()))
+}
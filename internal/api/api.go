@@ -0,0 +1,494 @@
+// Package api serves the JSON management API below /api/v1. It is
+// described by the OpenAPI document served at /api/v1/openapi.json.
+package api
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/audit"
+	"github.com/markussiebert/homeddns/internal/auth"
+	"github.com/markussiebert/homeddns/internal/health"
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/updater"
+)
+
+// Prefix is the path below which the API is served
+const Prefix = "/api/v1"
+
+//go:embed openapi.json
+var openAPI []byte
+
+// Error codes of structured errors
+const (
+	CodeBadRequest    = "bad_request"
+	CodeForbidden     = "forbidden"
+	CodeNotFound      = "not_found"
+	CodeNotSupported  = "not_supported"
+	CodeProviderError = "provider_error"
+	CodeInternal      = "internal_error"
+	CodeUnsupported   = "unsupported_media_type"
+)
+
+// Config configures the API
+type Config struct {
+	Updater *updater.Updater
+	// Health reports the provider status; if nil, all providers are checked
+	// on every request
+	Health *health.Checker
+	// AuditLog is the path of the audit log behind the history
+	AuditLog string
+	// Zones, if set, are the only zones that can be changed, as for DynDNS
+	// updates
+	Zones []string
+}
+
+// Record is a DNS record
+type Record struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	TTL      int    `json:"ttl,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+// RecordList is the response of a zone listing
+type RecordList struct {
+	Zone    string   `json:"zone"`
+	View    string   `json:"view"`
+	Records []Record `json:"records"`
+}
+
+// RecordUpdate is the body of a PUT request
+type RecordUpdate struct {
+	Value string `json:"value"`
+}
+
+// ViewResult is the outcome of a change in one view
+type ViewResult struct {
+	View     string `json:"view"`
+	Provider string `json:"provider"`
+	Type     string `json:"type"`
+	Value    string `json:"value,omitempty"`
+	Changed  bool   `json:"changed"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ChangeResponse is the response of a PUT or DELETE request
+type ChangeResponse struct {
+	Name    string       `json:"name"`
+	Type    string       `json:"type"`
+	Results []ViewResult `json:"results"`
+}
+
+// History is the response of a history request, oldest entry first
+type History struct {
+	Entries []audit.Entry `json:"entries"`
+}
+
+// Error is the body of every error response
+type Error struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes an error
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Handler serves the API
+type Handler struct {
+	config Config
+	mux    *http.ServeMux
+}
+
+// New creates the API handler. It expects full request paths, i.e. it is
+// mounted at Prefix + "/" without stripping.
+func New(config Config) *Handler {
+	if config.Health == nil {
+		var targets []health.Target
+		for _, view := range config.Updater.Views() {
+			targets = append(targets, health.Target{View: view.Name, Provider: view.Provider})
+		}
+		config.Health = health.New(0, targets...)
+	}
+
+	h := &Handler{config: config, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET "+Prefix+"/openapi.json", h.openAPI)
+	h.mux.HandleFunc("GET "+Prefix+"/providers", h.providers)
+	h.mux.HandleFunc("GET "+Prefix+"/history", h.history)
+	h.mux.HandleFunc("GET "+Prefix+"/zones/{zone}/records", h.listRecords)
+	h.mux.HandleFunc("GET "+Prefix+"/zones/{zone}/records/{name}/{type}", h.getRecord)
+	h.mux.HandleFunc("PUT "+Prefix+"/zones/{zone}/records/{name}/{type}", h.putRecord)
+	h.mux.HandleFunc("DELETE "+Prefix+"/zones/{zone}/records/{name}/{type}", h.deleteRecord)
+	h.mux.HandleFunc(Prefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "no such endpoint: "+r.Method+" "+r.URL.Path)
+	})
+	return h
+}
+
+// ServeHTTP handles HTTP requests
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// openAPI serves the OpenAPI document
+func (h *Handler) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPI)
+}
+
+// providers reports the health of the provider of every view
+func (h *Handler) providers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.config.Health.Check(r.Context()))
+}
+
+// history returns audit log entries, filtered by hostname and time and
+// limited to the hostnames the user may change
+func (h *Handler) history(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := audit.Filter{Hostname: strings.TrimSuffix(query.Get("hostname"), ".")}
+	for _, param := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeBadRequest, param.name+" must be an RFC 3339 time")
+			return
+		}
+		*param.t = t
+	}
+	limit := 100
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, CodeBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = n
+	}
+
+	entries, err := audit.Read(h.config.AuditLog, filter)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to read audit log: %v", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "failed to read the audit log")
+		return
+	}
+	// Users limited to some hostnames only see their entries
+	allowed := entries[:0]
+	for _, entry := range entries {
+		if auth.HostAllowed(r.Context(), entry.Hostname) {
+			allowed = append(allowed, entry)
+		}
+	}
+	entries = allowed
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	writeJSON(w, http.StatusOK, History{Entries: entries})
+}
+
+// listRecords lists the records of a zone the user may change, if the
+// provider supports it and the zone is configured
+func (h *Handler) listRecords(w http.ResponseWriter, r *http.Request) {
+	zone := normalizeName(r.PathValue("zone"))
+	if _, ok := h.zone(w, zone, zone); !ok {
+		return
+	}
+	view, ok := h.view(w, r)
+	if !ok {
+		return
+	}
+	lister, ok := provider.As[provider.RecordLister](view.Provider)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, CodeNotSupported, view.Provider.Name()+" cannot list records")
+		return
+	}
+
+	records, err := lister.ListRecords(r.Context(), zone)
+	if err != nil {
+		h.providerError(w, r, err)
+		return
+	}
+	list := RecordList{Zone: zone, View: view.Name, Records: make([]Record, 0, len(records))}
+	for _, record := range records {
+		if auth.HostAllowed(r.Context(), record.Name) {
+			list.Records = append(list.Records, toRecord(&record))
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// getRecord returns a record as served by the provider
+func (h *Handler) getRecord(w http.ResponseWriter, r *http.Request) {
+	zone, name, recordType, ok := recordPath(w, r, false)
+	if !ok {
+		return
+	}
+	if !auth.HostAllowed(r.Context(), name) {
+		writeError(w, http.StatusForbidden, CodeForbidden, auth.UserFromContext(r.Context())+" may not read "+name)
+		return
+	}
+	if zone, ok = h.zone(w, zone, name); !ok {
+		return
+	}
+	view, ok := h.view(w, r)
+	if !ok {
+		return
+	}
+
+	record, err := view.Provider.GetRecord(r.Context(), zone, name, recordType)
+	if err != nil {
+		if errors.Is(err, provider.ErrNotFound) {
+			writeError(w, http.StatusNotFound, CodeNotFound, recordType+" record of "+name+" not found")
+			return
+		}
+		h.providerError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toRecord(record))
+}
+
+// putRecord publishes an address in every view, like a DynDNS update
+func (h *Handler) putRecord(w http.ResponseWriter, r *http.Request) {
+	zone, name, recordType, ok := recordPath(w, r, true)
+	if !ok {
+		return
+	}
+	if !auth.HostAllowed(r.Context(), name) {
+		writeError(w, http.StatusForbidden, CodeForbidden, auth.UserFromContext(r.Context())+" may not change "+name)
+		return
+	}
+	if zone, ok = h.zone(w, zone, name); !ok {
+		return
+	}
+	var body RecordUpdate
+	if !readJSON(w, r, &body) {
+		return
+	}
+	ip := net.ParseIP(body.Value)
+	if ip == nil || updater.RecordType(body.Value) != recordType {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "value must be an "+map[string]string{"A": "IPv4", "AAAA": "IPv6"}[recordType]+" address")
+		return
+	}
+
+	// The value is explicit, so the caller's address is not published in
+	// views that use the client address; those views are skipped
+	results := h.config.Updater.Update(r.Context(), updater.Request{
+		Hostname: name,
+		Domain:   zone,
+		Address:  ip.String(),
+		Type:     recordType,
+		User:     auth.UserFromContext(r.Context()),
+	})
+	h.writeResults(w, r, name, recordType, results)
+}
+
+// deleteRecord removes a record from every view
+func (h *Handler) deleteRecord(w http.ResponseWriter, r *http.Request) {
+	zone, name, recordType, ok := recordPath(w, r, true)
+	if !ok {
+		return
+	}
+	if !auth.HostAllowed(r.Context(), name) {
+		writeError(w, http.StatusForbidden, CodeForbidden, auth.UserFromContext(r.Context())+" may not change "+name)
+		return
+	}
+	if zone, ok = h.zone(w, zone, name); !ok {
+		return
+	}
+
+	results := h.config.Updater.Delete(r.Context(), updater.Request{
+		Hostname: name,
+		Domain:   zone,
+		Client:   remoteIP(r),
+		Type:     recordType,
+		User:     auth.UserFromContext(r.Context()),
+	})
+	h.writeResults(w, r, name, recordType, results)
+}
+
+// zone returns the configured zone of name, which is split at the longest
+// matching zone like a DynDNS update. Without configured zones the zone of
+// the path is used.
+func (h *Handler) zone(w http.ResponseWriter, zone, name string) (string, bool) {
+	if len(h.config.Zones) == 0 {
+		return zone, true
+	}
+	zone, ok := updater.ZoneOf(h.config.Zones, name)
+	if !ok {
+		writeError(w, http.StatusForbidden, CodeForbidden, name+" is not in a configured zone")
+	}
+	return zone, ok
+}
+
+// writeResults reports the outcome of a change per view. If every view
+// failed, the response is an error.
+func (h *Handler) writeResults(w http.ResponseWriter, r *http.Request, name, recordType string, results []updater.Result) {
+	response := ChangeResponse{Name: name, Type: recordType, Results: make([]ViewResult, 0, len(results))}
+	var lastErr error
+	failed := 0
+	for _, result := range results {
+		res := ViewResult{
+			View:     result.View,
+			Provider: result.Provider,
+			Type:     result.Record.Type,
+			Value:    result.Record.Value,
+			Changed:  result.Changed,
+		}
+		if result.Err != nil {
+			logger.ErrorContext(r.Context(), "API change of %s in view %s failed: %v", name, result.View, result.Err)
+			res.Error = result.Err.Error()
+			lastErr = result.Err
+			failed++
+		}
+		response.Results = append(response.Results, res)
+	}
+	if failed > 0 && failed == len(results) {
+		h.providerError(w, r, lastErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// view returns the view selected by the view query parameter, or the
+// primary view
+func (h *Handler) view(w http.ResponseWriter, r *http.Request) (updater.View, bool) {
+	views := h.config.Updater.Views()
+	name := r.URL.Query().Get("view")
+	if name == "" {
+		return views[0], true
+	}
+	for _, view := range views {
+		if view.Name == name {
+			return view, true
+		}
+	}
+	writeError(w, http.StatusNotFound, CodeNotFound, "unknown view "+strconv.Quote(name))
+	return updater.View{}, false
+}
+
+// providerError reports a failed provider call
+func (h *Handler) providerError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, provider.ErrNotSupported) {
+		writeError(w, http.StatusNotImplemented, CodeNotSupported, err.Error())
+		return
+	}
+	status := http.StatusBadGateway
+	if errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusGatewayTimeout
+	}
+	logger.WarnContext(r.Context(), "API provider call failed: %v", err)
+	writeError(w, status, CodeProviderError, err.Error())
+}
+
+// recordPath returns the zone, fully qualified name and type of a record
+// path. Names are relative to the zone unless they end with it; "@" is the
+// zone apex. Changes are limited to address records.
+func recordPath(w http.ResponseWriter, r *http.Request, change bool) (zone, name, recordType string, ok bool) {
+	zone = normalizeName(r.PathValue("zone"))
+	name = normalizeName(r.PathValue("name"))
+	recordType = strings.ToUpper(r.PathValue("type"))
+	if !validName(zone) || !validName(name) {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "invalid zone or record name")
+		return "", "", "", false
+	}
+	switch {
+	case name == "@" || name == zone:
+		name = zone
+	case !strings.HasSuffix(name, "."+zone):
+		name += "." + zone
+	}
+	if change && recordType != "A" && recordType != "AAAA" {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "only A and AAAA records can be changed")
+		return "", "", "", false
+	}
+	return zone, name, recordType, true
+}
+
+// normalizeName lower-cases a name and strips the trailing dot
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// validName reports whether name only contains hostname characters
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '.', c == '_', c == '*', c == '@':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// toRecord converts a provider record
+func toRecord(record *provider.DNSRecord) Record {
+	return Record{
+		Name:     record.Name,
+		Type:     record.Type,
+		Value:    record.Value,
+		TTL:      record.TTL,
+		Priority: record.Priority,
+	}
+}
+
+// readJSON decodes a JSON request body
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, CodeUnsupported, "Content-Type must be application/json")
+		return false
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a structured error
+func writeError(w http.ResponseWriter, code int, errorCode, message string) {
+	writeJSON(w, code, Error{Error: ErrorDetail{Code: errorCode, Message: message}})
+}
+
+// remoteIP returns the address of the direct peer
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
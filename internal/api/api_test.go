@@ -0,0 +1,351 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/audit"
+	"github.com/markussiebert/homeddns/internal/auth"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/state"
+	"github.com/markussiebert/homeddns/internal/updater"
+)
+
+// memProvider keeps records in memory and can list them
+type memProvider struct {
+	mu      sync.Mutex
+	records map[string]provider.DNSRecord
+}
+
+func newMemProvider(records ...provider.DNSRecord) *memProvider {
+	p := &memProvider{records: make(map[string]provider.DNSRecord)}
+	for _, record := range records {
+		p.records[record.Name+"/"+record.Type] = record
+	}
+	return p
+}
+
+func (p *memProvider) Name() string { return "mem" }
+
+func (p *memProvider) GetRecord(ctx context.Context, domain, hostname, recordType string) (*provider.DNSRecord, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	record, ok := p.records[hostname+"/"+recordType]
+	if !ok {
+		return nil, provider.ErrNotFound
+	}
+	return &record, nil
+}
+
+func (p *memProvider) UpdateRecord(ctx context.Context, domain string, record *provider.DNSRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records[record.Name+"/"+record.Type] = *record
+	return nil
+}
+
+func (p *memProvider) DeleteRecord(ctx context.Context, domain string, record *provider.DNSRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.records, record.Name+"/"+record.Type)
+	return nil
+}
+
+func (p *memProvider) ListRecords(ctx context.Context, domain string) ([]provider.DNSRecord, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var records []provider.DNSRecord
+	for _, record := range p.records {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (p *memProvider) Close(ctx context.Context) error { return nil }
+
+// basicProvider has none of the optional capabilities
+type basicProvider struct {
+	p *memProvider
+}
+
+func (b basicProvider) Name() string { return "basic" }
+
+func (b basicProvider) GetRecord(ctx context.Context, domain, hostname, recordType string) (*provider.DNSRecord, error) {
+	return b.p.GetRecord(ctx, domain, hostname, recordType)
+}
+
+func (b basicProvider) UpdateRecord(ctx context.Context, domain string, record *provider.DNSRecord) error {
+	return b.p.UpdateRecord(ctx, domain, record)
+}
+
+func (b basicProvider) Close(ctx context.Context) error { return nil }
+
+func newTestAPI(t *testing.T, p provider.Provider) *Handler {
+	t.Helper()
+	dir := t.TempDir()
+	upd := updater.New(60, updater.View{Name: "public", Provider: p, Source: updater.SourceRequest})
+	store, err := state.Open(filepath.Join(dir, "state.json"), 0)
+	assert.NoError(t, err)
+	upd.UseStore(store)
+	log, err := audit.Open(filepath.Join(dir, "audit.log"), 0, 0)
+	assert.NoError(t, err)
+	upd.UseAudit(log)
+	return New(Config{Updater: upd, AuditLog: log.Path()})
+}
+
+func do(t *testing.T, h http.Handler, method, path, body string) (int, string) {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.String()
+}
+
+func errorCode(t *testing.T, body string) string {
+	t.Helper()
+	var e Error
+	assert.NoError(t, json.Unmarshal([]byte(body), &e))
+	return e.Error.Code
+}
+
+func TestAPI_RecordLifecycle(t *testing.T) {
+	p := newMemProvider()
+	h := newTestAPI(t, p)
+
+	code, body := do(t, h, http.MethodPut, "/api/v1/zones/example.com/records/nas/A", `{"value":"192.0.2.1"}`)
+	assert.Equal(t, http.StatusOK, code, body)
+	var change ChangeResponse
+	assert.NoError(t, json.Unmarshal([]byte(body), &change))
+	assert.Equal(t, "nas.example.com", change.Name)
+	assert.Equal(t, []ViewResult{{View: "public", Provider: "mem", Type: "A", Value: "192.0.2.1", Changed: true}}, change.Results)
+
+	code, body = do(t, h, http.MethodGet, "/api/v1/zones/example.com/records/nas.example.com./a", "")
+	assert.Equal(t, http.StatusOK, code, body)
+	var record Record
+	assert.NoError(t, json.Unmarshal([]byte(body), &record))
+	assert.Equal(t, Record{Name: "nas.example.com", Type: "A", Value: "192.0.2.1", TTL: 60}, record)
+
+	code, body = do(t, h, http.MethodGet, "/api/v1/zones/example.com/records", "")
+	assert.Equal(t, http.StatusOK, code, body)
+	var list RecordList
+	assert.NoError(t, json.Unmarshal([]byte(body), &list))
+	assert.Equal(t, "public", list.View)
+	assert.Equal(t, 1, len(list.Records))
+
+	code, body = do(t, h, http.MethodDelete, "/api/v1/zones/example.com/records/nas/A", "")
+	assert.Equal(t, http.StatusOK, code, body)
+	code, body = do(t, h, http.MethodGet, "/api/v1/zones/example.com/records/nas/A", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, CodeNotFound, errorCode(t, body))
+
+	code, body = do(t, h, http.MethodGet, "/api/v1/history?hostname=nas.example.com", "")
+	assert.Equal(t, http.StatusOK, code, body)
+	var history History
+	assert.NoError(t, json.Unmarshal([]byte(body), &history))
+	assert.Equal(t, 2, len(history.Entries))
+	assert.Equal(t, audit.ActionUpdate, history.Entries[0].Action)
+	assert.Equal(t, audit.ActionDelete, history.Entries[1].Action)
+	assert.Equal(t, "192.0.2.1", history.Entries[1].Previous)
+}
+
+func TestAPI_PutSkipsClientViews(t *testing.T) {
+	public, lan := newMemProvider(), newMemProvider()
+	upd := updater.New(60,
+		updater.View{Name: "public", Provider: public},
+		updater.View{Name: "lan", Provider: lan, Source: updater.SourceClient},
+	)
+	h := New(Config{Updater: upd})
+
+	// The caller's address is not published as the LAN record
+	code, body := do(t, h, http.MethodPut, "/api/v1/zones/example.com/records/nas/A", `{"value":"192.0.2.1"}`)
+	assert.Equal(t, http.StatusOK, code, body)
+	var change ChangeResponse
+	assert.NoError(t, json.Unmarshal([]byte(body), &change))
+	assert.Equal(t, []ViewResult{{View: "public", Provider: "mem", Type: "A", Value: "192.0.2.1", Changed: true}}, change.Results)
+	assert.Equal(t, 0, len(lan.records))
+}
+
+func TestAPI_Errors(t *testing.T) {
+	h := newTestAPI(t, newMemProvider())
+
+	for _, tc := range []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{http.MethodPut, "/api/v1/zones/example.com/records/nas/A", `{"value":"2001:db8::1"}`, http.StatusBadRequest, CodeBadRequest},
+		{http.MethodPut, "/api/v1/zones/example.com/records/nas/A", `{"value":"192.0.2.1","ttl":5}`, http.StatusBadRequest, CodeBadRequest},
+		{http.MethodPut, "/api/v1/zones/example.com/records/nas/MX", `{"value":"mail.example.com"}`, http.StatusBadRequest, CodeBadRequest},
+		{http.MethodPut, "/api/v1/zones/example.com/records/na%20s/A", `{"value":"192.0.2.1"}`, http.StatusBadRequest, CodeBadRequest},
+		{http.MethodGet, "/api/v1/zones/example.com/records?view=lan", "", http.StatusNotFound, CodeNotFound},
+		{http.MethodGet, "/api/v1/history?since=yesterday", "", http.StatusBadRequest, CodeBadRequest},
+		{http.MethodGet, "/api/v1/nothing", "", http.StatusNotFound, CodeNotFound},
+	} {
+		code, body := do(t, h, tc.method, tc.path, tc.body)
+		assert.Equal(t, tc.status, code, "%s %s: %s", tc.method, tc.path, body)
+		assert.Equal(t, tc.code, errorCode(t, body), "%s %s", tc.method, tc.path)
+	}
+
+	// A body must be declared as JSON
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/zones/example.com/records/nas/A", strings.NewReader(`{"value":"192.0.2.1"}`))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	assert.Equal(t, CodeUnsupported, errorCode(t, rec.Body.String()))
+}
+
+func TestAPI_NotSupported(t *testing.T) {
+	h := newTestAPI(t, basicProvider{newMemProvider()})
+
+	code, body := do(t, h, http.MethodGet, "/api/v1/zones/example.com/records", "")
+	assert.Equal(t, http.StatusNotImplemented, code)
+	assert.Equal(t, CodeNotSupported, errorCode(t, body))
+
+	code, body = do(t, h, http.MethodDelete, "/api/v1/zones/example.com/records/nas/A", "")
+	assert.Equal(t, http.StatusNotImplemented, code)
+	assert.Equal(t, CodeNotSupported, errorCode(t, body))
+}
+
+func TestAPI_HostACL(t *testing.T) {
+	p := newMemProvider(
+		provider.DNSRecord{Name: "nas.lan.example.com", Type: "A", Value: "192.168.1.10"},
+		provider.DNSRecord{Name: "www.example.com", Type: "A", Value: "192.0.2.80"},
+	)
+	api := newTestAPI(t, p)
+	h := auth.Middleware(auth.Config{
+		Users: []auth.User{
+			{Username: "admin", Password: "pw"},
+			{Username: "router", Password: "pw", Hosts: []string{"*.lan.example.com"}},
+		},
+	})(api)
+	request := func(user, method, path, body string) (int, string) {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		req.SetBasicAuth(user, "pw")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPut, "/api/v1/zones/example.com/records/nas.lan/A", `{"value":"192.0.2.1"}`, http.StatusOK},
+		{http.MethodPut, "/api/v1/zones/example.com/records/www/A", `{"value":"192.0.2.1"}`, http.StatusForbidden},
+		{http.MethodGet, "/api/v1/zones/example.com/records/nas.lan/A", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/zones/example.com/records/www/A", "", http.StatusForbidden},
+		{http.MethodDelete, "/api/v1/zones/example.com/records/www/A", "", http.StatusForbidden},
+	} {
+		code, body := request("router", tc.method, tc.path, tc.body)
+		assert.Equal(t, tc.status, code, "%s %s: %s", tc.method, tc.path, body)
+		if tc.status == http.StatusForbidden {
+			assert.Equal(t, CodeForbidden, errorCode(t, body))
+		}
+	}
+	// A change made by another user
+	api.config.Updater.Update(context.Background(), updater.Request{Hostname: "www.example.com", Domain: "example.com", Address: "192.0.2.81"})
+
+	// Listings and the history only show the user's hostnames
+	names := func(user string) (records, history []string) {
+		_, body := request(user, http.MethodGet, "/api/v1/zones/example.com/records", "")
+		var list RecordList
+		assert.NoError(t, json.Unmarshal([]byte(body), &list))
+		for _, record := range list.Records {
+			records = append(records, record.Name)
+		}
+		_, body = request(user, http.MethodGet, "/api/v1/history", "")
+		var entries History
+		assert.NoError(t, json.Unmarshal([]byte(body), &entries))
+		for _, entry := range entries.Entries {
+			history = append(history, entry.Hostname)
+		}
+		sort.Strings(records)
+		return records, history
+	}
+	records, history := names("router")
+	assert.Equal(t, []string{"nas.lan.example.com"}, records)
+	assert.Equal(t, []string{"nas.lan.example.com"}, history)
+	records, history = names("admin")
+	assert.Equal(t, []string{"nas.lan.example.com", "www.example.com"}, records)
+	assert.Equal(t, []string{"nas.lan.example.com", "www.example.com"}, history)
+}
+
+func TestAPI_Zones(t *testing.T) {
+	p := newMemProvider(provider.DNSRecord{Name: "www.example.com", Type: "A", Value: "192.0.2.80"})
+	h := newTestAPI(t, p)
+	h.config.Zones = []string{"lan.example.com"}
+
+	// Hostnames outside the configured zones cannot be changed
+	code, body := do(t, h, http.MethodPut, "/api/v1/zones/example.com/records/www/A", `{"value":"192.0.2.1"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, CodeForbidden, errorCode(t, body))
+	code, body = do(t, h, http.MethodDelete, "/api/v1/zones/example.com/records/www/A", "")
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, CodeForbidden, errorCode(t, body))
+	assert.Equal(t, "192.0.2.80", p.records["www.example.com/A"].Value)
+	// Nor read
+	code, body = do(t, h, http.MethodGet, "/api/v1/zones/example.com/records/www/A", "")
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, CodeForbidden, errorCode(t, body))
+	code, body = do(t, h, http.MethodGet, "/api/v1/zones/example.com/records", "")
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, CodeForbidden, errorCode(t, body))
+
+	// Hostnames inside are split at the longest zone
+	code, body = do(t, h, http.MethodPut, "/api/v1/zones/example.com/records/nas.lan/A", `{"value":"192.0.2.1"}`)
+	assert.Equal(t, http.StatusOK, code, body)
+	stored, ok := h.config.Updater.Store().Get("public", "nas.lan.example.com", "A")
+	assert.True(t, ok)
+	assert.Equal(t, "lan.example.com", stored.Domain)
+	code, body = do(t, h, http.MethodGet, "/api/v1/zones/example.com/records/nas.lan/A", "")
+	assert.Equal(t, http.StatusOK, code, body)
+	code, body = do(t, h, http.MethodGet, "/api/v1/zones/lan.example.com/records", "")
+	assert.Equal(t, http.StatusOK, code, body)
+}
+
+func TestAPI_OpenAPIDocument(t *testing.T) {
+	h := newTestAPI(t, newMemProvider())
+
+	code, body := do(t, h, http.MethodGet, "/api/v1/openapi.json", "")
+	assert.Equal(t, http.StatusOK, code)
+	var doc struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(body), &doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+
+	// Every route is documented
+	for path, methods := range map[string][]string{
+		"/zones/{zone}/records":               {"get"},
+		"/zones/{zone}/records/{name}/{type}": {"get", "put", "delete"},
+		"/providers":                          {"get"},
+		"/history":                            {"get"},
+	} {
+		for _, method := range methods {
+			_, ok := doc.Paths[path][method]
+			assert.True(t, ok, "%s %s is not documented", method, path)
+		}
+	}
+}
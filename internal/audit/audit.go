@@ -0,0 +1,247 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+)
+
+const (
+	// DefaultMaxFiles is the number of rotated files kept
+	DefaultMaxFiles = 5
+
+	auditDir  = ".homeddns"
+	auditFile = "audit.log"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Entry is one successful record update or deletion
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Hostname  string    `json:"hostname"`
+	Domain    string    `json:"domain"`
+	Type      string    `json:"type"`
+	Previous  string    `json:"previous,omitempty"`
+	Value     string    `json:"value"`
+	Changed   bool      `json:"changed"`
+	View      string    `json:"view,omitempty"`
+	Provider  string    `json:"provider,omitempty"`
+	Client    string    `json:"client,omitempty"`
+	User      string    `json:"user,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// Log is an append-only JSON-lines file. Once it would grow beyond maxSize
+// it is renamed to path.1 (shifting older files up to path.<maxFiles>) and
+// a new file is started.
+type Log struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	now      func() time.Time
+
+	mu sync.Mutex
+}
+
+// DefaultPath returns ~/.homeddns/audit.log
+func DefaultPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return auditFile
+	}
+	return filepath.Join(homeDir, auditDir, auditFile)
+}
+
+// Open returns a log writing to path. maxSize <= 0 disables rotation;
+// maxFiles <= 0 keeps DefaultMaxFiles rotated files.
+func Open(path string, maxSize int64, maxFiles int) (*Log, error) {
+	if maxFiles <= 0 {
+		maxFiles = DefaultMaxFiles
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("create audit log directory: %w", err)
+	}
+	return &Log{path: path, maxSize: maxSize, maxFiles: maxFiles, now: time.Now}, nil
+}
+
+// Path returns the audit log path
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Write appends an entry. The file is opened for every entry, so it may be
+// moved or truncated by external tools at any time.
+func (l *Log) Write(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = l.now()
+	}
+	if entry.Action == "" {
+		entry.Action = ActionUpdate
+	}
+	entry.Hostname = strings.ToLower(entry.Hostname)
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxSize > 0 {
+		if info, err := os.Stat(l.path); err == nil && info.Size() > 0 && info.Size()+int64(len(line)) > l.maxSize {
+			if err := l.rotate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close audit log: %w", err)
+	}
+	return nil
+}
+
+// rotate shifts path.N to path.N+1, dropping the oldest file, and renames
+// path to path.1; the caller must hold l.mu
+func (l *Log) rotate() error {
+	if err := os.Remove(rotatedPath(l.path, l.maxFiles)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove oldest audit log: %w", err)
+	}
+	for n := l.maxFiles - 1; n >= 1; n-- {
+		if err := os.Rename(rotatedPath(l.path, n), rotatedPath(l.path, n+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("rotate audit log: %w", err)
+		}
+	}
+	if err := os.Rename(l.path, rotatedPath(l.path, 1)); err != nil {
+		return fmt.Errorf("rotate audit log: %w", err)
+	}
+	logger.Debug("Rotated audit log %s", l.path)
+	return nil
+}
+
+// rotatedPath returns the path of the n-th rotated file
+func rotatedPath(path string, n int) string {
+	return path + "." + strconv.Itoa(n)
+}
+
+// Filter selects entries. Empty fields match everything.
+type Filter struct {
+	Hostname string
+	Since    time.Time // inclusive
+	Until    time.Time // exclusive
+}
+
+// Match reports whether the entry passes the filter
+func (f Filter) Match(entry Entry) bool {
+	if f.Hostname != "" && !strings.EqualFold(entry.Hostname, f.Hostname) {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Read returns the entries of the log at path and its rotated files that
+// match the filter, oldest first. Malformed lines, e.g. a line cut short by
+// a crash, are skipped. A missing log yields no entries.
+func Read(path string, filter Filter) ([]Entry, error) {
+	files, err := rotatedFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, path)
+
+	var entries []Entry
+	for _, file := range files {
+		matched, err := readFile(file, filter)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, matched...)
+	}
+	return entries, nil
+}
+
+// rotatedFiles returns the existing rotated files of path, oldest first
+func rotatedFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, fmt.Errorf("list rotated audit logs: %w", err)
+	}
+	numbers := make(map[string]int)
+	var files []string
+	for _, match := range matches {
+		n, err := strconv.Atoi(strings.TrimPrefix(match, path+"."))
+		if err != nil || n < 1 {
+			continue
+		}
+		numbers[match] = n
+		files = append(files, match)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return numbers[files[i]] > numbers[files[j]]
+	})
+	return files, nil
+}
+
+// readFile returns the matching entries of one file
+func readFile(path string, filter Filter) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			logger.Warn("Skipping malformed audit log line %s:%d: %v", path, lineNo, err)
+			continue
+		}
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log %s: %w", path, err)
+	}
+	return entries, nil
+}
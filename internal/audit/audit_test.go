@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestLog_WriteAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	log, err := Open(path, 0, 0)
+	assert.NoError(t, err)
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, log.Write(Entry{Time: base, Hostname: "NAS.example.com", Type: "A", Value: "192.0.2.1", Changed: true, Client: "198.51.100.7", User: "router"}))
+	assert.NoError(t, log.Write(Entry{Time: base.Add(time.Hour), Hostname: "vpn.example.com", Type: "A", Value: "192.0.2.1", Changed: true}))
+	assert.NoError(t, log.Write(Entry{Time: base.Add(2 * time.Hour), Hostname: "nas.example.com", Type: "A", Previous: "192.0.2.1", Value: "192.0.2.2", Changed: true, RequestID: "abc"}))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	entries, err := Read(path, Filter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, "nas.example.com", entries[0].Hostname)
+	assert.Equal(t, "router", entries[0].User)
+	assert.Equal(t, "192.0.2.1", entries[2].Previous)
+	assert.Equal(t, "abc", entries[2].RequestID)
+
+	entries, err = Read(path, Filter{Hostname: "NAS.example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+
+	entries, err = Read(path, Filter{Since: base.Add(time.Hour), Until: base.Add(2 * time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "vpn.example.com", entries[0].Hostname)
+}
+
+func TestLog_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := Open(path, 200, 2)
+	assert.NoError(t, err)
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, log.Write(Entry{Time: base.Add(time.Duration(i) * time.Minute), Hostname: "nas.example.com", Type: "A", Value: "192.0.2.1"}))
+	}
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		assert.NoError(t, err)
+		assert.True(t, info.Size() <= 200, "%s is %d bytes", p, info.Size())
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	// The oldest entries were dropped; the remaining ones are in order
+	entries, err := Read(path, Filter{})
+	assert.NoError(t, err)
+	assert.True(t, len(entries) > 0 && len(entries) < 10)
+	assert.Equal(t, base.Add(9*time.Minute), entries[len(entries)-1].Time)
+	for i := 1; i < len(entries); i++ {
+		assert.True(t, entries[i-1].Time.Before(entries[i].Time))
+	}
+}
+
+func TestRead_SkipsMalformedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	data := `{"time":"2024-05-01T12:00:00Z","hostname":"nas.example.com","type":"A","value":"192.0.2.1","changed":true}
+{"time":"2024-05-01T12:05:00Z","hostname":"nas.exa
+`
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0600))
+
+	entries, err := Read(path, Filter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+
+	entries, err = Read(filepath.Join(t.TempDir(), "missing.log"), Filter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(entries))
+}
@@ -1,65 +1,240 @@
 package auth
 
 import (
+	"context"
+	"crypto/x509"
 	"encoding/base64"
 	"net/http"
+	"strconv"
 	"strings"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/util"
+)
+
+// Mode selects how clients authenticate
+type Mode string
+
+const (
+	// ModeBasic requires Basic auth credentials
+	ModeBasic Mode = "basic"
+	// ModeCert requires a verified client certificate
+	ModeCert Mode = "cert"
+	// ModeCertOrBasic accepts a verified client certificate and falls back
+	// to Basic auth for clients without one
+	ModeCertOrBasic Mode = "cert_or_basic"
+	// ModeCertAndBasic requires a verified client certificate and Basic
+	// auth credentials; the Basic auth user is the identity
+	ModeCertAndBasic Mode = "cert_and_basic"
 )
 
+// Modes are the valid authentication modes
+var Modes = []Mode{ModeBasic, ModeCert, ModeCertOrBasic, ModeCertAndBasic}
+
+// Certificates reports whether the mode uses client certificates
+func (m Mode) Certificates() bool {
+	return m == ModeCert || m == ModeCertOrBasic || m == ModeCertAndBasic
+}
+
+// Basic reports whether the mode uses Basic auth
+func (m Mode) Basic() bool {
+	return m != ModeCert
+}
+
 // Config represents authentication configuration
 type Config struct {
+	// Mode selects Basic auth and/or client certificates (default
+	// ModeBasic). Client certificates must be verified by the TLS listener.
+	Mode     Mode
+	Username string
+	Password util.Secret
+	// Users are additional accounts, each optionally limited to hostnames
+	Users []User
+	// OnFailure is called for every rejected request (optional)
+	OnFailure func(r *http.Request)
+}
+
+// User is an account that may only update the hostnames matching Hosts.
+// A pattern "*.example.com" matches all subdomains of example.com. An
+// empty Hosts allows every hostname.
+type User struct {
 	Username string
-	Password string
+	Password util.Secret
+	Hosts    []string
+}
+
+// userKey is the context key of the authenticated username
+type userKey struct{}
+
+// hostsKey is the context key of the hostnames the user may update
+type hostsKey struct{}
+
+// UserFromContext returns the authenticated username of a request, if any
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+// HostAllowed reports whether the authenticated user of ctx may update
+// hostname. Requests without a hostname restriction may update any hostname.
+func HostAllowed(ctx context.Context, hostname string) bool {
+	hosts, ok := ctx.Value(hostsKey{}).([]string)
+	if !ok || len(hosts) == 0 {
+		return true
+	}
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	for _, pattern := range hosts {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+		if pattern == hostname {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok && strings.HasPrefix(suffix, ".") && strings.HasSuffix(hostname, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// certificateUser returns the account of a verified client certificate.
+// The subject common name and the DNS and email SANs are looked up as
+// usernames; a certificate that names no account may update the hostnames
+// of its DNS SANs.
+func (c Config) certificateUser(cert *x509.Certificate) (User, bool) {
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if c.Username != "" && name == c.Username {
+			return User{Username: c.Username}, true
+		}
+		for _, user := range c.Users {
+			if name == user.Username {
+				return user, true
+			}
+		}
+	}
+	if len(cert.DNSNames) == 0 {
+		return User{}, false
+	}
+	username := cert.Subject.CommonName
+	if username == "" {
+		username = cert.DNSNames[0]
+	}
+	return User{Username: username, Hosts: cert.DNSNames}, true
 }
 
-// Middleware creates a basic auth middleware
+// lookup returns the account matching the credentials
+func (c Config) lookup(username, password string) (User, bool) {
+	if c.Username != "" && username == c.Username && password == c.Password.Value() {
+		return User{Username: c.Username}, true
+	}
+	for _, user := range c.Users {
+		if username == user.Username && password == user.Password.Value() {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+// Middleware creates an authentication middleware for the mode of config
 func Middleware(config Config) func(http.Handler) http.Handler {
+	mode := config.Mode
+	if mode == "" {
+		mode = ModeBasic
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Extract basic auth credentials
-			auth := r.Header.Get("Authorization")
-			if auth == "" {
-				unauthorized(w)
-				return
+			reject := func(reason string) {
+				logger.WarnContext(r.Context(), "Authentication failed from %s: %s", r.RemoteAddr, reason)
+				if config.OnFailure != nil {
+					config.OnFailure(r)
+				}
+				unauthorized(w, mode)
 			}
 
-			// Parse "Basic <base64>"
-			const prefix = "Basic "
-			if !strings.HasPrefix(auth, prefix) {
-				unauthorized(w)
-				return
+			// Client certificates are verified during the handshake
+			var cert *x509.Certificate
+			if mode.Certificates() && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+				cert = r.TLS.VerifiedChains[0][0]
 			}
 
-			decoded, err := base64.StdEncoding.DecodeString(auth[len(prefix):])
-			if err != nil {
-				unauthorized(w)
+			var user User
+			switch {
+			case cert == nil && (mode == ModeCert || mode == ModeCertAndBasic):
+				reject("no client certificate")
 				return
+			case cert != nil && mode != ModeCertAndBasic:
+				var ok bool
+				if user, ok = config.certificateUser(cert); !ok {
+					reject("client certificate " + strconv.Quote(cert.Subject.String()) + " names no user or hostname")
+					return
+				}
+			default:
+				var reason string
+				if user, reason = config.basicUser(r); reason != "" {
+					reject(reason)
+					return
+				}
 			}
 
-			// Split username:password
-			credentials := string(decoded)
-			parts := strings.SplitN(credentials, ":", 2)
-			if len(parts) != 2 {
-				unauthorized(w)
-				return
+			// Authentication successful
+			if cert != nil {
+				logger.DebugContext(r.Context(), "Authenticated user %s with client certificate %s from %s", user.Username, cert.Subject, r.RemoteAddr)
+			} else {
+				logger.DebugContext(r.Context(), "Authenticated user %s from %s", user.Username, r.RemoteAddr)
+			}
+			ctx := context.WithValue(r.Context(), userKey{}, user.Username)
+			if len(user.Hosts) > 0 {
+				ctx = context.WithValue(ctx, hostsKey{}, user.Hosts)
 			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
 
-			username, password := parts[0], parts[1]
+// basicUser returns the account of the Basic auth credentials of r, or
+// why they were rejected
+func (c Config) basicUser(r *http.Request) (User, string) {
+	// Extract basic auth credentials
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return User{}, "no credentials"
+	}
 
-			// Verify credentials
-			if username != config.Username || password != config.Password {
-				unauthorized(w)
-				return
-			}
+	// Parse "Basic <base64>"
+	const prefix = "Basic "
+	if !strings.HasPrefix(auth, prefix) {
+		return User{}, "unsupported authorization scheme"
+	}
 
-			// Authentication successful
-			next.ServeHTTP(w, r)
-		})
+	decoded, err := base64.StdEncoding.DecodeString(auth[len(prefix):])
+	if err != nil {
+		return User{}, "malformed credentials"
 	}
+
+	// Split username:password
+	credentials := string(decoded)
+	parts := strings.SplitN(credentials, ":", 2)
+	if len(parts) != 2 {
+		return User{}, "malformed credentials"
+	}
+
+	username, password := parts[0], parts[1]
+
+	// Verify credentials
+	user, ok := c.lookup(username, password)
+	if !ok {
+		return User{}, "invalid credentials for user " + strconv.Quote(username)
+	}
+	return user, ""
 }
 
-func unauthorized(w http.ResponseWriter) {
-	w.Header().Set("WWW-Authenticate", `Basic realm="DynDNS"`)
+func unauthorized(w http.ResponseWriter, mode Mode) {
+	if mode.Basic() {
+		w.Header().Set("WWW-Authenticate", `Basic realm="DynDNS"`)
+	}
 	w.WriteHeader(http.StatusUnauthorized)
 	w.Write([]byte("401 Unauthorized\n"))
 }
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestMiddleware_Users(t *testing.T) {
+	var user string
+	var allowed bool
+	h := Middleware(Config{
+		Username: "admin",
+		Password: "secret",
+		Users: []User{
+			{Username: "router", Password: "pw", Hosts: []string{"home.example.com", "*.lan.example.com."}},
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user = UserFromContext(r.Context())
+		allowed = HostAllowed(r.Context(), r.URL.Query().Get("hostname"))
+	}))
+
+	for _, tc := range []struct {
+		username, password, hostname string
+		status                       int
+		allowed                      bool
+	}{
+		{"admin", "secret", "anything.example.org", http.StatusOK, true},
+		{"router", "pw", "home.example.com", http.StatusOK, true},
+		{"router", "pw", "NAS.lan.example.com", http.StatusOK, true},
+		{"router", "pw", "lan.example.com", http.StatusOK, false},
+		{"router", "pw", "other.example.com", http.StatusOK, false},
+		{"router", "secret", "home.example.com", http.StatusUnauthorized, false},
+	} {
+		user, allowed = "", false
+		req := httptest.NewRequest(http.MethodGet, "/nic/update?hostname="+tc.hostname, nil)
+		req.SetBasicAuth(tc.username, tc.password)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, tc.status, rec.Code, "%s %s", tc.username, tc.hostname)
+		assert.Equal(t, tc.allowed, allowed, "%s %s", tc.username, tc.hostname)
+		if tc.status == http.StatusOK {
+			assert.Equal(t, tc.username, user)
+		}
+	}
+}
+
+func TestMiddleware_ClientCertificates(t *testing.T) {
+	config := Config{
+		Username: "admin",
+		Password: "secret",
+		Users: []User{
+			{Username: "router", Password: "pw", Hosts: []string{"home.example.com"}},
+		},
+	}
+	router := &x509.Certificate{Subject: pkix.Name{CommonName: "router"}}
+	nas := &x509.Certificate{Subject: pkix.Name{CommonName: "NAS"}, DNSNames: []string{"nas.example.com"}}
+	unknown := &x509.Certificate{Subject: pkix.Name{CommonName: "printer"}}
+
+	for _, tc := range []struct {
+		mode     Mode
+		cert     *x509.Certificate
+		basic    bool
+		status   int
+		user     string
+		hostname string
+		allowed  bool
+	}{
+		// Certificates are ignored by Basic auth
+		{ModeBasic, router, false, http.StatusUnauthorized, "", "", false},
+		{ModeBasic, nil, true, http.StatusOK, "admin", "nas.example.com", true},
+		// The common name names a user, or the SANs are the hostnames
+		{ModeCert, router, false, http.StatusOK, "router", "home.example.com", true},
+		{ModeCert, router, false, http.StatusOK, "router", "nas.example.com", false},
+		{ModeCert, nas, false, http.StatusOK, "NAS", "nas.example.com", true},
+		{ModeCert, nas, false, http.StatusOK, "NAS", "home.example.com", false},
+		{ModeCert, unknown, false, http.StatusUnauthorized, "", "", false},
+		{ModeCert, nil, true, http.StatusUnauthorized, "", "", false},
+		// Either one
+		{ModeCertOrBasic, router, false, http.StatusOK, "router", "home.example.com", true},
+		{ModeCertOrBasic, nil, true, http.StatusOK, "admin", "nas.example.com", true},
+		{ModeCertOrBasic, nil, false, http.StatusUnauthorized, "", "", false},
+		// Both, with the Basic auth user as identity
+		{ModeCertAndBasic, router, true, http.StatusOK, "admin", "nas.example.com", true},
+		{ModeCertAndBasic, router, false, http.StatusUnauthorized, "", "", false},
+		{ModeCertAndBasic, nil, true, http.StatusUnauthorized, "", "", false},
+	} {
+		config.Mode = tc.mode
+		var user string
+		var allowed bool
+		h := Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user = UserFromContext(r.Context())
+			allowed = HostAllowed(r.Context(), tc.hostname)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/nic/update", nil)
+		if tc.cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tc.cert}}}
+		}
+		if tc.basic {
+			req.SetBasicAuth("admin", "secret")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, tc.status, rec.Code, "%s %v", tc.mode, tc.cert)
+		assert.Equal(t, tc.user, user, "%s %v", tc.mode, tc.cert)
+		assert.Equal(t, tc.allowed, allowed, "%s %v", tc.mode, tc.cert)
+		assert.Equal(t, tc.mode.Basic() && tc.status != http.StatusOK, rec.Header().Get("WWW-Authenticate") != "")
+	}
+}
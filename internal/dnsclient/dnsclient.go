@@ -0,0 +1,243 @@
+package dnsclient
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ErrNXDomain is returned when the queried name does not exist
+var ErrNXDomain = errors.New("name does not exist")
+
+// Client sends non-recursive queries directly to authoritative nameservers
+type Client struct {
+	// Timeout per query (default 5s)
+	Timeout time.Duration
+	// Nameservers overrides the NS discovery with fixed "host:port" servers,
+	// e.g. for zones served by a local BIND
+	Nameservers []string
+	// Resolver is used to discover the NS of a zone (default net.DefaultResolver)
+	Resolver *net.Resolver
+}
+
+// Lookup queries server for the values of name and record type (A, AAAA,
+// CNAME or TXT). A name without records of the type yields an empty result.
+func (c *Client) Lookup(ctx context.Context, server, name, recordType string) ([]string, error) {
+	qtype, ok := queryTypes[strings.ToUpper(recordType)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported record type %s", recordType)
+	}
+
+	msg, err := c.exchange(ctx, server, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	switch msg.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, ErrNXDomain
+	default:
+		return nil, fmt.Errorf("query %s %s at %s: %s", name, recordType, server, msg.RCode)
+	}
+
+	fqdn := canonical(name)
+	var values []string
+	for _, answer := range msg.Answers {
+		if answer.Header.Type != qtype || canonical(answer.Header.Name.String()) != fqdn {
+			continue
+		}
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			values = append(values, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			values = append(values, net.IP(body.AAAA[:]).String())
+		case *dnsmessage.CNAMEResource:
+			values = append(values, strings.TrimSuffix(body.CNAME.String(), "."))
+		case *dnsmessage.TXTResource:
+			values = append(values, strings.Join(body.TXT, ""))
+		}
+	}
+	return values, nil
+}
+
+// SameValue reports whether two record values are equal. Addresses are
+// compared parsed, since e.g. 2001:DB8:0::1 is served as 2001:db8::1.
+func SameValue(a, b string) bool {
+	if ipA, ipB := net.ParseIP(a), net.ParseIP(b); ipA != nil && ipB != nil {
+		return ipA.Equal(ipB)
+	}
+	return a == b
+}
+
+// AuthoritativeServers returns the "host:53" addresses of the nameservers
+// of zone, or the configured Nameservers
+func (c *Client) AuthoritativeServers(ctx context.Context, zone string) ([]string, error) {
+	if len(c.Nameservers) > 0 {
+		return c.Nameservers, nil
+	}
+
+	resolver := c.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	nameservers, err := resolver.LookupNS(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("lookup NS of %s: %w", zone, err)
+	}
+
+	var servers []string
+	for _, ns := range nameservers {
+		addrs, err := resolver.LookupHost(ctx, ns.Host)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			servers = append(servers, net.JoinHostPort(addr, "53"))
+		}
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no reachable nameserver found for %s", zone)
+	}
+	return servers, nil
+}
+
+// WaitForValue polls the authoritative nameservers of zone every interval
+// until all of them answer name with exactly value (see SameValue), or ctx
+// is done
+func (c *Client) WaitForValue(ctx context.Context, zone, name, recordType, value string, interval time.Duration) error {
+	servers, err := c.AuthoritativeServers(ctx, zone)
+	if err != nil {
+		return err
+	}
+
+	pending := servers
+	for {
+		var remaining []string
+		for _, server := range pending {
+			values, err := c.Lookup(ctx, server, name, recordType)
+			if err != nil || len(values) != 1 || !SameValue(values[0], value) {
+				remaining = append(remaining, server)
+			}
+		}
+		if len(remaining) == 0 {
+			return nil
+		}
+		pending = remaining
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s %s not %s at %s: %w", name, recordType, value, strings.Join(pending, ", "), ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// queryTypes maps the supported record types to query types
+var queryTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"TXT":   dnsmessage.TypeTXT,
+}
+
+// exchange sends a query over UDP and retries over TCP if the answer was truncated
+func (c *Client) exchange(ctx context.Context, server, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	qname, err := dnsmessage.NewName(canonical(name))
+	if err != nil {
+		return nil, fmt.Errorf("invalid name %s: %w", name, err)
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Uint32())},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("pack query: %w", err)
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	msg, err := c.roundTrip(ctx, "udp", server, packed, query.ID)
+	if err == nil && msg.Truncated {
+		msg, err = c.roundTrip(ctx, "tcp", server, packed, query.ID)
+	}
+	return msg, err
+}
+
+// roundTrip sends one query and reads the matching response
+func (c *Client) roundTrip(ctx context.Context, network, server string, query []byte, id uint16) (*dnsmessage.Message, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", server, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		framed := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(framed, uint16(len(query)))
+		copy(framed[2:], query)
+		query = framed
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, fmt.Errorf("send query to %s: %w", server, err)
+	}
+
+	for {
+		buf, err := readMessage(conn, network)
+		if err != nil {
+			return nil, fmt.Errorf("read response from %s: %w", server, err)
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf); err != nil {
+			return nil, fmt.Errorf("parse response from %s: %w", server, err)
+		}
+		// Ignore stray UDP datagrams
+		if msg.ID == id && msg.Response {
+			return &msg, nil
+		}
+	}
+}
+
+// readMessage reads a single DNS message from a UDP or TCP connection
+func readMessage(conn net.Conn, network string) ([]byte, error) {
+	if network == "tcp" {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+		_, err := io.ReadFull(conn, buf)
+		return buf, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	return buf[:n], err
+}
+
+// canonical returns the lower-case fully qualified form of name
+func canonical(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
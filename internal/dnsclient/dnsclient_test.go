@@ -0,0 +1,102 @@
+package dnsclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/dnsclient/dnstest"
+)
+
+func TestClient_Lookup(t *testing.T) {
+	server := dnstest.NewServer(t)
+	server.Set("home.example.com", "A", "192.0.2.1")
+	server.Set("home.example.com", "AAAA", "2001:db8::1")
+	server.Set("_acme-challenge.example.com", "TXT", "token")
+	client := &Client{}
+	ctx := context.Background()
+
+	values, err := client.Lookup(ctx, server.Addr, "HOME.example.com", "A")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.1"}, values)
+
+	values, err = client.Lookup(ctx, server.Addr, "home.example.com.", "AAAA")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2001:db8::1"}, values)
+
+	values, err = client.Lookup(ctx, server.Addr, "_acme-challenge.example.com", "TXT")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"token"}, values)
+
+	// Existing name without records of the type
+	values, err = client.Lookup(ctx, server.Addr, "_acme-challenge.example.com", "A")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(values))
+
+	_, err = client.Lookup(ctx, server.Addr, "missing.example.com", "A")
+	assert.True(t, errors.Is(err, ErrNXDomain))
+
+	_, err = client.Lookup(ctx, server.Addr, "home.example.com", "MX")
+	assert.Error(t, err)
+}
+
+func TestClient_LookupFallsBackToTCP(t *testing.T) {
+	server := dnstest.NewServer(t)
+	server.Set("home.example.com", "A", "192.0.2.1", "192.0.2.2")
+	server.SetTruncate(true)
+
+	values, err := (&Client{}).Lookup(context.Background(), server.Addr, "home.example.com", "A")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.1", "192.0.2.2"}, values)
+	assert.Equal(t, 2, server.Queries())
+}
+
+func TestClient_AuthoritativeServersOverride(t *testing.T) {
+	client := &Client{Nameservers: []string{"127.0.0.1:5353"}}
+	servers, err := client.AuthoritativeServers(context.Background(), "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:5353"}, servers)
+}
+
+func TestClient_WaitForValue(t *testing.T) {
+	first := dnstest.NewServer(t)
+	second := dnstest.NewServer(t)
+	first.Set("home.example.com", "A", "192.0.2.2")
+	second.Set("home.example.com", "A", "192.0.2.1")
+	client := &Client{Nameservers: []string{first.Addr, second.Addr}}
+
+	// The second server picks up the change after a few polls
+	go func() {
+		for second.Queries() < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		second.Set("home.example.com", "A", "192.0.2.2")
+	}()
+	err := client.WaitForValue(context.Background(), "example.com", "home.example.com", "A", "192.0.2.2", time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, first.Queries())
+
+	// A value that never appears times out
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = client.WaitForValue(ctx, "example.com", "home.example.com", "A", "192.0.2.3", time.Millisecond)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// Addresses match in any notation
+	first.Set("home.example.com", "AAAA", "2001:db8::1")
+	second.Set("home.example.com", "AAAA", "2001:db8::1")
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = client.WaitForValue(ctx, "example.com", "home.example.com", "AAAA", "2001:DB8:0::1", time.Millisecond)
+	assert.NoError(t, err)
+}
+
+func TestSameValue(t *testing.T) {
+	assert.True(t, SameValue("2001:DB8:0::1", "2001:db8::1"))
+	assert.True(t, SameValue("192.0.2.1", "::ffff:192.0.2.1"))
+	assert.False(t, SameValue("192.0.2.1", "192.0.2.2"))
+	assert.True(t, SameValue("token", "token"))
+	assert.False(t, SameValue("Token", "token"))
+}
@@ -0,0 +1,219 @@
+// Package dnstest provides an in-process authoritative DNS server for tests.
+package dnstest
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Server answers A, AAAA, CNAME and TXT queries over UDP and TCP from an
+// in-memory record table
+type Server struct {
+	// Addr is the "127.0.0.1:port" address of the server
+	Addr string
+
+	udp net.PacketConn
+	tcp net.Listener
+
+	mu       sync.Mutex
+	records  map[string][]string
+	truncate bool
+	queries  int
+}
+
+// NewServer starts a server that is stopped when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{records: make(map[string][]string)}
+
+	// UDP and TCP must share the port; retry if TCP finds it taken
+	for attempt := 0; ; attempt++ {
+		udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen udp: %v", err)
+		}
+		tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+		if err != nil {
+			udp.Close()
+			if attempt < 10 {
+				continue
+			}
+			t.Fatalf("listen tcp: %v", err)
+		}
+		s.udp, s.tcp, s.Addr = udp, tcp, udp.LocalAddr().String()
+		break
+	}
+	t.Cleanup(func() {
+		s.udp.Close()
+		s.tcp.Close()
+	})
+
+	go s.serveUDP()
+	go s.serveTCP()
+	return s
+}
+
+// Set replaces the values of a name and record type
+func (s *Server) Set(name, recordType string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key(name, recordType)] = values
+}
+
+// SetTruncate makes UDP answers truncated to force a TCP retry
+func (s *Server) SetTruncate(truncate bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.truncate = truncate
+}
+
+// Queries returns the number of queries answered
+func (s *Server) Queries() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries
+}
+
+func (s *Server) serveUDP() {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.answer(buf[:n], true); resp != nil {
+			_, _ = s.udp.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *Server) serveTCP() {
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			var length [2]byte
+			if _, err := io.ReadFull(conn, length[:]); err != nil {
+				return
+			}
+			buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return
+			}
+			resp := s.answer(buf, false)
+			if resp == nil {
+				return
+			}
+			framed := make([]byte, 2+len(resp))
+			binary.BigEndian.PutUint16(framed, uint16(len(resp)))
+			copy(framed[2:], resp)
+			_, _ = conn.Write(framed)
+		}()
+	}
+}
+
+// answer builds the response to a packed query
+func (s *Server) answer(packed []byte, udp bool) []byte {
+	var query dnsmessage.Message
+	if err := query.Unpack(packed); err != nil || len(query.Questions) != 1 {
+		return nil
+	}
+	q := query.Questions[0]
+
+	s.mu.Lock()
+	s.queries++
+	values := s.records[key(q.Name.String(), typeNames[q.Type])]
+	exists := false
+	prefix := strings.ToLower(q.Name.String()) + "|"
+	for k := range s.records {
+		if strings.HasPrefix(k, prefix) {
+			exists = true
+		}
+	}
+	truncate := s.truncate && udp
+	s.mu.Unlock()
+
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:            query.ID,
+			Response:      true,
+			Authoritative: true,
+			Truncated:     truncate,
+		},
+		Questions: query.Questions,
+	}
+	if !exists {
+		resp.RCode = dnsmessage.RCodeNameError
+	}
+	if !truncate {
+		for _, value := range values {
+			if rr, ok := resource(q, value); ok {
+				resp.Answers = append(resp.Answers, rr)
+			}
+		}
+	}
+
+	out, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// resource builds an answer record for a value
+func resource(q dnsmessage.Question, value string) (dnsmessage.Resource, bool) {
+	header := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 60}
+	switch q.Type {
+	case dnsmessage.TypeA:
+		ip := net.ParseIP(value).To4()
+		if ip == nil {
+			return dnsmessage.Resource{}, false
+		}
+		var a dnsmessage.AResource
+		copy(a.A[:], ip)
+		return dnsmessage.Resource{Header: header, Body: &a}, true
+	case dnsmessage.TypeAAAA:
+		ip := net.ParseIP(value).To16()
+		if ip == nil {
+			return dnsmessage.Resource{}, false
+		}
+		var aaaa dnsmessage.AAAAResource
+		copy(aaaa.AAAA[:], ip)
+		return dnsmessage.Resource{Header: header, Body: &aaaa}, true
+	case dnsmessage.TypeCNAME:
+		name, err := dnsmessage.NewName(strings.TrimSuffix(value, ".") + ".")
+		if err != nil {
+			return dnsmessage.Resource{}, false
+		}
+		return dnsmessage.Resource{Header: header, Body: &dnsmessage.CNAMEResource{CNAME: name}}, true
+	case dnsmessage.TypeTXT:
+		return dnsmessage.Resource{Header: header, Body: &dnsmessage.TXTResource{TXT: []string{value}}}, true
+	}
+	return dnsmessage.Resource{}, false
+}
+
+// typeNames maps the supported query types to record type names
+var typeNames = map[dnsmessage.Type]string{
+	dnsmessage.TypeA:     "A",
+	dnsmessage.TypeAAAA:  "AAAA",
+	dnsmessage.TypeCNAME: "CNAME",
+	dnsmessage.TypeTXT:   "TXT",
+}
+
+// key identifies a name and record type
+func key(name, recordType string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name + "|" + strings.ToUpper(recordType)
+}
@@ -6,22 +6,43 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/markussiebert/homeddns/internal/auth"
 	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/metrics"
 	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/updater"
 )
 
 // Config represents the DynDNS handler configuration
 type Config struct {
 	Provider   provider.Provider
 	DefaultTTL int
+	// Updater routes updates to one or more views. If nil, a single view
+	// using Provider is created.
+	Updater *updater.Updater
+	// WaitTimeout bounds how long a wait=1 request waits for propagation
+	WaitTimeout time.Duration
+	// OnResult, if set, is called with the DynDNS status of every request
+	OnResult func(hostname, status string)
+	// Zones, if set, are the only zones that can be updated. Hostnames are
+	// split at the longest matching zone instead of the last two labels.
+	Zones []string
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For header
+	// is used as the client address. Without them the header is ignored.
+	TrustedProxies []*net.IPNet
 }
 
 // DynDNSHandler handles DynDNS update requests
 type DynDNSHandler struct {
 	config Config
+	// untrustedForward warns once about X-Forwarded-For headers of peers
+	// that are not trusted proxies
+	untrustedForward sync.Once
 }
 
 // NewDynDNSHandler creates a new DynDNS handler
@@ -29,72 +50,160 @@ func NewDynDNSHandler(config Config) *DynDNSHandler {
 	if config.DefaultTTL == 0 {
 		config.DefaultTTL = 60
 	}
+	if config.WaitTimeout == 0 {
+		config.WaitTimeout = 2 * time.Minute
+	}
+	if config.Updater == nil {
+		config.Updater = updater.New(config.DefaultTTL, updater.View{
+			Name:     "public",
+			Provider: config.Provider,
+			Source:   updater.SourceRequest,
+		})
+	}
 	return &DynDNSHandler{config: config}
 }
 
 // ServeHTTP handles HTTP requests
 func (h *DynDNSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	logger.Debug("Received %s request: %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-	logger.Debug("Query params: %s", r.URL.RawQuery)
+	logger.DebugContext(r.Context(), "Received %s request: %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	logger.DebugContext(r.Context(), "Query params: %s", r.URL.RawQuery)
 
 	// Only allow GET requests
 	if r.Method != http.MethodGet {
-		logger.Warn("Method not allowed: %s from %s", r.Method, r.RemoteAddr)
+		logger.WarnContext(r.Context(), "Method not allowed: %s from %s", r.Method, r.RemoteAddr)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Determine format based on path
 	isStandardFormat := strings.HasPrefix(r.URL.Path, "/nic/update")
-	logger.Debug("Using %s format", map[bool]string{true: "standard", false: "UniFi"}[isStandardFormat])
+	logger.DebugContext(r.Context(), "Using %s format", map[bool]string{true: "standard", false: "UniFi"}[isStandardFormat])
 
 	// Extract hostname
 	hostname := h.extractHostname(r)
 	if hostname == "" {
-		logger.Warn("No valid hostname found in request from %s", r.RemoteAddr)
+		logger.WarnContext(r.Context(), "No valid hostname found in request from %s", r.RemoteAddr)
+		h.observe("", "notfqdn")
 		h.respond(w, "notfqdn", "", isStandardFormat)
 		return
 	}
 
-	logger.Debug("Extracted hostname: %s", hostname)
+	logger.DebugContext(r.Context(), "Extracted hostname: %s", hostname)
 
 	// Validate and parse hostname
 	hostname = h.normalizeHostname(hostname)
-	logger.Debug("Normalized hostname: %s", hostname)
+	logger.DebugContext(r.Context(), "Normalized hostname: %s", hostname)
 
 	domain, subdomain := h.splitHostname(hostname)
 	if domain == "" {
-		logger.Warn("Failed to split hostname '%s' into domain and subdomain", hostname)
+		logger.WarnContext(r.Context(), "Failed to split hostname '%s' into domain and subdomain", hostname)
+		h.observe("", "notfqdn")
 		h.respond(w, "notfqdn", "", isStandardFormat)
 		return
 	}
-	logger.Debug("Split hostname: domain=%s, subdomain=%s", domain, subdomain)
+	if len(h.config.Zones) > 0 {
+		zone, ok := h.zoneOf(hostname)
+		if !ok {
+			logger.WarnContext(r.Context(), "Hostname %s is not in a configured zone", hostname)
+			h.observe("", "nohost")
+			h.respond(w, "nohost", "", isStandardFormat)
+			return
+		}
+		domain, subdomain = zone, strings.TrimSuffix(strings.TrimSuffix(hostname, zone), ".")
+		if subdomain == "" {
+			subdomain = "@"
+		}
+	}
+	logger.DebugContext(r.Context(), "Split hostname: domain=%s, subdomain=%s", domain, subdomain)
+
+	// The user may be limited to some hostnames
+	if !auth.HostAllowed(r.Context(), hostname) {
+		logger.WarnContext(r.Context(), "User %s may not update %s", auth.UserFromContext(r.Context()), hostname)
+		h.observe("", "nohost")
+		h.respond(w, "nohost", "", isStandardFormat)
+		return
+	}
 
 	// Get IP address
 	ipAddress := h.extractIP(r)
 	if ipAddress == "" {
-		logger.Warn("Failed to extract valid IP address from request")
+		logger.WarnContext(r.Context(), "Failed to extract valid IP address from request")
+		h.observe(hostname, "911")
 		h.respond(w, "911", "", isStandardFormat)
 		return
 	}
-	logger.Debug("Extracted IP address: %s", ipAddress)
-
-	// Update DNS record
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	logger.DebugContext(r.Context(), "Extracted IP address: %s", ipAddress)
+
+	// Update DNS record, optionally waiting for propagation
+	timeout := 30 * time.Second
+	wait := h.extractWait(r)
+	if wait > 0 {
+		timeout += wait
+		// Keep the response writable beyond the server's WriteTimeout
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + 5*time.Second)); err != nil {
+			logger.DebugContext(r.Context(), "Cannot extend write deadline: %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
 	defer cancel()
 
-	logger.Debug("Updating DNS: hostname=%s, domain=%s, subdomain=%s, ip=%s", hostname, domain, subdomain, ipAddress)
+	logger.DebugContext(r.Context(), "Updating DNS: hostname=%s, domain=%s, subdomain=%s, ip=%s, wait=%v", hostname, domain, subdomain, ipAddress, wait)
 
-	if err := h.updateDNS(ctx, domain, subdomain, ipAddress); err != nil {
-		logger.Error("Error updating DNS for %s: %v", hostname, err)
-		h.respond(w, "911", ipAddress, isStandardFormat)
+	results := h.updateDNS(ctx, domain, subdomain, ipAddress, h.extractClientIP(r), wait)
+	status := h.reportViews(ctx, w, hostname, results)
+	h.observe(hostname, status)
+	if status != "good" {
+		h.respond(w, status, ipAddress, isStandardFormat)
 		return
 	}
 
-	logger.Info("Successfully updated %s to %s", hostname, ipAddress)
+	logger.InfoContext(r.Context(), "Successfully updated %s to %s", hostname, ipAddress)
 	h.respond(w, "good", ipAddress, isStandardFormat)
 }
 
+// observe records the status of a request. Rejected hostnames are passed
+// as "", so that they neither become metric labels nor Home Assistant
+// entities.
+func (h *DynDNSHandler) observe(hostname, status string) {
+	metrics.ObserveUpdate(hostname, status)
+	if h.config.OnResult != nil {
+		h.config.OnResult(hostname, status)
+	}
+}
+
+// reportViews logs the result of every view, adds one X-Homeddns-View header
+// per result and returns the DynDNS status of the primary view.
+func (h *DynDNSHandler) reportViews(ctx context.Context, w http.ResponseWriter, hostname string, results []updater.Result) string {
+	views := h.config.Updater.Views()
+	if len(views) == 0 {
+		return "911"
+	}
+	primary := views[0].Name
+
+	primaryUpdated, primaryFailed := false, false
+	for _, result := range results {
+		viewStatus := "good"
+		if result.Err != nil {
+			viewStatus = "911"
+			logger.ErrorContext(ctx, "Error updating DNS for %s in view %s (%s): %v", hostname, result.View, result.Provider, result.Err)
+		} else {
+			logger.DebugContext(ctx, "View %s: updated %s %s to %s", result.View, hostname, result.Record.Type, result.Record.Value)
+		}
+		w.Header().Add("X-Homeddns-View", fmt.Sprintf("%s=%s %s", result.View, viewStatus, result.Record.Value))
+
+		if result.View == primary {
+			primaryUpdated = true
+			primaryFailed = primaryFailed || result.Err != nil
+		}
+	}
+
+	// Any failed record of the primary view fails the whole update
+	if !primaryUpdated || primaryFailed {
+		return "911"
+	}
+	return "good"
+}
+
 // extractHostname extracts the hostname from the request
 func (h *DynDNSHandler) extractHostname(r *http.Request) string {
 	// Standard format: /nic/update?hostname=example.com
@@ -146,6 +255,11 @@ func (h *DynDNSHandler) splitHostname(hostname string) (domain, subdomain string
 	return domain, subdomain
 }
 
+// zoneOf returns the longest configured zone containing hostname
+func (h *DynDNSHandler) zoneOf(hostname string) (string, bool) {
+	return updater.ZoneOf(h.config.Zones, hostname)
+}
+
 // extractIP extracts the IP address from the request
 func (h *DynDNSHandler) extractIP(r *http.Request) string {
 	// Check query parameter first
@@ -156,16 +270,31 @@ func (h *DynDNSHandler) extractIP(r *http.Request) string {
 	}
 
 	// Fall back to request source IP
+	return h.extractClientIP(r)
+}
+
+// extractClientIP extracts the source IP address of the request. The
+// X-Forwarded-For header is only used if the peer is a trusted proxy; its
+// addresses are walked from the right, skipping further trusted proxies.
+func (h *DynDNSHandler) extractClientIP(r *http.Request) string {
 	ip := r.RemoteAddr
 	if host, _, err := net.SplitHostPort(ip); err == nil {
 		ip = host
 	}
 
-	// Handle X-Forwarded-For header
-	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-		ips := strings.Split(forwarded, ",")
-		if len(ips) > 0 {
-			ip = strings.TrimSpace(ips[0])
+	forwarded := r.Header.Get("X-Forwarded-For")
+	if forwarded != "" && !h.trustedProxy(ip) {
+		h.untrustedForward.Do(func() {
+			logger.WarnContext(r.Context(), "Ignoring X-Forwarded-For from %s, which is not in TRUSTED_PROXIES; the client address of requests through a reverse proxy is the proxy's", ip)
+		})
+	}
+	if forwarded != "" && h.trustedProxy(ip) {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip = strings.TrimSpace(hops[i])
+			if !h.trustedProxy(ip) {
+				break
+			}
 		}
 	}
 
@@ -176,31 +305,39 @@ func (h *DynDNSHandler) extractIP(r *http.Request) string {
 	return ""
 }
 
-// updateDNS updates the DNS record via the configured provider
-func (h *DynDNSHandler) updateDNS(ctx context.Context, domain, subdomain, ipAddress string) error {
-	// Determine record type
-	recordType := "A"
-	if strings.Contains(ipAddress, ":") {
-		recordType = "AAAA"
+// trustedProxy reports whether ip is one of the trusted proxies
+func (h *DynDNSHandler) trustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
 	}
-
-	// Build full hostname
-	hostname := h.buildHostname(subdomain, domain)
-
-	// Prepare DNS record
-	record := &provider.DNSRecord{
-		Name:  hostname,
-		Type:  recordType,
-		Value: ipAddress,
-		TTL:   h.config.DefaultTTL,
+	for _, network := range h.config.TrustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
 	}
+	return false
+}
 
-	// Update the record via provider
-	if err := h.config.Provider.UpdateRecord(ctx, domain, record); err != nil {
-		return fmt.Errorf("update DNS record: %w", err)
-	}
+// updateDNS updates the DNS records of all views
+func (h *DynDNSHandler) updateDNS(ctx context.Context, domain, subdomain, ipAddress, clientIP string, wait time.Duration) []updater.Result {
+	return h.config.Updater.Update(ctx, updater.Request{
+		Hostname: h.buildHostname(subdomain, domain),
+		Domain:   domain,
+		Address:  ipAddress,
+		Client:   clientIP,
+		User:     auth.UserFromContext(ctx),
+		Wait:     wait,
+	})
+}
 
-	return nil
+// extractWait returns the propagation timeout if the request asks to wait
+// (wait=1 or wait=true)
+func (h *DynDNSHandler) extractWait(r *http.Request) time.Duration {
+	if wait, err := strconv.ParseBool(r.URL.Query().Get("wait")); err == nil && wait {
+		return h.config.WaitTimeout
+	}
+	return 0
 }
 
 // buildHostname builds a full hostname from subdomain and domain
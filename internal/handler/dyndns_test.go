@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/auth"
+	"github.com/markussiebert/homeddns/internal/metrics"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/updater"
+)
+
+// memProvider keeps records in memory and fails every update if err is set
+type memProvider struct {
+	err error
+
+	mu      sync.Mutex
+	records map[string]string
+}
+
+func (p *memProvider) Name() string { return "mem" }
+
+func (p *memProvider) GetRecord(ctx context.Context, domain, hostname, recordType string) (*provider.DNSRecord, error) {
+	return nil, provider.ErrNotSupported
+}
+
+func (p *memProvider) UpdateRecord(ctx context.Context, domain string, record *provider.DNSRecord) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records[record.Name+"/"+record.Type] = record.Value
+	return nil
+}
+
+func (p *memProvider) Close(ctx context.Context) error { return nil }
+
+func get(h http.Handler, remoteAddr, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.RemoteAddr = remoteAddr
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDynDNSHandler_PrimaryView(t *testing.T) {
+	public := &memProvider{records: map[string]string{}}
+	lan := &memProvider{records: map[string]string{}, err: errors.New("pihole unreachable")}
+	h := NewDynDNSHandler(Config{Updater: updater.New(60,
+		updater.View{Name: "public", Provider: public},
+		updater.View{Name: "lan", Provider: lan, Source: updater.SourceClient},
+	)})
+
+	// A failing LAN view is reported in a header, but the update is good
+	rec := get(h, "192.168.1.2:4321", "/nic/update?hostname=nas.example.com&myip=203.0.113.7", nil)
+	assert.Equal(t, "good 203.0.113.7\n", rec.Body.String())
+	assert.Equal(t, []string{"public=good 203.0.113.7", "lan=911 192.168.1.2"}, rec.Header().Values("X-Homeddns-View"))
+
+	// A failing public view fails the update
+	public.err = errors.New("netcup unreachable")
+	lan.err = nil
+	rec = get(h, "192.168.1.2:4321", "/nic/update?hostname=nas.example.com&myip=203.0.113.7", nil)
+	assert.Equal(t, "911 203.0.113.7\n", rec.Body.String())
+	assert.Equal(t, "192.168.1.2", lan.records["nas.example.com/A"])
+}
+
+func TestDynDNSHandler_ClientAddress(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/24")
+	assert.NoError(t, err)
+	public := &memProvider{records: map[string]string{}}
+	lan := &memProvider{records: map[string]string{}}
+	h := NewDynDNSHandler(Config{
+		Updater: updater.New(60,
+			updater.View{Name: "public", Provider: public},
+			updater.View{Name: "lan", Provider: lan, Source: updater.SourceClient},
+		),
+		TrustedProxies: []*net.IPNet{proxies},
+	})
+	forwarded := http.Header{"X-Forwarded-For": {"192.168.1.66, 192.168.1.2, 10.0.0.5"}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		{"direct", "192.168.1.2:4321", nil, "192.168.1.2"},
+		// The header of untrusted peers is ignored
+		{"spoofed", "192.168.1.3:4321", forwarded, "192.168.1.3"},
+		// Trusted proxies are skipped from the right
+		{"proxied", "10.0.0.1:4321", forwarded, "192.168.1.2"},
+		{"only proxies", "10.0.0.1:4321", http.Header{"X-Forwarded-For": {"10.0.0.5"}}, "10.0.0.5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := get(h, test.remoteAddr, "/nic/update?hostname=nas.example.com", test.header)
+			assert.Equal(t, "good "+test.want+"\n", rec.Body.String())
+			assert.Equal(t, test.want, lan.records["nas.example.com/A"])
+		})
+	}
+}
+
+func TestDynDNSHandler_MetricLabels(t *testing.T) {
+	var results []string
+	h := auth.Middleware(auth.Config{
+		Users: []auth.User{{Username: "router", Password: "secret", Hosts: []string{"nas.example.com"}}},
+	})(NewDynDNSHandler(Config{
+		Provider: &memProvider{records: map[string]string{}},
+		Zones:    []string{"example.com"},
+		OnResult: func(hostname, status string) { results = append(results, hostname+"="+status) },
+	}))
+	good := metrics.UpdateRequests.Value("good", "nas.example.com")
+	other := metrics.UpdateRequests.Value("nohost", metrics.OtherHostname)
+
+	for _, hostname := range []string{"nas.example.com", "random1.example.com", "random2.example.org"} {
+		req := httptest.NewRequest(http.MethodGet, "/nic/update?hostname="+hostname+"&myip=203.0.113.7", nil)
+		req.SetBasicAuth("router", "secret")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Rejected hostnames do not become labels
+	assert.Equal(t, []string{"nas.example.com=good", "=nohost", "=nohost"}, results)
+	assert.Equal(t, good+1, metrics.UpdateRequests.Value("good", "nas.example.com"))
+	assert.Equal(t, other+2, metrics.UpdateRequests.Value("nohost", metrics.OtherHostname))
+	assert.Equal(t, float64(0), metrics.UpdateRequests.Value("nohost", "random1.example.com"))
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/logger"
+)
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logger.RequestID(r.Context())
+	}))
+
+	// A new ID is generated
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nic/update", nil))
+	assert.Equal(t, 16, len(seen))
+	assert.Equal(t, seen, rec.Header().Get(RequestIDHeader))
+
+	// A proxy's ID is kept
+	req := httptest.NewRequest(http.MethodGet, "/nic/update", nil)
+	req.Header.Set(RequestIDHeader, "proxy-42")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, "proxy-42", seen)
+
+	// Malformed IDs are replaced
+	req = httptest.NewRequest(http.MethodGet, "/nic/update", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.NotEqual(t, "bad id\n", seen)
+	assert.Equal(t, 16, len(seen))
+}
@@ -0,0 +1,142 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/provider"
+)
+
+// Status values of a provider check and of the whole report
+const (
+	StatusOK          = "ok"
+	StatusError       = "error"
+	StatusUnsupported = "unsupported" // provider has no HealthCheck
+)
+
+// Target is a provider to check
+type Target struct {
+	View     string
+	Provider provider.Provider
+}
+
+// ProviderStatus is the result of one provider check
+type ProviderStatus struct {
+	View     string `json:"view"`
+	Provider string `json:"provider"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Latency  string `json:"latency,omitempty"`
+}
+
+// Report is the readiness of all providers
+type Report struct {
+	Status    string           `json:"status"`
+	Checked   time.Time        `json:"checked"`
+	Providers []ProviderStatus `json:"providers"`
+}
+
+// Checker runs the provider health checks and caches the result
+type Checker struct {
+	targets []Target
+	ttl     time.Duration
+	timeout time.Duration
+	now     func() time.Time
+
+	mu   sync.Mutex
+	last *Report
+}
+
+// New creates a checker whose report is reused for ttl
+func New(ttl time.Duration, targets ...Target) *Checker {
+	return &Checker{
+		targets: targets,
+		ttl:     ttl,
+		timeout: 10 * time.Second,
+		now:     time.Now,
+	}
+}
+
+// SetTargets replaces the providers to check and drops the cached report
+func (c *Checker) SetTargets(targets ...Target) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets = targets
+	c.last = nil
+}
+
+// Check returns the cached report, or checks all providers concurrently if
+// it is older than the TTL. Concurrent callers share one check, which is not
+// canceled with the caller, since its result is cached for all of them.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last != nil && c.now().Sub(c.last.Checked) < c.ttl {
+		return *c.last
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checked: c.now(), Providers: make([]ProviderStatus, len(c.targets))}
+	var wg sync.WaitGroup
+	for i, target := range c.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Providers[i] = check(ctx, target)
+		}()
+	}
+	wg.Wait()
+
+	for _, status := range report.Providers {
+		if status.Status == StatusError {
+			report.Status = StatusError
+		}
+	}
+	c.last = &report
+	return report
+}
+
+// check runs the health check of one provider
+func check(ctx context.Context, target Target) ProviderStatus {
+	status := ProviderStatus{View: target.View, Provider: target.Provider.Name(), Status: StatusOK}
+
+	checker, ok := provider.As[provider.HealthChecker](target.Provider)
+	if !ok {
+		status.Status = StatusUnsupported
+		return status
+	}
+
+	start := time.Now()
+	err := checker.HealthCheck(ctx)
+	status.Latency = time.Since(start).Round(time.Millisecond).String()
+	if err != nil {
+		status.Status = StatusError
+		status.Error = err.Error()
+		logger.WarnContext(ctx, "Readiness check of %s (view %s) failed: %v", status.Provider, status.View, err)
+	}
+	return status
+}
+
+// ServeHTTP returns the report as JSON with status 200 if all providers are
+// healthy and 503 otherwise
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	report := c.Check(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,110 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/provider"
+)
+
+// stubProvider is a provider without a health check
+type stubProvider struct {
+	name string
+}
+
+func (p *stubProvider) Name() string { return p.name }
+
+func (p *stubProvider) GetRecord(ctx context.Context, domain, hostname, recordType string) (*provider.DNSRecord, error) {
+	return nil, fmt.Errorf("record not found")
+}
+
+func (p *stubProvider) UpdateRecord(ctx context.Context, domain string, record *provider.DNSRecord) error {
+	return nil
+}
+
+func (p *stubProvider) Close(ctx context.Context) error { return nil }
+
+// checkedProvider is a provider whose health check returns err
+type checkedProvider struct {
+	stubProvider
+	err    error
+	checks int
+}
+
+func (p *checkedProvider) HealthCheck(ctx context.Context) error {
+	p.checks++
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.err
+}
+
+func TestChecker(t *testing.T) {
+	public := &checkedProvider{stubProvider: stubProvider{name: "netcup_ccp"}}
+	lan := &stubProvider{name: "dnsmasq"}
+	c := New(time.Minute,
+		Target{View: "public", Provider: provider.WithRetry(public, provider.RetryPolicy{})},
+		Target{View: "lan", Provider: lan},
+	)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	report := c.Check(context.Background())
+	assert.Equal(t, StatusOK, report.Status)
+	assert.Equal(t, 2, len(report.Providers))
+	assert.Equal(t, StatusOK, report.Providers[0].Status)
+	assert.Equal(t, "netcup_ccp", report.Providers[0].Provider)
+	assert.Equal(t, StatusUnsupported, report.Providers[1].Status)
+
+	// The result is cached for the TTL
+	public.err = errors.New("login: invalid credentials")
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, StatusOK, c.Check(context.Background()).Status)
+	assert.Equal(t, 1, public.checks)
+
+	now = now.Add(time.Minute)
+	report = c.Check(context.Background())
+	assert.Equal(t, StatusError, report.Status)
+	assert.Equal(t, "login: invalid credentials", report.Providers[0].Error)
+	assert.Equal(t, 2, public.checks)
+}
+
+func TestChecker_CanceledCaller(t *testing.T) {
+	public := &checkedProvider{stubProvider: stubProvider{name: "netcup_ccp"}}
+	c := New(time.Minute, Target{View: "public", Provider: public})
+
+	// A caller that went away does not fail the check cached for others
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, StatusOK, c.Check(ctx).Status)
+	assert.Equal(t, StatusOK, c.Check(context.Background()).Status)
+	assert.Equal(t, 1, public.checks)
+}
+
+func TestChecker_ServeHTTP(t *testing.T) {
+	p := &checkedProvider{stubProvider: stubProvider{name: "aws_route53"}}
+	c := New(0, Target{View: "public", Provider: p})
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	p.err = errors.New("list hosted zones: access denied")
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var report Report
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, StatusError, report.Status)
+	assert.Equal(t, "aws_route53", report.Providers[0].Provider)
+	assert.Equal(t, "list hosted zones: access denied", report.Providers[0].Error)
+}
@@ -0,0 +1,394 @@
+// Package homeassistant publishes homeddns state to Home Assistant over MQTT
+// using MQTT discovery, and accepts update commands.
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/health"
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/mqtt"
+	"github.com/markussiebert/homeddns/internal/state"
+)
+
+// Client is the part of mqtt.Client used by the bridge
+type Client interface {
+	Publish(topic string, payload []byte, retain bool) error
+	Subscribe(filter string, handler func(mqtt.Message)) error
+}
+
+// Config configures a bridge
+type Config struct {
+	// DiscoveryPrefix is Home Assistant's discovery prefix (default
+	// "homeassistant")
+	DiscoveryPrefix string
+	// BaseTopic prefixes all state and command topics (default "homeddns")
+	BaseTopic string
+	// View is the view whose addresses are published (the primary one)
+	View    string
+	Version string
+	// Health, if set, is checked every HealthInterval (default 1m) and
+	// published as one connectivity sensor per provider
+	Health         *health.Checker
+	HealthInterval time.Duration
+	// Update forces an update of a hostname and returns its DynDNS status.
+	// If nil, update commands are ignored.
+	Update func(ctx context.Context, hostname string) string
+}
+
+// host is the published state of a hostname
+type host struct {
+	ipv4       string
+	ipv6       string
+	lastUpdate time.Time
+	result     string
+	announced  bool
+}
+
+// Bridge publishes discovery configs and states and handles commands
+type Bridge struct {
+	config Config
+
+	mu        sync.Mutex
+	client    Client // set on the first connect
+	hosts     map[string]*host
+	report    *health.Report
+	announced map[string]bool // provider sensors by view
+}
+
+// New creates a bridge. Call Connected after every (re)connect of the
+// client and Run to handle commands and health checks.
+func New(config Config) *Bridge {
+	if config.DiscoveryPrefix == "" {
+		config.DiscoveryPrefix = "homeassistant"
+	}
+	if config.BaseTopic == "" {
+		config.BaseTopic = "homeddns"
+	}
+	if config.HealthInterval <= 0 {
+		config.HealthInterval = time.Minute
+	}
+	return &Bridge{
+		config:    config,
+		hosts:     make(map[string]*host),
+		announced: make(map[string]bool),
+	}
+}
+
+// AvailabilityTopic is the topic of the online/offline state, which should
+// also be the topic of the client's will
+func (b *Bridge) AvailabilityTopic() string {
+	return b.config.BaseTopic + "/status"
+}
+
+// Will is the message the client should leave with the broker, so that
+// Home Assistant shows the entities as unavailable when homeddns is gone
+func (b *Bridge) Will() *mqtt.Message {
+	return &mqtt.Message{Topic: b.AvailabilityTopic(), Payload: []byte("offline"), Retain: true}
+}
+
+// CommandTopic is the topic on which a known hostname (or an empty payload
+// for all hostnames) triggers an update
+func (b *Bridge) CommandTopic() string {
+	return b.config.BaseTopic + "/update"
+}
+
+// Seed adds the stored records of the view
+func (b *Bridge) Seed(records []state.Record) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, record := range records {
+		if record.View != b.config.View {
+			continue
+		}
+		h := b.host(record.Hostname)
+		h.setAddress(record.Type, record.Value)
+		if record.LastSeen.After(h.lastUpdate) {
+			h.lastUpdate = record.LastSeen
+		}
+	}
+}
+
+// Connected announces the bridge and publishes all known state. Call it
+// from the client's OnConnect callback.
+func (b *Bridge) Connected(client Client) {
+	b.mu.Lock()
+	b.client = client
+	b.mu.Unlock()
+
+	b.publish(b.AvailabilityTopic(), "online")
+
+	b.mu.Lock()
+	hostnames := make([]string, 0, len(b.hosts))
+	for hostname, h := range b.hosts {
+		h.announced = false
+		hostnames = append(hostnames, hostname)
+	}
+	b.announced = make(map[string]bool)
+	report := b.report
+	b.mu.Unlock()
+
+	sort.Strings(hostnames)
+	for _, hostname := range hostnames {
+		b.publishHost(hostname)
+	}
+	if report != nil {
+		b.publishHealth(*report)
+	}
+}
+
+// Change publishes the new address of a changed record. Pass it to
+// state.Store.Subscribe.
+func (b *Bridge) Change(change state.Change) {
+	if change.View != b.config.View {
+		return
+	}
+	hostname := strings.ToLower(change.Hostname)
+	b.mu.Lock()
+	b.host(hostname).setAddress(change.Type, change.Value)
+	b.mu.Unlock()
+	b.publishHost(hostname)
+}
+
+// Result publishes the DynDNS status of an update request
+func (b *Bridge) Result(hostname, status string) {
+	if hostname == "" {
+		return
+	}
+	hostname = strings.ToLower(hostname)
+	b.mu.Lock()
+	h := b.host(hostname)
+	h.result = status
+	if status == "good" || status == "nochg" {
+		h.lastUpdate = time.Now()
+	}
+	b.mu.Unlock()
+	b.publishHost(hostname)
+}
+
+// Run subscribes client to the command topic and publishes the provider
+// health until ctx is done
+func (b *Bridge) Run(ctx context.Context, client Client) error {
+	if b.config.Update != nil {
+		err := client.Subscribe(b.CommandTopic(), func(msg mqtt.Message) {
+			go b.command(ctx, strings.TrimSpace(string(msg.Payload)))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if b.config.Health == nil {
+		<-ctx.Done()
+		return nil
+	}
+
+	ticker := time.NewTicker(b.config.HealthInterval)
+	defer ticker.Stop()
+	for {
+		report := b.config.Health.Check(ctx)
+		b.mu.Lock()
+		b.report = &report
+		b.mu.Unlock()
+		b.publishHealth(report)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// command forces an update of one or, for an empty payload, all hostnames.
+// Only hostnames the bridge already knows can be updated, so that anyone
+// able to publish cannot create records or entities.
+func (b *Bridge) command(ctx context.Context, hostname string) {
+	var hostnames []string
+	b.mu.Lock()
+	if hostname != "" {
+		hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+		if _, ok := b.hosts[hostname]; ok {
+			hostnames = []string{hostname}
+		}
+	} else {
+		for name := range b.hosts {
+			hostnames = append(hostnames, name)
+		}
+	}
+	b.mu.Unlock()
+	if hostname != "" && len(hostnames) == 0 {
+		logger.Warn("Ignoring MQTT update of unknown hostname %s", hostname)
+		return
+	}
+	sort.Strings(hostnames)
+
+	for _, name := range hostnames {
+		logger.Info("Update of %s requested via MQTT", name)
+		b.Result(name, b.config.Update(ctx, name))
+	}
+}
+
+// host returns the state of a hostname; the caller must hold b.mu
+func (b *Bridge) host(hostname string) *host {
+	hostname = strings.ToLower(hostname)
+	h, ok := b.hosts[hostname]
+	if !ok {
+		h = &host{}
+		b.hosts[hostname] = h
+	}
+	return h
+}
+
+// setAddress stores an address by record type
+func (h *host) setAddress(recordType, value string) {
+	switch recordType {
+	case "A":
+		h.ipv4 = value
+	case "AAAA":
+		h.ipv6 = value
+	}
+}
+
+// publishHost publishes the discovery configs of a hostname once per
+// connection, and its current state
+func (b *Bridge) publishHost(hostname string) {
+	b.mu.Lock()
+	h := *b.hosts[hostname]
+	b.hosts[hostname].announced = true
+	b.mu.Unlock()
+
+	id := objectID(hostname)
+	topic := b.config.BaseTopic + "/" + id
+
+	if !h.announced {
+		for _, sensor := range []struct {
+			suffix, name, icon, deviceClass string
+		}{
+			{"ipv4", "IPv4", "mdi:ip-network", ""},
+			{"ipv6", "IPv6", "mdi:ip-network-outline", ""},
+			{"last_update", "Last update", "", "timestamp"},
+			{"result", "Last result", "mdi:check-network", ""},
+		} {
+			b.publishConfig("sensor", id+"_"+sensor.suffix, map[string]any{
+				"name":         hostname + " " + sensor.name,
+				"state_topic":  topic + "/" + sensor.suffix,
+				"icon":         sensor.icon,
+				"device_class": sensor.deviceClass,
+			})
+		}
+		b.publishConfig("button", id+"_update", map[string]any{
+			"name":          hostname + " Update",
+			"command_topic": b.CommandTopic(),
+			"payload_press": hostname,
+			"icon":          "mdi:refresh",
+		})
+	}
+
+	b.publishState(topic+"/ipv4", h.ipv4)
+	b.publishState(topic+"/ipv6", h.ipv6)
+	if !h.lastUpdate.IsZero() {
+		b.publishState(topic+"/last_update", h.lastUpdate.UTC().Format(time.RFC3339))
+	}
+	b.publishState(topic+"/result", h.result)
+}
+
+// publishHealth publishes one connectivity sensor per provider
+func (b *Bridge) publishHealth(report health.Report) {
+	for _, status := range report.Providers {
+		id := "provider_" + objectID(status.View)
+		topic := b.config.BaseTopic + "/provider/" + objectID(status.View)
+
+		b.mu.Lock()
+		announced := b.announced[status.View]
+		b.announced[status.View] = true
+		b.mu.Unlock()
+		if !announced {
+			b.publishConfig("binary_sensor", id, map[string]any{
+				"name":                  "Provider " + status.View + " (" + status.Provider + ")",
+				"state_topic":           topic + "/state",
+				"json_attributes_topic": topic + "/attributes",
+				"device_class":          "connectivity",
+				"entity_category":       "diagnostic",
+			})
+		}
+
+		value := "ON"
+		if status.Status == health.StatusError {
+			value = "OFF"
+		}
+		b.publishState(topic+"/state", value)
+		attributes, _ := json.Marshal(status)
+		b.publish(topic+"/attributes", string(attributes))
+	}
+}
+
+// publishConfig publishes a discovery config with the shared device and
+// availability settings. Empty values are left out.
+func (b *Bridge) publishConfig(component, id string, config map[string]any) {
+	for key, value := range config {
+		if value == "" {
+			delete(config, key)
+		}
+	}
+	config["unique_id"] = "homeddns_" + id
+	config["availability_topic"] = b.AvailabilityTopic()
+	config["device"] = map[string]any{
+		"identifiers":  []string{"homeddns"},
+		"name":         "HomeDDNS",
+		"manufacturer": "homeddns",
+		"model":        "Dynamic DNS updater",
+		"sw_version":   b.config.Version,
+	}
+	payload, err := json.Marshal(config)
+	if err != nil {
+		logger.Warn("Failed to encode discovery config %s: %v", id, err)
+		return
+	}
+	b.publish(b.config.DiscoveryPrefix+"/"+component+"/homeddns/"+id+"/config", string(payload))
+}
+
+// publishState publishes a state, skipping unknown values
+func (b *Bridge) publishState(topic, value string) {
+	if value == "" {
+		return
+	}
+	b.publish(topic, value)
+}
+
+// publish sends a retained message. While disconnected, messages are
+// dropped; Connected publishes the current state again.
+func (b *Bridge) publish(topic, payload string) {
+	b.mu.Lock()
+	client := b.client
+	b.mu.Unlock()
+	if client == nil {
+		return
+	}
+	if err := client.Publish(topic, []byte(payload), true); err != nil {
+		if errors.Is(err, mqtt.ErrNotConnected) {
+			logger.Debug("Not publishing %s: %v", topic, err)
+			return
+		}
+		logger.Warn("Failed to publish %s: %v", topic, err)
+	}
+}
+
+// objectID turns a hostname or view name into a topic level and entity ID
+func objectID(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return '_'
+		}
+	}, name)
+}
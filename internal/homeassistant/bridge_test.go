@@ -0,0 +1,131 @@
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/health"
+	"github.com/markussiebert/homeddns/internal/mqtt"
+	"github.com/markussiebert/homeddns/internal/mqtt/mqtttest"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/state"
+)
+
+// healthyProvider passes every health check
+type healthyProvider struct {
+	provider.Provider
+}
+
+func (healthyProvider) Name() string                          { return "fake" }
+func (healthyProvider) HealthCheck(ctx context.Context) error { return nil }
+
+// startBridge connects a bridge to the broker until the test ends
+func startBridge(t *testing.T, broker *mqtttest.Broker, config Config, records []state.Record) *Bridge {
+	t.Helper()
+	bridge := New(config)
+	bridge.Seed(records)
+	client, err := mqtt.NewClient(mqtt.Options{
+		Broker:    broker.URL,
+		Will:      bridge.Will(),
+		OnConnect: func(c *mqtt.Client) { bridge.Connected(c) },
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{}, 2)
+	go func() { client.Run(ctx); done <- struct{}{} }()
+	go func() { _ = bridge.Run(ctx, client); done <- struct{}{} }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		<-done
+	})
+	return bridge
+}
+
+// payload returns the retained payload of a topic
+func payload(t *testing.T, broker *mqtttest.Broker, topic string) string {
+	t.Helper()
+	msg, ok := broker.Retained(topic)
+	assert.True(t, ok, "nothing retained on %s", topic)
+	return string(msg.Payload)
+}
+
+func TestBridge_PublishesDiscoveryAndState(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	lastSeen := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	bridge := startBridge(t, broker, Config{
+		View:    "public",
+		Version: "1.2.3",
+		Health:  health.New(0, health.Target{View: "public", Provider: healthyProvider{}}),
+	}, []state.Record{
+		{Hostname: "nas.example.com", Type: "A", Value: "192.0.2.1", View: "public", LastSeen: lastSeen},
+		{Hostname: "nas.example.com", Type: "A", Value: "10.0.0.5", View: "lan"},
+	})
+
+	broker.WaitFor(t, "homeddns/nas_example_com/last_update", nil)
+	assert.Equal(t, "online", payload(t, broker, "homeddns/status"))
+	assert.Equal(t, "192.0.2.1", payload(t, broker, "homeddns/nas_example_com/ipv4"))
+	assert.Equal(t, "2024-05-01T12:00:00Z", payload(t, broker, "homeddns/nas_example_com/last_update"))
+
+	var config map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(payload(t, broker, "homeassistant/sensor/homeddns/nas_example_com_ipv4/config")), &config))
+	assert.Equal(t, "homeddns/nas_example_com/ipv4", config["state_topic"].(string))
+	assert.Equal(t, "homeddns/status", config["availability_topic"].(string))
+	assert.Equal(t, "homeddns_nas_example_com_ipv4", config["unique_id"].(string))
+	assert.Equal(t, "1.2.3", config["device"].(map[string]any)["sw_version"].(string))
+
+	assert.NoError(t, json.Unmarshal([]byte(payload(t, broker, "homeassistant/button/homeddns/nas_example_com_update/config")), &config))
+	assert.Equal(t, "homeddns/update", config["command_topic"].(string))
+	assert.Equal(t, "nas.example.com", config["payload_press"].(string))
+
+	broker.WaitFor(t, "homeddns/provider/public/state", nil)
+	assert.Equal(t, "ON", payload(t, broker, "homeddns/provider/public/state"))
+
+	// Changes and results update the state
+	bridge.Change(state.Change{Hostname: "nas.example.com", Type: "AAAA", Value: "2001:db8::1", View: "public"})
+	bridge.Change(state.Change{Hostname: "nas.example.com", Type: "A", Value: "10.0.0.6", View: "lan"})
+	bridge.Result("nas.example.com", "911")
+	broker.WaitFor(t, "homeddns/nas_example_com/result", nil)
+	assert.Equal(t, "2001:db8::1", payload(t, broker, "homeddns/nas_example_com/ipv6"))
+	assert.Equal(t, "192.0.2.1", payload(t, broker, "homeddns/nas_example_com/ipv4"))
+	assert.Equal(t, "911", payload(t, broker, "homeddns/nas_example_com/result"))
+}
+
+func TestBridge_UpdateCommand(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	updated := make(chan string, 2)
+	startBridge(t, broker, Config{
+		View: "public",
+		Update: func(ctx context.Context, hostname string) string {
+			updated <- hostname
+			return "good"
+		},
+	}, []state.Record{
+		{Hostname: "nas.example.com", Type: "A", Value: "192.0.2.1", View: "public"},
+		{Hostname: "vpn.example.com", Type: "A", Value: "192.0.2.1", View: "public"},
+	})
+	broker.WaitForSubscription(t, "homeddns/update")
+
+	// Unknown hostnames are ignored
+	broker.Publish(mqtt.Message{Topic: "homeddns/update", Payload: []byte("random.example.com")})
+	broker.Publish(mqtt.Message{Topic: "homeddns/update", Payload: []byte("NAS.example.com")})
+	assert.Equal(t, "nas.example.com", <-updated)
+	broker.WaitFor(t, "homeddns/nas_example_com/result", func(msg mqtt.Message) bool { return string(msg.Payload) == "good" })
+	_, ok := broker.Retained("homeddns/random_example_com/result")
+	assert.False(t, ok)
+	broker.WaitFor(t, "homeddns/nas_example_com/last_update", nil)
+
+	// An empty payload updates all known hostnames
+	broker.Publish(mqtt.Message{Topic: "homeddns/update"})
+	assert.Equal(t, "nas.example.com", <-updated)
+	assert.Equal(t, "vpn.example.com", <-updated)
+}
+
+func TestObjectID(t *testing.T) {
+	assert.Equal(t, "nas_example_com", objectID("NAS.example.com"))
+	assert.Equal(t, "__example_com", objectID("*.example.com"))
+}
@@ -1,11 +1,16 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/util"
 )
 
 // Level represents a log level
@@ -38,36 +43,80 @@ func (l Level) String() string {
 	}
 }
 
-// Logger is a leveled logger
+// slogLevel returns the slog level of a log level
+func (l Level) slogLevel() slog.Level {
+	switch l {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Logger is a leveled logger writing through a slog handler
 type Logger struct {
-	level  Level
-	logger *log.Logger
+	level   *slog.LevelVar
+	handler slog.Handler
 }
 
-var defaultLogger *Logger
+var defaultLogger atomic.Pointer[Logger]
 
 func init() {
-	defaultLogger = New(os.Getenv("LOG_LEVEL"))
+	setDefault(NewWithFormat(os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"), os.Stdout))
 }
 
-// New creates a new logger with the specified level
+// New creates a new text logger with the specified level
 // levelStr can be: "debug", "info", "warn", "error" (case-insensitive)
 // If empty or invalid, defaults to INFO level
 func New(levelStr string) *Logger {
-	level := parseLevel(levelStr)
-	return &Logger{
-		level:  level,
-		logger: log.New(os.Stdout, "", log.LstdFlags),
-	}
+	return NewWithWriter(levelStr, os.Stdout)
 }
 
-// NewWithWriter creates a new logger with a custom writer
+// NewWithWriter creates a new text logger with a custom writer
 func NewWithWriter(levelStr string, w io.Writer) *Logger {
-	level := parseLevel(levelStr)
-	return &Logger{
-		level:  level,
-		logger: log.New(w, "", log.LstdFlags),
+	return NewWithFormat(levelStr, FormatText, w)
+}
+
+// NewWithFormat creates a new logger writing text (logfmt) or JSON lines
+// to w. Unknown formats fall back to text.
+func NewWithFormat(levelStr, format string, w io.Writer) *Logger {
+	level := new(slog.LevelVar)
+	level.Set(parseLevel(levelStr).slogLevel())
+	return newLogger(level, format, w)
+}
+
+// newLogger creates a logger with a shared level
+func newLogger(level *slog.LevelVar, format string, w io.Writer) *Logger {
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	var handler slog.Handler
+	if strings.EqualFold(strings.TrimSpace(format), FormatJSON) {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
 	}
+	return &Logger{level: level, handler: &contextHandler{Handler: handler}}
+}
+
+// redactAttr hides the values of sensitive attributes and of sensitive
+// key=value pairs in messages, so that secrets cannot be logged by accident
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && a.Key == slog.MessageKey {
+		return slog.String(a.Key, util.RedactKeyValues(a.Value.String()))
+	}
+	if util.IsSensitiveKey(a.Key) {
+		return slog.String(a.Key, util.Redacted)
+	}
+	return a
 }
 
 // parseLevel parses a log level string
@@ -86,56 +135,94 @@ func parseLevel(levelStr string) Level {
 	}
 }
 
-// SetLevel sets the log level
+// SetLevel sets the log level. It is safe to call while logging.
 func (l *Logger) SetLevel(level Level) {
-	l.level = level
+	l.level.Set(level.slogLevel())
 }
 
 // GetLevel returns the current log level
 func (l *Logger) GetLevel() Level {
-	return l.level
+	switch level := l.level.Level(); {
+	case level <= slog.LevelDebug:
+		return LevelDebug
+	case level <= slog.LevelInfo:
+		return LevelInfo
+	case level <= slog.LevelWarn:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+// Slog returns a slog.Logger writing through the same handler
+func (l *Logger) Slog() *slog.Logger {
+	return slog.New(l.handler)
 }
 
 // log outputs a log message at the specified level
-func (l *Logger) log(level Level, format string, v ...interface{}) {
-	if level < l.level {
+func (l *Logger) log(ctx context.Context, level Level, format string, v ...interface{}) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	slogLevel := level.slogLevel()
+	if !l.handler.Enabled(ctx, slogLevel) {
 		return
 	}
-	prefix := fmt.Sprintf("[%s] ", level)
-	l.logger.Printf(prefix+format, v...)
+	record := slog.NewRecord(time.Now(), slogLevel, fmt.Sprintf(format, v...), 0)
+	_ = l.handler.Handle(ctx, record)
 }
 
 // Debug logs a debug message
 func (l *Logger) Debug(format string, v ...interface{}) {
-	l.log(LevelDebug, format, v...)
+	l.log(context.Background(), LevelDebug, format, v...)
 }
 
 // Info logs an info message
 func (l *Logger) Info(format string, v ...interface{}) {
-	l.log(LevelInfo, format, v...)
+	l.log(context.Background(), LevelInfo, format, v...)
 }
 
 // Warn logs a warning message
 func (l *Logger) Warn(format string, v ...interface{}) {
-	l.log(LevelWarn, format, v...)
+	l.log(context.Background(), LevelWarn, format, v...)
 }
 
 // Error logs an error message
 func (l *Logger) Error(format string, v ...interface{}) {
-	l.log(LevelError, format, v...)
+	l.log(context.Background(), LevelError, format, v...)
+}
+
+// DebugContext logs a debug message with the request ID of ctx
+func (l *Logger) DebugContext(ctx context.Context, format string, v ...interface{}) {
+	l.log(ctx, LevelDebug, format, v...)
+}
+
+// InfoContext logs an info message with the request ID of ctx
+func (l *Logger) InfoContext(ctx context.Context, format string, v ...interface{}) {
+	l.log(ctx, LevelInfo, format, v...)
+}
+
+// WarnContext logs a warning message with the request ID of ctx
+func (l *Logger) WarnContext(ctx context.Context, format string, v ...interface{}) {
+	l.log(ctx, LevelWarn, format, v...)
+}
+
+// ErrorContext logs an error message with the request ID of ctx
+func (l *Logger) ErrorContext(ctx context.Context, format string, v ...interface{}) {
+	l.log(ctx, LevelError, format, v...)
 }
 
 // Errorf logs an error message and returns the error for convenient error handling
 // This eliminates the need to call both logger.Error() and fmt.Errorf() separately
 func (l *Logger) Errorf(format string, v ...interface{}) error {
 	err := fmt.Errorf(format, v...)
-	l.log(LevelError, "%v", err)
+	l.log(context.Background(), LevelError, "%v", err)
 	return err
 }
 
 // Fatal logs an error message and exits the program with status code 1
 func (l *Logger) Fatal(format string, v ...interface{}) {
-	l.log(LevelError, format, v...)
+	l.log(context.Background(), LevelError, format, v...)
 	os.Exit(1)
 }
 
@@ -147,52 +234,89 @@ func (l *Logger) Fatalf(format string, v ...interface{}) {
 
 // Default package-level functions using the default logger
 
+// setDefault replaces the default logger, also for log/slog users
+func setDefault(l *Logger) {
+	defaultLogger.Store(l)
+	slog.SetDefault(l.Slog())
+}
+
+// Default returns the default logger
+func Default() *Logger {
+	return defaultLogger.Load()
+}
+
+// SetFormat switches the default logger to text or JSON output on stdout,
+// keeping its level
+func SetFormat(format string) {
+	setDefault(newLogger(Default().level, format, os.Stdout))
+}
+
 // SetLevel sets the log level for the default logger
 func SetLevel(level Level) {
-	defaultLogger.SetLevel(level)
+	Default().SetLevel(level)
 }
 
 // SetLevelFromString sets the log level from a string
 func SetLevelFromString(levelStr string) {
-	defaultLogger.level = parseLevel(levelStr)
+	Default().SetLevel(parseLevel(levelStr))
 }
 
 // GetLevel returns the current log level
 func GetLevel() Level {
-	return defaultLogger.GetLevel()
+	return Default().GetLevel()
 }
 
 // Debug logs a debug message using the default logger
 func Debug(format string, v ...interface{}) {
-	defaultLogger.Debug(format, v...)
+	Default().Debug(format, v...)
 }
 
 // Info logs an info message using the default logger
 func Info(format string, v ...interface{}) {
-	defaultLogger.Info(format, v...)
+	Default().Info(format, v...)
 }
 
 // Warn logs a warning message using the default logger
 func Warn(format string, v ...interface{}) {
-	defaultLogger.Warn(format, v...)
+	Default().Warn(format, v...)
 }
 
 // Error logs an error message using the default logger
 func Error(format string, v ...interface{}) {
-	defaultLogger.Error(format, v...)
+	Default().Error(format, v...)
+}
+
+// DebugContext logs a debug message with the request ID of ctx using the default logger
+func DebugContext(ctx context.Context, format string, v ...interface{}) {
+	Default().DebugContext(ctx, format, v...)
+}
+
+// InfoContext logs an info message with the request ID of ctx using the default logger
+func InfoContext(ctx context.Context, format string, v ...interface{}) {
+	Default().InfoContext(ctx, format, v...)
+}
+
+// WarnContext logs a warning message with the request ID of ctx using the default logger
+func WarnContext(ctx context.Context, format string, v ...interface{}) {
+	Default().WarnContext(ctx, format, v...)
+}
+
+// ErrorContext logs an error message with the request ID of ctx using the default logger
+func ErrorContext(ctx context.Context, format string, v ...interface{}) {
+	Default().ErrorContext(ctx, format, v...)
 }
 
 // Errorf logs an error message and returns the error using the default logger
 func Errorf(format string, v ...interface{}) error {
-	return defaultLogger.Errorf(format, v...)
+	return Default().Errorf(format, v...)
 }
 
 // Fatal logs an error message and exits the program with status code 1
 func Fatal(format string, v ...interface{}) {
-	defaultLogger.Fatal(format, v...)
+	Default().Fatal(format, v...)
 }
 
 // Fatalf logs a formatted error message and exits the program with status code 1
 func Fatalf(format string, v ...interface{}) {
-	defaultLogger.Fatalf(format, v...)
+	Default().Fatalf(format, v...)
 }
@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestLogger_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithFormat("info", "json", &buf)
+
+	l.Debug("hidden")
+	l.Info("updated %s to %s", "home.example.com", "192.0.2.1")
+	l.WarnContext(WithRequestID(context.Background(), "abc123"), "slow provider")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+
+	var entry map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "INFO", entry["level"])
+	assert.Equal(t, "updated home.example.com to 192.0.2.1", entry["msg"])
+	assert.Equal(t, nil, entry["request_id"])
+
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, "abc123", entry["request_id"])
+}
+
+func TestLogger_TextAndLevels(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithWriter("warn", &buf)
+	assert.Equal(t, LevelWarn, l.GetLevel())
+
+	l.Info("hidden")
+	l.SetLevel(LevelDebug)
+	assert.Equal(t, LevelDebug, l.GetLevel())
+	l.DebugContext(WithRequestID(context.Background(), "r1"), "visible")
+
+	out := buf.String()
+	assert.NotContains(t, out, "hidden")
+	assert.Contains(t, out, `level=DEBUG msg=visible request_id=r1`)
+}
+
+func TestSetLevelConcurrently(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithWriter("info", &buf)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			l.SetLevel(LevelDebug)
+			l.SetLevel(LevelError)
+		}
+	}()
+	for range 100 {
+		_ = l.GetLevel()
+		l.Debug("message")
+	}
+	<-done
+}
+
+func TestLogger_RedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithFormat("debug", "json", &buf)
+
+	l.Debug("Query params: hostname=%s&password=%s", "home.example.com", "hunter2")
+	l.Slog().Info("login", "api_password", "hunter2", "user", "dyndns")
+
+	out := buf.String()
+	assert.NotContains(t, out, "hunter2")
+	assert.Contains(t, out, "hostname=home.example.com")
+	assert.Contains(t, out, `"api_password":"[REDACTED]"`)
+	assert.Contains(t, out, `"user":"dyndns"`)
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Default is the registry served at /metrics
+var Default = NewRegistry()
+
+var (
+	// UpdateRequests counts DynDNS update requests by response code and hostname
+	UpdateRequests = Default.NewCounterVec("homeddns_update_requests_total",
+		"DynDNS update requests by response code and hostname.", "code", "hostname")
+
+	// LastUpdate is the time of the last successful update per hostname
+	LastUpdate = Default.NewGaugeVec("homeddns_last_successful_update_timestamp_seconds",
+		"Unix time of the last successful update of a hostname.", "hostname")
+
+	// ProviderDuration observes the latency of provider calls
+	ProviderDuration = Default.NewHistogramVec("homeddns_provider_call_duration_seconds",
+		"Latency of DNS provider API calls.", nil, "provider", "operation")
+
+	// ProviderErrors counts failed provider calls by error kind
+	ProviderErrors = Default.NewCounterVec("homeddns_provider_errors_total",
+		"Failed DNS provider API calls by error kind.", "provider", "operation", "kind")
+
+	// AuthFailures counts rejected requests
+	AuthFailures = Default.NewCounterVec("homeddns_auth_failures_total",
+		"Requests rejected because of missing or invalid credentials.")
+)
+
+// OtherHostname is the hostname label of requests for missing, invalid or
+// rejected hostnames, so that clients cannot create label series at will
+const OtherHostname = "other"
+
+// ObserveUpdate records the response code of an update request. An empty
+// hostname is counted as OtherHostname.
+func ObserveUpdate(hostname, code string) {
+	if hostname == "" {
+		hostname = OtherHostname
+	}
+	UpdateRequests.Inc(code, hostname)
+	if code == "good" || code == "nochg" {
+		LastUpdate.Set(float64(time.Now().UnixNano())/1e9, hostname)
+	}
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests.", "code", "hostname")
+	last := r.NewGaugeVec("test_last_seconds", "Last update.", "hostname")
+	latency := r.NewHistogramVec("test_duration_seconds", "Latency.", []float64{0.5, 0.1}, "provider")
+	r.NewCounterFunc("test_logins_total", "Logins.", func() []Sample {
+		return []Sample{{LabelValues: []string{"netcup_ccp"}, Value: 3}}
+	}, "provider")
+
+	requests.Inc("good", "b.example.com")
+	requests.Inc("good", "a.example.com")
+	requests.Add(2, "911", "a.example.com")
+	requests.Add(-1, "911", "a.example.com") // counters never decrease
+	last.Set(1700000000.5, `we"ird\name`)
+	latency.Observe(0.05, "aws_route53")
+	latency.Observe(0.1, "aws_route53")
+	latency.Observe(2, "aws_route53")
+
+	assert.Equal(t, 2.0, requests.Value("911", "a.example.com"))
+	assert.Equal(t, uint64(3), latency.Count("aws_route53"))
+
+	var out strings.Builder
+	_, err := r.WriteTo(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{code="911",hostname="a.example.com"} 2
+test_requests_total{code="good",hostname="a.example.com"} 1
+test_requests_total{code="good",hostname="b.example.com"} 1
+# HELP test_last_seconds Last update.
+# TYPE test_last_seconds gauge
+test_last_seconds{hostname="we\"ird\\name"} 1.7000000005e+09
+# HELP test_duration_seconds Latency.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{provider="aws_route53",le="0.1"} 2
+test_duration_seconds_bucket{provider="aws_route53",le="0.5"} 2
+test_duration_seconds_bucket{provider="aws_route53",le="+Inf"} 3
+test_duration_seconds_sum{provider="aws_route53"} 2.15
+test_duration_seconds_count{provider="aws_route53"} 3
+# HELP test_logins_total Logins.
+# TYPE test_logins_total counter
+test_logins_total{provider="netcup_ccp"} 3
+`, out.String())
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("test_failures_total", "Failures.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "test_failures_total 1\n")
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/metrics", nil))
+	assert.Equal(t, 405, rec.Code)
+}
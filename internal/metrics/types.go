@@ -0,0 +1,234 @@
+package metrics
+
+import (
+	"bufio"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets for provider call latency in seconds
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// valueVec holds one float value per label combination
+type valueVec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*valueSeries
+}
+
+type valueSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// get returns the series of the label values, creating it if needed.
+// The caller must hold v.mu.
+func (v *valueVec) get(labelValues []string) *valueSeries {
+	key := seriesKey(labelValues)
+	s, ok := v.series[key]
+	if !ok {
+		s = &valueSeries{labelValues: slices.Clone(labelValues)}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *valueVec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.writeHeader(w)
+	for _, key := range sortedKeys(v.series) {
+		s := v.series[key]
+		v.writeSample(w, "", s.labelValues, "", s.value)
+	}
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	vec valueVec
+}
+
+// NewCounterVec registers a counter with the given label names
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: valueVec{
+		desc:   desc{name: name, help: help, kind: "counter", labels: labels},
+		series: make(map[string]*valueSeries),
+	}}
+	r.register(&c.vec)
+	return c
+}
+
+// Inc increments the counter of the label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter of the label values by delta (>= 0)
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.vec.mu.Lock()
+	defer c.vec.mu.Unlock()
+	c.vec.get(labelValues).value += delta
+}
+
+// Value returns the current value of the label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.vec.mu.Lock()
+	defer c.vec.mu.Unlock()
+	if s, ok := c.vec.series[seriesKey(labelValues)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	vec valueVec
+}
+
+// NewGaugeVec registers a gauge with the given label names
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec: valueVec{
+		desc:   desc{name: name, help: help, kind: "gauge", labels: labels},
+		series: make(map[string]*valueSeries),
+	}}
+	r.register(&g.vec)
+	return g
+}
+
+// Set sets the gauge of the label values
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.vec.mu.Lock()
+	defer g.vec.mu.Unlock()
+	g.vec.get(labelValues).value = value
+}
+
+// Value returns the current value of the label values
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	g.vec.mu.Lock()
+	defer g.vec.mu.Unlock()
+	if s, ok := g.vec.series[seriesKey(labelValues)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	desc
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+// NewHistogramVec registers a histogram with the given upper bucket bounds
+// (DefaultBuckets if nil) and label names
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = slices.Clone(buckets)
+	sort.Float64s(buckets)
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe adds a value to the histogram of the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := seriesKey(labelValues)
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labelValues: slices.Clone(labelValues), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i, _ := slices.BinarySearch(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+// Count returns the number of observations of the label values
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[seriesKey(labelValues)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			h.writeSample(w, "_bucket", s.labelValues, `le="`+formatFloat(bound)+`"`, float64(cumulative))
+		}
+		h.writeSample(w, "_bucket", s.labelValues, `le="`+formatFloat(math.Inf(1))+`"`, float64(s.count))
+		h.writeSample(w, "_sum", s.labelValues, "", s.sum)
+		h.writeSample(w, "_count", s.labelValues, "", float64(s.count))
+	}
+}
+
+// funcMetric reads its samples at scrape time
+type funcMetric struct {
+	desc
+	collect func() []Sample
+}
+
+// NewCounterFunc registers a counter whose samples are read from collect
+// on every scrape, e.g. counters kept by a provider
+func (r *Registry) NewCounterFunc(name, help string, collect func() []Sample, labels ...string) {
+	r.register(&funcMetric{desc: desc{name: name, help: help, kind: "counter", labels: labels}, collect: collect})
+}
+
+// NewGaugeFunc registers a gauge whose samples are read from collect on
+// every scrape
+func (r *Registry) NewGaugeFunc(name, help string, collect func() []Sample, labels ...string) {
+	r.register(&funcMetric{desc: desc{name: name, help: help, kind: "gauge", labels: labels}, collect: collect})
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	samples := f.collect()
+	sort.Slice(samples, func(i, j int) bool {
+		return seriesKey(samples[i].LabelValues) < seriesKey(samples[j].LabelValues)
+	})
+	f.writeHeader(w)
+	for _, s := range samples {
+		f.writeSample(w, "", s.LabelValues, "", s.Value)
+	}
+}
+
+// sortedKeys returns the keys of a series map in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,383 @@
+// Package mqtt is a minimal MQTT 3.1.1 client. It publishes with QoS 0,
+// subscribes with QoS 0 and reconnects until stopped, which is all that is
+// needed to publish state to Home Assistant.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/util"
+)
+
+// ErrNotConnected is returned by Publish while the broker is unreachable
+var ErrNotConnected = errors.New("not connected to MQTT broker")
+
+// Message is an application message
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options configures a client
+type Options struct {
+	// Broker is the broker URL: mqtt://host:1883 (or tcp://) and
+	// mqtts://host:8883 (or ssl://, tls://) for TLS
+	Broker   string
+	ClientID string
+	Username string
+	Password util.Secret
+	// KeepAlive is the ping interval agreed with the broker (default 60s)
+	KeepAlive time.Duration
+	// Will is published by the broker when the connection is lost, and by
+	// the client when Run stops
+	Will *Message
+	// TLSConfig overrides the TLS settings of mqtts brokers
+	TLSConfig *tls.Config
+	// OnConnect is called after every successful (re)connect, e.g. to
+	// publish state that must survive a broker restart
+	OnConnect func(c *Client)
+}
+
+// Client is an MQTT client that stays connected while Run is running
+type Client struct {
+	options Options
+	addr    string
+	useTLS  bool
+
+	// mu guards conn and serializes writes
+	mu   sync.Mutex
+	conn net.Conn
+
+	subsMu   sync.Mutex
+	subs     map[string]func(Message)
+	packetID uint16
+}
+
+// NewClient validates the options and creates a client. Call Run to connect.
+func NewClient(options Options) (*Client, error) {
+	u, err := url.Parse(options.Broker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid MQTT broker URL %q", options.Broker)
+	}
+	c := &Client{options: options, subs: make(map[string]func(Message))}
+	port := u.Port()
+	switch u.Scheme {
+	case "mqtt", "tcp":
+		if port == "" {
+			port = "1883"
+		}
+	case "mqtts", "ssl", "tls":
+		c.useTLS = true
+		if port == "" {
+			port = "8883"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported MQTT broker scheme %q", u.Scheme)
+	}
+	c.addr = net.JoinHostPort(u.Hostname(), port)
+
+	if c.options.ClientID == "" {
+		c.options.ClientID = "homeddns"
+	}
+	if c.options.KeepAlive <= 0 {
+		c.options.KeepAlive = 60 * time.Second
+	}
+	if c.options.TLSConfig == nil {
+		c.options.TLSConfig = &tls.Config{ServerName: u.Hostname()}
+	}
+	return c, nil
+}
+
+// Run connects to the broker and reconnects with backoff whenever the
+// connection is lost, until ctx is done
+func (c *Client) Run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := c.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		// A connection that lasted a while resets the backoff
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+		logger.Warn("MQTT connection to %s lost, reconnecting in %v: %v", c.addr, backoff, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+}
+
+// Connected reports whether the client is connected
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// Publish sends a message with QoS 0
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	return c.write(EncodePublish(Message{Topic: topic, Payload: payload, Retain: retain}, 0, 0))
+}
+
+// Subscribe calls handler for every message matching filter. The
+// subscription is renewed after every reconnect. Handlers run on the
+// receive loop and must return quickly.
+func (c *Client) Subscribe(filter string, handler func(Message)) error {
+	c.subsMu.Lock()
+	c.subs[filter] = handler
+	c.subsMu.Unlock()
+
+	if !c.Connected() {
+		return nil
+	}
+	return c.write(c.subscribePacket([]string{filter}))
+}
+
+// session runs one connection until it fails or ctx is done
+func (c *Client) session(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		// A clean disconnect discards the will, so publish it ourselves
+		c.mu.Lock()
+		if will := c.options.Will; will != nil {
+			_ = WritePacket(conn, EncodePublish(*will, 0, 0))
+		}
+		_ = WritePacket(conn, Packet{Type: TypeDisconnect})
+		c.mu.Unlock()
+		conn.Close()
+	})
+	defer stop()
+
+	r := bufio.NewReader(conn)
+	if err := c.connect(conn, r); err != nil {
+		return err
+	}
+	logger.Info("Connected to MQTT broker %s", c.addr)
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+	}()
+
+	if filters := c.filters(); len(filters) > 0 {
+		if err := c.write(c.subscribePacket(filters)); err != nil {
+			return err
+		}
+	}
+	if c.options.OnConnect != nil {
+		c.options.OnConnect(c)
+	}
+
+	pingDone := make(chan struct{})
+	defer close(pingDone)
+	go c.ping(pingDone)
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(c.options.KeepAlive * 3 / 2))
+		p, err := ReadPacket(r)
+		if err != nil {
+			return err
+		}
+		switch p.Type {
+		case TypePublish:
+			msg, qos, packetID, err := DecodePublish(p)
+			if err != nil {
+				return err
+			}
+			if qos == 1 {
+				_ = c.write(Packet{Type: TypePuback, Body: binary.BigEndian.AppendUint16(nil, packetID)})
+			}
+			c.dispatch(msg)
+		case TypeSuback:
+			for _, code := range p.Body[min(2, len(p.Body)):] {
+				if code == 0x80 {
+					logger.Warn("MQTT broker %s rejected a subscription", c.addr)
+				}
+			}
+		case TypePingresp, TypePuback, TypeUnsuback:
+		default:
+			return fmt.Errorf("unexpected packet type %d", p.Type)
+		}
+	}
+}
+
+// dial opens the network connection
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if c.useTLS {
+		return (&tls.Dialer{NetDialer: dialer, Config: c.options.TLSConfig}).DialContext(ctx, "tcp", c.addr)
+	}
+	return dialer.DialContext(ctx, "tcp", c.addr)
+}
+
+// connect sends CONNECT and waits for CONNACK
+func (c *Client) connect(conn net.Conn, r *bufio.Reader) error {
+	flags := byte(0x02) // clean session
+	body := AppendString(nil, "MQTT")
+	body = append(body, 4) // protocol level 3.1.1
+	if will := c.options.Will; will != nil {
+		flags |= 0x04
+		if will.Retain {
+			flags |= 0x20
+		}
+	}
+	if c.options.Username != "" {
+		flags |= 0x80
+		if c.options.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body = append(body, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(c.options.KeepAlive/time.Second))
+	body = AppendString(body, c.options.ClientID)
+	if will := c.options.Will; will != nil {
+		body = AppendString(body, will.Topic)
+		body = AppendString(body, string(will.Payload))
+	}
+	if c.options.Username != "" {
+		body = AppendString(body, c.options.Username)
+		if c.options.Password != "" {
+			body = AppendString(body, c.options.Password.Value())
+		}
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+	if err := WritePacket(conn, Packet{Type: TypeConnect, Body: body}); err != nil {
+		return fmt.Errorf("send CONNECT: %w", err)
+	}
+	p, err := ReadPacket(r)
+	if err != nil {
+		return fmt.Errorf("read CONNACK: %w", err)
+	}
+	if p.Type != TypeConnack || len(p.Body) != 2 {
+		return errors.New("broker did not answer with CONNACK")
+	}
+	if code := p.Body[1]; code != 0 {
+		return fmt.Errorf("broker refused connection: %s", connackReason(code))
+	}
+	return nil
+}
+
+// connackReason describes a CONNACK return code
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad username or password"
+	case 5:
+		return "not authorized"
+	default:
+		return fmt.Sprintf("return code %d", code)
+	}
+}
+
+// ping keeps the connection alive until done is closed
+func (c *Client) ping(done <-chan struct{}) {
+	ticker := time.NewTicker(c.options.KeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := c.write(Packet{Type: TypePingreq}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// write sends a packet on the current connection
+func (c *Client) write(p Packet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := WritePacket(c.conn, p); err != nil {
+		// The read loop notices the broken connection and reconnects
+		c.conn.Close()
+		return fmt.Errorf("MQTT write failed: %w", err)
+	}
+	return nil
+}
+
+// filters returns the subscribed topic filters
+func (c *Client) filters() []string {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	filters := make([]string, 0, len(c.subs))
+	for filter := range c.subs {
+		filters = append(filters, filter)
+	}
+	sort.Strings(filters)
+	return filters
+}
+
+// subscribePacket returns a SUBSCRIBE packet for the filters with QoS 0
+func (c *Client) subscribePacket(filters []string) Packet {
+	c.subsMu.Lock()
+	c.packetID++
+	if c.packetID == 0 {
+		c.packetID = 1
+	}
+	body := binary.BigEndian.AppendUint16(nil, c.packetID)
+	c.subsMu.Unlock()
+
+	for _, filter := range filters {
+		body = AppendString(body, filter)
+		body = append(body, 0)
+	}
+	return Packet{Type: TypeSubscribe, Flags: 0x02, Body: body}
+}
+
+// dispatch passes a message to the handlers of all matching filters
+func (c *Client) dispatch(msg Message) {
+	c.subsMu.Lock()
+	var handlers []func(Message)
+	for filter, handler := range c.subs {
+		if Match(filter, msg.Topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+	c.subsMu.Unlock()
+
+	for _, handler := range handlers {
+		handler(msg)
+	}
+}
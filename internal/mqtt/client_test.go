@@ -0,0 +1,132 @@
+package mqtt_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/mqtt"
+	"github.com/markussiebert/homeddns/internal/mqtt/mqtttest"
+)
+
+// runClient runs a client until the test ends
+func runClient(t *testing.T, options mqtt.Options) *mqtt.Client {
+	t.Helper()
+	c, err := mqtt.NewClient(options)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return c
+}
+
+func TestClient_PublishAndSubscribe(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	broker.RequirePassword("secret")
+
+	received := make(chan mqtt.Message, 1)
+	var connects atomic.Int32
+	c := runClient(t, mqtt.Options{
+		Broker:   broker.URL,
+		ClientID: "homeddns-test",
+		Username: "homeddns",
+		Password: "secret",
+		Will:     &mqtt.Message{Topic: "homeddns/status", Payload: []byte("offline"), Retain: true},
+		OnConnect: func(c *mqtt.Client) {
+			connects.Add(1)
+			assert.NoError(t, c.Publish("homeddns/status", []byte("online"), true))
+		},
+	})
+	assert.NoError(t, c.Subscribe("homeddns/+/update", func(msg mqtt.Message) { received <- msg }))
+
+	broker.WaitFor(t, "homeddns/status", nil)
+	connect := broker.Connects()[0]
+	assert.Equal(t, "homeddns-test", connect.ClientID)
+	assert.Equal(t, "homeddns", connect.Username)
+	assert.Equal(t, "offline", string(connect.Will.Payload))
+
+	retained, ok := broker.Retained("homeddns/status")
+	assert.True(t, ok)
+	assert.Equal(t, "online", string(retained.Payload))
+
+	broker.WaitForSubscription(t, "homeddns/+/update")
+	broker.Publish(mqtt.Message{Topic: "homeddns/nas/update", Payload: []byte("PRESS")})
+	select {
+	case msg := <-received:
+		assert.Equal(t, "homeddns/nas/update", msg.Topic)
+		assert.Equal(t, "PRESS", string(msg.Payload))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	assert.Equal(t, int32(1), connects.Load())
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+
+	var connects atomic.Int32
+	received := make(chan mqtt.Message, 1)
+	c := runClient(t, mqtt.Options{
+		Broker: broker.URL,
+		Will:   &mqtt.Message{Topic: "homeddns/status", Payload: []byte("offline"), Retain: true},
+		OnConnect: func(c *mqtt.Client) {
+			connects.Add(1)
+			_ = c.Publish("homeddns/status", []byte("online"), true)
+		},
+	})
+	assert.NoError(t, c.Subscribe("homeddns/command", func(msg mqtt.Message) { received <- msg }))
+	broker.WaitForSubscription(t, "homeddns/command")
+
+	// A lost connection publishes the will; the client reconnects,
+	// publishes its state again and renews its subscriptions
+	broker.Disconnect()
+	broker.WaitFor(t, "homeddns/status", func(msg mqtt.Message) bool { return string(msg.Payload) == "offline" })
+	broker.WaitFor(t, "homeddns/status", func(msg mqtt.Message) bool {
+		return string(msg.Payload) == "online" && connects.Load() == 2
+	})
+	broker.WaitForSubscription(t, "homeddns/command")
+
+	broker.Publish(mqtt.Message{Topic: "homeddns/command", Payload: []byte("update")})
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received after reconnect")
+	}
+}
+
+func TestNewClient_InvalidBroker(t *testing.T) {
+	for _, broker := range []string{"", "localhost:1883", "http://localhost"} {
+		_, err := mqtt.NewClient(mqtt.Options{Broker: broker})
+		assert.Error(t, err, broker)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tt := range []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"homeddns/status", "homeddns/status", true},
+		{"homeddns/status", "homeddns/status/x", false},
+		{"homeddns/+/update", "homeddns/nas/update", true},
+		{"homeddns/+/update", "homeddns/nas/state", false},
+		{"homeddns/+", "homeddns", false},
+		{"homeddns/#", "homeddns", true},
+		{"homeddns/#", "homeddns/a/b", true},
+		{"#", "anything/at/all", true},
+		{"+/+", "a/b", true},
+		{"+/+", "a/b/c", false},
+	} {
+		assert.Equal(t, tt.want, mqtt.Match(tt.filter, tt.topic), "%s %s", tt.filter, tt.topic)
+	}
+}
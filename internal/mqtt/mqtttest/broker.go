@@ -0,0 +1,361 @@
+// Package mqtttest provides an in-process MQTT 3.1.1 broker for tests. It
+// supports QoS 0, retained messages, wills and wildcard subscriptions.
+package mqtttest
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/mqtt"
+)
+
+// Connect describes a received CONNECT packet
+type Connect struct {
+	ClientID string
+	Username string
+	Password string
+	Will     *mqtt.Message
+}
+
+// Broker is an MQTT broker stand-in listening on localhost
+type Broker struct {
+	// Addr is the "127.0.0.1:port" address of the broker
+	Addr string
+	// URL is the mqtt:// URL of the broker
+	URL string
+
+	ln net.Listener
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	clients   map[*client]struct{}
+	retained  map[string]mqtt.Message
+	published []mqtt.Message
+	connects  []Connect
+	password  string
+}
+
+// client is a connection to the broker
+type client struct {
+	conn    net.Conn
+	will    *mqtt.Message
+	filters []string
+	writeMu sync.Mutex
+}
+
+// NewBroker starts a broker that is stopped when the test ends
+func NewBroker(t testing.TB) *Broker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	b := &Broker{
+		Addr:     ln.Addr().String(),
+		URL:      "mqtt://" + ln.Addr().String(),
+		ln:       ln,
+		clients:  make(map[*client]struct{}),
+		retained: make(map[string]mqtt.Message),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	t.Cleanup(b.Close)
+	go b.serve()
+	return b
+}
+
+// RequirePassword makes the broker refuse clients with another password
+func (b *Broker) RequirePassword(password string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.password = password
+}
+
+// Close stops the broker and drops all connections without publishing
+// their wills
+func (b *Broker) Close() {
+	b.ln.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.clients {
+		c.will = nil
+		c.conn.Close()
+	}
+}
+
+// Disconnect drops all client connections as if the network failed. Wills
+// are published.
+func (b *Broker) Disconnect() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.clients {
+		c.conn.Close()
+	}
+}
+
+// Publish sends a message to all subscribed clients, as if published by
+// another client
+func (b *Broker) Publish(msg mqtt.Message) {
+	b.route(msg)
+}
+
+// Retained returns the retained message of a topic
+func (b *Broker) Retained(topic string) (mqtt.Message, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msg, ok := b.retained[topic]
+	return msg, ok
+}
+
+// Published returns all messages routed by the broker, including wills
+// and messages sent with Publish
+func (b *Broker) Published() []mqtt.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]mqtt.Message(nil), b.published...)
+}
+
+// Connects returns all received CONNECT packets
+func (b *Broker) Connects() []Connect {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Connect(nil), b.connects...)
+}
+
+// WaitFor waits until a message matching filter was routed and match, if
+// set, accepts it. It returns the latest such message.
+func (b *Broker) WaitFor(t testing.TB, filter string, match func(mqtt.Message) bool) mqtt.Message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	timer := time.AfterFunc(5*time.Second, func() {
+		b.mu.Lock()
+		b.cond.Broadcast()
+		b.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		for i := len(b.published) - 1; i >= 0; i-- {
+			msg := b.published[i]
+			if mqtt.Match(filter, msg.Topic) && (match == nil || match(msg)) {
+				return msg
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no message on %s within 5s", filter)
+		}
+		b.cond.Wait()
+	}
+}
+
+// WaitForSubscription waits until a client subscribed to filter
+func (b *Broker) WaitForSubscription(t testing.TB, filter string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		b.mu.Lock()
+		for c := range b.clients {
+			for _, f := range c.filters {
+				if f == filter {
+					b.mu.Unlock()
+					return
+				}
+			}
+		}
+		b.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no subscription to %s within 5s", filter)
+}
+
+// serve accepts connections until the broker is closed
+func (b *Broker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+// handle serves one client connection
+func (b *Broker) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	p, err := mqtt.ReadPacket(r)
+	if err != nil || p.Type != mqtt.TypeConnect {
+		return
+	}
+	connect, ok := parseConnect(p.Body)
+	if !ok {
+		return
+	}
+	c := &client{conn: conn, will: connect.Will}
+
+	b.mu.Lock()
+	b.connects = append(b.connects, connect)
+	refused := b.password != "" && connect.Password != b.password
+	if !refused {
+		b.clients[c] = struct{}{}
+	}
+	b.mu.Unlock()
+
+	if refused {
+		_ = c.write(mqtt.Packet{Type: mqtt.TypeConnack, Body: []byte{0, 4}})
+		return
+	}
+	_ = c.write(mqtt.Packet{Type: mqtt.TypeConnack, Body: []byte{0, 0}})
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		will := c.will
+		b.mu.Unlock()
+		if will != nil {
+			b.route(*will)
+		}
+	}()
+
+	for {
+		p, err := mqtt.ReadPacket(r)
+		if err != nil {
+			return
+		}
+		switch p.Type {
+		case mqtt.TypePublish:
+			msg, _, _, err := mqtt.DecodePublish(p)
+			if err != nil {
+				return
+			}
+			b.route(msg)
+		case mqtt.TypeSubscribe:
+			b.subscribe(c, p.Body)
+		case mqtt.TypePingreq:
+			_ = c.write(mqtt.Packet{Type: mqtt.TypePingresp})
+		case mqtt.TypeDisconnect:
+			b.mu.Lock()
+			c.will = nil
+			b.mu.Unlock()
+			return
+		}
+	}
+}
+
+// subscribe registers the filters of a SUBSCRIBE packet, acknowledges them
+// and sends matching retained messages
+func (b *Broker) subscribe(c *client, body []byte) {
+	if len(body) < 2 {
+		return
+	}
+	packetID := body[:2]
+	rest := body[2:]
+	var filters []string
+	codes := []byte{}
+	for len(rest) > 0 {
+		filter, r, err := mqtt.ReadString(rest)
+		if err != nil || len(r) < 1 {
+			return
+		}
+		filters = append(filters, filter)
+		codes = append(codes, 0)
+		rest = r[1:]
+	}
+
+	b.mu.Lock()
+	c.filters = append(c.filters, filters...)
+	var retained []mqtt.Message
+	for topic, msg := range b.retained {
+		for _, filter := range filters {
+			if mqtt.Match(filter, topic) {
+				retained = append(retained, msg)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	_ = c.write(mqtt.Packet{Type: mqtt.TypeSuback, Body: append(append([]byte(nil), packetID...), codes...)})
+	for _, msg := range retained {
+		_ = c.write(mqtt.EncodePublish(msg, 0, 0))
+	}
+}
+
+// route stores and forwards a published message
+func (b *Broker) route(msg mqtt.Message) {
+	b.mu.Lock()
+	b.published = append(b.published, msg)
+	if msg.Retain {
+		if len(msg.Payload) == 0 {
+			delete(b.retained, msg.Topic)
+		} else {
+			b.retained[msg.Topic] = msg
+		}
+	}
+	var targets []*client
+	for c := range b.clients {
+		for _, filter := range c.filters {
+			if mqtt.Match(filter, msg.Topic) {
+				targets = append(targets, c)
+				break
+			}
+		}
+	}
+	b.cond.Broadcast()
+	b.mu.Unlock()
+
+	// Forwarded messages are not retained unless sent on subscription
+	forward := msg
+	forward.Retain = false
+	for _, c := range targets {
+		_ = c.write(mqtt.EncodePublish(forward, 0, 0))
+	}
+}
+
+// write sends a packet to the client
+func (c *client) write(p mqtt.Packet) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return mqtt.WritePacket(c.conn, p)
+}
+
+// parseConnect parses the variable header and payload of CONNECT
+func parseConnect(body []byte) (Connect, bool) {
+	protocol, rest, err := mqtt.ReadString(body)
+	if err != nil || protocol != "MQTT" || len(rest) < 4 {
+		return Connect{}, false
+	}
+	flags := rest[1]
+	rest = rest[4:] // level, flags, keep alive (ignored)
+
+	var connect Connect
+	if connect.ClientID, rest, err = mqtt.ReadString(rest); err != nil {
+		return Connect{}, false
+	}
+	if flags&0x04 != 0 {
+		var topic, payload string
+		if topic, rest, err = mqtt.ReadString(rest); err != nil {
+			return Connect{}, false
+		}
+		if payload, rest, err = mqtt.ReadString(rest); err != nil {
+			return Connect{}, false
+		}
+		connect.Will = &mqtt.Message{Topic: topic, Payload: []byte(payload), Retain: flags&0x20 != 0}
+	}
+	if flags&0x80 != 0 {
+		if connect.Username, rest, err = mqtt.ReadString(rest); err != nil {
+			return Connect{}, false
+		}
+	}
+	if flags&0x40 != 0 {
+		if connect.Password, _, err = mqtt.ReadString(rest); err != nil {
+			return Connect{}, false
+		}
+	}
+	return connect, true
+}
@@ -0,0 +1,165 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types of MQTT 3.1.1
+const (
+	TypeConnect     byte = 1
+	TypeConnack     byte = 2
+	TypePublish     byte = 3
+	TypePuback      byte = 4
+	TypeSubscribe   byte = 8
+	TypeSuback      byte = 9
+	TypeUnsubscribe byte = 10
+	TypeUnsuback    byte = 11
+	TypePingreq     byte = 12
+	TypePingresp    byte = 13
+	TypeDisconnect  byte = 14
+)
+
+// maxPacketSize limits the size of received packets. homeddns only
+// receives short commands, so anything larger is a protocol error.
+const maxPacketSize = 1 << 20
+
+// Packet is a raw control packet. The codec is exported for the broker
+// stand-in in mqtttest.
+type Packet struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+// WritePacket writes a control packet with its fixed header
+func WritePacket(w io.Writer, p Packet) error {
+	header := []byte{p.Type<<4 | p.Flags&0x0f}
+	n := len(p.Body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		header = append(header, b)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(header, p.Body...))
+	return err
+}
+
+// ReadPacket reads one control packet
+func ReadPacket(r *bufio.Reader) (Packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return Packet{}, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return Packet{}, errors.New("malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return Packet{}, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	if length > maxPacketSize {
+		return Packet{}, fmt.Errorf("packet of %d bytes exceeds limit", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return Packet{}, err
+	}
+	return Packet{Type: first >> 4, Flags: first & 0x0f, Body: body}, nil
+}
+
+// AppendString appends a length-prefixed UTF-8 string
+func AppendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// ReadString reads a length-prefixed string and returns the rest
+func ReadString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// EncodePublish returns a PUBLISH packet. QoS 1 packets need a packet ID.
+func EncodePublish(msg Message, qos byte, packetID uint16) Packet {
+	flags := qos << 1
+	if msg.Retain {
+		flags |= 0x01
+	}
+	body := AppendString(nil, msg.Topic)
+	if qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, packetID)
+	}
+	return Packet{Type: TypePublish, Flags: flags, Body: append(body, msg.Payload...)}
+}
+
+// DecodePublish parses a PUBLISH packet and returns its QoS and packet ID
+func DecodePublish(p Packet) (Message, byte, uint16, error) {
+	topic, rest, err := ReadString(p.Body)
+	if err != nil {
+		return Message{}, 0, 0, fmt.Errorf("malformed PUBLISH: %w", err)
+	}
+	qos := (p.Flags >> 1) & 0x03
+	var packetID uint16
+	if qos > 0 {
+		if len(rest) < 2 {
+			return Message{}, 0, 0, errors.New("malformed PUBLISH: missing packet ID")
+		}
+		packetID = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	msg := Message{Topic: topic, Payload: append([]byte(nil), rest...), Retain: p.Flags&0x01 != 0}
+	return msg, qos, packetID, nil
+}
+
+// Match reports whether a topic matches a subscription filter with the
+// + (one level) and # (all remaining levels) wildcards
+func Match(filter, topic string) bool {
+	for {
+		fLevel, fRest, fMore := cut(filter)
+		tLevel, tRest, tMore := cut(topic)
+		switch {
+		case fLevel == "#":
+			return true
+		case fLevel != "+" && fLevel != tLevel:
+			return false
+		case !fMore || !tMore:
+			// "a/#" also matches "a"
+			return fMore == tMore || (fMore && fRest == "#")
+		}
+		filter, topic = fRest, tRest
+	}
+}
+
+// cut splits the first level off a topic
+func cut(topic string) (level, rest string, more bool) {
+	for i := 0; i < len(topic); i++ {
+		if topic[i] == '/' {
+			return topic[:i], topic[i+1:], true
+		}
+	}
+	return topic, "", false
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/markussiebert/homeddns/internal/util"
+)
+
+// Gotify sends events as messages to a Gotify server (https://gotify.net)
+type Gotify struct {
+	// URL is the server URL, e.g. https://gotify.example.com
+	URL string
+	// Token is the application token
+	Token    util.Secret
+	Priority int
+	Client   *http.Client
+}
+
+// gotifyMessage is the body of POST /message
+type gotifyMessage struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+// Name returns "gotify"
+func (g *Gotify) Name() string {
+	return "gotify"
+}
+
+// Notify creates a message
+func (g *Gotify) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(gotifyMessage{Title: event.Title, Message: event.Message, Priority: g.Priority})
+	if err != nil {
+		return Permanent(fmt.Errorf("marshal message: %w", err))
+	}
+	url := strings.TrimSuffix(g.URL, "/") + "/message"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(fmt.Errorf("create request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.Token.Value())
+	return do(g.Client, req)
+}
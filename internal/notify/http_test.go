@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/state"
+)
+
+// captured is a request received by the test server
+type captured struct {
+	path   string
+	header http.Header
+	body   string
+}
+
+// newTestServer records requests and answers with status
+func newTestServer(t *testing.T, status int) (*httptest.Server, *[]captured) {
+	t.Helper()
+	var requests []captured
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, captured{path: r.URL.Path, header: r.Header.Clone(), body: string(body)})
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+var testEvent = NewEvent(state.Change{Hostname: "nas.example.com", Type: "A", Previous: "192.0.2.1", Value: "192.0.2.2"})
+
+func TestWebhook(t *testing.T) {
+	server, requests := newTestServer(t, http.StatusNoContent)
+
+	w, err := NewWebhook(server.URL+"/hook", "")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Notify(context.Background(), testEvent))
+
+	var body map[string]string
+	assert.NoError(t, json.Unmarshal([]byte((*requests)[0].body), &body))
+	assert.Equal(t, "nas.example.com", body["hostname"])
+	assert.Equal(t, "192.0.2.2", body["value"])
+	assert.Equal(t, testEvent.Message, body["message"])
+	assert.Equal(t, "application/json", (*requests)[0].header.Get("Content-Type"))
+
+	w, err = NewWebhook(server.URL+"/hook", `{"text": {{json .Message}}, "ip": "{{.Value}}"}`)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Notify(context.Background(), testEvent))
+	assert.Equal(t, `{"text": "nas.example.com (A) changed from 192.0.2.1 to 192.0.2.2", "ip": "192.0.2.2"}`, (*requests)[1].body)
+
+	_, err = NewWebhook(server.URL, "{{.Value")
+	assert.Error(t, err)
+}
+
+func TestWebhook_Errors(t *testing.T) {
+	rejecting, _ := newTestServer(t, http.StatusUnauthorized)
+	w, err := NewWebhook(rejecting.URL, "")
+	assert.NoError(t, err)
+	err = w.Notify(context.Background(), testEvent)
+	assert.Error(t, err)
+	assert.True(t, IsPermanent(err))
+
+	failing, _ := newTestServer(t, http.StatusBadGateway)
+	w, err = NewWebhook(failing.URL, "")
+	assert.NoError(t, err)
+	err = w.Notify(context.Background(), testEvent)
+	assert.Error(t, err)
+	assert.False(t, IsPermanent(err))
+}
+
+func TestNtfy(t *testing.T) {
+	server, requests := newTestServer(t, http.StatusOK)
+
+	n := &Ntfy{URL: server.URL + "/homeddns", Token: "tk_secret", Priority: "high"}
+	assert.NoError(t, n.Notify(context.Background(), testEvent))
+
+	r := (*requests)[0]
+	assert.Equal(t, "/homeddns", r.path)
+	assert.Equal(t, testEvent.Message, r.body)
+	assert.Equal(t, "nas.example.com changed", r.header.Get("Title"))
+	assert.Equal(t, "high", r.header.Get("Priority"))
+	assert.Equal(t, "Bearer tk_secret", r.header.Get("Authorization"))
+}
+
+func TestGotify(t *testing.T) {
+	server, requests := newTestServer(t, http.StatusOK)
+
+	g := &Gotify{URL: server.URL + "/", Token: "app-token", Priority: 5}
+	assert.NoError(t, g.Notify(context.Background(), testEvent))
+
+	r := (*requests)[0]
+	assert.Equal(t, "/message", r.path)
+	assert.Equal(t, "app-token", r.header.Get("X-Gotify-Key"))
+	var message gotifyMessage
+	assert.NoError(t, json.Unmarshal([]byte(r.body), &message))
+	assert.Equal(t, gotifyMessage{Title: testEvent.Title, Message: testEvent.Message, Priority: 5}, message)
+}
@@ -0,0 +1,246 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/state"
+)
+
+// Event is a record change to notify about
+type Event struct {
+	state.Change
+	// Title and Message summarize the change for humans
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// NewEvent creates the event of a change
+func NewEvent(change state.Change) Event {
+	event := Event{Change: change, Title: fmt.Sprintf("%s changed", change.Hostname)}
+	if change.Previous == "" {
+		event.Message = fmt.Sprintf("%s (%s) set to %s", change.Hostname, change.Type, change.Value)
+	} else {
+		event.Message = fmt.Sprintf("%s (%s) changed from %s to %s", change.Hostname, change.Type, change.Previous, change.Value)
+	}
+	if change.View != "" {
+		event.Message += fmt.Sprintf(" in view %s", change.View)
+	}
+	return event
+}
+
+// Notifier sends an event to one backend
+type Notifier interface {
+	// Name identifies the backend in logs
+	Name() string
+	// Notify sends the event. Errors wrapped with Permanent are not retried.
+	Notify(ctx context.Context, event Event) error
+}
+
+// permanentError is an error that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not retryable, e.g. a rejected request
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// checkStatus returns an error for unsuccessful HTTP responses. Client
+// errors other than 408 and 429 are permanent.
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err := fmt.Errorf("unexpected status %s", resp.Status)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
+
+// RetryPolicy configures how often a failed notification is retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry; it doubles per attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff
+	MaxDelay time.Duration
+	// Timeout bounds a single attempt
+	Timeout time.Duration
+}
+
+// DefaultRetryPolicy retries for about two minutes
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   2 * time.Second,
+		MaxDelay:    time.Minute,
+		Timeout:     30 * time.Second,
+	}
+}
+
+// queueSize is the number of events buffered while notifications are sent
+const queueSize = 64
+
+// Dispatcher sends events to all notifiers in the background, so that
+// slow or unreachable backends never delay DNS updates
+type Dispatcher struct {
+	notifiers []Notifier
+	policy    RetryPolicy
+	sleep     func(ctx context.Context, d time.Duration) error
+
+	queue  chan Event
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewDispatcher starts a dispatcher for the notifiers
+func NewDispatcher(policy RetryPolicy, notifiers ...Notifier) *Dispatcher {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		notifiers: notifiers,
+		policy:    policy,
+		sleep:     sleepContext,
+		queue:     make(chan Event, queueSize),
+		done:      make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	go d.run()
+	return d
+}
+
+// Notify queues a notification of the change. It never blocks; if the
+// queue is full the change is dropped with a warning. It can be passed to
+// state.Store.Subscribe.
+func (d *Dispatcher) Notify(change state.Change) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	select {
+	case d.queue <- NewEvent(change):
+	default:
+		logger.Warn("Notification queue full, dropping notification for %s", change.Hostname)
+	}
+}
+
+// Close sends the queued notifications and stops the dispatcher. Retries
+// still pending when ctx is done are abandoned.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-d.done
+		return ctx.Err()
+	}
+}
+
+// run sends queued events until the queue is closed
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	defer d.cancel()
+	for event := range d.queue {
+		var wg sync.WaitGroup
+		for _, n := range d.notifiers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.send(n, event)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// send delivers an event to one notifier, retrying with exponential
+// backoff and full jitter
+func (d *Dispatcher) send(n Notifier, event Event) {
+	for attempt := 1; ; attempt++ {
+		err := d.attempt(n, event)
+		if err == nil {
+			logger.Debug("Sent %s notification for %s", n.Name(), event.Hostname)
+			return
+		}
+		if IsPermanent(err) || attempt >= d.policy.MaxAttempts || d.ctx.Err() != nil {
+			logger.Error("Failed to send %s notification for %s after %d attempt(s): %v", n.Name(), event.Hostname, attempt, err)
+			return
+		}
+
+		delay := d.policy.BaseDelay << (attempt - 1)
+		if d.policy.MaxDelay > 0 && (delay > d.policy.MaxDelay || delay <= 0) {
+			delay = d.policy.MaxDelay
+		}
+		if delay > 0 {
+			delay = rand.N(delay) + 1
+		}
+		logger.Warn("Sending %s notification for %s failed (attempt %d/%d), retrying in %v: %v",
+			n.Name(), event.Hostname, attempt, d.policy.MaxAttempts, delay.Round(time.Millisecond), err)
+		if err := d.sleep(d.ctx, delay); err != nil {
+			logger.Error("Abandoned %s notification for %s: %v", n.Name(), event.Hostname, err)
+			return
+		}
+	}
+}
+
+// attempt sends an event once, bounded by the policy timeout
+func (d *Dispatcher) attempt(n Notifier, event Event) error {
+	ctx := d.ctx
+	if d.policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.policy.Timeout)
+		defer cancel()
+	}
+	return n.Notify(ctx, event)
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/state"
+)
+
+// fakeNotifier fails the first failures attempts with err
+type fakeNotifier struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	attempts int
+	events   []Event
+}
+
+func (f *fakeNotifier) Name() string { return "fake" }
+
+func (f *fakeNotifier) Notify(ctx context.Context, event Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts++
+	if f.attempts <= f.failures {
+		return f.err
+	}
+	f.events = append(f.events, event)
+	return nil
+}
+
+func newTestDispatcher(notifiers ...Notifier) *Dispatcher {
+	d := NewDispatcher(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second}, notifiers...)
+	d.sleep = func(ctx context.Context, _ time.Duration) error { return ctx.Err() }
+	return d
+}
+
+func TestNewEvent(t *testing.T) {
+	event := NewEvent(state.Change{Hostname: "nas.example.com", Type: "A", Previous: "192.0.2.1", Value: "192.0.2.2", View: "public"})
+	assert.Equal(t, "nas.example.com changed", event.Title)
+	assert.Equal(t, "nas.example.com (A) changed from 192.0.2.1 to 192.0.2.2 in view public", event.Message)
+
+	event = NewEvent(state.Change{Hostname: "nas.example.com", Type: "AAAA", Value: "2001:db8::1"})
+	assert.Equal(t, "nas.example.com (AAAA) set to 2001:db8::1", event.Message)
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	flaky := &fakeNotifier{failures: 2, err: errors.New("connection refused")}
+	rejected := &fakeNotifier{failures: 10, err: Permanent(errors.New("unauthorized"))}
+	down := &fakeNotifier{failures: 10, err: errors.New("connection refused")}
+
+	d := newTestDispatcher(flaky, rejected, down)
+	d.Notify(state.Change{Hostname: "nas.example.com", Type: "A", Value: "192.0.2.1"})
+	assert.NoError(t, d.Close(context.Background()))
+
+	assert.Equal(t, 3, flaky.attempts)
+	assert.Equal(t, 1, len(flaky.events))
+	assert.Equal(t, "nas.example.com", flaky.events[0].Hostname)
+	assert.Equal(t, 1, rejected.attempts)
+	assert.Equal(t, 3, down.attempts)
+
+	// Changes after Close are ignored
+	d.Notify(state.Change{Hostname: "nas.example.com", Type: "A", Value: "192.0.2.2"})
+	assert.Equal(t, 1, len(flaky.events))
+}
+
+func TestDispatcher_SubscribesToStore(t *testing.T) {
+	store, err := state.Open(t.TempDir()+"/state.json", 0)
+	assert.NoError(t, err)
+
+	n := &fakeNotifier{}
+	d := newTestDispatcher(n)
+	store.Subscribe(d.Notify)
+
+	for _, value := range []string{"192.0.2.1", "192.0.2.1", "192.0.2.2"} {
+		_, err := store.Apply(state.Change{Hostname: "nas.example.com", Type: "A", Value: value})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, d.Close(context.Background()))
+
+	// Only actual changes are sent
+	assert.Equal(t, 2, len(n.events))
+	assert.Equal(t, "192.0.2.1", n.events[1].Previous)
+}
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/markussiebert/homeddns/internal/util"
+)
+
+// Ntfy publishes events to an ntfy topic (https://ntfy.sh)
+type Ntfy struct {
+	// URL is the topic URL, e.g. https://ntfy.sh/my-homeddns
+	URL string
+	// Token is an optional access token
+	Token util.Secret
+	// Priority is an optional priority: 1-5 or min, low, default, high, max
+	Priority string
+	Client   *http.Client
+}
+
+// Name returns "ntfy"
+func (n *Ntfy) Name() string {
+	return "ntfy"
+}
+
+// Notify publishes the event message with its title
+func (n *Ntfy) Notify(ctx context.Context, event Event) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, strings.NewReader(event.Message))
+	if err != nil {
+		return Permanent(fmt.Errorf("create request: %w", err))
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Title", event.Title)
+	req.Header.Set("Tags", "globe_with_meridians")
+	if n.Priority != "" {
+		req.Header.Set("Priority", n.Priority)
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token.Value())
+	}
+	return do(n.Client, req)
+}
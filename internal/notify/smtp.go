@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/util"
+)
+
+// SMTP sends events by email. Without TLS the connection is upgraded with
+// STARTTLS if the server supports it; credentials are only sent over TLS
+// or to localhost.
+type SMTP struct {
+	Host     string
+	Port     int // defaults to 587, or 465 with TLS
+	Username string
+	Password util.Secret
+	From     string
+	To       []string
+	// TLS connects with implicit TLS (usually port 465) instead of STARTTLS
+	TLS bool
+	// TLSConfig overrides the TLS settings, e.g. for a private CA
+	TLSConfig *tls.Config
+}
+
+// Name returns "smtp"
+func (s *SMTP) Name() string {
+	return "smtp"
+}
+
+// Notify sends the event as a plain text email to all recipients
+func (s *SMTP) Notify(ctx context.Context, event Event) error {
+	port := s.Port
+	if port == 0 {
+		port = 587
+		if s.TLS {
+			port = 465
+		}
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(port))
+
+	var conn net.Conn
+	var err error
+	if s.TLS {
+		dialer := &tls.Dialer{Config: s.tlsConfig()}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connect to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return classifySMTP(err)
+	}
+	defer c.Close()
+
+	if !s.TLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(s.tlsConfig()); err != nil {
+				return classifySMTP(fmt.Errorf("STARTTLS: %w", err))
+			}
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password.Value(), s.Host)); err != nil {
+			return classifySMTP(fmt.Errorf("authenticate: %w", err))
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return classifySMTP(fmt.Errorf("MAIL FROM: %w", err))
+	}
+	for _, to := range s.To {
+		if err := c.Rcpt(to); err != nil {
+			return classifySMTP(fmt.Errorf("RCPT TO %s: %w", to, err))
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return classifySMTP(fmt.Errorf("DATA: %w", err))
+	}
+	if _, err := w.Write(s.message(event)); err != nil {
+		return classifySMTP(fmt.Errorf("write message: %w", err))
+	}
+	if err := w.Close(); err != nil {
+		return classifySMTP(fmt.Errorf("send message: %w", err))
+	}
+	return c.Quit()
+}
+
+// tlsConfig returns the TLS settings for the server
+func (s *SMTP) tlsConfig() *tls.Config {
+	if s.TLSConfig != nil {
+		return s.TLSConfig
+	}
+	return &tls.Config{ServerName: s.Host}
+}
+
+// message formats the email with headers
+func (s *SMTP) message(event Event) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "homeddns: "+event.Title))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(event.Message)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// classifySMTP marks permanent (5xx) SMTP replies as not retryable
+func classifySMTP(err error) error {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		return Permanent(err)
+	}
+	return err
+}
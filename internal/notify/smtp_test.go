@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// smtpSession is what the stand-in server received in one session
+type smtpSession struct {
+	commands []string
+	data     string
+}
+
+// startSMTPServer runs a minimal SMTP server on localhost that accepts one
+// session. rcptCode is the reply to RCPT TO.
+func startSMTPServer(t *testing.T, rcptCode int) (string, int, <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var session smtpSession
+		defer func() { sessions <- session }()
+
+		tp := textproto.NewConn(conn)
+		_ = tp.PrintfLine("220 localhost ESMTP stand-in")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			session.commands = append(session.commands, line)
+			switch verb := strings.ToUpper(strings.Fields(line)[0]); verb {
+			case "EHLO":
+				_ = tp.PrintfLine("250-localhost")
+				_ = tp.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				_ = tp.PrintfLine("235 Authenticated")
+			case "MAIL":
+				_ = tp.PrintfLine("250 OK")
+			case "RCPT":
+				_ = tp.PrintfLine("%d recipient", rcptCode)
+			case "DATA":
+				_ = tp.PrintfLine("354 Go ahead")
+				data, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				session.data = string(data)
+				_ = tp.PrintfLine("250 Queued")
+			case "QUIT":
+				_ = tp.PrintfLine("221 Bye")
+				return
+			default:
+				_ = tp.PrintfLine("502 Unknown command")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return host, p, sessions
+}
+
+func TestSMTP(t *testing.T) {
+	host, port, sessions := startSMTPServer(t, 250)
+
+	s := &SMTP{
+		Host:     host,
+		Port:     port,
+		Username: "homeddns",
+		Password: "secret",
+		From:     "homeddns@example.com",
+		To:       []string{"admin@example.com", "ops@example.com"},
+	}
+	assert.NoError(t, s.Notify(context.Background(), testEvent))
+
+	session := <-sessions
+	assert.Contains(t, strings.Join(session.commands, "\n"), "AUTH PLAIN")
+	assert.Contains(t, strings.Join(session.commands, "\n"), "RCPT TO:<ops@example.com>")
+
+	msg, err := textproto.NewReader(bufio.NewReader(strings.NewReader(session.data))).ReadMIMEHeader()
+	assert.NoError(t, err)
+	assert.Equal(t, "homeddns: nas.example.com changed", msg.Get("Subject"))
+	assert.Equal(t, "admin@example.com, ops@example.com", msg.Get("To"))
+	assert.Contains(t, session.data, testEvent.Message)
+}
+
+func TestSMTP_RejectedRecipient(t *testing.T) {
+	host, port, _ := startSMTPServer(t, 550)
+
+	s := &SMTP{Host: host, Port: port, From: "homeddns@example.com", To: []string{"nobody@example.com"}}
+	err := s.Notify(context.Background(), testEvent)
+	assert.Error(t, err)
+	assert.True(t, IsPermanent(err))
+}
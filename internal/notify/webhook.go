@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+)
+
+// Webhook posts events to a URL. The body is the event as JSON or, if a
+// template is set, the rendered template.
+type Webhook struct {
+	URL         string
+	Template    *template.Template
+	ContentType string
+	Client      *http.Client
+}
+
+// templateFuncs are available in webhook templates. json encodes a value
+// as JSON, e.g. {"text": {{json .Message}}}.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// NewWebhook creates a webhook notifier. body is a text/template executed
+// with the Event; if empty, the event is sent as JSON.
+func NewWebhook(url, body string) (*Webhook, error) {
+	w := &Webhook{URL: url, ContentType: "application/json", Client: http.DefaultClient}
+	if body != "" {
+		tmpl, err := template.New("webhook").Funcs(templateFuncs).Option("missingkey=error").Parse(body)
+		if err != nil {
+			return nil, fmt.Errorf("parse webhook template: %w", err)
+		}
+		w.Template = tmpl
+	}
+	return w, nil
+}
+
+// Name returns "webhook"
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+// Notify posts the event
+func (w *Webhook) Notify(ctx context.Context, event Event) error {
+	var body bytes.Buffer
+	if w.Template != nil {
+		if err := w.Template.Execute(&body, event); err != nil {
+			return Permanent(fmt.Errorf("render webhook template: %w", err))
+		}
+	} else if err := json.NewEncoder(&body).Encode(event); err != nil {
+		return Permanent(fmt.Errorf("marshal event: %w", err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, &body)
+	if err != nil {
+		return Permanent(fmt.Errorf("create request: %w", err))
+	}
+	req.Header.Set("Content-Type", w.ContentType)
+	return do(w.Client, req)
+}
+
+// do sends a request and checks the response status
+func do(client *http.Client, req *http.Request) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	return checkStatus(resp)
+}
@@ -0,0 +1,237 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+)
+
+// CacheStats are the counters of a CachingProvider
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+// cacheEntry is a last-known record value
+type cacheEntry struct {
+	domain  string
+	record  DNSRecord
+	expires time.Time
+}
+
+// CachingProvider keeps last-known record values so that unchanged updates
+// and repeated lookups do not reach the wrapped provider
+type CachingProvider struct {
+	inner Provider
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// WithCache wraps a provider with a read-through record cache. Entries
+// expire after ttl; writes replace the entry of the written record and
+// deletes drop it.
+func WithCache(p Provider, ttl time.Duration) *CachingProvider {
+	return &CachingProvider{
+		inner:   p,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]cacheEntry),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Name returns the name of the wrapped provider
+func (c *CachingProvider) Name() string {
+	return c.inner.Name()
+}
+
+// Unwrap returns the wrapped provider
+func (c *CachingProvider) Unwrap() Provider {
+	return c.inner
+}
+
+// GetRecord returns the cached record or fetches it from the wrapped provider
+func (c *CachingProvider) GetRecord(ctx context.Context, domain, hostname, recordType string) (*DNSRecord, error) {
+	if record, ok := c.lookup(domain, hostname, recordType); ok {
+		c.hits.Add(1)
+		return &record, nil
+	}
+	c.misses.Add(1)
+
+	record, err := c.inner.GetRecord(ctx, domain, hostname, recordType)
+	if err != nil {
+		return nil, err
+	}
+	c.store(domain, record)
+	return record, nil
+}
+
+// UpdateRecord skips the update if the cached value already matches
+func (c *CachingProvider) UpdateRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	return c.UpdateRecords(ctx, domain, []*DNSRecord{record})
+}
+
+// UpdateRecords forwards the records whose cached value differs
+func (c *CachingProvider) UpdateRecords(ctx context.Context, domain string, records []*DNSRecord) error {
+	var stale []*DNSRecord
+	for _, record := range records {
+		if cached, ok := c.lookup(domain, record.Name, record.Type); ok && cached.Value == record.Value {
+			c.hits.Add(1)
+			logger.DebugContext(ctx, "%s: Record %s (%s) unchanged according to cache", c.inner.Name(), record.Name, record.Type)
+			continue
+		}
+		c.misses.Add(1)
+		c.Invalidate(domain, record.Name, record.Type)
+		stale = append(stale, record)
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	if err := UpdateRecords(ctx, c.inner, domain, stale); err != nil {
+		return err
+	}
+	for _, record := range stale {
+		c.store(domain, record)
+	}
+	return nil
+}
+
+// DeleteRecord drops the cached record and deletes it
+func (c *CachingProvider) DeleteRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	c.Invalidate(domain, record.Name, record.Type)
+	return DeleteRecord(ctx, c.inner, domain, record)
+}
+
+// Close stops revalidation and closes the wrapped provider
+func (c *CachingProvider) Close(ctx context.Context) error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	stats := c.Stats()
+	logger.DebugContext(ctx, "%s: Record cache hits=%d, misses=%d", c.inner.Name(), stats.Hits, stats.Misses)
+	return c.inner.Close(ctx)
+}
+
+// Stats returns the cache counters
+func (c *CachingProvider) Stats() CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: entries}
+}
+
+// Seed caches a record known from elsewhere, e.g. persisted state
+func (c *CachingProvider) Seed(domain string, record *DNSRecord) {
+	c.store(domain, record)
+}
+
+// Invalidate drops the cached record of a hostname and type
+func (c *CachingProvider) Invalidate(domain, hostname, recordType string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, cacheKey(domain, hostname, recordType))
+}
+
+// Revalidate compares every cached record with the wrapped provider and
+// replaces entries that were changed outside homeddns. Records that can no
+// longer be read are dropped. It returns the number of changed entries.
+func (c *CachingProvider) Revalidate(ctx context.Context) int {
+	c.mu.Lock()
+	snapshot := make(map[string]cacheEntry, len(c.entries))
+	for key, entry := range c.entries {
+		snapshot[key] = entry
+	}
+	c.mu.Unlock()
+
+	changed := 0
+	for key, entry := range snapshot {
+		current, err := c.inner.GetRecord(ctx, entry.domain, entry.record.Name, entry.record.Type)
+
+		c.mu.Lock()
+		if latest, ok := c.entries[key]; !ok || latest.record != entry.record {
+			// Written or invalidated meanwhile
+			c.mu.Unlock()
+			continue
+		}
+		switch {
+		case err != nil:
+			logger.DebugContext(ctx, "%s: Dropping cached record %s (%s): %v", c.inner.Name(), entry.record.Name, entry.record.Type, err)
+			delete(c.entries, key)
+		case current.Value != entry.record.Value:
+			logger.InfoContext(ctx, "%s: Record %s (%s) was changed outside homeddns: %s -> %s",
+				c.inner.Name(), entry.record.Name, entry.record.Type, entry.record.Value, current.Value)
+			c.entries[key] = cacheEntry{domain: entry.domain, record: *current, expires: c.now().Add(c.ttl)}
+			changed++
+		default:
+			// Confirmed, keep it fresh
+			c.entries[key] = cacheEntry{domain: entry.domain, record: entry.record, expires: c.now().Add(c.ttl)}
+		}
+		c.mu.Unlock()
+	}
+	return changed
+}
+
+// StartRevalidation revalidates the cache now and then every interval
+// until Close
+func (c *CachingProvider) StartRevalidation(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		c.Revalidate(context.Background())
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				c.Revalidate(context.Background())
+			}
+		}
+	}()
+}
+
+// lookup returns an unexpired cached record
+func (c *CachingProvider) lookup(domain, hostname, recordType string) (DNSRecord, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheKey(domain, hostname, recordType)
+	entry, ok := c.entries[key]
+	if !ok {
+		return DNSRecord{}, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return DNSRecord{}, false
+	}
+	return entry.record, true
+}
+
+// store caches a record
+func (c *CachingProvider) store(domain string, record *DNSRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[cacheKey(domain, record.Name, record.Type)] = cacheEntry{
+		domain:  domain,
+		record:  *record,
+		expires: c.now().Add(c.ttl),
+	}
+}
+
+// cacheKey identifies a record set
+func cacheKey(domain, hostname, recordType string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, ".")) + "|" +
+		strings.ToLower(strings.TrimSuffix(hostname, ".")) + "|" + strings.ToUpper(recordType)
+}
@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestWithCache_SkipsUnchangedUpdates(t *testing.T) {
+	fake := newFakeProvider()
+	cache := WithCache(fake, time.Hour)
+	ctx := context.Background()
+	record := &DNSRecord{Name: "a.example.com", Type: "A", Value: "192.0.2.1"}
+
+	assert.NoError(t, cache.UpdateRecord(ctx, "example.com", record))
+	assert.NoError(t, cache.UpdateRecord(ctx, "example.com", record))
+	assert.NoError(t, cache.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "A.example.com", Type: "A", Value: "192.0.2.1"}))
+	assert.Equal(t, 1, fake.callCount("UpdateRecords"))
+
+	got, err := cache.GetRecord(ctx, "example.com", "a.example.com", "A")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", got.Value)
+	assert.Equal(t, 0, fake.callCount("GetRecord"))
+
+	assert.NoError(t, cache.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "a.example.com", Type: "A", Value: "192.0.2.2"}))
+	assert.Equal(t, 2, fake.callCount("UpdateRecords"))
+	assert.Equal(t, CacheStats{Hits: 3, Misses: 2, Entries: 1}, cache.Stats())
+}
+
+func TestWithCache_ExpiresAndInvalidates(t *testing.T) {
+	fake := newFakeProvider()
+	fake.records["a.example.com/A"] = DNSRecord{Name: "a.example.com", Type: "A", Value: "192.0.2.1"}
+	cache := WithCache(fake, time.Minute)
+	now := time.Unix(0, 0)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := cache.GetRecord(ctx, "example.com", "a.example.com", "A")
+	assert.NoError(t, err)
+	_, err = cache.GetRecord(ctx, "example.com", "a.example.com", "A")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fake.callCount("GetRecord"))
+
+	now = now.Add(time.Minute)
+	_, err = cache.GetRecord(ctx, "example.com", "a.example.com", "A")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fake.callCount("GetRecord"))
+
+	assert.NoError(t, cache.DeleteRecord(ctx, "example.com", &DNSRecord{Name: "a.example.com", Type: "A"}))
+	_, err = cache.GetRecord(ctx, "example.com", "a.example.com", "A")
+	assert.Error(t, err)
+	assert.Equal(t, 0, cache.Stats().Entries)
+}
+
+func TestWithCache_Revalidate(t *testing.T) {
+	fake := newFakeProvider()
+	cache := WithCache(fake, time.Hour)
+	ctx := context.Background()
+	record := &DNSRecord{Name: "a.example.com", Type: "A", Value: "192.0.2.1"}
+	assert.NoError(t, cache.UpdateRecord(ctx, "example.com", record))
+	assert.NoError(t, cache.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "b.example.com", Type: "A", Value: "192.0.2.2"}))
+	assert.Equal(t, 0, cache.Revalidate(ctx))
+
+	// Edited and deleted outside homeddns
+	fake.records["a.example.com/A"] = DNSRecord{Name: "a.example.com", Type: "A", Value: "198.51.100.1"}
+	delete(fake.records, "b.example.com/A")
+	assert.Equal(t, 1, cache.Revalidate(ctx))
+	assert.Equal(t, 1, cache.Stats().Entries)
+
+	// The next update with the original value repairs the record
+	assert.NoError(t, cache.UpdateRecord(ctx, "example.com", record))
+	assert.Equal(t, "192.0.2.1", fake.records["a.example.com/A"].Value)
+}
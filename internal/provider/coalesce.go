@@ -0,0 +1,206 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+)
+
+// coalescingProvider serializes writes per zone and merges updates that
+// arrive within a short window into a single batch
+type coalescingProvider struct {
+	inner  Provider
+	window time.Duration
+	after  func(d time.Duration) <-chan time.Time
+
+	mu    sync.Mutex
+	zones map[string]*zoneQueue
+	wg    sync.WaitGroup
+}
+
+// zoneQueue holds the pending writes of one zone
+type zoneQueue struct {
+	pending []*pendingWrite
+	running bool // a flush goroutine owns the zone
+}
+
+// pendingWrite is a queued update or delete with its waiter
+type pendingWrite struct {
+	ctx    context.Context
+	record *DNSRecord
+	delete bool
+	done   chan error
+}
+
+// WithCoalescing wraps a provider so that all writes to a zone go through a
+// single queue. Updates arriving within window of the first pending one are
+// merged into one UpdateRecords call (last write wins per name and type),
+// which avoids concurrent read-modify-write cycles overwriting each other.
+// Every caller still receives the result of its own record.
+func WithCoalescing(p Provider, window time.Duration) Provider {
+	return &coalescingProvider{
+		inner:  p,
+		window: window,
+		after:  time.After,
+		zones:  make(map[string]*zoneQueue),
+	}
+}
+
+// Name returns the name of the wrapped provider
+func (c *coalescingProvider) Name() string {
+	return c.inner.Name()
+}
+
+// Unwrap returns the wrapped provider
+func (c *coalescingProvider) Unwrap() Provider {
+	return c.inner
+}
+
+// GetRecord retrieves a record directly from the wrapped provider
+func (c *coalescingProvider) GetRecord(ctx context.Context, domain, hostname, recordType string) (*DNSRecord, error) {
+	return c.inner.GetRecord(ctx, domain, hostname, recordType)
+}
+
+// UpdateRecord queues an update and waits for its result
+func (c *coalescingProvider) UpdateRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	return c.UpdateRecords(ctx, domain, []*DNSRecord{record})
+}
+
+// UpdateRecords queues several updates and waits for their results
+func (c *coalescingProvider) UpdateRecords(ctx context.Context, domain string, records []*DNSRecord) error {
+	writes := make([]*pendingWrite, len(records))
+	for i, record := range records {
+		writes[i] = &pendingWrite{ctx: ctx, record: record, done: make(chan error, 1)}
+	}
+	return c.submit(ctx, domain, writes)
+}
+
+// DeleteRecord queues a delete behind the pending updates of the zone
+func (c *coalescingProvider) DeleteRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	write := &pendingWrite{ctx: ctx, record: record, delete: true, done: make(chan error, 1)}
+	return c.submit(ctx, domain, []*pendingWrite{write})
+}
+
+// Close waits for queued writes and closes the wrapped provider
+func (c *coalescingProvider) Close(ctx context.Context) error {
+	c.wg.Wait()
+	return c.inner.Close(ctx)
+}
+
+// submit queues writes and returns the first error among their results
+func (c *coalescingProvider) submit(ctx context.Context, domain string, writes []*pendingWrite) error {
+	key := strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	c.mu.Lock()
+	queue, ok := c.zones[key]
+	if !ok {
+		queue = &zoneQueue{}
+		c.zones[key] = queue
+	}
+	queue.pending = append(queue.pending, writes...)
+	if !queue.running {
+		queue.running = true
+		c.wg.Add(1)
+		go c.run(domain, queue)
+	}
+	c.mu.Unlock()
+
+	var firstErr error
+	for _, write := range writes {
+		select {
+		case err := <-write.done:
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return firstErr
+}
+
+// run waits for the coalescing window and flushes the zone queue until it
+// is empty. Writes queued while a flush is in progress are picked up by the
+// next iteration.
+func (c *coalescingProvider) run(domain string, queue *zoneQueue) {
+	defer c.wg.Done()
+
+	if c.window > 0 {
+		<-c.after(c.window)
+	}
+
+	for {
+		c.mu.Lock()
+		batch := queue.pending
+		queue.pending = nil
+		if len(batch) == 0 {
+			queue.running = false
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+
+		// Deletes split the batch so that writes are applied in order
+		for len(batch) > 0 {
+			n := 1
+			if batch[0].delete {
+				c.applyDelete(domain, batch[0])
+			} else {
+				for n < len(batch) && !batch[n].delete {
+					n++
+				}
+				c.applyUpdates(domain, batch[:n])
+			}
+			batch = batch[n:]
+		}
+	}
+}
+
+// applyUpdates merges consecutive updates and applies them in one call
+func (c *coalescingProvider) applyUpdates(domain string, writes []*pendingWrite) {
+	// Last write wins per name and type
+	var records []*DNSRecord
+	index := make(map[string]int)
+	keys := make([]string, len(writes))
+	for i, write := range writes {
+		key := strings.ToLower(write.record.Name) + "/" + write.record.Type
+		keys[i] = key
+		if j, ok := index[key]; ok {
+			records[j] = write.record
+			continue
+		}
+		index[key] = len(records)
+		records = append(records, write.record)
+	}
+
+	// The batch outlives the request that happened to start it
+	ctx := context.WithoutCancel(writes[0].ctx)
+	if len(writes) > 1 {
+		logger.DebugContext(ctx, "%s: Coalesced %d updates of %s into %d records", c.inner.Name(), len(writes), domain, len(records))
+	}
+	results := make([]error, len(records))
+	err := UpdateRecords(ctx, c.inner, domain, records)
+	if err != nil && len(records) > 1 && KindOf(err) == KindPermanent {
+		// One bad record must not fail the others: retry them one by one
+		logger.DebugContext(ctx, "%s: Batch update of %s failed, applying records individually: %v", c.inner.Name(), domain, err)
+		for i, record := range records {
+			results[i] = c.inner.UpdateRecord(ctx, domain, record)
+		}
+	} else {
+		for i := range results {
+			results[i] = err
+		}
+	}
+
+	for i, write := range writes {
+		write.done <- results[index[keys[i]]]
+	}
+}
+
+// applyDelete applies a single queued delete
+func (c *coalescingProvider) applyDelete(domain string, write *pendingWrite) {
+	write.done <- DeleteRecord(context.WithoutCancel(write.ctx), c.inner, domain, write.record)
+}
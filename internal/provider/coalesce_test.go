@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// newTestCoalescing returns a coalescing provider whose window ends when
+// flush is closed
+func newTestCoalescing(p Provider) (*coalescingProvider, chan time.Time) {
+	c := WithCoalescing(p, time.Minute).(*coalescingProvider)
+	flush := make(chan time.Time)
+	c.after = func(time.Duration) <-chan time.Time { return flush }
+	return c, flush
+}
+
+// submitAsync starts a write and waits until it is queued
+func submitAsync(t *testing.T, c *coalescingProvider, queued int, fn func() error) <-chan error {
+	t.Helper()
+	result := make(chan error, 1)
+	go func() { result <- fn() }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		n := 0
+		if queue, ok := c.zones["example.com"]; ok {
+			n = len(queue.pending)
+		}
+		c.mu.Unlock()
+		if n >= queued {
+			return result
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("write was not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWithCoalescing_MergesUpdates(t *testing.T) {
+	fake := newFakeProvider()
+	c, flush := newTestCoalescing(fake)
+	ctx := context.Background()
+
+	update := func(name, value string) func() error {
+		return func() error {
+			return c.UpdateRecord(ctx, "example.com", &DNSRecord{Name: name, Type: "A", Value: value})
+		}
+	}
+	first := submitAsync(t, c, 1, update("a.example.com", "192.0.2.1"))
+	second := submitAsync(t, c, 2, update("b.example.com", "192.0.2.2"))
+	third := submitAsync(t, c, 3, update("a.example.com", "192.0.2.3"))
+	close(flush)
+
+	assert.NoError(t, <-first)
+	assert.NoError(t, <-second)
+	assert.NoError(t, <-third)
+	assert.Equal(t, [][]string{{"a.example.com=192.0.2.3", "b.example.com=192.0.2.2"}}, fake.batches)
+	assert.Equal(t, 0, fake.callCount("UpdateRecord"))
+}
+
+func TestWithCoalescing_SeparatesResultsOnBatchFailure(t *testing.T) {
+	fake := newFakeProvider()
+	fake.errs = []error{
+		NewError(KindPermanent, errors.New("batch rejected")),
+		NewError(KindPermanent, errors.New("invalid destination")),
+	}
+	c, flush := newTestCoalescing(fake)
+	ctx := context.Background()
+
+	bad := submitAsync(t, c, 1, func() error {
+		return c.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "bad.example.com", Type: "A", Value: "x"})
+	})
+	good := submitAsync(t, c, 2, func() error {
+		return c.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "good.example.com", Type: "A", Value: "192.0.2.1"})
+	})
+	close(flush)
+
+	assert.EqualError(t, <-bad, "invalid destination")
+	assert.NoError(t, <-good)
+	assert.Equal(t, 2, fake.callCount("UpdateRecord"))
+}
+
+func TestWithCoalescing_KeepsDeleteOrder(t *testing.T) {
+	fake := newFakeProvider()
+	c, flush := newTestCoalescing(fake)
+	ctx := context.Background()
+	record := &DNSRecord{Name: "a.example.com", Type: "A", Value: "192.0.2.1"}
+
+	updated := submitAsync(t, c, 1, func() error { return c.UpdateRecord(ctx, "example.com", record) })
+	deleted := submitAsync(t, c, 2, func() error { return c.DeleteRecord(ctx, "example.com", record) })
+	close(flush)
+
+	assert.NoError(t, <-updated)
+	assert.NoError(t, <-deleted)
+	assert.Equal(t, 1, fake.callCount("UpdateRecords"))
+	assert.Equal(t, 1, fake.callCount("DeleteRecord"))
+	_, err := fake.GetRecord(ctx, "example.com", "a.example.com", "A")
+	assert.Error(t, err)
+
+	assert.NoError(t, c.Close(ctx))
+}
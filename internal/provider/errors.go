@@ -0,0 +1,117 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ErrorKind classifies provider errors for retry decisions
+type ErrorKind int
+
+const (
+	// KindPermanent errors will fail again if retried (bad input, unknown zone, ...)
+	KindPermanent ErrorKind = iota
+	// KindRetryable errors are transient (network errors, throttling, 5xx responses)
+	KindRetryable
+	// KindAuth errors are caused by invalid or missing credentials
+	KindAuth
+)
+
+// String returns the string representation of an error kind
+func (k ErrorKind) String() string {
+	switch k {
+	case KindPermanent:
+		return "permanent"
+	case KindRetryable:
+		return "retryable"
+	case KindAuth:
+		return "auth"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrNotSupported is returned for optional operations a provider does not implement
+var ErrNotSupported = errors.New("operation not supported by provider")
+
+// ErrNotFound is returned by GetRecord if the record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// Error is a classified provider error
+type Error struct {
+	Kind ErrorKind
+	Err  error
+	// RetryAfter is a minimum delay requested by the API (optional)
+	RetryAfter time.Duration
+}
+
+// Error returns the error message
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError wraps err with a classification
+func NewError(kind ErrorKind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// KindOf classifies an error. Errors that were not classified by a provider
+// are retryable if they are network errors and permanent otherwise.
+func KindOf(err error) ErrorKind {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return perr.Kind
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return KindPermanent
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return KindRetryable
+	}
+	return KindPermanent
+}
+
+// IsRetryable reports whether an error is worth retrying
+func IsRetryable(err error) bool {
+	return err != nil && KindOf(err) == KindRetryable
+}
+
+// IsAuth reports whether an error was caused by invalid credentials
+func IsAuth(err error) bool {
+	return err != nil && KindOf(err) == KindAuth
+}
+
+// transportError classifies an error of an HTTP round trip as retryable,
+// unless the context was canceled or its deadline passed
+func transportError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return NewError(KindRetryable, err)
+}
+
+// httpStatusError classifies an unexpected HTTP response status
+func httpStatusError(statusCode int, body []byte) error {
+	err := fmt.Errorf("unexpected status code: %d, body: %s", statusCode, body)
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return NewError(KindAuth, err)
+	case statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout || statusCode >= 500:
+		return NewError(KindRetryable, err)
+	default:
+		return NewError(KindPermanent, err)
+	}
+}
@@ -0,0 +1,196 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// hostsFile is an /etc/hosts style file ("IP name [name...]") as used by
+// dnsmasq addn-hosts and Pi-hole custom.list. Comments and unrelated lines
+// are kept untouched.
+type hostsFile struct {
+	lines []string
+}
+
+// readHostsFile reads a hosts file; a missing file is treated as empty
+func readHostsFile(path string) (*hostsFile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &hostsFile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read hosts file: %w", err)
+	}
+	return parseHostsFile(string(data)), nil
+}
+
+// parseHostsFile parses hosts file content
+func parseHostsFile(text string) *hostsFile {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return &hostsFile{}
+	}
+	return &hostsFile{lines: strings.Split(text, "\n")}
+}
+
+// String returns the hosts file content with a trailing newline
+func (h *hostsFile) String() string {
+	if len(h.lines) == 0 {
+		return ""
+	}
+	return strings.Join(h.lines, "\n") + "\n"
+}
+
+// hostsLineFields returns the IP and names of a line, or false for comments and blank lines
+func hostsLineFields(line string) (string, []string, bool) {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+		return "", nil, false
+	}
+	return fields[0], fields[1:], true
+}
+
+// lookup returns the first address of a name for the given record type
+func (h *hostsFile) lookup(name, recordType string) (string, bool) {
+	if addresses := h.addresses(name, recordType); len(addresses) > 0 {
+		return addresses[0], true
+	}
+	return "", false
+}
+
+// set points name to ip, replacing other addresses of the same family.
+// It returns false if the file already contained exactly that mapping.
+func (h *hostsFile) set(name, ip string) bool {
+	recordType := hostsRecordType(ip)
+	if addresses := h.addresses(name, recordType); len(addresses) == 1 && addresses[0] == ip {
+		return false
+	}
+	h.remove(name, recordType, "")
+	h.lines = append(h.lines, ip+" "+strings.ToLower(name))
+	return true
+}
+
+// addresses returns all addresses of a name for the given record type
+func (h *hostsFile) addresses(name, recordType string) []string {
+	name = strings.ToLower(name)
+	var addresses []string
+	for _, line := range h.lines {
+		ip, names, ok := hostsLineFields(line)
+		if !ok || hostsRecordType(ip) != recordType {
+			continue
+		}
+		for _, n := range names {
+			if strings.ToLower(n) == name {
+				addresses = append(addresses, ip)
+			}
+		}
+	}
+	return addresses
+}
+
+// remove deletes name from all lines of the given family, optionally only
+// those pointing to value. Lines left without names are dropped.
+// It returns the number of removed mappings.
+func (h *hostsFile) remove(name, recordType, value string) int {
+	name = strings.ToLower(name)
+	removed := 0
+	kept := h.lines[:0]
+	for _, line := range h.lines {
+		ip, names, ok := hostsLineFields(line)
+		if !ok || hostsRecordType(ip) != recordType || (value != "" && ip != value) {
+			kept = append(kept, line)
+			continue
+		}
+
+		remaining := make([]string, 0, len(names))
+		for _, n := range names {
+			if strings.ToLower(n) == name {
+				removed++
+				continue
+			}
+			remaining = append(remaining, n)
+		}
+		switch {
+		case len(remaining) == len(names):
+			kept = append(kept, line)
+		case len(remaining) > 0:
+			kept = append(kept, ip+" "+strings.Join(remaining, " "))
+		}
+	}
+	h.lines = kept
+	return removed
+}
+
+// hostsRecordType returns A or AAAA depending on the address family
+func hostsRecordType(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "AAAA"
+	}
+	return "A"
+}
+
+// validateAddressRecord checks that a record can be stored as a local DNS entry
+func validateAddressRecord(record *DNSRecord) error {
+	if record.Type != "A" && record.Type != "AAAA" {
+		return fmt.Errorf("unsupported record type %s (only A and AAAA)", record.Type)
+	}
+	ip := net.ParseIP(record.Value)
+	if ip == nil {
+		return fmt.Errorf("invalid IP address: %s", record.Value)
+	}
+	if (ip.To4() != nil) != (record.Type == "A") {
+		return fmt.Errorf("address %s does not match record type %s", record.Value, record.Type)
+	}
+	return nil
+}
+
+// hostsFileStore serializes read-modify-write cycles on a hosts file
+type hostsFileStore struct {
+	path          string
+	reloadCommand string
+	mu            sync.Mutex
+}
+
+// get returns the address of a name from the hosts file
+func (s *hostsFileStore) get(hostname, recordType string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hosts, err := readHostsFile(s.path)
+	if err != nil {
+		return "", err
+	}
+	ip, ok := hosts.lookup(hostname, recordType)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return ip, nil
+}
+
+// modify applies fn to the hosts file and writes it back if fn reports a change
+func (s *hostsFileStore) modify(ctx context.Context, fn func(*hostsFile) bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hosts, err := readHostsFile(s.path)
+	if err != nil {
+		return false, err
+	}
+	if !fn(hosts) {
+		return false, nil
+	}
+	if err := writeFileAtomic(s.path, []byte(hosts.String())); err != nil {
+		return false, fmt.Errorf("write hosts file: %w", err)
+	}
+	if err := runReloadCommand(ctx, s.reloadCommand); err != nil {
+		return true, err
+	}
+	return true, nil
+}
@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Observer receives the duration and result of every provider call.
+// Operation is the method name, e.g. "UpdateRecords".
+type Observer func(provider, operation string, duration time.Duration, err error)
+
+// instrumentedProvider reports every call to an Observer
+type instrumentedProvider struct {
+	inner   Provider
+	observe Observer
+}
+
+// WithInstrumentation wraps a provider so that the latency and result of
+// every call is passed to observe. Wrapped inside WithRetry, each attempt is
+// observed separately. Calls failing with ErrNotSupported are not observed.
+func WithInstrumentation(p Provider, observe Observer) Provider {
+	return &instrumentedProvider{inner: p, observe: observe}
+}
+
+// Name returns the name of the wrapped provider
+func (i *instrumentedProvider) Name() string {
+	return i.inner.Name()
+}
+
+// Unwrap returns the wrapped provider
+func (i *instrumentedProvider) Unwrap() Provider {
+	return i.inner
+}
+
+// GetRecord retrieves a record
+func (i *instrumentedProvider) GetRecord(ctx context.Context, domain, hostname, recordType string) (*DNSRecord, error) {
+	var record *DNSRecord
+	err := i.do("GetRecord", func() error {
+		var err error
+		record, err = i.inner.GetRecord(ctx, domain, hostname, recordType)
+		return err
+	})
+	return record, err
+}
+
+// UpdateRecord updates a record
+func (i *instrumentedProvider) UpdateRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	return i.do("UpdateRecord", func() error {
+		return i.inner.UpdateRecord(ctx, domain, record)
+	})
+}
+
+// UpdateRecords updates several records
+func (i *instrumentedProvider) UpdateRecords(ctx context.Context, domain string, records []*DNSRecord) error {
+	return i.do("UpdateRecords", func() error {
+		return UpdateRecords(ctx, i.inner, domain, records)
+	})
+}
+
+// DeleteRecord deletes a record
+func (i *instrumentedProvider) DeleteRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	return i.do("DeleteRecord", func() error {
+		return DeleteRecord(ctx, i.inner, domain, record)
+	})
+}
+
+// Close closes the wrapped provider
+func (i *instrumentedProvider) Close(ctx context.Context) error {
+	return i.inner.Close(ctx)
+}
+
+// do runs fn and reports its duration and result
+func (i *instrumentedProvider) do(op string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	if !errors.Is(err, ErrNotSupported) {
+		i.observe(i.inner.Name(), op, time.Since(start), err)
+	}
+	return err
+}
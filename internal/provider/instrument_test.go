@@ -0,0 +1,37 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestWithInstrumentation(t *testing.T) {
+	fake := newFakeProvider()
+	fake.errs = []error{nil, NewError(KindRetryable, errors.New("timeout"))}
+
+	var observed []string
+	p := WithInstrumentation(fake, func(provider, operation string, duration time.Duration, err error) {
+		result := "ok"
+		if err != nil {
+			result = KindOf(err).String()
+		}
+		observed = append(observed, provider+"/"+operation+"/"+result)
+	})
+	ctx := context.Background()
+
+	assert.NoError(t, p.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "a", Type: "A", Value: "192.0.2.1"}))
+	_, err := p.GetRecord(ctx, "example.com", "a", "A")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"fake/UpdateRecord/ok", "fake/GetRecord/retryable"}, observed)
+
+	// Unsupported optional operations are not observed
+	p = WithInstrumentation(updateOnly{fake}, func(string, string, time.Duration, error) {
+		t.Fatal("unexpected observation")
+	})
+	err = DeleteRecord(ctx, p, "example.com", &DNSRecord{Name: "a", Type: "A"})
+	assert.True(t, errors.Is(err, ErrNotSupported))
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
+
+	"github.com/markussiebert/homeddns/internal/util"
 )
 
 // DNSRecordSet represents a DNS zone's record set
@@ -28,9 +31,101 @@ type Provider interface {
 	Close(ctx context.Context) error
 }
 
+// RecordDeleter is implemented by providers that can remove records.
+// If record.Value is empty, all values of the given name and type are removed.
+type RecordDeleter interface {
+	DeleteRecord(ctx context.Context, domain string, record *DNSRecord) error
+}
+
+// RecordLister is implemented by providers that can list all records of a
+// zone. Record names are fully qualified, without trailing dot.
+type RecordLister interface {
+	ListRecords(ctx context.Context, domain string) ([]DNSRecord, error)
+}
+
+// BatchUpdater is implemented by providers that can apply several record
+// updates of one zone in a single read-modify-write cycle.
+type BatchUpdater interface {
+	UpdateRecords(ctx context.Context, domain string, records []*DNSRecord) error
+}
+
+// DisplayValue returns the value of a record for log output. TXT values
+// can hold ACME tokens or verification secrets and are masked.
+func DisplayValue(record *DNSRecord) string {
+	if strings.EqualFold(record.Type, "TXT") {
+		return util.MaskValue(record.Value)
+	}
+	return record.Value
+}
+
+// PropagationWaiter is implemented by providers that can tell when an
+// update is served by their nameservers, e.g. Route53 GetChange INSYNC.
+// Providers without it are checked by polling the authoritative nameservers.
+type PropagationWaiter interface {
+	WaitForPropagation(ctx context.Context, domain string, record *DNSRecord) error
+}
+
+// HealthChecker is implemented by providers that can verify their
+// credentials and connectivity with a cheap call
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// Wrapper is implemented by decorators (retry, caching, ...) around a provider.
+//
+// Decorators implement every mutating optional interface (RecordDeleter,
+// BatchUpdater) and forward it with the package-level helpers, so that the
+// decorator's behaviour applies and the helper's fallback is used if the
+// wrapped provider lacks the capability. Read-only capabilities
+// (RecordLister, PropagationWaiter, HealthChecker) are looked up on the
+// innermost provider with As.
+type Wrapper interface {
+	Unwrap() Provider
+}
+
+// As finds the first provider in the decorator chain of p that implements T
+func As[T any](p Provider) (T, bool) {
+	for p != nil {
+		if t, ok := p.(T); ok {
+			return t, true
+		}
+		w, ok := p.(Wrapper)
+		if !ok {
+			break
+		}
+		p = w.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// DeleteRecord removes a record if the provider supports it
+func DeleteRecord(ctx context.Context, p Provider, domain string, record *DNSRecord) error {
+	if d, ok := p.(RecordDeleter); ok {
+		return d.DeleteRecord(ctx, domain, record)
+	}
+	return fmt.Errorf("%s: delete record: %w", p.Name(), ErrNotSupported)
+}
+
+// UpdateRecords applies several updates to a zone, in one call if the provider
+// supports it and one by one otherwise
+func UpdateRecords(ctx context.Context, p Provider, domain string, records []*DNSRecord) error {
+	if b, ok := p.(BatchUpdater); ok {
+		return b.UpdateRecords(ctx, domain, records)
+	}
+	for _, record := range records {
+		if err := p.UpdateRecord(ctx, domain, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 var (
 	// factories holds the registered provider factories.
 	factories = make(map[string]func(ctx context.Context, config interface{}) (Provider, error))
+	// aliases maps other names of providers to their registered names.
+	aliases = make(map[string]string)
 )
 
 // RegisterFactory registers a provider factory function.
@@ -42,8 +137,17 @@ func RegisterFactory(name string, factory func(ctx context.Context, config inter
 	factories[name] = factory
 }
 
-// GetFactory retrieves a provider factory by name.
+// RegisterAlias registers another name of a provider, e.g. a name used by
+// older releases or documentation.
+func RegisterAlias(alias, name string) {
+	aliases[alias] = name
+}
+
+// GetFactory retrieves a provider factory by name or alias.
 func GetFactory(name string) (func(ctx context.Context, config interface{}) (Provider, error), bool) {
+	if registered, ok := aliases[name]; ok {
+		name = registered
+	}
 	factory, ok := factories[name]
 	return factory, ok
 }
@@ -0,0 +1,236 @@
+//go:build adguard_home || (!netcup_ccp && !aws_route53)
+// +build adguard_home !netcup_ccp,!aws_route53
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/util"
+)
+
+// AdGuardHomeConfig holds configuration for the AdGuard Home provider.
+type AdGuardHomeConfig struct {
+	// URL is the AdGuard Home base URL, e.g. http://192.168.1.2:3000
+	URL      string
+	Username string
+	Password util.Secret
+}
+
+// LoadAdGuardHomeConfig loads the AdGuard Home configuration from environment variables
+// or the settings of the configuration file
+func LoadAdGuardHomeConfig(settings Settings) (*AdGuardHomeConfig, error) {
+	config := &AdGuardHomeConfig{
+		URL:      strings.TrimSuffix(settings.Get("ADGUARD_URL"), "/"),
+		Username: settings.Get("ADGUARD_USERNAME"),
+	}
+	password, err := settings.Secret("ADGUARD_PASSWORD")
+	if err != nil {
+		return nil, logger.Errorf("%w", err)
+	}
+	config.Password = password
+	if config.URL == "" {
+		return nil, logger.Errorf("ADGUARD_URL is required for the adguard_home provider")
+	}
+	logger.Debug("AdGuard Home config: url=%s, username=%s", config.URL, config.Username)
+	return config, nil
+}
+
+// adguardRewrite is a DNS rewrite rule of AdGuard Home
+type adguardRewrite struct {
+	Domain string `json:"domain"`
+	Answer string `json:"answer"`
+}
+
+// AdGuardHomeClient manages DNS rewrites of AdGuard Home
+type AdGuardHomeClient struct {
+	config     AdGuardHomeConfig
+	httpClient *http.Client
+}
+
+// NewAdGuardHomeClient creates a new AdGuard Home client
+func NewAdGuardHomeClient(config AdGuardHomeConfig) *AdGuardHomeClient {
+	return &AdGuardHomeClient{
+		config: config,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+func init() {
+	RegisterFactory("adguard_home", NewAdGuardHomeProvider)
+}
+
+// NewAdGuardHomeProvider creates a new AdGuard Home provider
+func NewAdGuardHomeProvider(ctx context.Context, config interface{}) (Provider, error) {
+	cfg, err := LoadAdGuardHomeConfig(SettingsFrom(config))
+	if err != nil {
+		return nil, fmt.Errorf("load adguard home config: %w", err)
+	}
+	return NewAdGuardHomeClient(*cfg), nil
+}
+
+// Name returns the provider name
+func (c *AdGuardHomeClient) Name() string {
+	return "adguard_home"
+}
+
+// GetRecord retrieves a DNS rewrite
+func (c *AdGuardHomeClient) GetRecord(ctx context.Context, domain, hostname, recordType string) (*DNSRecord, error) {
+	logger.DebugContext(ctx, "AdGuard Home: Getting record for hostname=%s, type=%s", hostname, recordType)
+
+	rewrites, err := c.rewrites(ctx, hostname, recordType)
+	if err != nil {
+		return nil, err
+	}
+	if len(rewrites) == 0 {
+		return nil, ErrNotFound
+	}
+	return &DNSRecord{Name: hostname, Type: recordType, Value: rewrites[0].Answer}, nil
+}
+
+// UpdateRecord replaces the DNS rewrite of a hostname for the record's address family
+func (c *AdGuardHomeClient) UpdateRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	logger.DebugContext(ctx, "AdGuard Home: Updating record name=%s, type=%s, value=%s", record.Name, record.Type, record.Value)
+
+	if err := validateAddressRecord(record); err != nil {
+		return err
+	}
+
+	existing, err := c.rewrites(ctx, record.Name, record.Type)
+	if err != nil {
+		return err
+	}
+	if len(existing) == 1 && existing[0].Answer == record.Value {
+		logger.DebugContext(ctx, "AdGuard Home: Record already up to date")
+		return nil
+	}
+
+	for _, rewrite := range existing {
+		if err := c.post(ctx, "/control/rewrite/delete", rewrite, nil); err != nil {
+			return fmt.Errorf("delete rewrite: %w", err)
+		}
+	}
+	rewrite := adguardRewrite{Domain: strings.ToLower(record.Name), Answer: record.Value}
+	if err := c.post(ctx, "/control/rewrite/add", rewrite, nil); err != nil {
+		return fmt.Errorf("add rewrite: %w", err)
+	}
+
+	logger.InfoContext(ctx, "AdGuard Home: Successfully updated record %s to %s", record.Name, record.Value)
+	return nil
+}
+
+// DeleteRecord removes DNS rewrites of a hostname
+func (c *AdGuardHomeClient) DeleteRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	logger.DebugContext(ctx, "AdGuard Home: Deleting record name=%s, type=%s", record.Name, record.Type)
+
+	existing, err := c.rewrites(ctx, record.Name, record.Type)
+	if err != nil {
+		return err
+	}
+	for _, rewrite := range existing {
+		if record.Value != "" && rewrite.Answer != record.Value {
+			continue
+		}
+		if err := c.post(ctx, "/control/rewrite/delete", rewrite, nil); err != nil {
+			return fmt.Errorf("delete rewrite: %w", err)
+		}
+	}
+	return nil
+}
+
+// WaitForPropagation returns immediately: AdGuard Home serves rewrites as soon as the API call returns
+func (c *AdGuardHomeClient) WaitForPropagation(ctx context.Context, domain string, record *DNSRecord) error {
+	return nil
+}
+
+// HealthCheck verifies the API credentials by requesting the server status
+func (c *AdGuardHomeClient) HealthCheck(ctx context.Context) error {
+	var status map[string]any
+	if err := c.request(ctx, http.MethodGet, "/control/status", nil, &status); err != nil {
+		return fmt.Errorf("get status: %w", err)
+	}
+	return nil
+}
+
+// Close cleans up resources (no-op for AdGuard Home)
+func (c *AdGuardHomeClient) Close(ctx context.Context) error {
+	return nil
+}
+
+// rewrites returns the address rewrites of a hostname for the given record type
+func (c *AdGuardHomeClient) rewrites(ctx context.Context, hostname, recordType string) ([]adguardRewrite, error) {
+	var all []adguardRewrite
+	if err := c.request(ctx, http.MethodGet, "/control/rewrite/list", nil, &all); err != nil {
+		return nil, fmt.Errorf("list rewrites: %w", err)
+	}
+
+	hostname = strings.ToLower(hostname)
+	var matching []adguardRewrite
+	for _, rewrite := range all {
+		if strings.ToLower(rewrite.Domain) != hostname || net.ParseIP(rewrite.Answer) == nil {
+			continue
+		}
+		if hostsRecordType(rewrite.Answer) == recordType {
+			matching = append(matching, rewrite)
+		}
+	}
+	return matching, nil
+}
+
+// post performs a POST request with a JSON body
+func (c *AdGuardHomeClient) post(ctx context.Context, path string, payload, result any) error {
+	return c.request(ctx, http.MethodPost, path, payload, result)
+}
+
+// request performs an API request with basic authentication
+func (c *AdGuardHomeClient) request(ctx context.Context, method, path string, payload, result any) error {
+	var reader io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.config.URL+path, reader)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.config.Username != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Password.Value())
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return transportError(fmt.Errorf("do request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return httpStatusError(resp.StatusCode, body)
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(body, result); err != nil {
+			return fmt.Errorf("unmarshal response: %w", err)
+		}
+	}
+	return nil
+}
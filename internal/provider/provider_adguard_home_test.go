@@ -0,0 +1,84 @@
+//go:build adguard_home || (!netcup_ccp && !aws_route53)
+// +build adguard_home !netcup_ccp,!aws_route53
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestAdGuardHomeProvider(t *testing.T) {
+	var mu sync.Mutex
+	rewrites := []adguardRewrite{
+		{Domain: "nas.example.com", Answer: "192.168.1.10"},
+		{Domain: "nas.example.com", Answer: "fd00::10"},
+		{Domain: "alias.example.com", Answer: "nas.example.com"},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/control/rewrite/list":
+			_ = json.NewEncoder(w).Encode(rewrites)
+		case "/control/rewrite/add":
+			var rw adguardRewrite
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&rw))
+			rewrites = append(rewrites, rw)
+		case "/control/rewrite/delete":
+			var rw adguardRewrite
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&rw))
+			for i, existing := range rewrites {
+				if existing == rw {
+					rewrites = append(rewrites[:i], rewrites[i+1:]...)
+					break
+				}
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewAdGuardHomeClient(AdGuardHomeConfig{URL: server.URL, Username: "admin", Password: "secret"})
+	ctx := context.Background()
+
+	record, err := client.GetRecord(ctx, "example.com", "nas.example.com", "AAAA")
+	assert.NoError(t, err)
+	assert.Equal(t, "fd00::10", record.Value)
+
+	err = client.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "nas.example.com", Type: "A", Value: "192.168.1.20"})
+	assert.NoError(t, err)
+
+	mu.Lock()
+	answers := make([]string, 0, len(rewrites))
+	for _, rw := range rewrites {
+		answers = append(answers, rw.Domain+"="+rw.Answer)
+	}
+	mu.Unlock()
+	sort.Strings(answers)
+	assert.Equal(t, []string{"alias.example.com=nas.example.com", "nas.example.com=192.168.1.20", "nas.example.com=fd00::10"}, answers)
+
+	assert.NoError(t, client.DeleteRecord(ctx, "example.com", &DNSRecord{Name: "nas.example.com", Type: "AAAA"}))
+	_, err = client.GetRecord(ctx, "example.com", "nas.example.com", "AAAA")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	unauthorized := NewAdGuardHomeClient(AdGuardHomeConfig{URL: server.URL, Username: "admin", Password: "wrong"})
+	_, err = unauthorized.GetRecord(ctx, "example.com", "nas.example.com", "A")
+	assert.Error(t, err)
+}
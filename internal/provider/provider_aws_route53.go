@@ -5,13 +5,20 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/route53"
 	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/smithy-go"
 	"github.com/markussiebert/homeddns/internal/logger"
 )
 
@@ -20,46 +27,78 @@ type Route53API interface {
 	ListHostedZones(ctx context.Context, params *route53.ListHostedZonesInput, optFns ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error)
 	ListResourceRecordSets(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error)
 	ChangeResourceRecordSets(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error)
+	GetChange(ctx context.Context, params *route53.GetChangeInput, optFns ...func(*route53.Options)) (*route53.GetChangeOutput, error)
 }
 
+// route53PollInterval is the GetChange polling interval while waiting for INSYNC
+const route53PollInterval = 5 * time.Second
+
 // AwsRoute53Client represents an AWS Route53 client
 type AwsRoute53Client struct {
 	client    Route53API
 	zoneCache map[string]string // domain -> hostedZoneId cache
+
+	changesMu    sync.Mutex
+	changes      map[string]string // fqdn|type -> ID of the last change
+	pollInterval time.Duration
 }
 
-// NewAwsRoute53Client creates a new Route53 client
-func NewAwsRoute53Client(ctx context.Context) (*AwsRoute53Client, error) {
-	logger.Debug("Loading AWS Route53 configuration")
+// NewAwsRoute53Client creates a new Route53 client. The region, static
+// credentials and shared config profile can be given as settings; anything
+// else comes from the default credential chain.
+func NewAwsRoute53Client(ctx context.Context, settings Settings) (*AwsRoute53Client, error) {
+	logger.DebugContext(ctx, "Loading AWS Route53 configuration")
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+	var options []func(*config.LoadOptions) error
+	if settings["aws_region"] != "" {
+		options = append(options, config.WithRegion(settings.Get("AWS_REGION")))
+	}
+	if settings["aws_profile"] != "" {
+		options = append(options, config.WithSharedConfigProfile(settings.Get("AWS_PROFILE")))
+	}
+	secretKey, err := settings.Secret("AWS_SECRET_ACCESS_KEY")
 	if err != nil {
-		logger.Info("Ensure AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_REGION are set")
+		return nil, logger.Errorf("%w", err)
+	}
+	sessionToken, err := settings.Secret("AWS_SESSION_TOKEN")
+	if err != nil {
+		return nil, logger.Errorf("%w", err)
+	}
+	// Static credentials from settings or secret files; plain environment
+	// variables are picked up by the default credential chain
+	if settings["aws_access_key_id"] != "" || settings["aws_secret_access_key"] != "" ||
+		os.Getenv("AWS_SECRET_ACCESS_KEY_FILE") != "" || os.Getenv("AWS_SESSION_TOKEN_FILE") != "" {
+		options = append(options, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			settings.Get("AWS_ACCESS_KEY_ID"),
+			secretKey.Value(),
+			sessionToken.Value(),
+		)))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		logger.InfoContext(ctx, "Ensure AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_REGION are set")
 		return nil, logger.Errorf("load AWS config: %w", err)
 	}
 
-	logger.Info("AWS Route53 client initialized successfully (region: %s)", cfg.Region)
-	logger.Debug("AWS config loaded from default credential chain")
+	logger.InfoContext(ctx, "AWS Route53 client initialized successfully (region: %s)", cfg.Region)
+	logger.DebugContext(ctx, "AWS config loaded from default credential chain")
 
-	return &AwsRoute53Client{
-		client:    route53.NewFromConfig(cfg),
-		zoneCache: make(map[string]string),
-	}, nil
+	return NewAwsRoute53ClientWithConfig(cfg), nil
 }
 
 // NewAwsRoute53ClientWithConfig creates a new Route53 client with custom AWS config
 func NewAwsRoute53ClientWithConfig(cfg aws.Config) *AwsRoute53Client {
-	return &AwsRoute53Client{
-		client:    route53.NewFromConfig(cfg),
-		zoneCache: make(map[string]string),
-	}
+	return NewAwsRoute53ClientWithMock(route53.NewFromConfig(cfg))
 }
 
 // NewAwsRoute53ClientWithMock creates a new Route53 client with a mock API for testing
 func NewAwsRoute53ClientWithMock(mock Route53API) *AwsRoute53Client {
 	return &AwsRoute53Client{
-		client:    mock,
-		zoneCache: make(map[string]string),
+		client:       mock,
+		zoneCache:    make(map[string]string),
+		changes:      make(map[string]string),
+		pollInterval: route53PollInterval,
 	}
 }
 
@@ -70,7 +109,7 @@ func (c *AwsRoute53Client) Name() string {
 
 // GetRecord retrieves a specific DNS record
 func (c *AwsRoute53Client) GetRecord(ctx context.Context, domain, hostname, recordType string) (*DNSRecord, error) {
-	logger.Debug("AWS Route53: Getting record for domain=%s, hostname=%s, type=%s", domain, hostname, recordType)
+	logger.DebugContext(ctx, "AWS Route53: Getting record for domain=%s, hostname=%s, type=%s", domain, hostname, recordType)
 
 	// Get hosted zone ID
 	zoneID, err := c.getHostedZoneID(ctx, domain)
@@ -91,23 +130,23 @@ func (c *AwsRoute53Client) GetRecord(ctx context.Context, domain, hostname, reco
 
 	result, err := c.client.ListResourceRecordSets(ctx, input)
 	if err != nil {
-		return nil, fmt.Errorf("list record sets: %w", err)
+		return nil, fmt.Errorf("list record sets: %w", classifyRoute53Error(err))
 	}
 
 	// Check if we found the record
 	if len(result.ResourceRecordSets) == 0 {
-		return nil, fmt.Errorf("record not found")
+		return nil, ErrNotFound
 	}
 
 	recordSet := result.ResourceRecordSets[0]
 	if aws.ToString(recordSet.Name) != fqdn || string(recordSet.Type) != recordType {
-		return nil, fmt.Errorf("record not found")
+		return nil, ErrNotFound
 	}
 
 	// Extract value
 	var value string
 	if len(recordSet.ResourceRecords) > 0 {
-		value = aws.ToString(recordSet.ResourceRecords[0].Value)
+		value = recordValue(recordType, aws.ToString(recordSet.ResourceRecords[0].Value))
 	}
 
 	return &DNSRecord{
@@ -120,57 +159,296 @@ func (c *AwsRoute53Client) GetRecord(ctx context.Context, domain, hostname, reco
 
 // UpdateRecord updates or creates a DNS record
 func (c *AwsRoute53Client) UpdateRecord(ctx context.Context, domain string, record *DNSRecord) error {
-	logger.Debug("AWS Route53: Updating record for domain=%s, name=%s, type=%s, value=%s", domain, record.Name, record.Type, record.Value)
+	return c.UpdateRecords(ctx, domain, []*DNSRecord{record})
+}
 
+// UpdateRecords updates or creates several DNS records of a domain in a
+// single change batch
+func (c *AwsRoute53Client) UpdateRecords(ctx context.Context, domain string, records []*DNSRecord) error {
 	// Get hosted zone ID
 	zoneID, err := c.getHostedZoneID(ctx, domain)
 	if err != nil {
 		return fmt.Errorf("get hosted zone: %w", err)
 	}
 
-	// Ensure hostname ends with a dot for Route53
-	fqdn := c.ensureTrailingDot(record.Name)
+	var changes []types.Change
+	var changed []*DNSRecord
+	for _, record := range records {
+		logger.DebugContext(ctx, "AWS Route53: Updating record for domain=%s, name=%s, type=%s, value=%s", domain, record.Name, record.Type, DisplayValue(record))
 
-	// Check if record exists and if it needs updating
-	existing, err := c.GetRecord(ctx, domain, record.Name, record.Type)
-	if err == nil && existing.Value == record.Value {
-		logger.Debug("AWS Route53: Record already up to date")
-		// Record exists and is already up to date
-		return nil
-	}
+		// Check if record exists and if it needs updating
+		existing, err := c.GetRecord(ctx, domain, record.Name, record.Type)
+		if err == nil && existing.Value == record.Value {
+			logger.DebugContext(ctx, "AWS Route53: Record %s already up to date", record.Name)
+			continue
+		}
 
-	// Prepare the resource record
-	resourceRecord := types.ResourceRecord{
-		Value: aws.String(record.Value),
+		// Ensure hostname ends with a dot for Route53
+		fqdn := c.ensureTrailingDot(record.Name)
+
+		// Prepare the change
+		changes = append(changes, types.Change{
+			Action: types.ChangeActionUpsert,
+			ResourceRecordSet: &types.ResourceRecordSet{
+				Name: aws.String(fqdn),
+				Type: types.RRType(record.Type),
+				TTL:  aws.Int64(int64(record.TTL)),
+				ResourceRecords: []types.ResourceRecord{
+					{Value: aws.String(route53Value(record))},
+				},
+			},
+		})
+		changed = append(changed, record)
 	}
 
-	// Prepare the change batch
-	change := types.Change{
-		Action: types.ChangeActionUpsert,
-		ResourceRecordSet: &types.ResourceRecordSet{
-			Name: aws.String(fqdn),
-			Type: types.RRType(record.Type),
-			TTL:  aws.Int64(int64(record.TTL)),
-			ResourceRecords: []types.ResourceRecord{
-				resourceRecord,
-			},
-		},
+	if len(changes) == 0 {
+		// Records exist and are already up to date
+		return nil
 	}
 
-	// Apply the change
+	// Apply the changes
 	input := &route53.ChangeResourceRecordSetsInput{
 		HostedZoneId: aws.String(zoneID),
 		ChangeBatch: &types.ChangeBatch{
-			Changes: []types.Change{change},
+			Changes: changes,
 		},
 	}
 
-	_, err = c.client.ChangeResourceRecordSets(ctx, input)
+	output, err := c.client.ChangeResourceRecordSets(ctx, input)
+	if err != nil {
+		return fmt.Errorf("change resource record sets: %w", classifyRoute53Error(err))
+	}
+
+	// Remember the change for WaitForPropagation
+	if output.ChangeInfo != nil {
+		c.changesMu.Lock()
+		for _, record := range changed {
+			c.changes[c.changeKey(record)] = aws.ToString(output.ChangeInfo.Id)
+		}
+		c.changesMu.Unlock()
+	}
+
+	for _, record := range changed {
+		logger.InfoContext(ctx, "AWS Route53: Successfully updated record %s to %s", record.Name, DisplayValue(record))
+	}
+	return nil
+}
+
+// DeleteRecord removes a value from a record set, or the whole set if
+// record.Value is empty or it was the last value
+func (c *AwsRoute53Client) DeleteRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	logger.DebugContext(ctx, "AWS Route53: Deleting record for domain=%s, name=%s, type=%s", domain, record.Name, record.Type)
+
+	zoneID, err := c.getHostedZoneID(ctx, domain)
 	if err != nil {
-		return fmt.Errorf("change resource record sets: %w", err)
+		return fmt.Errorf("get hosted zone: %w", err)
 	}
 
-	logger.Info("AWS Route53: Successfully updated record %s to %s", record.Name, record.Value)
+	// A DELETE must match the existing set exactly
+	fqdn := c.ensureTrailingDot(record.Name)
+	result, err := c.client.ListResourceRecordSets(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(zoneID),
+		StartRecordName: aws.String(fqdn),
+		StartRecordType: types.RRType(record.Type),
+		MaxItems:        aws.Int32(1),
+	})
+	if err != nil {
+		return fmt.Errorf("list record sets: %w", classifyRoute53Error(err))
+	}
+	if len(result.ResourceRecordSets) == 0 ||
+		!strings.EqualFold(aws.ToString(result.ResourceRecordSets[0].Name), fqdn) ||
+		string(result.ResourceRecordSets[0].Type) != record.Type {
+		logger.DebugContext(ctx, "AWS Route53: Nothing to delete")
+		return nil
+	}
+	existing := result.ResourceRecordSets[0]
+
+	change := types.Change{Action: types.ChangeActionDelete, ResourceRecordSet: &existing}
+	if record.Value != "" {
+		var remaining []types.ResourceRecord
+		for _, rr := range existing.ResourceRecords {
+			if recordValue(record.Type, aws.ToString(rr.Value)) != record.Value {
+				remaining = append(remaining, rr)
+			}
+		}
+		if len(remaining) == len(existing.ResourceRecords) {
+			logger.DebugContext(ctx, "AWS Route53: Nothing to delete")
+			return nil
+		}
+		if len(remaining) > 0 {
+			updated := existing
+			updated.ResourceRecords = remaining
+			change = types.Change{Action: types.ChangeActionUpsert, ResourceRecordSet: &updated}
+		}
+	}
+
+	output, err := c.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(zoneID),
+		ChangeBatch:  &types.ChangeBatch{Changes: []types.Change{change}},
+	})
+	if err != nil {
+		return fmt.Errorf("change resource record sets: %w", classifyRoute53Error(err))
+	}
+	if output.ChangeInfo != nil {
+		c.changesMu.Lock()
+		c.changes[c.changeKey(record)] = aws.ToString(output.ChangeInfo.Id)
+		c.changesMu.Unlock()
+	}
+
+	logger.InfoContext(ctx, "AWS Route53: Successfully deleted record %s (%s)", record.Name, record.Type)
+	return nil
+}
+
+// ListRecords returns all records of a hosted zone, one per value. Alias
+// records have their target as value.
+func (c *AwsRoute53Client) ListRecords(ctx context.Context, domain string) ([]DNSRecord, error) {
+	zoneID, err := c.getHostedZoneID(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("get hosted zone: %w", err)
+	}
+
+	var records []DNSRecord
+	input := &route53.ListResourceRecordSetsInput{HostedZoneId: aws.String(zoneID)}
+	for {
+		output, err := c.client.ListResourceRecordSets(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("list record sets: %w", classifyRoute53Error(err))
+		}
+		for _, set := range output.ResourceRecordSets {
+			record := DNSRecord{
+				Name: strings.TrimSuffix(aws.ToString(set.Name), "."),
+				Type: string(set.Type),
+				TTL:  int(aws.ToInt64(set.TTL)),
+			}
+			if set.AliasTarget != nil {
+				record.Value = strings.TrimSuffix(aws.ToString(set.AliasTarget.DNSName), ".")
+				records = append(records, record)
+				continue
+			}
+			for _, rr := range set.ResourceRecords {
+				record.Value = recordValue(record.Type, aws.ToString(rr.Value))
+				records = append(records, record)
+			}
+		}
+
+		if !output.IsTruncated {
+			return records, nil
+		}
+		input.StartRecordName = output.NextRecordName
+		input.StartRecordType = output.NextRecordType
+		input.StartRecordIdentifier = output.NextRecordIdentifier
+	}
+}
+
+// WaitForPropagation polls GetChange until the last change of the record is
+// INSYNC, i.e. served by all Route53 nameservers
+func (c *AwsRoute53Client) WaitForPropagation(ctx context.Context, domain string, record *DNSRecord) error {
+	c.changesMu.Lock()
+	changeID := c.changes[c.changeKey(record)]
+	c.changesMu.Unlock()
+	if changeID == "" {
+		logger.DebugContext(ctx, "AWS Route53: No pending change for %s", record.Name)
+		return nil
+	}
+
+	logger.DebugContext(ctx, "AWS Route53: Waiting for change %s of %s", changeID, record.Name)
+	for {
+		output, err := c.client.GetChange(ctx, &route53.GetChangeInput{Id: aws.String(changeID)})
+		if err != nil {
+			return fmt.Errorf("get change: %w", classifyRoute53Error(err))
+		}
+		if output.ChangeInfo != nil && output.ChangeInfo.Status == types.ChangeStatusInsync {
+			logger.InfoContext(ctx, "AWS Route53: Change of %s is in sync", record.Name)
+			c.changesMu.Lock()
+			if c.changes[c.changeKey(record)] == changeID {
+				delete(c.changes, c.changeKey(record))
+			}
+			c.changesMu.Unlock()
+			return nil
+		}
+
+		timer := time.NewTimer(c.pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("change %s of %s not in sync: %w", changeID, record.Name, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// changeKey identifies the change of a record
+func (c *AwsRoute53Client) changeKey(record *DNSRecord) string {
+	return strings.ToLower(c.ensureTrailingDot(record.Name)) + "|" + record.Type
+}
+
+// route53Value returns the value of a record as Route53 expects it. TXT
+// values are quoted, in strings of at most 255 characters.
+func route53Value(record *DNSRecord) string {
+	if record.Type != "TXT" {
+		return record.Value
+	}
+	value := record.Value
+	var quoted []string
+	for {
+		chunk := value
+		if len(chunk) > 255 {
+			chunk = chunk[:255]
+		}
+		value = value[len(chunk):]
+		chunk = strings.ReplaceAll(chunk, `\`, `\\`)
+		quoted = append(quoted, `"`+strings.ReplaceAll(chunk, `"`, `\"`)+`"`)
+		if value == "" {
+			return strings.Join(quoted, " ")
+		}
+	}
+}
+
+// recordValue returns the value of a Route53 resource record. The quoted
+// strings of TXT values are joined and unescaped.
+func recordValue(recordType, value string) string {
+	if recordType != "TXT" || !strings.HasPrefix(value, `"`) {
+		return value
+	}
+	var b strings.Builder
+	quoted := false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case !quoted:
+			// Space between strings
+		case c == '\\' && i+3 < len(value) && isDigits(value[i+1:i+4]):
+			n, _ := strconv.Atoi(value[i+1 : i+4])
+			b.WriteByte(byte(n))
+			i += 3
+		case c == '\\' && i+1 < len(value):
+			i++
+			b.WriteByte(value[i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// isDigits reports whether s consists of decimal digits
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// HealthCheck verifies the credentials by listing a single hosted zone
+func (c *AwsRoute53Client) HealthCheck(ctx context.Context) error {
+	_, err := c.client.ListHostedZones(ctx, &route53.ListHostedZonesInput{MaxItems: aws.Int32(1)})
+	if err != nil {
+		return fmt.Errorf("list hosted zones: %w", classifyRoute53Error(err))
+	}
 	return nil
 }
 
@@ -183,11 +461,11 @@ func (c *AwsRoute53Client) Close(ctx context.Context) error {
 func (c *AwsRoute53Client) getHostedZoneID(ctx context.Context, domain string) (string, error) {
 	// Check cache first
 	if zoneID, exists := c.zoneCache[domain]; exists {
-		logger.Debug("AWS Route53: Using cached zone ID for domain %s", domain)
+		logger.DebugContext(ctx, "AWS Route53: Using cached zone ID for domain %s", domain)
 		return zoneID, nil
 	}
 
-	logger.Debug("AWS Route53: Looking up hosted zone ID for domain %s", domain)
+	logger.DebugContext(ctx, "AWS Route53: Looking up hosted zone ID for domain %s", domain)
 
 	// Ensure domain ends with a dot
 	domainWithDot := c.ensureTrailingDot(domain)
@@ -201,7 +479,7 @@ func (c *AwsRoute53Client) getHostedZoneID(ctx context.Context, domain string) (
 
 		output, err := c.client.ListHostedZones(ctx, input)
 		if err != nil {
-			return "", fmt.Errorf("list hosted zones: %w", err)
+			return "", fmt.Errorf("list hosted zones: %w", classifyRoute53Error(err))
 		}
 
 		for _, zone := range output.HostedZones {
@@ -223,6 +501,26 @@ func (c *AwsRoute53Client) getHostedZoneID(ctx context.Context, domain string) (
 	return "", fmt.Errorf("hosted zone for domain %s not found", domain)
 }
 
+// classifyRoute53Error maps AWS API error codes to the provider error taxonomy
+func classifyRoute53Error(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		// Transport errors are classified by KindOf
+		return err
+	}
+
+	switch apiErr.ErrorCode() {
+	case "Throttling", "ThrottlingException", "RequestLimitExceeded", "PriorRequestNotComplete",
+		"ServiceUnavailable", "InternalError", "InternalFailure":
+		return NewError(KindRetryable, err)
+	case "AccessDenied", "AccessDeniedException", "InvalidClientTokenId", "SignatureDoesNotMatch",
+		"UnrecognizedClientException", "ExpiredToken", "ExpiredTokenException", "InvalidSignatureException":
+		return NewError(KindAuth, err)
+	default:
+		return NewError(KindPermanent, err)
+	}
+}
+
 // ensureTrailingDot ensures the hostname ends with a dot
 func (c *AwsRoute53Client) ensureTrailingDot(hostname string) string {
 	if !strings.HasSuffix(hostname, ".") {
@@ -233,10 +531,13 @@ func (c *AwsRoute53Client) ensureTrailingDot(hostname string) string {
 
 func init() {
 	RegisterFactory("aws_route53", NewRoute53Provider)
+	// The Home Assistant add-on and the README used to call it route53
+	RegisterAlias("route53", "aws_route53")
 }
 
 // NewRoute53Provider creates a new AWS Route53 provider
 // It uses the default AWS SDK configuration chain (env vars, ~/.aws/credentials, IAM roles, etc.)
+// unless the configuration file sets credentials
 func NewRoute53Provider(ctx context.Context, config interface{}) (Provider, error) {
-	return NewAwsRoute53Client(ctx)
+	return NewAwsRoute53Client(ctx, SettingsFrom(config))
 }
@@ -2,9 +2,13 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/alecthomas/assert/v2"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/route53"
 	"github.com/aws/aws-sdk-go-v2/service/route53/types"
@@ -15,6 +19,7 @@ type mockRoute53API struct {
 	ListHostedZonesFunc          func(ctx context.Context, params *route53.ListHostedZonesInput, optFns ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error)
 	ListResourceRecordSetsFunc   func(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error)
 	ChangeResourceRecordSetsFunc func(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error)
+	GetChangeFunc                func(ctx context.Context, params *route53.GetChangeInput, optFns ...func(*route53.Options)) (*route53.GetChangeOutput, error)
 }
 
 func (m *mockRoute53API) ListHostedZones(ctx context.Context, params *route53.ListHostedZonesInput, optFns ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error) {
@@ -38,6 +43,13 @@ func (m *mockRoute53API) ChangeResourceRecordSets(ctx context.Context, params *r
 	return nil, fmt.Errorf("ChangeResourceRecordSetsFunc is not implemented")
 }
 
+func (m *mockRoute53API) GetChange(ctx context.Context, params *route53.GetChangeInput, optFns ...func(*route53.Options)) (*route53.GetChangeOutput, error) {
+	if m.GetChangeFunc != nil {
+		return m.GetChangeFunc(ctx, params, optFns...)
+	}
+	return nil, fmt.Errorf("GetChangeFunc is not implemented")
+}
+
 func TestAwsRoute53Client_GetRecord(t *testing.T) {
 	domain := "example.com"
 	hostname := "test.example.com"
@@ -100,6 +112,32 @@ func TestAwsRoute53Client_GetRecord(t *testing.T) {
 	}
 }
 
+func TestAwsRoute53Client_GetRecordNotFound(t *testing.T) {
+	mockAPI := &mockRoute53API{
+		ListHostedZonesFunc: func(ctx context.Context, params *route53.ListHostedZonesInput, optFns ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error) {
+			return &route53.ListHostedZonesOutput{
+				HostedZones: []types.HostedZone{{Id: aws.String("/hostedzone/ZONE123"), Name: aws.String("example.com.")}},
+			}, nil
+		},
+		ListResourceRecordSetsFunc: func(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+			// The listing starts at the next record
+			return &route53.ListResourceRecordSetsOutput{
+				ResourceRecordSets: []types.ResourceRecordSet{{
+					Name:            aws.String("www.example.com."),
+					Type:            types.RRTypeA,
+					ResourceRecords: []types.ResourceRecord{{Value: aws.String("192.0.2.80")}},
+				}},
+			}, nil
+		},
+	}
+
+	client := NewAwsRoute53ClientWithMock(mockAPI)
+	_, err := client.GetRecord(context.Background(), "example.com", "test.example.com", "A")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
 func TestAwsRoute53Client_UpdateRecord(t *testing.T) {
 	domain := "example.com"
 	record := &DNSRecord{
@@ -160,3 +198,202 @@ func TestAwsRoute53Client_UpdateRecord(t *testing.T) {
 		t.Fatalf("expected 1 change call, got %d", changeCalls)
 	}
 }
+
+func TestAwsRoute53Client_WaitForPropagation(t *testing.T) {
+	record := &DNSRecord{Name: "test.example.com", Type: "A", Value: "192.0.2.2", TTL: 60}
+
+	mockAPI := &mockRoute53API{}
+	mockAPI.ListHostedZonesFunc = func(ctx context.Context, params *route53.ListHostedZonesInput, optFns ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error) {
+		return &route53.ListHostedZonesOutput{HostedZones: []types.HostedZone{{
+			Id:   aws.String("/hostedzone/ZONE123"),
+			Name: aws.String("example.com."),
+		}}}, nil
+	}
+	mockAPI.ListResourceRecordSetsFunc = func(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+		return &route53.ListResourceRecordSetsOutput{}, nil
+	}
+	mockAPI.ChangeResourceRecordSetsFunc = func(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+		return &route53.ChangeResourceRecordSetsOutput{ChangeInfo: &types.ChangeInfo{
+			Id:     aws.String("/change/C123"),
+			Status: types.ChangeStatusPending,
+		}}, nil
+	}
+	var polls int
+	stuck := false
+	mockAPI.GetChangeFunc = func(ctx context.Context, params *route53.GetChangeInput, optFns ...func(*route53.Options)) (*route53.GetChangeOutput, error) {
+		polls++
+		if aws.ToString(params.Id) != "/change/C123" {
+			t.Fatalf("unexpected change id: %s", aws.ToString(params.Id))
+		}
+		status := types.ChangeStatusPending
+		if polls == 3 && !stuck {
+			status = types.ChangeStatusInsync
+		}
+		return &route53.GetChangeOutput{ChangeInfo: &types.ChangeInfo{Id: params.Id, Status: status}}, nil
+	}
+
+	client := NewAwsRoute53ClientWithMock(mockAPI)
+	client.pollInterval = time.Millisecond
+	ctx := context.Background()
+
+	if err := client.UpdateRecord(ctx, "example.com", record); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waiter, ok := As[PropagationWaiter](WithRetry(client, RetryPolicy{}))
+	if !ok {
+		t.Fatalf("expected Route53 client to implement PropagationWaiter")
+	}
+	if err := waiter.WaitForPropagation(ctx, "example.com", record); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if polls != 3 {
+		t.Fatalf("expected 3 GetChange calls, got %d", polls)
+	}
+
+	// The change is forgotten once in sync
+	if err := client.WaitForPropagation(ctx, "example.com", record); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if polls != 3 {
+		t.Fatalf("expected no further GetChange calls, got %d", polls)
+	}
+
+	// A change that never syncs times out
+	stuck = true
+	if err := client.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "other.example.com", Type: "A", Value: "192.0.2.3"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := client.WaitForPropagation(timeoutCtx, "example.com", &DNSRecord{Name: "other.example.com", Type: "A"}); err == nil {
+		t.Fatalf("expected timeout error")
+	}
+}
+
+func TestAwsRoute53Client_HealthCheck(t *testing.T) {
+	mockAPI := &mockRoute53API{}
+	client := NewAwsRoute53ClientWithMock(mockAPI)
+	ctx := context.Background()
+
+	mockAPI.ListHostedZonesFunc = func(ctx context.Context, params *route53.ListHostedZonesInput, optFns ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error) {
+		if aws.ToInt32(params.MaxItems) != 1 {
+			t.Fatalf("expected MaxItems 1, got %d", aws.ToInt32(params.MaxItems))
+		}
+		return &route53.ListHostedZonesOutput{}, nil
+	}
+	if err := client.HealthCheck(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	mockAPI.ListHostedZonesFunc = func(ctx context.Context, params *route53.ListHostedZonesInput, optFns ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error) {
+		return nil, fmt.Errorf("connection refused")
+	}
+	if err := client.HealthCheck(ctx); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestAwsRoute53Client_DeleteRecord(t *testing.T) {
+	set := types.ResourceRecordSet{
+		Name: aws.String("test.example.com."),
+		Type: types.RRTypeA,
+		TTL:  aws.Int64(60),
+		ResourceRecords: []types.ResourceRecord{
+			{Value: aws.String("192.0.2.1")},
+			{Value: aws.String("192.0.2.2")},
+		},
+	}
+	var changes []types.Change
+	mockAPI := &mockRoute53API{
+		ListHostedZonesFunc: func(ctx context.Context, params *route53.ListHostedZonesInput, optFns ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error) {
+			return &route53.ListHostedZonesOutput{HostedZones: []types.HostedZone{{
+				Id:   aws.String("/hostedzone/ZONE123"),
+				Name: aws.String("example.com."),
+			}}}, nil
+		},
+		ListResourceRecordSetsFunc: func(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+			return &route53.ListResourceRecordSetsOutput{ResourceRecordSets: []types.ResourceRecordSet{set}}, nil
+		},
+		ChangeResourceRecordSetsFunc: func(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+			changes = append(changes, params.ChangeBatch.Changes...)
+			return &route53.ChangeResourceRecordSetsOutput{}, nil
+		},
+	}
+	client := NewAwsRoute53ClientWithMock(mockAPI)
+	ctx := context.Background()
+
+	// Removing one of two values keeps the other
+	assert.NoError(t, client.DeleteRecord(ctx, "example.com", &DNSRecord{Name: "test.example.com", Type: "A", Value: "192.0.2.1"}))
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, types.ChangeActionUpsert, changes[0].Action)
+	assert.Equal(t, 1, len(changes[0].ResourceRecordSet.ResourceRecords))
+	assert.Equal(t, "192.0.2.2", aws.ToString(changes[0].ResourceRecordSet.ResourceRecords[0].Value))
+
+	// Without a value, the whole set is deleted as it is
+	assert.NoError(t, client.DeleteRecord(ctx, "example.com", &DNSRecord{Name: "test.example.com", Type: "A"}))
+	assert.Equal(t, 2, len(changes))
+	assert.Equal(t, types.ChangeActionDelete, changes[1].Action)
+	assert.Equal(t, 2, len(changes[1].ResourceRecordSet.ResourceRecords))
+
+	// Missing records are not changed
+	assert.NoError(t, client.DeleteRecord(ctx, "example.com", &DNSRecord{Name: "other.example.com", Type: "A"}))
+	assert.Equal(t, 2, len(changes))
+}
+
+func TestAwsRoute53Client_ListRecords(t *testing.T) {
+	var calls int
+	mockAPI := &mockRoute53API{
+		ListHostedZonesFunc: func(ctx context.Context, params *route53.ListHostedZonesInput, optFns ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error) {
+			return &route53.ListHostedZonesOutput{HostedZones: []types.HostedZone{{
+				Id:   aws.String("/hostedzone/ZONE123"),
+				Name: aws.String("example.com."),
+			}}}, nil
+		},
+		ListResourceRecordSetsFunc: func(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+			calls++
+			if calls == 1 {
+				return &route53.ListResourceRecordSetsOutput{
+					ResourceRecordSets: []types.ResourceRecordSet{{
+						Name:            aws.String("example.com."),
+						Type:            types.RRTypeNs,
+						TTL:             aws.Int64(172800),
+						ResourceRecords: []types.ResourceRecord{{Value: aws.String("ns-1.awsdns-00.com.")}, {Value: aws.String("ns-2.awsdns-00.net.")}},
+					}},
+					IsTruncated:    true,
+					NextRecordName: aws.String("www.example.com."),
+					NextRecordType: types.RRTypeA,
+				}, nil
+			}
+			assert.Equal(t, "www.example.com.", aws.ToString(params.StartRecordName))
+			return &route53.ListResourceRecordSetsOutput{ResourceRecordSets: []types.ResourceRecordSet{{
+				Name:        aws.String("www.example.com."),
+				Type:        types.RRTypeA,
+				AliasTarget: &types.AliasTarget{DNSName: aws.String("lb.example.net.")},
+			}}}, nil
+		},
+	}
+
+	records, err := NewAwsRoute53ClientWithMock(mockAPI).ListRecords(context.Background(), "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []DNSRecord{
+		{Name: "example.com", Type: "NS", Value: "ns-1.awsdns-00.com.", TTL: 172800},
+		{Name: "example.com", Type: "NS", Value: "ns-2.awsdns-00.net.", TTL: 172800},
+		{Name: "www.example.com", Type: "A", Value: "lb.example.net"},
+	}, records)
+}
+
+func TestRoute53TXTValues(t *testing.T) {
+	for _, value := range []string{
+		"gfj9Xq-Rz5PtM3pOZWTeS2hiWk5YyJ4dE8wMq0e3lQI",
+		`v=spf1 include:"example.com" \ -all`,
+		strings.Repeat("a", 300),
+	} {
+		record := &DNSRecord{Name: "_acme-challenge.example.com", Type: "TXT", Value: value}
+		quoted := route53Value(record)
+		assert.True(t, strings.HasPrefix(quoted, `"`))
+		assert.Equal(t, value, recordValue("TXT", quoted))
+	}
+	assert.Equal(t, `"`+strings.Repeat("a", 255)+`" "aaa"`, route53Value(&DNSRecord{Type: "TXT", Value: strings.Repeat("a", 258)}))
+	assert.Equal(t, "a b", recordValue("TXT", `"a\032b"`))
+	assert.Equal(t, "192.0.2.1", route53Value(&DNSRecord{Type: "A", Value: "192.0.2.1"}))
+}
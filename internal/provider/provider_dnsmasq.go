@@ -0,0 +1,128 @@
+//go:build dnsmasq || (!netcup_ccp && !aws_route53)
+// +build dnsmasq !netcup_ccp,!aws_route53
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+)
+
+// DnsmasqConfig holds configuration for the dnsmasq provider.
+type DnsmasqConfig struct {
+	// HostsFile is the file dnsmasq reads via addn-hosts
+	HostsFile string
+	// ReloadCommand is run after every write, e.g. "pkill -HUP dnsmasq" (optional)
+	ReloadCommand string
+}
+
+// LoadDnsmasqConfig loads the dnsmasq configuration from environment variables
+// or the settings of the configuration file
+func LoadDnsmasqConfig(settings Settings) (*DnsmasqConfig, error) {
+	config := &DnsmasqConfig{
+		HostsFile:     settings.Get("DNSMASQ_HOSTS_FILE"),
+		ReloadCommand: settings.Get("DNSMASQ_RELOAD_COMMAND"),
+	}
+	if config.HostsFile == "" {
+		return nil, logger.Errorf("DNSMASQ_HOSTS_FILE is required for the dnsmasq provider")
+	}
+	logger.Debug("dnsmasq config: hosts_file=%s, reload=%v", config.HostsFile, config.ReloadCommand != "")
+	return config, nil
+}
+
+// DnsmasqClient writes local DNS entries to a dnsmasq addn-hosts file
+type DnsmasqClient struct {
+	store *hostsFileStore
+}
+
+// NewDnsmasqClient creates a new dnsmasq client
+func NewDnsmasqClient(config DnsmasqConfig) *DnsmasqClient {
+	return &DnsmasqClient{
+		store: &hostsFileStore{path: config.HostsFile, reloadCommand: config.ReloadCommand},
+	}
+}
+
+func init() {
+	RegisterFactory("dnsmasq", NewDnsmasqProvider)
+}
+
+// NewDnsmasqProvider creates a new dnsmasq provider
+func NewDnsmasqProvider(ctx context.Context, config interface{}) (Provider, error) {
+	cfg, err := LoadDnsmasqConfig(SettingsFrom(config))
+	if err != nil {
+		return nil, fmt.Errorf("load dnsmasq config: %w", err)
+	}
+	return NewDnsmasqClient(*cfg), nil
+}
+
+// Name returns the provider name
+func (c *DnsmasqClient) Name() string {
+	return "dnsmasq"
+}
+
+// GetRecord retrieves a local DNS entry
+func (c *DnsmasqClient) GetRecord(ctx context.Context, domain, hostname, recordType string) (*DNSRecord, error) {
+	logger.DebugContext(ctx, "dnsmasq: Getting record for hostname=%s, type=%s", hostname, recordType)
+
+	ip, err := c.store.get(hostname, recordType)
+	if err != nil {
+		return nil, err
+	}
+	return &DNSRecord{Name: hostname, Type: recordType, Value: ip}, nil
+}
+
+// UpdateRecord updates or creates a local DNS entry
+func (c *DnsmasqClient) UpdateRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	logger.DebugContext(ctx, "dnsmasq: Updating record name=%s, type=%s, value=%s", record.Name, record.Type, record.Value)
+
+	if err := validateAddressRecord(record); err != nil {
+		return err
+	}
+
+	changed, err := c.store.modify(ctx, func(hosts *hostsFile) bool {
+		return hosts.set(record.Name, record.Value)
+	})
+	if err != nil {
+		return err
+	}
+	if !changed {
+		logger.DebugContext(ctx, "dnsmasq: Record already up to date")
+		return nil
+	}
+
+	logger.InfoContext(ctx, "dnsmasq: Successfully updated record %s to %s", record.Name, record.Value)
+	return nil
+}
+
+// DeleteRecord removes a local DNS entry
+func (c *DnsmasqClient) DeleteRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	logger.DebugContext(ctx, "dnsmasq: Deleting record name=%s, type=%s", record.Name, record.Type)
+
+	changed, err := c.store.modify(ctx, func(hosts *hostsFile) bool {
+		return hosts.remove(record.Name, record.Type, record.Value) > 0
+	})
+	if err != nil {
+		return err
+	}
+	if changed {
+		logger.InfoContext(ctx, "dnsmasq: Successfully deleted record %s (%s)", record.Name, record.Type)
+	}
+	return nil
+}
+
+// WaitForPropagation returns immediately: the hosts file is served once the reload command has run
+func (c *DnsmasqClient) WaitForPropagation(ctx context.Context, domain string, record *DNSRecord) error {
+	return nil
+}
+
+// HealthCheck verifies that the hosts file can be read and replaced
+func (c *DnsmasqClient) HealthCheck(ctx context.Context) error {
+	return checkFileAccess(c.store.path)
+}
+
+// Close cleans up resources (no-op for dnsmasq)
+func (c *DnsmasqClient) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,70 @@
+//go:build dnsmasq || (!netcup_ccp && !aws_route53)
+// +build dnsmasq !netcup_ccp,!aws_route53
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestDnsmasqProvider_UpdateAndDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "homeddns.hosts")
+	original := "# managed by homeddns\n192.168.1.5 printer.lan\n192.168.1.10 nas.example.com nas\n"
+	assert.NoError(t, os.WriteFile(path, []byte(original), 0o644))
+
+	client := NewDnsmasqClient(DnsmasqConfig{HostsFile: path})
+	ctx := context.Background()
+
+	record, err := client.GetRecord(ctx, "example.com", "nas.example.com", "A")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.10", record.Value)
+
+	// Update moves the name to a new line and keeps the alias on the old one
+	err = client.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "nas.example.com", Type: "A", Value: "192.168.1.11"})
+	assert.NoError(t, err)
+	err = client.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "nas.example.com", Type: "AAAA", Value: "fd00::11"})
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "# managed by homeddns\n192.168.1.5 printer.lan\n192.168.1.10 nas\n192.168.1.11 nas.example.com\nfd00::11 nas.example.com\n", string(data))
+
+	// Unchanged value keeps the file as is
+	err = client.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "nas.example.com", Type: "A", Value: "192.168.1.11"})
+	assert.NoError(t, err)
+
+	err = client.DeleteRecord(ctx, "example.com", &DNSRecord{Name: "nas.example.com", Type: "AAAA"})
+	assert.NoError(t, err)
+	_, err = client.GetRecord(ctx, "example.com", "nas.example.com", "AAAA")
+	assert.EqualError(t, err, "record not found")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// Only address records are supported
+	err = client.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "nas.example.com", Type: "TXT", Value: "hello"})
+	assert.Error(t, err)
+	err = client.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "nas.example.com", Type: "A", Value: "fd00::1"})
+	assert.Error(t, err)
+}
+
+func TestDnsmasqProvider_HealthCheck(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "homeddns.hosts")
+	client := NewDnsmasqClient(DnsmasqConfig{HostsFile: path})
+	ctx := context.Background()
+
+	assert.Error(t, client.HealthCheck(ctx))
+
+	assert.NoError(t, os.WriteFile(path, nil, 0o644))
+	assert.NoError(t, client.HealthCheck(ctx))
+
+	// The check leaves no temporary files behind
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+}
@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -32,19 +33,28 @@ const (
 // NetcupConfig holds Netcup specific configuration.
 type NetcupConfig struct {
 	CustomerNumber string
-	ApiKey         string
-	ApiPassword    string
+	ApiKey         util.Secret
+	ApiPassword    util.Secret
 }
 
-// LoadNetcupConfig loads Netcup credentials from environment variables or credential file
-func LoadNetcupConfig() (*NetcupConfig, error) {
+// LoadNetcupConfig loads Netcup credentials from environment variables, the
+// settings of the configuration file or the credential file
+func LoadNetcupConfig(settings Settings) (*NetcupConfig, error) {
 	logger.Debug("Loading Netcup credentials")
 	config := &NetcupConfig{}
 
-	// First, try environment variables
-	config.CustomerNumber = os.Getenv("NETCUP_CUSTOMER_NUMBER")
-	config.ApiKey = os.Getenv("NETCUP_API_KEY")
-	config.ApiPassword = os.Getenv("NETCUP_API_PASSWORD")
+	// First, try environment variables, secret files and settings
+	customerNumber, err := settings.Secret("NETCUP_CUSTOMER_NUMBER")
+	if err != nil {
+		return nil, logger.Errorf("%w", err)
+	}
+	config.CustomerNumber = customerNumber.Value()
+	if config.ApiKey, err = settings.Secret("NETCUP_API_KEY"); err != nil {
+		return nil, logger.Errorf("%w", err)
+	}
+	if config.ApiPassword, err = settings.Secret("NETCUP_API_PASSWORD"); err != nil {
+		return nil, logger.Errorf("%w", err)
+	}
 
 	hasCustomerNumber := config.CustomerNumber != ""
 	hasApiKey := config.ApiKey != ""
@@ -107,13 +117,13 @@ func LoadNetcupConfig() (*NetcupConfig, error) {
 			}
 		case "api_key":
 			if config.ApiKey == "" {
-				config.ApiKey = value
+				config.ApiKey = util.Secret(value)
 				logger.Debug("Loaded api_key from file: %s", util.MaskValue(value))
 				keysFound++
 			}
 		case "api_password":
 			if config.ApiPassword == "" {
-				config.ApiPassword = value
+				config.ApiPassword = util.Secret(value)
 				logger.Debug("Loaded api_password from file: %s", util.MaskValue(value))
 				keysFound++
 			}
@@ -254,17 +264,17 @@ func (c *NetcupClient) doRequest(ctx context.Context, req *APIRequest) (*APIResp
 
 	resp, err := c.httpNetcupClient.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		return nil, transportError(fmt.Errorf("do request: %w", err))
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+		return nil, transportError(fmt.Errorf("read response: %w", err))
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, respBody)
+		return nil, httpStatusError(resp.StatusCode, respBody)
 	}
 
 	var apiResp APIResponse
@@ -273,21 +283,40 @@ func (c *NetcupClient) doRequest(ctx context.Context, req *APIRequest) (*APIResp
 	}
 
 	if apiResp.Status != "success" {
-		// Check for rate limiting
-		if apiResp.StatusCode == 4013 {
-			logger.Warn("Netcup: Rate limit hit (180 req/min). Error: %s", apiResp.LongMessage)
-		}
-		return nil, fmt.Errorf("API error: %s - %s (code: %d)", apiResp.ShortMessage, apiResp.LongMessage, apiResp.StatusCode)
+		return nil, c.classifyAPIError(req.Action, &apiResp)
 	}
 
 	return &apiResp, nil
 }
 
+// classifyAPIError turns an unsuccessful API response into a classified error
+func (c *NetcupClient) classifyAPIError(action string, apiResp *APIResponse) error {
+	err := fmt.Errorf("API error: %s - %s (code: %d)", apiResp.ShortMessage, apiResp.LongMessage, apiResp.StatusCode)
+
+	switch {
+	case apiResp.StatusCode == 4013:
+		logger.Warn("Netcup: Rate limit hit (180 req/min). Error: %s", apiResp.LongMessage)
+		return &Error{Kind: KindRetryable, Err: err, RetryAfter: 5 * time.Second}
+	case action == "login":
+		return NewError(KindAuth, err)
+	case strings.Contains(strings.ToLower(apiResp.ShortMessage+" "+apiResp.LongMessage), "session"):
+		// Session expired or invalidated server-side: drop it so the retry logs in again
+		c.sessionMu.Lock()
+		c.sessionID = ""
+		c.sessionExpiry = time.Time{}
+		c.sessionMu.Unlock()
+		logger.Warn("Netcup: Session rejected by API, will re-authenticate: %s", apiResp.LongMessage)
+		return NewError(KindRetryable, err)
+	default:
+		return NewError(KindPermanent, err)
+	}
+}
+
 // login performs a login and stores the session ID
 // Must be called with sessionMu write lock NOT held
 func (c *NetcupClient) login(ctx context.Context) error {
 	loginTime := time.Now()
-	logger.Info("Netcup: Initiating login to CCP API (attempt at %s)", loginTime.Format("15:04:05.000"))
+	logger.InfoContext(ctx, "Netcup: Initiating login to CCP API (attempt at %s)", loginTime.Format("15:04:05.000"))
 
 	req := &APIRequest{
 		Action: "login",
@@ -298,7 +327,7 @@ func (c *NetcupClient) login(ctx context.Context) error {
 		},
 	}
 
-	logger.Debug("Netcup: Sending login request to %s", c.endpoint)
+	logger.DebugContext(ctx, "Netcup: Sending login request to %s", c.endpoint)
 	resp, err := c.doRequest(ctx, req)
 	if err != nil {
 		return logger.Errorf("login request: %w", err)
@@ -321,7 +350,7 @@ func (c *NetcupClient) login(ctx context.Context) error {
 	timeSinceFirst := time.Since(c.firstLoginTime)
 	c.sessionMu.Unlock()
 
-	logger.Info("Netcup: ✓ Login successful (#%d, total time: %v), session ID: %s..., valid until %s (duration: %v)",
+	logger.InfoContext(ctx, "Netcup: ✓ Login successful (#%d, total time: %v), session ID: %s..., valid until %s (duration: %v)",
 		loginCount,
 		timeSinceFirst.Round(time.Second),
 		util.MaskValue(sessionID),
@@ -341,7 +370,7 @@ func (c *NetcupClient) ensureSession(ctx context.Context) error {
 	c.sessionMu.RUnlock()
 
 	if hasSession && !isExpired {
-		logger.Debug("Netcup: ✓ Reusing existing session (expires in %v)", timeUntilExpiry)
+		logger.DebugContext(ctx, "Netcup: ✓ Reusing existing session (expires in %v)", timeUntilExpiry)
 		return nil
 	}
 
@@ -354,14 +383,14 @@ func (c *NetcupClient) ensureSession(ctx context.Context) error {
 	isExpired = time.Now().After(c.sessionExpiry)
 
 	if hasSession && !isExpired {
-		logger.Info("Netcup: ✓ Session was refreshed by another request, reusing it")
+		logger.InfoContext(ctx, "Netcup: ✓ Session was refreshed by another request, reusing it")
 		return nil
 	}
 
 	if hasSession && isExpired {
-		logger.Warn("Netcup: Session expired (was valid until %v), re-authenticating now", c.sessionExpiry.Format("15:04:05"))
+		logger.WarnContext(ctx, "Netcup: Session expired (was valid until %v), re-authenticating now", c.sessionExpiry.Format("15:04:05"))
 	} else {
-		logger.Info("Netcup: No active session, authenticating for the first time")
+		logger.InfoContext(ctx, "Netcup: No active session, authenticating for the first time")
 	}
 
 	// Release the lock before calling login (login will acquire it internally)
@@ -445,7 +474,7 @@ func (c *NetcupClient) Logout(ctx context.Context) error {
 	}
 	c.sessionMu.RUnlock()
 
-	logger.Debug("Netcup: Logging out")
+	logger.DebugContext(ctx, "Netcup: Logging out")
 
 	req := &APIRequest{
 		Action: "logout",
@@ -462,7 +491,7 @@ func (c *NetcupClient) Logout(ctx context.Context) error {
 	c.sessionExpiry = time.Time{}
 	c.sessionMu.Unlock()
 
-	logger.Debug("Netcup: Successfully logged out")
+	logger.DebugContext(ctx, "Netcup: Successfully logged out")
 	return nil
 }
 
@@ -473,11 +502,11 @@ func init() {
 // NewNetcupProvider creates a new Netcup provider
 func NewNetcupProvider(ctx context.Context, config interface{}) (Provider, error) {
 	// Load Netcup credentials from environment or file
-	cfg, err := LoadNetcupConfig()
+	cfg, err := LoadNetcupConfig(SettingsFrom(config))
 	if err != nil {
 		return nil, fmt.Errorf("load netcup config: %w", err)
 	}
-	return NewNetcupClient(cfg.CustomerNumber, cfg.ApiKey, cfg.ApiPassword), nil
+	return NewNetcupClient(cfg.CustomerNumber, cfg.ApiKey.Value(), cfg.ApiPassword.Value()), nil
 }
 
 // Provider interface implementation
@@ -489,7 +518,7 @@ func (c *NetcupClient) Name() string {
 
 // GetRecord retrieves a specific DNS record
 func (c *NetcupClient) GetRecord(ctx context.Context, domain, hostname, recordType string) (*DNSRecord, error) {
-	logger.Debug("Netcup: Getting record for domain=%s, hostname=%s, type=%s", domain, hostname, recordType)
+	logger.DebugContext(ctx, "Netcup: Getting record for domain=%s, hostname=%s, type=%s", domain, hostname, recordType)
 
 	// Extract subdomain from hostname
 	subdomain := c.extractSubdomain(hostname, domain)
@@ -512,62 +541,147 @@ func (c *NetcupClient) GetRecord(ctx context.Context, domain, hostname, recordTy
 		}
 	}
 
-	return nil, fmt.Errorf("record not found")
+	return nil, ErrNotFound
 }
 
 // UpdateRecord updates or creates a DNS record
 func (c *NetcupClient) UpdateRecord(ctx context.Context, domain string, record *DNSRecord) error {
-	logger.Debug("Netcup: Updating record for domain=%s, name=%s, type=%s, value=%s", domain, record.Name, record.Type, record.Value)
-
-	// Extract subdomain from hostname
-	subdomain := c.extractSubdomain(record.Name, domain)
+	return c.UpdateRecords(ctx, domain, []*DNSRecord{record})
+}
 
+// UpdateRecords updates or creates several DNS records of a domain with a
+// single infoDnsRecords/updateDnsRecords round-trip
+func (c *NetcupClient) UpdateRecords(ctx context.Context, domain string, records []*DNSRecord) error {
 	// Get all existing records
-	records, err := c.InfoDNSRecords(ctx, domain)
+	existingRecords, err := c.InfoDNSRecords(ctx, domain)
 	if err != nil {
 		return fmt.Errorf("get DNS records: %w", err)
 	}
 
-	// Find existing record
-	var existingRecord *netcupDNSRecord
-	var otherRecords []netcupDNSRecord
-	for _, r := range records {
-		if r.Hostname == subdomain && r.Type == record.Type {
-			existingRecord = &r
-		} else {
-			otherRecords = append(otherRecords, r)
+	var changed []*DNSRecord
+	for _, record := range records {
+		logger.DebugContext(ctx, "Netcup: Updating record for domain=%s, name=%s, type=%s, value=%s", domain, record.Name, record.Type, DisplayValue(record))
+
+		// Extract subdomain from hostname
+		subdomain := c.extractSubdomain(record.Name, domain)
+
+		// Find existing record
+		var existingRecord *netcupDNSRecord
+		var otherRecords []netcupDNSRecord
+		for _, r := range existingRecords {
+			if r.Hostname == subdomain && r.Type == record.Type {
+				existingRecord = &r
+			} else {
+				otherRecords = append(otherRecords, r)
+			}
+		}
+
+		// Check if update is needed
+		if existingRecord != nil && existingRecord.Destination == record.Value {
+			logger.DebugContext(ctx, "Netcup: Record %s already up to date", record.Name)
+			continue
+		}
+
+		// Prepare record for update
+		recordToUpdate := netcupDNSRecord{
+			Hostname:    subdomain,
+			Type:        record.Type,
+			Destination: record.Value,
+		}
+		if existingRecord != nil {
+			recordToUpdate.ID = existingRecord.ID
 		}
+
+		// Later records of the batch see this change
+		existingRecords = append(otherRecords, recordToUpdate)
+		changed = append(changed, record)
 	}
 
-	// Check if update is needed
-	if existingRecord != nil && existingRecord.Destination == record.Value {
-		logger.Debug("Netcup: Record already up to date")
+	if len(changed) == 0 {
 		// Already up to date
 		return nil
 	}
 
-	// Prepare record for update
-	recordToUpdate := netcupDNSRecord{
-		Hostname:    subdomain,
-		Type:        record.Type,
-		Destination: record.Value,
+	// Update the records
+	if err := c.UpdateDNSRecords(ctx, domain, existingRecords); err != nil {
+		return fmt.Errorf("update DNS record: %w", err)
+	}
+
+	for _, record := range changed {
+		logger.InfoContext(ctx, "Netcup: Successfully updated record %s to %s", record.Name, DisplayValue(record))
 	}
-	if existingRecord != nil {
-		recordToUpdate.ID = existingRecord.ID
+	return nil
+}
+
+// DeleteRecord removes the matching records; all values of the name and type
+// if record.Value is empty
+func (c *NetcupClient) DeleteRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	logger.DebugContext(ctx, "Netcup: Deleting record for domain=%s, name=%s, type=%s", domain, record.Name, record.Type)
+
+	existingRecords, err := c.InfoDNSRecords(ctx, domain)
+	if err != nil {
+		return fmt.Errorf("get DNS records: %w", err)
 	}
 
-	// Create the new list of records
-	updatedRecords := append(otherRecords, recordToUpdate)
+	subdomain := c.extractSubdomain(record.Name, domain)
+	var toDelete []netcupDNSRecord
+	for _, r := range existingRecords {
+		if r.Hostname == subdomain && r.Type == record.Type && (record.Value == "" || r.Destination == record.Value) {
+			r.Delete = true
+			toDelete = append(toDelete, r)
+		}
+	}
+	if len(toDelete) == 0 {
+		logger.DebugContext(ctx, "Netcup: Nothing to delete")
+		return nil
+	}
 
-	// Update the record
-	if err := c.UpdateDNSRecords(ctx, domain, updatedRecords); err != nil {
-		return fmt.Errorf("update DNS record: %w", err)
+	if err := c.UpdateDNSRecords(ctx, domain, toDelete); err != nil {
+		return fmt.Errorf("delete DNS record: %w", err)
 	}
 
-	logger.Info("Netcup: Successfully updated record %s to %s", record.Name, record.Value)
+	logger.InfoContext(ctx, "Netcup: Successfully deleted record %s (%s)", record.Name, record.Type)
 	return nil
 }
 
+// ListRecords returns all records of a domain
+func (c *NetcupClient) ListRecords(ctx context.Context, domain string) ([]DNSRecord, error) {
+	existingRecords, err := c.InfoDNSRecords(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("get DNS records: %w", err)
+	}
+
+	records := make([]DNSRecord, 0, len(existingRecords))
+	for _, r := range existingRecords {
+		name := domain
+		if r.Hostname != "@" {
+			name = r.Hostname + "." + domain
+		}
+		priority, _ := strconv.Atoi(r.Priority)
+		records = append(records, DNSRecord{
+			Name:     name,
+			Type:     r.Type,
+			Value:    r.Destination,
+			TTL:      60, // Netcup doesn't expose TTL via API, default to 60
+			Priority: priority,
+		})
+	}
+	return records, nil
+}
+
+// LoginCount returns the number of logins performed since the client was created
+func (c *NetcupClient) LoginCount() int {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	return c.loginCount
+}
+
+// HealthCheck verifies the credentials. A valid session counts as healthy;
+// otherwise a new login is performed.
+func (c *NetcupClient) HealthCheck(ctx context.Context) error {
+	return c.ensureSession(ctx)
+}
+
 // Close logs out and cleans up resources
 func (c *NetcupClient) Close(ctx context.Context) error {
 	return c.Logout(ctx)
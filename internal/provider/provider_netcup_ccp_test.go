@@ -3,10 +3,14 @@ package provider
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -75,7 +79,7 @@ func newMockNetcupAPIServer() *mockNetcupAPIServer {
 			err := json.Unmarshal(paramBytes, &params)
 			assert.NoError(&testing.T{}, err)
 			mock.mu.Lock()
-			mock.records = params.DNSRecordSet.DNSRecords
+			mock.apply(params.DNSRecordSet.DNSRecords)
 			mock.mu.Unlock()
 			resp = APIResponse{
 				Status:       "success",
@@ -102,6 +106,28 @@ func newMockNetcupAPIServer() *mockNetcupAPIServer {
 	return mock
 }
 
+// apply merges sent records like updateDnsRecords: records with an ID are
+// replaced or deleted, others are created. m.mu must be held.
+func (m *mockNetcupAPIServer) apply(sent []netcupDNSRecord) {
+	for _, record := range sent {
+		index := -1
+		for i, existing := range m.records {
+			if record.ID != "" && existing.ID == record.ID {
+				index = i
+			}
+		}
+		switch {
+		case record.Delete && index >= 0:
+			m.records = append(m.records[:index], m.records[index+1:]...)
+		case index >= 0:
+			m.records[index] = record
+		case !record.Delete:
+			record.ID = fmt.Sprint(len(m.records) + 100)
+			m.records = append(m.records, record)
+		}
+	}
+}
+
 func (m *mockNetcupAPIServer) marshalRecords() string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -131,6 +157,7 @@ func TestNetcupProvider_GetRecord(t *testing.T) {
 	_, err = client.GetRecord(context.Background(), "example.com", "notfound.example.com", "A")
 	assert.Error(t, err)
 	assert.Equal(t, "record not found", err.Error())
+	assert.True(t, errors.Is(err, ErrNotFound))
 }
 
 func TestNetcupProvider_UpdateRecord(t *testing.T) {
@@ -184,6 +211,68 @@ func TestNetcupProvider_UpdateRecord(t *testing.T) {
 	mockServer.mu.Unlock()
 }
 
+func TestNetcupProvider_DeleteAndListRecords(t *testing.T) {
+	mockServer := newMockNetcupAPIServer()
+	defer mockServer.Close()
+
+	client := NewNetcupClient("user", "key", "pass").WithEndpoint(mockServer.server.URL)
+	ctx := context.Background()
+
+	records, err := client.ListRecords(ctx, "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, "example.com", records[0].Name)
+	assert.Equal(t, "www.example.com", records[1].Name)
+	assert.Equal(t, "*.example.com", records[2].Name)
+
+	assert.NoError(t, client.DeleteRecord(ctx, "example.com", &DNSRecord{Name: "www.example.com", Type: "A"}))
+
+	// Only the deleted record was sent
+	mockServer.mu.Lock()
+	last := mockServer.requests[len(mockServer.requests)-1]
+	mockServer.mu.Unlock()
+	assert.Equal(t, "updateDnsRecords", last.Action)
+	data, err := json.Marshal(last.Param)
+	assert.NoError(t, err)
+	var params UpdateDNSRecordsParams
+	assert.NoError(t, json.Unmarshal(data, &params))
+	assert.Equal(t, []netcupDNSRecord{{ID: "2", Hostname: "www", Type: "A", Destination: "1.1.1.1", Delete: true}}, params.DNSRecordSet.DNSRecords)
+	_, err = client.GetRecord(ctx, "example.com", "www.example.com", "A")
+	assert.EqualError(t, err, "record not found")
+
+	// Deleting a missing record is a no-op
+	assert.NoError(t, client.DeleteRecord(ctx, "example.com", &DNSRecord{Name: "www.example.com", Type: "A"}))
+	records, err = client.ListRecords(ctx, "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(records))
+}
+
+func TestNetcupProvider_ContextErrors(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	client := WithRetry(NewNetcupClient("user", "key", "pass").WithEndpoint(server.URL), RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second})
+
+	// Shutdown and request timeouts are not retried
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.GetRecord(ctx, "example.com", "www.example.com", "A")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.False(t, IsRetryable(err))
+	assert.Equal(t, int32(1), requests.Load())
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = client.GetRecord(ctx, "example.com", "www.example.com", "A")
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, int32(1), requests.Load())
+}
+
 func TestNetcupProvider_extractSubdomain(t *testing.T) {
 	client := &NetcupClient{}
 	testCases := []struct {
@@ -243,3 +332,19 @@ func TestNetcupProvider_NewNetcupProvider(t *testing.T) {
 	_, err = NewNetcupProvider(context.Background(), nil)
 	assert.Error(t, err)
 }
+
+func TestLoadNetcupConfig_SecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, value := range map[string]string{"key": "api-key\n", "password": "api-password\n"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(value), 0o440))
+	}
+	t.Setenv("NETCUP_CUSTOMER_NUMBER", "12345")
+	t.Setenv("NETCUP_API_KEY_FILE", filepath.Join(dir, "key"))
+	t.Setenv("NETCUP_API_PASSWORD_FILE", filepath.Join(dir, "password"))
+
+	config, err := LoadNetcupConfig(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", config.CustomerNumber)
+	assert.Equal(t, "api-key", config.ApiKey.Value())
+	assert.Equal(t, "api-password", config.ApiPassword.Value())
+}
@@ -0,0 +1,351 @@
+//go:build pihole || (!netcup_ccp && !aws_route53)
+// +build pihole !netcup_ccp,!aws_route53
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/util"
+)
+
+// PiholeConfig holds configuration for the Pi-hole provider.
+// Either CustomList (file mode) or URL and Password (API mode) must be set.
+type PiholeConfig struct {
+	// CustomList is the path of Pi-hole's custom.list file
+	CustomList string
+	// ReloadCommand is run after every file write, e.g. "pihole reloaddns" (optional)
+	ReloadCommand string
+	// URL is the Pi-hole base URL, e.g. http://pi.hole
+	URL string
+	// Password is the Pi-hole web interface or application password
+	Password util.Secret
+}
+
+// LoadPiholeConfig loads the Pi-hole configuration from environment variables
+// or the settings of the configuration file
+func LoadPiholeConfig(settings Settings) (*PiholeConfig, error) {
+	config := &PiholeConfig{
+		CustomList:    settings.Get("PIHOLE_CUSTOM_LIST"),
+		ReloadCommand: settings.Get("PIHOLE_RELOAD_COMMAND"),
+		URL:           strings.TrimSuffix(settings.Get("PIHOLE_URL"), "/"),
+	}
+	password, err := settings.Secret("PIHOLE_PASSWORD")
+	if err != nil {
+		return nil, logger.Errorf("%w", err)
+	}
+	config.Password = password
+
+	switch {
+	case config.CustomList != "":
+		logger.Debug("Pi-hole config: file mode, custom_list=%s", config.CustomList)
+	case config.URL != "":
+		logger.Debug("Pi-hole config: API mode, url=%s", config.URL)
+	default:
+		return nil, logger.Errorf("PIHOLE_CUSTOM_LIST or PIHOLE_URL is required for the pihole provider")
+	}
+	return config, nil
+}
+
+// PiholeClient writes local DNS entries to Pi-hole, either through its
+// custom.list file or the Pi-hole v6 REST API.
+type PiholeClient struct {
+	store *hostsFileStore // file mode
+
+	baseURL    string // API mode
+	password   string
+	httpClient *http.Client
+	sessionID  string
+	sessionMu  sync.Mutex
+}
+
+// NewPiholeClient creates a new Pi-hole client
+func NewPiholeClient(config PiholeConfig) *PiholeClient {
+	client := &PiholeClient{
+		baseURL:  config.URL,
+		password: config.Password.Value(),
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+	if config.CustomList != "" {
+		client.store = &hostsFileStore{path: config.CustomList, reloadCommand: config.ReloadCommand}
+	}
+	return client
+}
+
+func init() {
+	RegisterFactory("pihole", NewPiholeProvider)
+}
+
+// NewPiholeProvider creates a new Pi-hole provider
+func NewPiholeProvider(ctx context.Context, config interface{}) (Provider, error) {
+	cfg, err := LoadPiholeConfig(SettingsFrom(config))
+	if err != nil {
+		return nil, fmt.Errorf("load pihole config: %w", err)
+	}
+	return NewPiholeClient(*cfg), nil
+}
+
+// Name returns the provider name
+func (c *PiholeClient) Name() string {
+	return "pihole"
+}
+
+// GetRecord retrieves a local DNS entry
+func (c *PiholeClient) GetRecord(ctx context.Context, domain, hostname, recordType string) (*DNSRecord, error) {
+	logger.DebugContext(ctx, "Pi-hole: Getting record for hostname=%s, type=%s", hostname, recordType)
+
+	if c.store != nil {
+		ip, err := c.store.get(hostname, recordType)
+		if err != nil {
+			return nil, err
+		}
+		return &DNSRecord{Name: hostname, Type: recordType, Value: ip}, nil
+	}
+
+	hosts, err := c.listHosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ip, ok := hosts.lookup(hostname, recordType)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &DNSRecord{Name: hostname, Type: recordType, Value: ip}, nil
+}
+
+// UpdateRecord updates or creates a local DNS entry
+func (c *PiholeClient) UpdateRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	logger.DebugContext(ctx, "Pi-hole: Updating record name=%s, type=%s, value=%s", record.Name, record.Type, record.Value)
+
+	if err := validateAddressRecord(record); err != nil {
+		return err
+	}
+
+	if c.store != nil {
+		changed, err := c.store.modify(ctx, func(hosts *hostsFile) bool {
+			return hosts.set(record.Name, record.Value)
+		})
+		if err != nil {
+			return err
+		}
+		if changed {
+			logger.InfoContext(ctx, "Pi-hole: Successfully updated record %s to %s", record.Name, record.Value)
+		}
+		return nil
+	}
+
+	hosts, err := c.listHosts(ctx)
+	if err != nil {
+		return err
+	}
+	addresses := hosts.addresses(record.Name, record.Type)
+	if len(addresses) == 1 && addresses[0] == record.Value {
+		logger.DebugContext(ctx, "Pi-hole: Record already up to date")
+		return nil
+	}
+
+	for _, ip := range addresses {
+		if err := c.hostEntry(ctx, http.MethodDelete, ip, record.Name); err != nil {
+			return err
+		}
+	}
+	if err := c.hostEntry(ctx, http.MethodPut, record.Value, record.Name); err != nil {
+		return err
+	}
+
+	logger.InfoContext(ctx, "Pi-hole: Successfully updated record %s to %s", record.Name, record.Value)
+	return nil
+}
+
+// DeleteRecord removes a local DNS entry
+func (c *PiholeClient) DeleteRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	logger.DebugContext(ctx, "Pi-hole: Deleting record name=%s, type=%s", record.Name, record.Type)
+
+	if c.store != nil {
+		_, err := c.store.modify(ctx, func(hosts *hostsFile) bool {
+			return hosts.remove(record.Name, record.Type, record.Value) > 0
+		})
+		return err
+	}
+
+	hosts, err := c.listHosts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, ip := range hosts.addresses(record.Name, record.Type) {
+		if record.Value != "" && ip != record.Value {
+			continue
+		}
+		if err := c.hostEntry(ctx, http.MethodDelete, ip, record.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitForPropagation returns immediately: Pi-hole serves local records as soon as they are written
+func (c *PiholeClient) WaitForPropagation(ctx context.Context, domain string, record *DNSRecord) error {
+	return nil
+}
+
+// HealthCheck verifies the API credentials by listing the local DNS
+// entries, or the access to the custom list file
+func (c *PiholeClient) HealthCheck(ctx context.Context) error {
+	if c.store != nil {
+		return checkFileAccess(c.store.path)
+	}
+	_, err := c.listHosts(ctx)
+	return err
+}
+
+// Close ends the API session
+func (c *PiholeClient) Close(ctx context.Context) error {
+	c.sessionMu.Lock()
+	sessionID := c.sessionID
+	c.sessionID = ""
+	c.sessionMu.Unlock()
+
+	if c.store != nil || sessionID == "" {
+		return nil
+	}
+	_, err := c.do(ctx, http.MethodDelete, "/api/auth", nil, sessionID)
+	return err
+}
+
+// piholeHostsResponse is the response of GET /api/config/dns/hosts
+type piholeHostsResponse struct {
+	Config struct {
+		DNS struct {
+			Hosts []string `json:"hosts"`
+		} `json:"dns"`
+	} `json:"config"`
+}
+
+// piholeAuthResponse is the response of POST /api/auth
+type piholeAuthResponse struct {
+	Session struct {
+		Valid bool   `json:"valid"`
+		SID   string `json:"sid"`
+	} `json:"session"`
+}
+
+// listHosts fetches the local DNS entries via the API
+func (c *PiholeClient) listHosts(ctx context.Context) (*hostsFile, error) {
+	body, err := c.authenticated(ctx, http.MethodGet, "/api/config/dns/hosts", nil)
+	if err != nil {
+		return nil, fmt.Errorf("list local DNS entries: %w", err)
+	}
+
+	var resp piholeHostsResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("unmarshal local DNS entries: %w", err)
+	}
+	return &hostsFile{lines: resp.Config.DNS.Hosts}, nil
+}
+
+// hostEntry adds (PUT) or removes (DELETE) a single "IP hostname" entry
+func (c *PiholeClient) hostEntry(ctx context.Context, method, ip, hostname string) error {
+	path := "/api/config/dns/hosts/" + url.PathEscape(ip+" "+strings.ToLower(hostname))
+	if _, err := c.authenticated(ctx, method, path, nil); err != nil {
+		return fmt.Errorf("%s local DNS entry: %w", strings.ToLower(method), err)
+	}
+	return nil
+}
+
+// authenticated performs an API request, logging in first if needed and
+// once more if the session has expired.
+func (c *PiholeClient) authenticated(ctx context.Context, method, path string, payload any) ([]byte, error) {
+	sessionID, err := c.session(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.do(ctx, method, path, payload, sessionID)
+	if err == errPiholeUnauthorized {
+		if sessionID, err = c.session(ctx, true); err != nil {
+			return nil, err
+		}
+		body, err = c.do(ctx, method, path, payload, sessionID)
+	}
+	return body, err
+}
+
+// session returns the current session ID, logging in if necessary
+func (c *PiholeClient) session(ctx context.Context, renew bool) (string, error) {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+
+	if c.sessionID != "" && !renew {
+		return c.sessionID, nil
+	}
+
+	logger.DebugContext(ctx, "Pi-hole: Authenticating at %s", c.baseURL)
+	body, err := c.do(ctx, http.MethodPost, "/api/auth", map[string]string{"password": c.password}, "")
+	if err != nil {
+		return "", fmt.Errorf("login: %w", err)
+	}
+
+	var resp piholeAuthResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("unmarshal login response: %w", err)
+	}
+	if !resp.Session.Valid {
+		return "", NewError(KindAuth, fmt.Errorf("login: invalid password"))
+	}
+	// An empty SID means the Pi-hole has no password set
+	c.sessionID = resp.Session.SID
+	return c.sessionID, nil
+}
+
+var errPiholeUnauthorized = fmt.Errorf("unauthorized")
+
+// do performs a single API request
+func (c *PiholeClient) do(ctx context.Context, method, path string, payload any, sessionID string) ([]byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sessionID != "" {
+		req.Header.Set("X-FTL-SID", sessionID)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, transportError(fmt.Errorf("do request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && sessionID != "" {
+		return nil, errPiholeUnauthorized
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, httpStatusError(resp.StatusCode, body)
+	}
+	return body, nil
+}
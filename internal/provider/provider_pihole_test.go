@@ -0,0 +1,122 @@
+//go:build pihole || (!netcup_ccp && !aws_route53)
+// +build pihole !netcup_ccp,!aws_route53
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestPiholeProvider_FileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custom.list")
+	client := NewPiholeClient(PiholeConfig{CustomList: path})
+	ctx := context.Background()
+
+	// custom.list does not exist yet
+	_, err := client.GetRecord(ctx, "example.com", "nas.example.com", "A")
+	assert.Error(t, err)
+
+	err = client.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "nas.example.com", Type: "A", Value: "192.168.1.10"})
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.10 nas.example.com\n", string(data))
+}
+
+// mockPiholeServer simulates the Pi-hole v6 API.
+type mockPiholeServer struct {
+	server *httptest.Server
+	mu     sync.Mutex
+	hosts  []string
+	logins int
+}
+
+func newMockPiholeServer(t *testing.T) *mockPiholeServer {
+	mock := &mockPiholeServer{hosts: []string{"192.168.1.5 printer.lan"}}
+	mock.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+
+		if r.URL.Path == "/api/auth" {
+			switch r.Method {
+			case http.MethodPost:
+				var body map[string]string
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				mock.logins++
+				valid := body["password"] == "secret"
+				_ = json.NewEncoder(w).Encode(map[string]any{"session": map[string]any{"valid": valid, "sid": "sid-1"}})
+			case http.MethodDelete:
+				w.WriteHeader(http.StatusNoContent)
+			}
+			return
+		}
+
+		if r.Header.Get("X-FTL-SID") != "sid-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		const prefix = "/api/config/dns/hosts"
+		entry, _ := url.PathUnescape(strings.TrimPrefix(strings.TrimPrefix(r.URL.EscapedPath(), prefix), "/"))
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(map[string]any{"config": map[string]any{"dns": map[string]any{"hosts": mock.hosts}}})
+		case http.MethodPut:
+			mock.hosts = append(mock.hosts, entry)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			for i, h := range mock.hosts {
+				if h == entry {
+					mock.hosts = append(mock.hosts[:i], mock.hosts[i+1:]...)
+					break
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	return mock
+}
+
+func TestPiholeProvider_APIMode(t *testing.T) {
+	mock := newMockPiholeServer(t)
+	defer mock.server.Close()
+
+	client := NewPiholeClient(PiholeConfig{URL: mock.server.URL, Password: "secret"})
+	ctx := context.Background()
+
+	err := client.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "nas.example.com", Type: "A", Value: "192.168.1.10"})
+	assert.NoError(t, err)
+	err = client.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "nas.example.com", Type: "A", Value: "192.168.1.11"})
+	assert.NoError(t, err)
+
+	record, err := client.GetRecord(ctx, "example.com", "nas.example.com", "A")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.11", record.Value)
+
+	mock.mu.Lock()
+	assert.Equal(t, []string{"192.168.1.5 printer.lan", "192.168.1.11 nas.example.com"}, mock.hosts)
+	assert.Equal(t, 1, mock.logins)
+	mock.mu.Unlock()
+
+	assert.NoError(t, client.DeleteRecord(ctx, "example.com", &DNSRecord{Name: "nas.example.com", Type: "A"}))
+	_, err = client.GetRecord(ctx, "example.com", "nas.example.com", "A")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// Wrong password is reported as login failure
+	bad := NewPiholeClient(PiholeConfig{URL: mock.server.URL, Password: "wrong"})
+	_, err = bad.GetRecord(ctx, "example.com", "nas.example.com", "A")
+	assert.Error(t, err)
+}
@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// fakeProvider is an in-memory provider whose calls can be made to fail.
+type fakeProvider struct {
+	mu      sync.Mutex
+	records map[string]DNSRecord
+	calls   map[string]int
+	errs    []error // returned by subsequent calls, in order
+	batches [][]string
+}
+
+func newFakeProvider() *fakeProvider {
+	return &fakeProvider{records: make(map[string]DNSRecord), calls: make(map[string]int)}
+}
+
+func (f *fakeProvider) Name() string { return "fake" }
+
+func (f *fakeProvider) nextErr(op string) error {
+	f.calls[op]++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *fakeProvider) GetRecord(ctx context.Context, domain, hostname, recordType string) (*DNSRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.nextErr("GetRecord"); err != nil {
+		return nil, err
+	}
+	record, ok := f.records[hostname+"/"+recordType]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &record, nil
+}
+
+func (f *fakeProvider) UpdateRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.nextErr("UpdateRecord"); err != nil {
+		return err
+	}
+	f.records[record.Name+"/"+record.Type] = *record
+	return nil
+}
+
+func (f *fakeProvider) UpdateRecords(ctx context.Context, domain string, records []*DNSRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.nextErr("UpdateRecords"); err != nil {
+		return err
+	}
+	var batch []string
+	for _, record := range records {
+		f.records[record.Name+"/"+record.Type] = *record
+		batch = append(batch, record.Name+"="+record.Value)
+	}
+	f.batches = append(f.batches, batch)
+	return nil
+}
+
+func (f *fakeProvider) DeleteRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.nextErr("DeleteRecord"); err != nil {
+		return err
+	}
+	delete(f.records, record.Name+"/"+record.Type)
+	return nil
+}
+
+func (f *fakeProvider) Close(ctx context.Context) error { return nil }
+
+func (f *fakeProvider) callCount(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+// updateOnly hides the optional interfaces of a provider
+type updateOnly struct{ Provider }
+
+func TestUpdateRecords_FallsBackToSingleUpdates(t *testing.T) {
+	fake := newFakeProvider()
+	records := []*DNSRecord{
+		{Name: "a.example.com", Type: "A", Value: "192.0.2.1"},
+		{Name: "b.example.com", Type: "A", Value: "192.0.2.2"},
+	}
+
+	err := UpdateRecords(context.Background(), updateOnly{fake}, "example.com", records)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fake.callCount("UpdateRecord"))
+	assert.Equal(t, 0, fake.callCount("UpdateRecords"))
+
+	err = UpdateRecords(context.Background(), fake, "example.com", records)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fake.callCount("UpdateRecords"))
+}
+
+func TestDeleteRecord_NotSupported(t *testing.T) {
+	err := DeleteRecord(context.Background(), updateOnly{newFakeProvider()}, "example.com", &DNSRecord{Name: "a.example.com", Type: "A"})
+	assert.True(t, errors.Is(err, ErrNotSupported))
+}
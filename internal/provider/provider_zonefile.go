@@ -0,0 +1,744 @@
+//go:build zonefile || (!netcup_ccp && !aws_route53)
+// +build zonefile !netcup_ccp,!aws_route53
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+)
+
+const (
+	// SerialModeDate uses YYYYMMDDnn serials as recommended by RFC 1912
+	SerialModeDate = "date"
+	// SerialModeCounter increments the serial by one on every change
+	SerialModeCounter = "counter"
+)
+
+// ZoneFileConfig holds configuration for the zone file provider.
+type ZoneFileConfig struct {
+	// Path is either a zone file or a directory containing <domain>.zone files
+	Path string
+	// SerialMode is SerialModeDate or SerialModeCounter
+	SerialMode string
+	// ReloadCommand is run after every successful write (optional)
+	ReloadCommand string
+}
+
+// LoadZoneFileConfig loads the zone file configuration from environment variables
+// or the settings of the configuration file
+func LoadZoneFileConfig(settings Settings) (*ZoneFileConfig, error) {
+	config := &ZoneFileConfig{
+		Path:          settings.Get("ZONEFILE_PATH"),
+		SerialMode:    strings.ToLower(settings.Get("ZONEFILE_SERIAL_MODE")),
+		ReloadCommand: settings.Get("ZONEFILE_RELOAD_COMMAND"),
+	}
+
+	if config.Path == "" {
+		return nil, logger.Errorf("ZONEFILE_PATH is required for the zonefile provider")
+	}
+	if config.SerialMode == "" {
+		config.SerialMode = SerialModeDate
+	}
+	if config.SerialMode != SerialModeDate && config.SerialMode != SerialModeCounter {
+		return nil, logger.Errorf("invalid ZONEFILE_SERIAL_MODE %q (expected %s or %s)", config.SerialMode, SerialModeDate, SerialModeCounter)
+	}
+
+	logger.Debug("Zone file config: path=%s, serial_mode=%s, reload=%v", config.Path, config.SerialMode, config.ReloadCommand != "")
+	return config, nil
+}
+
+// ZoneFileClient edits RFC 1035 master files on disk
+type ZoneFileClient struct {
+	config ZoneFileConfig
+	mu     sync.Mutex
+	now    func() time.Time
+}
+
+// NewZoneFileClient creates a new zone file client
+func NewZoneFileClient(config ZoneFileConfig) *ZoneFileClient {
+	if config.SerialMode == "" {
+		config.SerialMode = SerialModeDate
+	}
+	return &ZoneFileClient{
+		config: config,
+		now:    time.Now,
+	}
+}
+
+func init() {
+	RegisterFactory("zonefile", NewZoneFileProvider)
+}
+
+// NewZoneFileProvider creates a new zone file provider
+func NewZoneFileProvider(ctx context.Context, config interface{}) (Provider, error) {
+	cfg, err := LoadZoneFileConfig(SettingsFrom(config))
+	if err != nil {
+		return nil, fmt.Errorf("load zonefile config: %w", err)
+	}
+	return NewZoneFileClient(*cfg), nil
+}
+
+// Name returns the provider name
+func (c *ZoneFileClient) Name() string {
+	return "zonefile"
+}
+
+// GetRecord retrieves a specific DNS record from the zone file
+func (c *ZoneFileClient) GetRecord(ctx context.Context, domain, hostname, recordType string) (*DNSRecord, error) {
+	logger.DebugContext(ctx, "Zone file: Getting record for domain=%s, hostname=%s, type=%s", domain, hostname, recordType)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	zone, err := c.load(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := absoluteName(hostname)
+	for _, entry := range zone.entries {
+		if entry.owner == owner && strings.EqualFold(entry.rrType, recordType) {
+			return zone.toRecord(entry, hostname), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// UpdateRecord updates or creates a DNS record and bumps the SOA serial
+func (c *ZoneFileClient) UpdateRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	return c.UpdateRecords(ctx, domain, []*DNSRecord{record})
+}
+
+// UpdateRecords updates or creates several DNS records with a single SOA
+// serial bump and reload
+func (c *ZoneFileClient) UpdateRecords(ctx context.Context, domain string, records []*DNSRecord) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	zone, err := c.load(domain)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, record := range records {
+		logger.DebugContext(ctx, "Zone file: Updating record for domain=%s, name=%s, type=%s", domain, record.Name, record.Type)
+		recordChanged, err := zone.upsert(record)
+		if err != nil {
+			return err
+		}
+		changed = changed || recordChanged
+	}
+	if !changed {
+		logger.DebugContext(ctx, "Zone file: Records already up to date")
+		return nil
+	}
+
+	if err := c.save(ctx, domain, zone); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		logger.InfoContext(ctx, "Zone file: Successfully updated record %s (%s)", record.Name, record.Type)
+	}
+	return nil
+}
+
+// DeleteRecord removes matching records and bumps the SOA serial
+func (c *ZoneFileClient) DeleteRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	logger.DebugContext(ctx, "Zone file: Deleting record for domain=%s, name=%s, type=%s", domain, record.Name, record.Type)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	zone, err := c.load(domain)
+	if err != nil {
+		return err
+	}
+
+	removed, err := zone.remove(absoluteName(record.Name), record.Type, zone.formatValue(record))
+	if err != nil {
+		return err
+	}
+	if !removed {
+		logger.DebugContext(ctx, "Zone file: Nothing to delete")
+		return nil
+	}
+
+	if err := c.save(ctx, domain, zone); err != nil {
+		return err
+	}
+
+	logger.InfoContext(ctx, "Zone file: Successfully deleted record %s (%s)", record.Name, record.Type)
+	return nil
+}
+
+// ListRecords returns all records of the zone
+func (c *ZoneFileClient) ListRecords(ctx context.Context, domain string) ([]DNSRecord, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	zone, err := c.load(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]DNSRecord, 0, len(zone.entries))
+	for _, entry := range zone.entries {
+		records = append(records, *zone.toRecord(entry, strings.TrimSuffix(entry.owner, ".")))
+	}
+	return records, nil
+}
+
+// HealthCheck verifies that the zone file (or directory) can be read and
+// replaced
+func (c *ZoneFileClient) HealthCheck(ctx context.Context) error {
+	return checkFileAccess(c.config.Path)
+}
+
+// Close cleans up resources (no-op for zone files)
+func (c *ZoneFileClient) Close(ctx context.Context) error {
+	return nil
+}
+
+// zonePath returns the zone file path for a domain
+func (c *ZoneFileClient) zonePath(domain string) string {
+	if info, err := os.Stat(c.config.Path); err == nil && info.IsDir() {
+		return filepath.Join(c.config.Path, strings.TrimSuffix(domain, ".")+".zone")
+	}
+	return c.config.Path
+}
+
+// load reads and parses the zone file for a domain
+func (c *ZoneFileClient) load(domain string) (*zoneFile, error) {
+	path := c.zonePath(domain)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read zone file: %w", err)
+	}
+	zone, err := parseZoneFile(string(data), absoluteName(domain))
+	if err != nil {
+		return nil, fmt.Errorf("parse zone file %s: %w", path, err)
+	}
+	return zone, nil
+}
+
+// save bumps the serial, writes the zone atomically and runs the reload command
+func (c *ZoneFileClient) save(ctx context.Context, domain string, zone *zoneFile) error {
+	serial, err := zone.bumpSerial(c.config.SerialMode, c.now())
+	if err != nil {
+		return err
+	}
+	logger.DebugContext(ctx, "Zone file: New SOA serial %d", serial)
+
+	path := c.zonePath(domain)
+	if err := writeFileAtomic(path, []byte(zone.String())); err != nil {
+		return fmt.Errorf("write zone file: %w", err)
+	}
+
+	if err := runReloadCommand(ctx, c.config.ReloadCommand); err != nil {
+		return err
+	}
+	return nil
+}
+
+// zoneToken is a single token of a zone file with its position
+type zoneToken struct {
+	text       string
+	line       int
+	start, end int
+}
+
+// zoneEntry is a resource record spanning one or more lines
+type zoneEntry struct {
+	first, last   int // line span (inclusive)
+	owner         string
+	explicitOwner bool
+	ttl           *zoneToken
+	rrType        string
+	rdata         []zoneToken
+}
+
+// zoneFile is a parsed master file that keeps the original text so that
+// comments, formatting and unrelated records survive a round-trip.
+type zoneFile struct {
+	lines      []string
+	base       string // origin the file was parsed with (the zone apex)
+	origin     string // origin in effect at the end of the file
+	defaultTTL int
+	entries    []zoneEntry
+}
+
+// parseZoneFile parses an RFC 1035 master file. $INCLUDE and $GENERATE are not supported.
+func parseZoneFile(text, origin string) (*zoneFile, error) {
+	zone := &zoneFile{
+		lines:  strings.Split(text, "\n"),
+		base:   origin,
+		origin: origin,
+	}
+
+	var (
+		tokens     []zoneToken
+		first      int
+		depth      int
+		blankStart bool
+		lastOwner  string
+	)
+
+	flush := func(last int) error {
+		defer func() { tokens = nil }()
+		if len(tokens) == 0 {
+			return nil
+		}
+
+		if strings.HasPrefix(tokens[0].text, "$") {
+			return zone.directive(tokens)
+		}
+
+		entry := zoneEntry{first: first, last: last}
+		rest := tokens
+		if blankStart {
+			if lastOwner == "" {
+				return fmt.Errorf("line %d: record without owner", first+1)
+			}
+			entry.owner = lastOwner
+		} else {
+			entry.owner = resolveName(rest[0].text, zone.origin)
+			entry.explicitOwner = true
+			rest = rest[1:]
+		}
+		lastOwner = entry.owner
+
+		for len(rest) > 0 {
+			tok := rest[0]
+			if _, ok := parseTTL(tok.text); ok {
+				t := tok
+				entry.ttl = &t
+			} else if !isClass(tok.text) {
+				break
+			}
+			rest = rest[1:]
+		}
+		if len(rest) == 0 {
+			return fmt.Errorf("line %d: missing record type", first+1)
+		}
+		entry.rrType = strings.ToUpper(rest[0].text)
+		entry.rdata = rest[1:]
+		zone.entries = append(zone.entries, entry)
+		return nil
+	}
+
+	for lineNum, line := range zone.lines {
+		if depth == 0 {
+			first = lineNum
+			blankStart = len(line) > 0 && (line[0] == ' ' || line[0] == '\t')
+		}
+
+		for i := 0; i < len(line); {
+			ch := line[i]
+			switch {
+			case ch == ';':
+				i = len(line)
+			case ch == ' ' || ch == '\t' || ch == '\r':
+				i++
+			case ch == '(':
+				depth++
+				i++
+			case ch == ')':
+				if depth == 0 {
+					return nil, fmt.Errorf("line %d: unbalanced parenthesis", lineNum+1)
+				}
+				depth--
+				i++
+			case ch == '"':
+				end := i + 1
+				for end < len(line) && line[end] != '"' {
+					if line[end] == '\\' {
+						end++
+					}
+					end++
+				}
+				if end >= len(line) {
+					return nil, fmt.Errorf("line %d: unterminated string", lineNum+1)
+				}
+				tokens = append(tokens, zoneToken{text: line[i : end+1], line: lineNum, start: i, end: end + 1})
+				i = end + 1
+			default:
+				end := i
+				for end < len(line) && !strings.ContainsRune(" \t\r;()\"", rune(line[end])) {
+					if line[end] == '\\' {
+						end++
+					}
+					end++
+				}
+				if end > len(line) {
+					end = len(line)
+				}
+				tokens = append(tokens, zoneToken{text: line[i:end], line: lineNum, start: i, end: end})
+				i = end
+			}
+		}
+
+		if depth == 0 {
+			if err := flush(lineNum); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parenthesis at end of file")
+	}
+	return zone, nil
+}
+
+// directive handles $ORIGIN and $TTL lines
+func (z *zoneFile) directive(tokens []zoneToken) error {
+	name := strings.ToUpper(tokens[0].text)
+	switch name {
+	case "$ORIGIN":
+		if len(tokens) < 2 {
+			return fmt.Errorf("line %d: $ORIGIN without name", tokens[0].line+1)
+		}
+		z.origin = resolveName(tokens[1].text, z.origin)
+	case "$TTL":
+		if len(tokens) < 2 {
+			return fmt.Errorf("line %d: $TTL without value", tokens[0].line+1)
+		}
+		ttl, ok := parseTTL(tokens[1].text)
+		if !ok {
+			return fmt.Errorf("line %d: invalid $TTL %q", tokens[0].line+1, tokens[1].text)
+		}
+		z.defaultTTL = ttl
+	default:
+		return fmt.Errorf("line %d: unsupported directive %s", tokens[0].line+1, name)
+	}
+	return nil
+}
+
+// String returns the zone file text
+func (z *zoneFile) String() string {
+	return strings.Join(z.lines, "\n")
+}
+
+// reparse re-reads the entries after the lines were modified
+func (z *zoneFile) reparse() error {
+	parsed, err := parseZoneFile(z.String(), z.base)
+	if err != nil {
+		return err
+	}
+	*z = *parsed
+	return nil
+}
+
+// toRecord converts an entry to a DNSRecord
+func (z *zoneFile) toRecord(entry zoneEntry, hostname string) *DNSRecord {
+	record := &DNSRecord{
+		Name: hostname,
+		Type: entry.rrType,
+		TTL:  z.defaultTTL,
+	}
+	if entry.ttl != nil {
+		record.TTL, _ = parseTTL(entry.ttl.text)
+	}
+
+	rdata := make([]string, 0, len(entry.rdata))
+	for _, tok := range entry.rdata {
+		rdata = append(rdata, tok.text)
+	}
+	if entry.rrType == "MX" && len(rdata) == 2 {
+		record.Priority, _ = strconv.Atoi(rdata[0])
+		rdata = rdata[1:]
+	}
+	if entry.rrType == "TXT" && len(rdata) == 1 {
+		rdata[0] = strings.Trim(rdata[0], `"`)
+	}
+	record.Value = strings.Join(rdata, " ")
+	return record
+}
+
+// formatValue renders the rdata of a record in master file syntax
+func (z *zoneFile) formatValue(record *DNSRecord) string {
+	if record.Value == "" {
+		return ""
+	}
+	value := record.Value
+	switch strings.ToUpper(record.Type) {
+	case "TXT":
+		if !strings.HasPrefix(value, `"`) {
+			value = strconv.Quote(value)
+		}
+	case "MX":
+		if record.Priority > 0 {
+			value = strconv.Itoa(record.Priority) + " " + value
+		}
+	}
+	return value
+}
+
+// entryValue returns the rdata of an entry as a single string
+func entryValue(entry zoneEntry) string {
+	parts := make([]string, 0, len(entry.rdata))
+	for _, tok := range entry.rdata {
+		parts = append(parts, tok.text)
+	}
+	return strings.Join(parts, " ")
+}
+
+// upsert sets the single value of a name/type pair. It returns false if the
+// zone already contained exactly that value.
+func (z *zoneFile) upsert(record *DNSRecord) (bool, error) {
+	owner := absoluteName(record.Name)
+	rrType := strings.ToUpper(record.Type)
+	value := z.formatValue(record)
+
+	matches := func(entry zoneEntry) bool {
+		return entry.owner == owner && entry.rrType == rrType
+	}
+
+	// Keep only the first value of the pair
+	removed, err := z.removeWhere(matches, 1)
+	if err != nil {
+		return false, err
+	}
+
+	var entry *zoneEntry
+	for i := range z.entries {
+		if matches(z.entries[i]) {
+			entry = &z.entries[i]
+			break
+		}
+	}
+
+	if entry == nil {
+		line := fmt.Sprintf("%s\t%d\tIN\t%s\t%s", relativeName(owner, z.origin), z.recordTTL(record), rrType, value)
+		// Keep the trailing newline at the end of the file
+		if n := len(z.lines); n > 0 && strings.TrimSpace(z.lines[n-1]) == "" {
+			z.lines = append(z.lines[:n-1], line, z.lines[n-1])
+		} else {
+			z.lines = append(z.lines, line)
+		}
+		return true, z.reparse()
+	}
+
+	ttl := z.defaultTTL
+	if entry.ttl != nil {
+		ttl, _ = parseTTL(entry.ttl.text)
+	}
+	if entryValue(*entry) == value && (record.TTL <= 0 || record.TTL == ttl) {
+		return removed, nil
+	}
+	if len(entry.rdata) == 0 {
+		return false, fmt.Errorf("line %d: record without data", entry.first+1)
+	}
+
+	firstTok, lastTok := entry.rdata[0], entry.rdata[len(entry.rdata)-1]
+	// A TTL differing from $TTL must be written, or the record would never
+	// match it and every update would bump the serial
+	addTTL := entry.ttl == nil && record.TTL > 0 && record.TTL != ttl
+	if !addTTL && firstTok.line == lastTok.line && (entry.ttl == nil || entry.ttl.line == firstTok.line) {
+		// Rewrite in place so comments on the same line are kept
+		line := z.lines[firstTok.line]
+		line = line[:firstTok.start] + value + line[lastTok.end:]
+		if entry.ttl != nil && record.TTL > 0 {
+			line = line[:entry.ttl.start] + strconv.Itoa(record.TTL) + line[entry.ttl.end:]
+		}
+		z.lines[firstTok.line] = line
+	} else {
+		// Multi-line record or missing TTL: replace it with a single line
+		ownerText := ""
+		if entry.explicitOwner {
+			ownerText = relativeName(owner, z.originAt(entry.first))
+		}
+		line := fmt.Sprintf("%s\t%d\tIN\t%s\t%s", ownerText, z.recordTTL(record), rrType, value)
+		if entry.first == entry.last {
+			// Keep a comment on the same line
+			line += z.lines[entry.last][lastTok.end:]
+		}
+		replaced := append([]string{}, z.lines[:entry.first]...)
+		replaced = append(replaced, line)
+		z.lines = append(replaced, z.lines[entry.last+1:]...)
+	}
+	return true, z.reparse()
+}
+
+// remove deletes all entries of a name/type pair, optionally only those with the given value
+func (z *zoneFile) remove(owner, rrType, value string) (bool, error) {
+	rrType = strings.ToUpper(rrType)
+	return z.removeWhere(func(entry zoneEntry) bool {
+		if entry.owner != owner || entry.rrType != rrType {
+			return false
+		}
+		return value == "" || entryValue(entry) == value
+	}, 0)
+}
+
+// removeWhere deletes matching entries except the first keep ones
+func (z *zoneFile) removeWhere(match func(zoneEntry) bool, keep int) (bool, error) {
+	removed := false
+	for {
+		var matching []zoneEntry
+		for _, entry := range z.entries {
+			if match(entry) {
+				matching = append(matching, entry)
+			}
+		}
+		if len(matching) <= keep {
+			return removed, nil
+		}
+
+		z.removeEntry(matching[len(matching)-1])
+		removed = true
+		if err := z.reparse(); err != nil {
+			return removed, err
+		}
+	}
+}
+
+// removeEntry deletes the lines of an entry. If the following record inherits
+// the owner of the removed one, the owner is carried over to it.
+func (z *zoneFile) removeEntry(entry zoneEntry) {
+	if entry.explicitOwner {
+		for _, next := range z.entries {
+			if next.first > entry.last {
+				if !next.explicitOwner && next.owner == entry.owner {
+					ownerText := strings.Fields(z.lines[entry.first])[0]
+					z.lines[next.first] = ownerText + z.lines[next.first]
+				}
+				break
+			}
+		}
+	}
+	z.lines = append(z.lines[:entry.first], z.lines[entry.last+1:]...)
+}
+
+// originAt returns the $ORIGIN in effect at the given line
+func (z *zoneFile) originAt(line int) string {
+	parsed, err := parseZoneFile(strings.Join(z.lines[:line], "\n"), z.base)
+	if err != nil {
+		return z.base
+	}
+	return parsed.origin
+}
+
+// recordTTL returns the TTL to write for a record
+func (z *zoneFile) recordTTL(record *DNSRecord) int {
+	if record.TTL > 0 {
+		return record.TTL
+	}
+	if z.defaultTTL > 0 {
+		return z.defaultTTL
+	}
+	return 60
+}
+
+// bumpSerial increments the SOA serial in place and returns the new value
+func (z *zoneFile) bumpSerial(mode string, now time.Time) (uint32, error) {
+	for _, entry := range z.entries {
+		if entry.rrType != "SOA" {
+			continue
+		}
+		if len(entry.rdata) < 3 {
+			return 0, fmt.Errorf("line %d: malformed SOA record", entry.first+1)
+		}
+		tok := entry.rdata[2]
+		current, err := strconv.ParseUint(tok.text, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: invalid SOA serial %q", tok.line+1, tok.text)
+		}
+
+		serial := nextSerial(uint32(current), mode, now)
+		line := z.lines[tok.line]
+		z.lines[tok.line] = line[:tok.start] + strconv.FormatUint(uint64(serial), 10) + line[tok.end:]
+		return serial, nil
+	}
+	return 0, fmt.Errorf("zone has no SOA record")
+}
+
+// nextSerial computes the next SOA serial
+func nextSerial(current uint32, mode string, now time.Time) uint32 {
+	if mode == SerialModeDate {
+		today, _ := strconv.ParseUint(now.UTC().Format("20060102")+"00", 10, 32)
+		if uint32(today) > current {
+			return uint32(today)
+		}
+	}
+	// RFC 1982 serial arithmetic wraps around; zero is avoided for clarity
+	next := current + 1
+	if next == 0 {
+		next = 1
+	}
+	return next
+}
+
+// parseTTL parses a TTL in seconds or BIND unit syntax (e.g. 1h30m)
+func parseTTL(text string) (int, bool) {
+	if text == "" || text[0] < '0' || text[0] > '9' {
+		return 0, false
+	}
+	total, current := 0, 0
+	hasDigits := false
+	for _, ch := range strings.ToLower(text) {
+		switch {
+		case ch >= '0' && ch <= '9':
+			current = current*10 + int(ch-'0')
+			hasDigits = true
+		case hasDigits && strings.ContainsRune("smhdw", ch):
+			total += current * map[rune]int{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}[ch]
+			current, hasDigits = 0, false
+		default:
+			return 0, false
+		}
+	}
+	return total + current, true
+}
+
+// isClass reports whether the token is a DNS class
+func isClass(text string) bool {
+	switch strings.ToUpper(text) {
+	case "IN", "CS", "CH", "HS":
+		return true
+	}
+	return false
+}
+
+// absoluteName returns a lower-case fully qualified name with trailing dot
+func absoluteName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
+
+// resolveName resolves an owner name relative to the origin
+func resolveName(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return strings.ToLower(name)
+	default:
+		return strings.ToLower(name) + "." + origin
+	}
+}
+
+// relativeName renders an absolute name relative to the origin if possible
+func relativeName(name, origin string) string {
+	if name == origin {
+		return "@"
+	}
+	if strings.HasSuffix(name, "."+origin) {
+		return strings.TrimSuffix(name, "."+origin)
+	}
+	return name
+}
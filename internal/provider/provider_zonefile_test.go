@@ -0,0 +1,230 @@
+//go:build zonefile || (!netcup_ccp && !aws_route53)
+// +build zonefile !netcup_ccp,!aws_route53
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+const testZone = `; Zone for example.com
+$TTL 3600
+$ORIGIN example.com.
+@	IN	SOA	ns1.example.com. hostmaster.example.com. (
+		2024010101 ; serial
+		7200       ; refresh
+		3600       ; retry
+		1209600    ; expire
+		300 )      ; minimum
+	IN	NS	ns1.example.com.
+	IN	MX	10 mail.example.com.
+ns1	IN	A	192.0.2.53
+www	300	IN	A	192.0.2.1 ; web server
+mail	IN	A	192.0.2.25
+	IN	AAAA	2001:db8::25
+txt	IN	TXT	"v=spf1 -all"
+`
+
+func newTestZoneFile(t *testing.T, content string) (*ZoneFileClient, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "example.com.zone")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o640))
+
+	client := NewZoneFileClient(ZoneFileConfig{Path: path, SerialMode: SerialModeCounter})
+	client.now = func() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) }
+	return client, path
+}
+
+func readZone(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestZoneFileProvider_GetRecord(t *testing.T) {
+	client, _ := newTestZoneFile(t, testZone)
+	ctx := context.Background()
+
+	record, err := client.GetRecord(ctx, "example.com", "www.example.com", "A")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", record.Value)
+	assert.Equal(t, 300, record.TTL)
+
+	// Owner inherited from the previous line
+	record, err = client.GetRecord(ctx, "example.com", "mail.example.com", "AAAA")
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::25", record.Value)
+	assert.Equal(t, 3600, record.TTL)
+
+	record, err = client.GetRecord(ctx, "example.com", "example.com", "MX")
+	assert.NoError(t, err)
+	assert.Equal(t, "mail.example.com.", record.Value)
+	assert.Equal(t, 10, record.Priority)
+
+	record, err = client.GetRecord(ctx, "example.com", "txt.example.com", "TXT")
+	assert.NoError(t, err)
+	assert.Equal(t, "v=spf1 -all", record.Value)
+
+	_, err = client.GetRecord(ctx, "example.com", "missing.example.com", "A")
+	assert.EqualError(t, err, "record not found")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestZoneFileProvider_ListRecords(t *testing.T) {
+	client, _ := newTestZoneFile(t, testZone)
+
+	records, err := client.ListRecords(context.Background(), "example.com")
+	assert.NoError(t, err)
+	var names []string
+	for _, record := range records {
+		names = append(names, record.Name+" "+record.Type)
+	}
+	assert.Equal(t, []string{
+		"example.com SOA", "example.com NS", "example.com MX", "ns1.example.com A",
+		"www.example.com A", "mail.example.com A", "mail.example.com AAAA", "txt.example.com TXT",
+	}, names)
+	assert.Equal(t, "v=spf1 -all", records[7].Value)
+}
+
+func TestZoneFileProvider_UpdateRecordRoundTrip(t *testing.T) {
+	client, path := newTestZoneFile(t, testZone)
+	ctx := context.Background()
+
+	err := client.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "www.example.com", Type: "A", Value: "198.51.100.7", TTL: 300})
+	assert.NoError(t, err)
+
+	content := readZone(t, path)
+	assert.Contains(t, content, "www\t300\tIN\tA\t198.51.100.7 ; web server")
+	assert.Contains(t, content, "2024010102 ; serial")
+	assert.Contains(t, content, "; Zone for example.com")
+	assert.Contains(t, content, "mail\tIN\tA\t192.0.2.25\n\tIN\tAAAA\t2001:db8::25")
+
+	// Only the changed line and the serial differ from the original
+	before := strings.Split(testZone, "\n")
+	after := strings.Split(content, "\n")
+	assert.Equal(t, len(before), len(after))
+	var diff []int
+	for i := range before {
+		if before[i] != after[i] {
+			diff = append(diff, i)
+		}
+	}
+	assert.Equal(t, []int{4, 12}, diff)
+
+	// Unchanged value does not touch the file
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	err = client.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "www.example.com", Type: "A", Value: "198.51.100.7"})
+	assert.NoError(t, err)
+	assert.Equal(t, content, readZone(t, path))
+	infoAfter, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, info.ModTime(), infoAfter.ModTime())
+	assert.Equal(t, os.FileMode(0o640), infoAfter.Mode().Perm())
+}
+
+func TestZoneFileProvider_UpdateRecordInheritedTTL(t *testing.T) {
+	client, path := newTestZoneFile(t, testZone)
+	ctx := context.Background()
+
+	// A TTL differing from $TTL is written to the record
+	record := &DNSRecord{Name: "mail.example.com", Type: "A", Value: "192.0.2.25", TTL: 60}
+	assert.NoError(t, client.UpdateRecord(ctx, "example.com", record))
+	content := readZone(t, path)
+	assert.Contains(t, content, "mail\t60\tIN\tA\t192.0.2.25\n\tIN\tAAAA\t2001:db8::25")
+	assert.Contains(t, content, "2024010102 ; serial")
+
+	// The same update again is no change
+	assert.NoError(t, client.UpdateRecord(ctx, "example.com", record))
+	assert.Equal(t, content, readZone(t, path))
+}
+
+func TestZoneFileProvider_CreateAndDeleteRecord(t *testing.T) {
+	client, path := newTestZoneFile(t, testZone)
+	ctx := context.Background()
+
+	err := client.UpdateRecord(ctx, "example.com", &DNSRecord{Name: "home.example.com", Type: "AAAA", Value: "2001:db8::1", TTL: 60})
+	assert.NoError(t, err)
+	content := readZone(t, path)
+	assert.True(t, strings.HasSuffix(content, "home\t60\tIN\tAAAA\t2001:db8::1\n"))
+
+	record, err := client.GetRecord(ctx, "example.com", "home.example.com", "AAAA")
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", record.Value)
+
+	// Deleting mail A keeps the inherited-owner AAAA record attached to "mail"
+	err = client.DeleteRecord(ctx, "example.com", &DNSRecord{Name: "mail.example.com", Type: "A"})
+	assert.NoError(t, err)
+	_, err = client.GetRecord(ctx, "example.com", "mail.example.com", "A")
+	assert.Error(t, err)
+	record, err = client.GetRecord(ctx, "example.com", "mail.example.com", "AAAA")
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::25", record.Value)
+
+	content = readZone(t, path)
+	assert.Contains(t, content, "2024010103 ; serial")
+	assert.Contains(t, content, "www\t300\tIN\tA\t192.0.2.1 ; web server")
+}
+
+func TestZoneFileProvider_DuplicateValuesCollapsed(t *testing.T) {
+	zone := testZone + "multi\tIN\tA\t192.0.2.10\nmulti\tIN\tA\t192.0.2.11\n"
+	client, path := newTestZoneFile(t, zone)
+
+	err := client.UpdateRecord(context.Background(), "example.com", &DNSRecord{Name: "multi.example.com", Type: "A", Value: "192.0.2.12"})
+	assert.NoError(t, err)
+
+	content := readZone(t, path)
+	assert.Contains(t, content, "multi\tIN\tA\t192.0.2.12\n")
+	assert.NotContains(t, content, "192.0.2.11")
+}
+
+func TestZoneFileProvider_ParseErrors(t *testing.T) {
+	_, err := parseZoneFile("$INCLUDE other.zone\n", "example.com.")
+	assert.Error(t, err)
+
+	_, err = parseZoneFile("@ IN SOA ns1 host ( 1 2 3 4 5\n", "example.com.")
+	assert.Error(t, err)
+}
+
+func TestZoneFileProvider_nextSerial(t *testing.T) {
+	now := time.Date(2024, 3, 15, 8, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name     string
+		current  uint32
+		mode     string
+		expected uint32
+	}{
+		{"date older", 2024010105, SerialModeDate, 2024031500},
+		{"date same day", 2024031500, SerialModeDate, 2024031501},
+		{"date ahead", 2024031599, SerialModeDate, 2024031600},
+		{"counter", 41, SerialModeCounter, 42},
+		{"counter wrap", 4294967295, SerialModeCounter, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, nextSerial(tc.current, tc.mode, now))
+		})
+	}
+}
+
+func TestZoneFileProvider_parseTTL(t *testing.T) {
+	for text, expected := range map[string]int{"300": 300, "1h": 3600, "1h30m": 5400, "1w": 604800, "2D": 172800} {
+		ttl, ok := parseTTL(text)
+		assert.True(t, ok, text)
+		assert.Equal(t, expected, ttl, text)
+	}
+	for _, text := range []string{"", "IN", "h1", "10x"} {
+		_, ok := parseTTL(text)
+		assert.False(t, ok, text)
+	}
+}
@@ -0,0 +1,174 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+)
+
+// RetryPolicy configures WithRetry
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry; it doubles per attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff
+	MaxDelay time.Duration
+	// RateLimit is the number of calls allowed per RateInterval (0 disables limiting)
+	RateLimit    int
+	RateInterval time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy for a provider
+func DefaultRetryPolicy(name string) RetryPolicy {
+	policy := RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+	}
+	switch name {
+	case "netcup_ccp":
+		// Netcup allows 180 API requests per minute. An update needs up to
+		// three requests (login, infoDnsRecords, updateDnsRecords).
+		policy.RateLimit = 60
+		policy.RateInterval = time.Minute
+	case "aws_route53":
+		// Route53 allows five requests per second per account
+		policy.RateLimit = 5
+		policy.RateInterval = time.Second
+	}
+	return policy
+}
+
+// retryProvider retries retryable errors with exponential backoff and jitter
+type retryProvider struct {
+	inner   Provider
+	policy  RetryPolicy
+	limiter *RateLimiter
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+// WithRetry wraps a provider so that retryable errors (see KindOf) are retried
+// with exponential backoff and full jitter. Auth and permanent errors are
+// returned immediately. If the policy has a rate limit, every call waits for
+// a token first.
+func WithRetry(p Provider, policy RetryPolicy) Provider {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	r := &retryProvider{
+		inner:  p,
+		policy: policy,
+		sleep:  sleepContext,
+	}
+	if policy.RateLimit > 0 && policy.RateInterval > 0 {
+		r.limiter = NewRateLimiter(policy.RateLimit, policy.RateInterval)
+	}
+	return r
+}
+
+// Name returns the name of the wrapped provider
+func (r *retryProvider) Name() string {
+	return r.inner.Name()
+}
+
+// Unwrap returns the wrapped provider
+func (r *retryProvider) Unwrap() Provider {
+	return r.inner
+}
+
+// GetRecord retrieves a record, retrying transient failures
+func (r *retryProvider) GetRecord(ctx context.Context, domain, hostname, recordType string) (*DNSRecord, error) {
+	var record *DNSRecord
+	err := r.do(ctx, "GetRecord", func() error {
+		var err error
+		record, err = r.inner.GetRecord(ctx, domain, hostname, recordType)
+		return err
+	})
+	return record, err
+}
+
+// UpdateRecord updates a record, retrying transient failures
+func (r *retryProvider) UpdateRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	return r.do(ctx, "UpdateRecord", func() error {
+		return r.inner.UpdateRecord(ctx, domain, record)
+	})
+}
+
+// UpdateRecords updates several records, retrying transient failures
+func (r *retryProvider) UpdateRecords(ctx context.Context, domain string, records []*DNSRecord) error {
+	return r.do(ctx, "UpdateRecords", func() error {
+		return UpdateRecords(ctx, r.inner, domain, records)
+	})
+}
+
+// DeleteRecord deletes a record, retrying transient failures
+func (r *retryProvider) DeleteRecord(ctx context.Context, domain string, record *DNSRecord) error {
+	return r.do(ctx, "DeleteRecord", func() error {
+		return DeleteRecord(ctx, r.inner, domain, record)
+	})
+}
+
+// Close closes the wrapped provider
+func (r *retryProvider) Close(ctx context.Context) error {
+	return r.inner.Close(ctx)
+}
+
+// do runs fn until it succeeds, fails with a non-retryable error or the
+// attempts are exhausted
+func (r *retryProvider) do(ctx context.Context, op string, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if r.limiter != nil {
+			if waitErr := r.limiter.Wait(ctx); waitErr != nil {
+				return waitErr
+			}
+		}
+
+		err = fn()
+		if err == nil || !IsRetryable(err) || attempt >= r.policy.MaxAttempts {
+			return err
+		}
+
+		delay := r.backoff(attempt, err)
+		logger.WarnContext(ctx, "%s: %s failed (attempt %d/%d), retrying in %v: %v",
+			r.inner.Name(), op, attempt, r.policy.MaxAttempts, delay.Round(time.Millisecond), err)
+		if sleepErr := r.sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// backoff returns a random delay in [0, min(MaxDelay, BaseDelay*2^(attempt-1))],
+// but at least the RetryAfter requested by the error
+func (r *retryProvider) backoff(attempt int, err error) time.Duration {
+	ceiling := r.policy.BaseDelay << (attempt - 1)
+	if ceiling <= 0 || (r.policy.MaxDelay > 0 && ceiling > r.policy.MaxDelay) {
+		ceiling = r.policy.MaxDelay
+	}
+	var delay time.Duration
+	if ceiling > 0 {
+		delay = time.Duration(rand.Int64N(int64(ceiling) + 1))
+	}
+
+	var perr *Error
+	if errors.As(err, &perr) && perr.RetryAfter > delay {
+		delay = perr.RetryAfter
+	}
+	return delay
+}
+
+// sleepContext sleeps for d or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
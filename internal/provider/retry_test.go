@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func newTestRetry(p Provider, policy RetryPolicy) (*retryProvider, *[]time.Duration) {
+	r := WithRetry(p, policy).(*retryProvider)
+	var sleeps []time.Duration
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	return r, &sleeps
+}
+
+func TestWithRetry_RetriesRetryableErrors(t *testing.T) {
+	fake := newFakeProvider()
+	fake.errs = []error{
+		NewError(KindRetryable, errors.New("timeout")),
+		httpStatusError(http.StatusServiceUnavailable, nil),
+	}
+	r, sleeps := newTestRetry(fake, RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second, MaxDelay: 3 * time.Second})
+
+	err := r.UpdateRecord(context.Background(), "example.com", &DNSRecord{Name: "a.example.com", Type: "A", Value: "192.0.2.1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, fake.callCount("UpdateRecord"))
+	assert.Equal(t, 2, len(*sleeps))
+	assert.True(t, (*sleeps)[0] <= time.Second)
+	assert.True(t, (*sleeps)[1] <= 2*time.Second)
+}
+
+func TestWithRetry_DoesNotRetryAuthOrPermanentErrors(t *testing.T) {
+	for _, kind := range []ErrorKind{KindAuth, KindPermanent} {
+		t.Run(kind.String(), func(t *testing.T) {
+			fake := newFakeProvider()
+			fake.errs = []error{fmt.Errorf("wrapped: %w", NewError(kind, errors.New("nope")))}
+			r, sleeps := newTestRetry(fake, RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second})
+
+			_, err := r.GetRecord(context.Background(), "example.com", "a.example.com", "A")
+			assert.Error(t, err)
+			assert.Equal(t, kind, KindOf(err))
+			assert.Equal(t, 1, fake.callCount("GetRecord"))
+			assert.Equal(t, 0, len(*sleeps))
+		})
+	}
+}
+
+func TestWithRetry_GivesUpAfterMaxAttempts(t *testing.T) {
+	fake := newFakeProvider()
+	for i := 0; i < 5; i++ {
+		fake.errs = append(fake.errs, &Error{Kind: KindRetryable, Err: errors.New("rate limited"), RetryAfter: 5 * time.Second})
+	}
+	r, sleeps := newTestRetry(fake, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	err := r.DeleteRecord(context.Background(), "example.com", &DNSRecord{Name: "a.example.com", Type: "A"})
+	assert.Error(t, err)
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, 3, fake.callCount("DeleteRecord"))
+	assert.Equal(t, []time.Duration{5 * time.Second, 5 * time.Second}, *sleeps)
+}
+
+func TestWithRetry_AsAndUnsupportedDelete(t *testing.T) {
+	fake := newFakeProvider()
+	r := WithRetry(fake, RetryPolicy{})
+
+	found, ok := As[*fakeProvider](r)
+	assert.True(t, ok)
+	assert.Equal(t, fake, found)
+
+	// A provider without DeleteRecord reports ErrNotSupported through the wrapper
+	wrapped := WithRetry(updateOnly{fake}, RetryPolicy{MaxAttempts: 3})
+	err := DeleteRecord(context.Background(), wrapped, "example.com", &DNSRecord{Name: "a.example.com", Type: "A"})
+	assert.True(t, errors.Is(err, ErrNotSupported))
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewRateLimiter(3, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, time.Duration(0), limiter.reserve())
+	}
+	assert.Equal(t, 20*time.Second, limiter.reserve())
+
+	now = now.Add(20 * time.Second)
+	assert.Equal(t, time.Duration(0), limiter.reserve())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, limiter.Wait(ctx))
+}
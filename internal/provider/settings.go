@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/markussiebert/homeddns/internal/util"
+)
+
+// Settings are provider settings from the configuration file, keyed by the
+// name of the equivalent environment variable in lower case (for example
+// netcup_api_key). They are passed to a Factory as its config argument.
+type Settings map[string]string
+
+// SettingsFrom returns the settings passed to a Factory, or nil if the
+// provider is configured from the environment only
+func SettingsFrom(config interface{}) Settings {
+	settings, _ := config.(Settings)
+	return settings
+}
+
+// Get returns the environment variable key if it is set, otherwise the
+// setting of the same name. Environment variables take precedence so that
+// deployments can override single values of a configuration file.
+func (s Settings) Get(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return s[strings.ToLower(key)]
+}
+
+// Secret returns a secret setting. Besides the environment variable key and
+// the setting of the same name, the secret can be read from the file named
+// by the environment variable key+"_FILE" (e.g. NETCUP_API_PASSWORD_FILE),
+// as used for Docker and Kubernetes secrets. Environment variables take
+// precedence; setting both key and key+"_FILE" is an error.
+func (s Settings) Secret(key string) (util.Secret, error) {
+	value, file := os.Getenv(key), os.Getenv(key+"_FILE")
+	if value != "" && file != "" {
+		return "", fmt.Errorf("%s and %s_FILE are both set", key, key)
+	}
+	if value == "" && file == "" {
+		return util.Secret(s[strings.ToLower(key)]), nil
+	}
+	if value != "" {
+		return util.Secret(value), nil
+	}
+	secret, err := util.ReadSecretFile(file)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE: %w", key, err)
+	}
+	return secret, nil
+}
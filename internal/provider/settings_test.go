@@ -0,0 +1,32 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSettings(t *testing.T) {
+	settings := Settings{"test_url": "http://file", "test_password": "from-file"}
+	assert.Equal(t, "http://file", settings.Get("TEST_URL"))
+	t.Setenv("TEST_URL", "http://env")
+	assert.Equal(t, "http://env", settings.Get("TEST_URL"))
+	assert.Equal(t, "", Settings(nil).Get("TEST_MISSING"))
+
+	secret, err := settings.Secret("TEST_PASSWORD")
+	assert.NoError(t, err)
+	assert.Equal(t, "from-file", secret.Value())
+
+	path := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, os.WriteFile(path, []byte("from-secret\n"), 0o400))
+	t.Setenv("TEST_PASSWORD_FILE", path)
+	secret, err = settings.Secret("TEST_PASSWORD")
+	assert.NoError(t, err)
+	assert.Equal(t, "from-secret", secret.Value())
+
+	t.Setenv("TEST_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	_, err = settings.Secret("TEST_PASSWORD")
+	assert.Error(t, err)
+}
@@ -0,0 +1,237 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/dnsclient"
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/state"
+)
+
+// DefaultMaxEvents is the number of drift events kept in memory
+const DefaultMaxEvents = 100
+
+// Event describes a record whose served value differs from the desired one
+type Event struct {
+	Time     time.Time `json:"time"`
+	View     string    `json:"view"`
+	Hostname string    `json:"hostname"`
+	Type     string    `json:"type"`
+	Expected string    `json:"expected"`
+	Actual   []string  `json:"actual"`
+	Server   string    `json:"server,omitempty"`
+	Repaired bool      `json:"repaired"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Config configures a Reconciler
+type Config struct {
+	// Store holds the desired state
+	Store *state.Store
+	// Providers maps the names of the views to check to their providers
+	Providers map[string]provider.Provider
+	// Client queries the authoritative nameservers
+	Client *dnsclient.Client
+	// AutoRepair re-applies drifted records through UpdateRecord
+	AutoRepair bool
+	// Grace skips records changed more recently, to allow for propagation
+	Grace time.Duration
+	// DefaultTTL is used for repaired records
+	DefaultTTL int
+	// MaxEvents bounds the event buffer (default DefaultMaxEvents)
+	MaxEvents int
+}
+
+// Reconciler compares the records served by the authoritative nameservers
+// with the desired state and repairs drift
+type Reconciler struct {
+	config    Config
+	providers atomic.Pointer[map[string]provider.Provider]
+	now       func() time.Time
+
+	mu     sync.Mutex
+	events []Event // ring buffer, oldest first
+}
+
+// New creates a new reconciler
+func New(config Config) *Reconciler {
+	if config.Client == nil {
+		config.Client = &dnsclient.Client{}
+	}
+	if config.MaxEvents <= 0 {
+		config.MaxEvents = DefaultMaxEvents
+	}
+	if config.DefaultTTL == 0 {
+		config.DefaultTTL = 60
+	}
+	r := &Reconciler{config: config, now: time.Now}
+	r.SetProviders(config.Providers)
+	return r
+}
+
+// SetProviders replaces the providers of the views to check, e.g. after the
+// configuration was reloaded
+func (r *Reconciler) SetProviders(providers map[string]provider.Provider) {
+	r.providers.Store(&providers)
+}
+
+// Run checks all records every interval until ctx is done
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Check(ctx)
+		}
+	}
+}
+
+// Check compares every stored record of the configured views with the
+// authoritative answer and returns the drift events found
+func (r *Reconciler) Check(ctx context.Context) []Event {
+	servers := make(map[string][]string) // per domain
+	providers := *r.providers.Load()
+	var found []Event
+
+	for _, record := range r.config.Store.Records() {
+		p, ok := providers[record.View]
+		if !ok || record.Value == "" {
+			continue
+		}
+		if r.now().Sub(record.Changed) < r.config.Grace {
+			logger.DebugContext(ctx, "Drift check: skipping %s (%s), changed recently", record.Hostname, record.Type)
+			continue
+		}
+
+		domainServers, ok := servers[record.Domain]
+		if !ok {
+			var err error
+			domainServers, err = r.config.Client.AuthoritativeServers(ctx, record.Domain)
+			if err != nil {
+				logger.WarnContext(ctx, "Drift check: %v", err)
+			}
+			servers[record.Domain] = domainServers
+		}
+		if len(domainServers) == 0 {
+			continue
+		}
+
+		event, drifted := r.check(ctx, p, record, domainServers)
+		if drifted {
+			r.add(event)
+			found = append(found, event)
+		}
+	}
+	return found
+}
+
+// check resolves one record and repairs it if it drifted
+func (r *Reconciler) check(ctx context.Context, p provider.Provider, record state.Record, servers []string) (Event, bool) {
+	event := Event{
+		Time:     r.now(),
+		View:     record.View,
+		Hostname: record.Hostname,
+		Type:     record.Type,
+		Expected: record.Value,
+	}
+
+	var lastErr error
+	for _, server := range servers {
+		actual, err := r.config.Client.Lookup(ctx, server, record.Hostname, record.Type)
+		if err != nil && !errors.Is(err, dnsclient.ErrNXDomain) {
+			lastErr = err
+			continue
+		}
+		if len(actual) == 1 && dnsclient.SameValue(actual[0], record.Value) {
+			logger.DebugContext(ctx, "Drift check: %s (%s) is %s at %s", record.Hostname, record.Type, record.Value, server)
+			return event, false
+		}
+		event.Server = server
+		event.Actual = actual
+		lastErr = nil
+		break
+	}
+	if lastErr != nil {
+		// Unreachable nameservers are not drift
+		logger.WarnContext(ctx, "Drift check: cannot resolve %s (%s): %v", record.Hostname, record.Type, lastErr)
+		return event, false
+	}
+
+	logger.WarnContext(ctx, "Drift detected: %s (%s) in view %s is %v at %s, expected %s",
+		record.Hostname, record.Type, record.View, event.Actual, event.Server, record.Value)
+
+	if r.config.AutoRepair {
+		if err := r.repair(ctx, p, record); err != nil {
+			event.Error = err.Error()
+			logger.ErrorContext(ctx, "Drift repair of %s (%s) failed: %v", record.Hostname, record.Type, err)
+		} else {
+			event.Repaired = true
+			logger.InfoContext(ctx, "Drift repair: re-applied %s (%s) = %s", record.Hostname, record.Type, record.Value)
+		}
+	}
+	return event, true
+}
+
+// repair re-applies the desired value, bypassing the record cache
+func (r *Reconciler) repair(ctx context.Context, p provider.Provider, record state.Record) error {
+	if cache, ok := provider.As[*provider.CachingProvider](p); ok {
+		cache.Invalidate(record.Domain, record.Hostname, record.Type)
+	}
+	err := p.UpdateRecord(ctx, record.Domain, &provider.DNSRecord{
+		Name:  record.Hostname,
+		Type:  record.Type,
+		Value: record.Value,
+		TTL:   r.config.DefaultTTL,
+	})
+	if err != nil {
+		return fmt.Errorf("update DNS record: %w", err)
+	}
+	return nil
+}
+
+// add appends an event to the ring buffer
+func (r *Reconciler) add(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	if len(r.events) > r.config.MaxEvents {
+		r.events = slices.Clone(r.events[len(r.events)-r.config.MaxEvents:])
+	}
+}
+
+// Events returns the recorded drift events, newest first
+func (r *Reconciler) Events() []Event {
+	r.mu.Lock()
+	events := slices.Clone(r.events)
+	r.mu.Unlock()
+	slices.Reverse(events)
+	return events
+}
+
+// ServeHTTP returns the drift events as JSON
+func (r *Reconciler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	events := r.Events()
+	if events == nil {
+		events = []Event{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		Events []Event `json:"events"`
+	}{Events: events})
+}
@@ -0,0 +1,125 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/dnsclient"
+	"github.com/markussiebert/homeddns/internal/dnsclient/dnstest"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/state"
+)
+
+// recordingProvider records updates
+type recordingProvider struct {
+	updates []string
+}
+
+func (p *recordingProvider) Name() string { return "recording" }
+
+func (p *recordingProvider) GetRecord(ctx context.Context, domain, hostname, recordType string) (*provider.DNSRecord, error) {
+	return nil, fmt.Errorf("record not found")
+}
+
+func (p *recordingProvider) UpdateRecord(ctx context.Context, domain string, record *provider.DNSRecord) error {
+	p.updates = append(p.updates, record.Name+"="+record.Value)
+	return nil
+}
+
+func (p *recordingProvider) Close(ctx context.Context) error { return nil }
+
+func newTestReconciler(t *testing.T, autoRepair bool) (*Reconciler, *dnstest.Server, *recordingProvider) {
+	t.Helper()
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.json"), 0)
+	assert.NoError(t, err)
+	for _, change := range []state.Change{
+		{Hostname: "home.example.com", Domain: "example.com", Type: "A", Value: "192.0.2.1", View: "public"},
+		{Hostname: "nas.example.com", Domain: "example.com", Type: "A", Value: "192.0.2.2", View: "public"},
+		{Hostname: "nas.example.com", Domain: "example.com", Type: "A", Value: "192.168.1.10", View: "lan"},
+	} {
+		_, err := store.Apply(change)
+		assert.NoError(t, err)
+	}
+
+	server := dnstest.NewServer(t)
+	p := &recordingProvider{}
+	r := New(Config{
+		Store:      store,
+		Providers:  map[string]provider.Provider{"public": p},
+		Client:     &dnsclient.Client{Nameservers: []string{server.Addr}},
+		AutoRepair: autoRepair,
+		MaxEvents:  2,
+	})
+	return r, server, p
+}
+
+func TestReconciler_NoDrift(t *testing.T) {
+	r, server, p := newTestReconciler(t, true)
+	server.Set("home.example.com", "A", "192.0.2.1")
+	server.Set("nas.example.com", "A", "192.0.2.2")
+
+	assert.Equal(t, 0, len(r.Check(context.Background())))
+	assert.Equal(t, 0, len(p.updates))
+	// The lan view is not checked
+	assert.Equal(t, 2, server.Queries())
+}
+
+func TestReconciler_RepairsDrift(t *testing.T) {
+	r, server, p := newTestReconciler(t, true)
+	server.Set("home.example.com", "A", "198.51.100.9")
+	// nas.example.com is missing entirely
+
+	events := r.Check(context.Background())
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, []string{"198.51.100.9"}, events[0].Actual)
+	assert.Equal(t, server.Addr, events[0].Server)
+	assert.True(t, events[0].Repaired)
+	assert.Equal(t, 0, len(events[1].Actual))
+	assert.Equal(t, []string{"home.example.com=192.0.2.1", "nas.example.com=192.0.2.2"}, p.updates)
+
+	// The buffer keeps the newest MaxEvents events
+	r.Check(context.Background())
+	history := r.Events()
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, "nas.example.com", history[0].Hostname)
+}
+
+func TestReconciler_ReportOnlyAndGrace(t *testing.T) {
+	r, server, p := newTestReconciler(t, false)
+	server.Set("home.example.com", "A", "198.51.100.9")
+	server.Set("nas.example.com", "A", "192.0.2.2")
+
+	r.config.Grace = time.Hour
+	assert.Equal(t, 0, len(r.Check(context.Background())))
+
+	r.config.Grace = 0
+	events := r.Check(context.Background())
+	assert.Equal(t, 1, len(events))
+	assert.False(t, events[0].Repaired)
+	assert.Equal(t, 0, len(p.updates))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/drift", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), `"expected":"192.0.2.1"`))
+}
+
+func TestReconciler_NonCanonicalAddress(t *testing.T) {
+	r, server, p := newTestReconciler(t, true)
+	server.Set("home.example.com", "A", "192.0.2.1")
+	server.Set("nas.example.com", "A", "192.0.2.2")
+	// Stored as sent by an updater, served in canonical form
+	_, err := r.config.Store.Apply(state.Change{Hostname: "v6.example.com", Domain: "example.com", Type: "AAAA", Value: "2001:DB8:0::1", View: "public"})
+	assert.NoError(t, err)
+	server.Set("v6.example.com", "AAAA", "2001:db8::1")
+
+	assert.Equal(t, 0, len(r.Check(context.Background())))
+	assert.Equal(t, 0, len(p.updates))
+}
@@ -0,0 +1,296 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+)
+
+const (
+	// DefaultHistoryLimit is the number of changes kept per record
+	DefaultHistoryLimit = 20
+
+	stateDir  = ".homeddns"
+	stateFile = "state.json"
+)
+
+// Change is a single change of a record value
+type Change struct {
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname"`
+	Domain   string    `json:"domain"`
+	Type     string    `json:"type"`
+	Value    string    `json:"value"`
+	Previous string    `json:"previous,omitempty"`
+	View     string    `json:"view,omitempty"`
+	Provider string    `json:"provider,omitempty"`
+	Client   string    `json:"client,omitempty"`
+	User     string    `json:"user,omitempty"`
+}
+
+// Record is the last applied value of a hostname and type in one view
+type Record struct {
+	Hostname string    `json:"hostname"`
+	Domain   string    `json:"domain"`
+	Type     string    `json:"type"`
+	Value    string    `json:"value"`
+	View     string    `json:"view,omitempty"`
+	Provider string    `json:"provider,omitempty"`
+	Changed  time.Time `json:"changed"`
+	Client   string    `json:"client,omitempty"`
+	User     string    `json:"user,omitempty"`
+	// LastSeen is the time of the last update request, changed or not
+	LastSeen time.Time `json:"last_seen"`
+	// History holds the most recent changes, oldest first
+	History []Change `json:"history,omitempty"`
+}
+
+// file is the on-disk format
+type file struct {
+	Version int       `json:"version"`
+	Records []*Record `json:"records"`
+}
+
+// Store persists the last applied records and their history in a JSON file
+type Store struct {
+	path         string
+	historyLimit int
+	now          func() time.Time
+
+	mu          sync.Mutex
+	records     map[string]*Record
+	subscribers []func(Change)
+}
+
+// DefaultPath returns ~/.homeddns/state.json
+func DefaultPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return stateFile
+	}
+	return filepath.Join(homeDir, stateDir, stateFile)
+}
+
+// Open loads the store from path. A missing file yields an empty store.
+func Open(path string, historyLimit int) (*Store, error) {
+	if historyLimit <= 0 {
+		historyLimit = DefaultHistoryLimit
+	}
+	s := &Store{
+		path:         path,
+		historyLimit: historyLimit,
+		now:          time.Now,
+		records:      make(map[string]*Record),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		logger.Debug("State file %s does not exist yet", path)
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state file: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse state file %s: %w", path, err)
+	}
+	for _, record := range f.Records {
+		s.records[recordKey(record.View, record.Hostname, record.Type)] = record
+	}
+	logger.Debug("Loaded %d records from state file %s", len(s.records), path)
+	return s, nil
+}
+
+// Path returns the state file path
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Subscribe registers fn to be called after every applied change
+func (s *Store) Subscribe(fn func(Change)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// Apply records an applied update. If the value differs from the stored one,
+// the change is added to the history, persisted and passed to subscribers.
+// It reports whether the value changed.
+func (s *Store) Apply(change Change) (bool, error) {
+	if change.Time.IsZero() {
+		change.Time = s.now()
+	}
+	change.Hostname = strings.ToLower(change.Hostname)
+
+	s.mu.Lock()
+	key := recordKey(change.View, change.Hostname, change.Type)
+	record, ok := s.records[key]
+	if !ok {
+		record = &Record{Hostname: change.Hostname, Type: change.Type, View: change.View}
+		s.records[key] = record
+	}
+	record.Domain = change.Domain
+	record.Provider = change.Provider
+	record.LastSeen = change.Time
+
+	changed := !ok || record.Value != change.Value
+	if changed {
+		change.Previous = record.Value
+		record.Value = change.Value
+		record.Changed = change.Time
+		record.Client = change.Client
+		record.User = change.User
+		record.History = append(record.History, change)
+		if len(record.History) > s.historyLimit {
+			record.History = append([]Change(nil), record.History[len(record.History)-s.historyLimit:]...)
+		}
+	}
+
+	err := s.save()
+	subscribers := make([]func(Change), len(s.subscribers))
+	copy(subscribers, s.subscribers)
+	s.mu.Unlock()
+
+	if err != nil {
+		return changed, err
+	}
+	if changed {
+		for _, fn := range subscribers {
+			fn(change)
+		}
+	}
+	return changed, nil
+}
+
+// Get returns the stored record of a hostname and type in a view
+func (s *Store) Get(view, hostname, recordType string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[recordKey(view, hostname, recordType)]
+	if !ok {
+		return Record{}, false
+	}
+	return copyRecord(record), true
+}
+
+// Delete removes the record of a hostname and type in a view, including
+// its history, and returns it
+func (s *Store) Delete(view, hostname, recordType string) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := recordKey(view, hostname, recordType)
+	record, ok := s.records[key]
+	if !ok {
+		return Record{}, false, nil
+	}
+	delete(s.records, key)
+	return copyRecord(record), true, s.save()
+}
+
+// Records returns all stored records sorted by hostname, type and view
+func (s *Store) Records() []Record {
+	s.mu.Lock()
+	records := make([]Record, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, copyRecord(record))
+	}
+	s.mu.Unlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Hostname != b.Hostname {
+			return a.Hostname < b.Hostname
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.View < b.View
+	})
+	return records
+}
+
+// History returns the most recent changes, newest first. An empty hostname
+// matches all records; limit <= 0 returns everything.
+func (s *Store) History(hostname string, limit int) []Change {
+	hostname = strings.ToLower(hostname)
+
+	s.mu.Lock()
+	var changes []Change
+	for _, record := range s.records {
+		if hostname == "" || record.Hostname == hostname {
+			changes = append(changes, record.History...)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Time.After(changes[j].Time)
+	})
+	if limit > 0 && len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return changes
+}
+
+// save writes the store atomically; the caller must hold s.mu
+func (s *Store) save() error {
+	f := file{Version: 1, Records: make([]*Record, 0, len(s.records))}
+	for _, record := range s.records {
+		f.Records = append(f.Records, record)
+	}
+	sort.Slice(f.Records, func(i, j int) bool {
+		return recordKey(f.Records[i].View, f.Records[i].Hostname, f.Records[i].Type) <
+			recordKey(f.Records[j].View, f.Records[j].Hostname, f.Records[j].Type)
+	})
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("create temp state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write state file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("replace state file: %w", err)
+	}
+	return nil
+}
+
+// recordKey identifies a record in a view
+func recordKey(view, hostname, recordType string) string {
+	return view + "|" + strings.ToLower(hostname) + "|" + recordType
+}
+
+// copyRecord returns a copy that does not share the history slice
+func copyRecord(record *Record) Record {
+	c := *record
+	c.History = append([]Change(nil), record.History...)
+	return c
+}
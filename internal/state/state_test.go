@@ -0,0 +1,103 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestStore_ApplyAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "state.json")
+	store, err := Open(path, 2)
+	assert.NoError(t, err)
+
+	var notified []Change
+	store.Subscribe(func(c Change) { notified = append(notified, c) })
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	apply := func(minute int, value string) bool {
+		changed, err := store.Apply(Change{
+			Time:     base.Add(time.Duration(minute) * time.Minute),
+			Hostname: "NAS.example.com",
+			Domain:   "example.com",
+			Type:     "A",
+			Value:    value,
+			View:     "public",
+			Client:   "198.51.100.7",
+			User:     "router",
+		})
+		assert.NoError(t, err)
+		return changed
+	}
+
+	assert.True(t, apply(0, "192.0.2.1"))
+	assert.False(t, apply(5, "192.0.2.1"))
+	assert.True(t, apply(10, "192.0.2.2"))
+	assert.True(t, apply(15, "192.0.2.3"))
+	assert.Equal(t, 3, len(notified))
+	assert.Equal(t, "192.0.2.2", notified[2].Previous)
+
+	reopened, err := Open(path, 2)
+	assert.NoError(t, err)
+	record, ok := reopened.Get("public", "nas.example.com", "A")
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.3", record.Value)
+	assert.Equal(t, base.Add(15*time.Minute), record.Changed.UTC())
+	assert.Equal(t, base.Add(15*time.Minute), record.LastSeen.UTC())
+	assert.Equal(t, "router", record.User)
+
+	// History is bounded and returned newest first
+	history := reopened.History("nas.example.com", 0)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, "192.0.2.3", history[0].Value)
+	assert.Equal(t, "192.0.2.2", history[1].Value)
+	assert.Equal(t, 1, len(reopened.History("", 1)))
+	assert.Equal(t, 0, len(reopened.History("other.example.com", 0)))
+}
+
+func TestStore_ViewsAreSeparate(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "state.json"), 0)
+	assert.NoError(t, err)
+
+	_, err = store.Apply(Change{Hostname: "nas.example.com", Type: "A", Value: "192.0.2.1", View: "public"})
+	assert.NoError(t, err)
+	_, err = store.Apply(Change{Hostname: "nas.example.com", Type: "A", Value: "192.168.1.10", View: "lan"})
+	assert.NoError(t, err)
+
+	records := store.Records()
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, "lan", records[0].View)
+	assert.Equal(t, "public", records[1].View)
+}
+
+func TestStore_Delete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := Open(path, 0)
+	assert.NoError(t, err)
+
+	_, err = store.Apply(Change{Hostname: "nas.example.com", Type: "A", Value: "192.0.2.1", View: "public"})
+	assert.NoError(t, err)
+
+	record, ok, err := store.Delete("public", "NAS.example.com", "A")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.1", record.Value)
+
+	_, ok, err = store.Delete("public", "nas.example.com", "A")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	reloaded, err := Open(path, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(reloaded.Records()))
+}
+
+func TestOpen_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0600))
+	_, err := Open(path, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,172 @@
+package tlscert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+)
+
+// ClientVerifier verifies client certificates against the CA certificates
+// of a file and rejects those revoked by an optional CRL file. The CRL is
+// reloaded when the file changes, so that revocations apply without a
+// restart. Use Config for the TLS listener.
+type ClientVerifier struct {
+	// CheckInterval is how often the modification time of the CRL is
+	// compared during handshakes (default DefaultCheckInterval)
+	CheckInterval time.Duration
+
+	cas     []*x509.Certificate
+	pool    *x509.CertPool
+	crlFile string
+
+	mu      sync.Mutex
+	modTime time.Time
+	checked time.Time
+	// revoked holds the revoked serial numbers by issuer
+	revoked    map[string]bool
+	nextUpdate time.Time
+}
+
+// NewClientVerifier loads the CA certificates of caFile and, if crlFile is
+// set, the CRL, which must be signed by one of the CAs
+func NewClientVerifier(caFile, crlFile string) (*ClientVerifier, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	v := &ClientVerifier{CheckInterval: DefaultCheckInterval, pool: x509.NewCertPool(), crlFile: crlFile}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		ca, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse client CA %s: %w", caFile, err)
+		}
+		v.cas = append(v.cas, ca)
+		v.pool.AddCert(ca)
+	}
+	if len(v.cas) == 0 {
+		return nil, fmt.Errorf("no certificates in client CA file %s", caFile)
+	}
+	if crlFile != "" {
+		if err := v.loadCRL(); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Config returns base with client certificate verification. Clients without
+// a certificate are accepted, so that endpoints without authentication stay
+// reachable; certificates that do not verify or are revoked fail the
+// handshake.
+func (v *ClientVerifier) Config(base *tls.Config) *tls.Config {
+	config := base.Clone()
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	config.ClientCAs = v.pool
+	config.VerifyConnection = v.VerifyConnection
+	return config
+}
+
+// CAs returns the number of CA certificates
+func (v *ClientVerifier) CAs() int {
+	return len(v.cas)
+}
+
+// Revoked returns the number of revoked certificates and when the CRL
+// should be replaced by a newer one
+func (v *ClientVerifier) Revoked() (int, time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return len(v.revoked), v.nextUpdate
+}
+
+// VerifyConnection rejects verified chains that contain a revoked
+// certificate. It reloads the CRL first if the file changed.
+func (v *ClientVerifier) VerifyConnection(state tls.ConnectionState) error {
+	if v.crlFile == "" || len(state.VerifiedChains) == 0 {
+		return nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if time.Since(v.checked) >= v.CheckInterval {
+		v.checked = time.Now()
+		if info, err := os.Stat(v.crlFile); err != nil {
+			logger.Warn("Cannot check CRL file: %v", err)
+		} else if !info.ModTime().Equal(v.modTime) {
+			if err := v.load(); err != nil {
+				logger.Warn("Keeping the current CRL: %v", err)
+			}
+		}
+	}
+	for _, chain := range state.VerifiedChains {
+		for _, cert := range chain {
+			if v.revoked[revocationKey(cert.RawIssuer, cert.SerialNumber.String())] {
+				return fmt.Errorf("client certificate %s (serial %s) is revoked", cert.Subject, cert.SerialNumber)
+			}
+		}
+	}
+	return nil
+}
+
+// loadCRL reads the CRL file
+func (v *ClientVerifier) loadCRL() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.load()
+}
+
+// load reads the CRL file; v.mu must be held
+func (v *ClientVerifier) load() error {
+	info, err := os.Stat(v.crlFile)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(v.crlFile)
+	if err != nil {
+		return err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return fmt.Errorf("parse CRL %s: %w", v.crlFile, err)
+	}
+	signed := false
+	for _, ca := range v.cas {
+		if crl.CheckSignatureFrom(ca) == nil {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return errors.New("CRL " + v.crlFile + " is not signed by a client CA")
+	}
+
+	revoked := make(map[string]bool, len(crl.RevokedCertificateEntries))
+	for _, entry := range crl.RevokedCertificateEntries {
+		revoked[revocationKey(crl.RawIssuer, entry.SerialNumber.String())] = true
+	}
+	v.revoked, v.nextUpdate = revoked, crl.NextUpdate
+	v.modTime, v.checked = info.ModTime(), time.Now()
+	logger.Info("Loaded CRL %s with %d revoked certificates", v.crlFile, len(revoked))
+	if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+		logger.Warn("CRL %s is outdated since %s", v.crlFile, crl.NextUpdate.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// revocationKey identifies a certificate by its issuer and serial number
+func revocationKey(issuer []byte, serial string) string {
+	return string(issuer) + "/" + serial
+}
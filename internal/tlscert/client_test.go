@@ -0,0 +1,158 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// testCA issues client certificates and CRLs
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+// writeCA writes the CA certificate
+func (ca *testCA) writeCA(t *testing.T, path string) {
+	t.Helper()
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600))
+}
+
+// issue returns a client certificate for name
+func (ca *testCA) issue(t *testing.T, serial int64, name string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// writeCRL writes a CRL revoking serials
+func (ca *testCA) writeCRL(t *testing.T, path string, number int64, modTime time.Time, serials ...int64) {
+	t.Helper()
+	var entries []x509.RevocationListEntry
+	for _, serial := range serials {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(number),
+		ThisUpdate:                time.Now().Add(-time.Minute),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}, ca.cert, ca.key)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o600))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestClientVerifier(t *testing.T) {
+	dir := t.TempDir()
+	caFile, crlFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca.crl")
+	ca := newTestCA(t)
+	ca.writeCA(t, caFile)
+	start := time.Now().Add(-time.Hour)
+	ca.writeCRL(t, crlFile, 1, start, 3)
+
+	v, err := NewClientVerifier(caFile, crlFile)
+	assert.NoError(t, err)
+	v.CheckInterval = 0
+	assert.Equal(t, 1, v.CAs())
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.VerifiedChains) > 0 {
+			_, _ = w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+		}
+	}))
+	server.TLS = v.Config(&tls.Config{})
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(certs ...tls.Certificate) (string, error) {
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		buf := make([]byte, 64)
+		n, _ := resp.Body.Read(buf)
+		return string(buf[:n]), nil
+	}
+
+	// Clients without a certificate are left to the authentication
+	identity, err := get()
+	assert.NoError(t, err)
+	assert.Equal(t, "", identity)
+
+	identity, err = get(ca.issue(t, 2, "router"))
+	assert.NoError(t, err)
+	assert.Equal(t, "router", identity)
+
+	// Revoked certificates and those of other CAs fail the handshake
+	_, err = get(ca.issue(t, 3, "stolen"))
+	assert.Error(t, err)
+	_, err = get(newTestCA(t).issue(t, 2, "router"))
+	assert.Error(t, err)
+
+	// A new CRL applies without a restart
+	ca.writeCRL(t, crlFile, 2, start.Add(time.Minute), 2, 3)
+	_, err = get(ca.issue(t, 2, "router"))
+	assert.Error(t, err)
+	revoked, _ := v.Revoked()
+	assert.Equal(t, 2, revoked)
+}
+
+func TestNewClientVerifier_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	caFile, crlFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca.crl")
+	_, err := NewClientVerifier(caFile, "")
+	assert.Error(t, err)
+
+	// The CRL must be signed by a client CA
+	newTestCA(t).writeCA(t, caFile)
+	newTestCA(t).writeCRL(t, crlFile, 1, time.Now(), 2)
+	_, err = NewClientVerifier(caFile, crlFile)
+	assert.Error(t, err)
+}
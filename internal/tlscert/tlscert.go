@@ -0,0 +1,119 @@
+// Package tlscert serves TLS certificates that can change while the server
+// is running, such as renewed Let's Encrypt certificates, and verifies
+// client certificates.
+package tlscert
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/logger"
+)
+
+// DefaultCheckInterval is how often the files are checked for changes
+const DefaultCheckInterval = 10 * time.Second
+
+// Reloader serves the certificate of a certificate and key file and reloads
+// it when the files change. Use GetCertificate in a tls.Config.
+type Reloader struct {
+	// CheckInterval is how often the modification times are compared during
+	// handshakes (default DefaultCheckInterval)
+	CheckInterval time.Duration
+
+	mu       sync.Mutex
+	certFile string
+	keyFile  string
+	modTime  time.Time
+	checked  time.Time
+	cert     *tls.Certificate
+}
+
+// New loads the certificate and key file
+func New(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{CheckInterval: DefaultCheckInterval}
+	if err := r.SetFiles(certFile, keyFile); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetFiles loads a certificate from other files. On error the current
+// certificate is kept.
+func (r *Reloader) SetFiles(certFile, keyFile string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.load(certFile, keyFile)
+}
+
+// Reload loads the files again, even if they seem unchanged. On error the
+// current certificate is kept.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.load(r.certFile, r.keyFile)
+}
+
+// Certificate returns the current certificate
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert
+}
+
+// GetCertificate returns the current certificate, reloading it first if the
+// files changed since the last check
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) >= r.CheckInterval {
+		r.checked = time.Now()
+		if modTime, err := latestModTime(r.certFile, r.keyFile); err != nil {
+			logger.Warn("Cannot check certificate files: %v", err)
+		} else if !modTime.Equal(r.modTime) {
+			if err := r.load(r.certFile, r.keyFile); err != nil {
+				// Renewals may write the two files one after the other
+				logger.Warn("Keeping the current certificate: %v", err)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// load reads the certificate and key; r.mu must be held
+func (r *Reloader) load(certFile, keyFile string) error {
+	modTime, err := latestModTime(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate %s: %w", certFile, err)
+	}
+
+	r.certFile, r.keyFile = certFile, keyFile
+	r.modTime, r.checked = modTime, time.Now()
+	r.cert = &cert
+	if cert.Leaf != nil {
+		logger.Info("Loaded certificate for %v, valid until %s", cert.Leaf.DNSNames, cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// latestModTime returns the newest modification time of the files
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
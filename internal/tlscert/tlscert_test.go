@@ -0,0 +1,81 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// writeCert writes a self-signed certificate for name and its key
+func writeCert(t *testing.T, certFile, keyFile, name string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	assert.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	assert.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func served(t *testing.T, r *Reloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	assert.NoError(t, err)
+	return cert.Leaf.DNSNames[0]
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "fullchain.pem"), filepath.Join(dir, "privkey.pem")
+	start := time.Now().Add(-time.Hour)
+	writeCert(t, certFile, keyFile, "old.example.com", start)
+
+	r, err := New(certFile, keyFile)
+	assert.NoError(t, err)
+	r.CheckInterval = 0
+	assert.Equal(t, "old.example.com", served(t, r))
+
+	// A renewal is picked up on the next handshake
+	writeCert(t, certFile, keyFile, "new.example.com", start.Add(time.Minute))
+	assert.Equal(t, "new.example.com", served(t, r))
+
+	// A half-written renewal keeps the current certificate
+	assert.NoError(t, os.WriteFile(keyFile, []byte("garbage"), 0o600))
+	assert.Equal(t, "new.example.com", served(t, r))
+	assert.Error(t, r.Reload())
+
+	// Other files can be set, but only valid ones
+	assert.Error(t, r.SetFiles(filepath.Join(dir, "missing.pem"), keyFile))
+	other := t.TempDir()
+	writeCert(t, filepath.Join(other, "cert.pem"), filepath.Join(other, "key.pem"), "other.example.com", start)
+	assert.NoError(t, r.SetFiles(filepath.Join(other, "cert.pem"), filepath.Join(other, "key.pem")))
+	assert.Equal(t, "other.example.com", served(t, r))
+}
+
+func TestNew_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	_, err := New(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	assert.Error(t, err)
+}
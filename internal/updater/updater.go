@@ -0,0 +1,315 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/audit"
+	"github.com/markussiebert/homeddns/internal/dnsclient"
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/state"
+)
+
+// AddressSource selects which address a view publishes for a hostname
+type AddressSource string
+
+const (
+	// SourceRequest publishes the address sent by the updater (myip parameter,
+	// falling back to the client address). This is the classic DynDNS behaviour.
+	SourceRequest AddressSource = "request"
+	// SourceClient publishes the source address of the update request
+	SourceClient AddressSource = "client"
+	// SourceStatic publishes addresses from a static hostname map
+	SourceStatic AddressSource = "static"
+)
+
+// View routes one variant of a record (e.g. public or LAN) to a provider
+type View struct {
+	Name     string
+	Provider provider.Provider
+	Source   AddressSource
+	// Static maps hostnames to addresses for SourceStatic views
+	Static map[string][]string
+}
+
+// Request describes a single hostname update
+type Request struct {
+	Hostname string // fully qualified, e.g. nas.example.com
+	Domain   string // zone, e.g. example.com
+	Address  string // address sent by the updater (myip or detected public IP)
+	Client   string // source address of the request
+	Type     string // restrict to A or AAAA (optional)
+	User     string // authenticated user (optional)
+	// Wait, if set, waits up to this long for each update to be served by
+	// the provider's nameservers
+	Wait time.Duration
+}
+
+// Result is the outcome of a request for one view and address
+type Result struct {
+	View     string
+	Provider string
+	Record   *provider.DNSRecord
+	Err      error
+	// Changed reports whether the value differs from the last applied one.
+	// Without a state store every successful update counts as a change.
+	Changed bool
+}
+
+// Updater applies updates to all configured views
+type Updater struct {
+	// views is replaced as a whole by SetViews; requests keep the views they
+	// started with
+	views      atomic.Pointer[[]View]
+	defaultTTL int
+	store      *state.Store
+	audit      *audit.Log
+	dns        *dnsclient.Client
+	// pollInterval is how often the nameservers are queried while waiting
+	pollInterval time.Duration
+}
+
+// New creates a new updater. The first view is the primary one whose result
+// is reported to DynDNS clients.
+func New(defaultTTL int, views ...View) *Updater {
+	if defaultTTL == 0 {
+		defaultTTL = 60
+	}
+	u := &Updater{
+		defaultTTL:   defaultTTL,
+		dns:          &dnsclient.Client{},
+		pollInterval: 2 * time.Second,
+	}
+	u.SetViews(views...)
+	return u
+}
+
+// SetViews replaces the views, e.g. after the configuration was reloaded.
+// Updates in progress finish with the previous views.
+func (u *Updater) SetViews(views ...View) {
+	views = append([]View(nil), views...)
+	for i := range views {
+		if views[i].Source == "" {
+			views[i].Source = SourceRequest
+		}
+	}
+	u.views.Store(&views)
+}
+
+// UseStore records every successful update in store
+func (u *Updater) UseStore(store *state.Store) {
+	u.store = store
+}
+
+// UseAudit appends every successful update to log
+func (u *Updater) UseAudit(log *audit.Log) {
+	u.audit = log
+}
+
+// UseDNSClient sets the client used to wait for propagation at the
+// authoritative nameservers
+func (u *Updater) UseDNSClient(client *dnsclient.Client) {
+	u.dns = client
+}
+
+// Store returns the state store, or nil if none is used
+func (u *Updater) Store() *state.Store {
+	return u.store
+}
+
+// Views returns the configured views
+func (u *Updater) Views() []View {
+	return *u.views.Load()
+}
+
+// Update applies the request to every view. Views without an address for the
+// hostname are skipped and produce no result.
+func (u *Updater) Update(ctx context.Context, req Request) []Result {
+	var results []Result
+	for _, view := range u.Views() {
+		for _, address := range u.addresses(view, req) {
+			record := &provider.DNSRecord{
+				Name:  req.Hostname,
+				Type:  RecordType(address),
+				Value: address,
+				TTL:   u.defaultTTL,
+			}
+			if req.Type != "" && record.Type != req.Type {
+				continue
+			}
+
+			logger.DebugContext(ctx, "Updating view %s: hostname=%s, type=%s, value=%s, provider=%s",
+				view.Name, record.Name, record.Type, record.Value, view.Provider.Name())
+
+			result := Result{View: view.Name, Provider: view.Provider.Name(), Record: record}
+			if err := view.Provider.UpdateRecord(ctx, req.Domain, record); err != nil {
+				result.Err = fmt.Errorf("update DNS record: %w", err)
+			} else {
+				var previous string
+				previous, result.Changed = u.record(ctx, view, req, record)
+				u.writeAudit(ctx, audit.ActionUpdate, view, req, record, previous, result.Changed)
+				if req.Wait > 0 {
+					if err := u.wait(ctx, view, req, record); err != nil {
+						result.Err = fmt.Errorf("wait for propagation: %w", err)
+					}
+				}
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// Delete removes the records of a hostname from every view. Without
+// req.Type, both A and AAAA records are removed. Address and Wait are
+// ignored.
+func (u *Updater) Delete(ctx context.Context, req Request) []Result {
+	types := []string{"A", "AAAA"}
+	if req.Type != "" {
+		types = []string{req.Type}
+	}
+
+	var results []Result
+	for _, view := range u.Views() {
+		for _, recordType := range types {
+			record := &provider.DNSRecord{Name: req.Hostname, Type: recordType}
+			logger.DebugContext(ctx, "Deleting from view %s: hostname=%s, type=%s, provider=%s",
+				view.Name, record.Name, record.Type, view.Provider.Name())
+
+			result := Result{View: view.Name, Provider: view.Provider.Name(), Record: record}
+			if err := provider.DeleteRecord(ctx, view.Provider, req.Domain, record); err != nil {
+				result.Err = fmt.Errorf("delete DNS record: %w", err)
+				results = append(results, result)
+				continue
+			}
+
+			var previous string
+			if u.store != nil {
+				stored, ok, err := u.store.Delete(view.Name, record.Name, record.Type)
+				if err != nil {
+					logger.WarnContext(ctx, "Failed to save state for %s: %v", record.Name, err)
+				}
+				previous = stored.Value
+				result.Changed = ok
+			}
+			u.writeAudit(ctx, audit.ActionDelete, view, req, record, previous, result.Changed)
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// record stores a successful update. It returns the previously applied
+// value and reports whether the value changed.
+func (u *Updater) record(ctx context.Context, view View, req Request, record *provider.DNSRecord) (string, bool) {
+	if u.store == nil {
+		return "", true
+	}
+	previous, _ := u.store.Get(view.Name, record.Name, record.Type)
+	changed, err := u.store.Apply(state.Change{
+		Hostname: record.Name,
+		Domain:   req.Domain,
+		Type:     record.Type,
+		Value:    record.Value,
+		View:     view.Name,
+		Provider: view.Provider.Name(),
+		Client:   req.Client,
+		User:     req.User,
+	})
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to save state for %s: %v", record.Name, err)
+	}
+	return previous.Value, changed
+}
+
+// writeAudit appends a successful update or deletion to the audit log, if any
+func (u *Updater) writeAudit(ctx context.Context, action string, view View, req Request, record *provider.DNSRecord, previous string, changed bool) {
+	if u.audit == nil {
+		return
+	}
+	err := u.audit.Write(audit.Entry{
+		Action:    action,
+		Hostname:  record.Name,
+		Domain:    req.Domain,
+		Type:      record.Type,
+		Previous:  previous,
+		Value:     record.Value,
+		Changed:   changed,
+		View:      view.Name,
+		Provider:  view.Provider.Name(),
+		Client:    req.Client,
+		User:      req.User,
+		RequestID: logger.RequestID(ctx),
+	})
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to write audit log for %s: %v", record.Name, err)
+	}
+}
+
+// wait blocks until the record is served, using the provider's own status
+// if it has one and the zone's authoritative nameservers otherwise
+func (u *Updater) wait(ctx context.Context, view View, req Request, record *provider.DNSRecord) error {
+	ctx, cancel := context.WithTimeout(ctx, req.Wait)
+	defer cancel()
+
+	start := time.Now()
+	var err error
+	if waiter, ok := provider.As[provider.PropagationWaiter](view.Provider); ok {
+		err = waiter.WaitForPropagation(ctx, req.Domain, record)
+	} else {
+		err = u.dns.WaitForValue(ctx, req.Domain, record.Name, record.Type, record.Value, u.pollInterval)
+	}
+	if err != nil {
+		return err
+	}
+	logger.InfoContext(ctx, "View %s: %s (%s) propagated after %v", view.Name, record.Name, record.Type, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// addresses returns the addresses a view publishes for a request, in the
+// canonical form of net.IP.String, so that state, cache, drift checks and
+// propagation waits compare equal values
+func (u *Updater) addresses(view View, req Request) []string {
+	var candidates []string
+	switch view.Source {
+	case SourceRequest:
+		candidates = []string{req.Address}
+	case SourceClient:
+		candidates = []string{req.Client}
+	case SourceStatic:
+		candidates = view.Static[strings.ToLower(req.Hostname)]
+	}
+
+	var addresses []string
+	for _, address := range candidates {
+		if ip := net.ParseIP(address); ip != nil {
+			addresses = append(addresses, ip.String())
+		}
+	}
+	return addresses
+}
+
+// RecordType returns A or AAAA depending on the address family
+func RecordType(address string) string {
+	if strings.Contains(address, ":") {
+		return "AAAA"
+	}
+	return "A"
+}
+
+// ZoneOf returns the longest of zones containing hostname
+func ZoneOf(zones []string, hostname string) (string, bool) {
+	best := ""
+	for _, zone := range zones {
+		zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+		if (hostname == zone || strings.HasSuffix(hostname, "."+zone)) && len(zone) > len(best) {
+			best = zone
+		}
+	}
+	return best, best != ""
+}
@@ -0,0 +1,174 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/state"
+)
+
+// viewProvider keeps the records of one view in memory and fails every
+// update if err is set
+type viewProvider struct {
+	name string
+	err  error
+
+	mu      sync.Mutex
+	records map[string]string
+}
+
+func newViewProvider(name string) *viewProvider {
+	return &viewProvider{name: name, records: map[string]string{}}
+}
+
+func (p *viewProvider) Name() string { return p.name }
+
+func (p *viewProvider) GetRecord(ctx context.Context, domain, hostname, recordType string) (*provider.DNSRecord, error) {
+	return nil, provider.ErrNotSupported
+}
+
+func (p *viewProvider) UpdateRecord(ctx context.Context, domain string, record *provider.DNSRecord) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records[record.Name+"/"+record.Type] = record.Value
+	return nil
+}
+
+func (p *viewProvider) DeleteRecord(ctx context.Context, domain string, record *provider.DNSRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.records, record.Name+"/"+record.Type)
+	return nil
+}
+
+func (p *viewProvider) Close(ctx context.Context) error { return nil }
+
+// summary returns view=value for every result, or view=error
+func summary(results []Result) []string {
+	var lines []string
+	for _, result := range results {
+		value := result.Record.Type + " " + result.Record.Value
+		if result.Err != nil {
+			value = "error"
+		}
+		lines = append(lines, result.View+"="+value)
+	}
+	return lines
+}
+
+func TestUpdater_Update_Views(t *testing.T) {
+	public, lan := newViewProvider("netcup"), newViewProvider("pihole")
+	u := New(60,
+		View{Name: "public", Provider: public},
+		View{Name: "lan", Provider: lan, Source: SourceStatic, Static: map[string][]string{
+			"nas.example.com": {"192.168.1.10", "fd00::10"},
+		}},
+	)
+	assert.Equal(t, SourceRequest, u.Views()[0].Source)
+
+	// The public view gets the requested address, the LAN view its static ones
+	results := u.Update(context.Background(), Request{Hostname: "nas.example.com", Domain: "example.com", Address: "203.0.113.7", Client: "192.168.1.2"})
+	assert.Equal(t, []string{"public=A 203.0.113.7", "lan=A 192.168.1.10", "lan=AAAA fd00::10"}, summary(results))
+	assert.Equal(t, map[string]string{"nas.example.com/A": "203.0.113.7"}, public.records)
+	assert.Equal(t, map[string]string{"nas.example.com/A": "192.168.1.10", "nas.example.com/AAAA": "fd00::10"}, lan.records)
+
+	// Hostnames without a static address are skipped in the LAN view
+	results = u.Update(context.Background(), Request{Hostname: "vpn.example.com", Domain: "example.com", Address: "203.0.113.7"})
+	assert.Equal(t, []string{"public=A 203.0.113.7"}, summary(results))
+
+	// Type restricts the records of all views
+	results = u.Update(context.Background(), Request{Hostname: "nas.example.com", Domain: "example.com", Address: "203.0.113.7", Type: "AAAA"})
+	assert.Equal(t, []string{"lan=AAAA fd00::10"}, summary(results))
+}
+
+func TestUpdater_Update_ClientSource(t *testing.T) {
+	public, lan := newViewProvider("netcup"), newViewProvider("pihole")
+	u := New(60, View{Name: "public", Provider: public}, View{Name: "lan", Provider: lan, Source: SourceClient})
+
+	results := u.Update(context.Background(), Request{Hostname: "nas.example.com", Domain: "example.com", Address: "203.0.113.7", Client: "192.168.1.2"})
+	assert.Equal(t, []string{"public=A 203.0.113.7", "lan=A 192.168.1.2"}, summary(results))
+
+	// Without a valid client address only the public view is updated
+	results = u.Update(context.Background(), Request{Hostname: "nas.example.com", Domain: "example.com", Address: "203.0.113.7", Client: "unknown"})
+	assert.Equal(t, []string{"public=A 203.0.113.7"}, summary(results))
+}
+
+func TestUpdater_Update_PartialFailure(t *testing.T) {
+	public, lan := newViewProvider("netcup"), newViewProvider("pihole")
+	lan.err = errors.New("pihole unreachable")
+	u := New(60, View{Name: "public", Provider: public}, View{Name: "lan", Provider: lan, Source: SourceClient})
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.json"), 0)
+	assert.NoError(t, err)
+	u.UseStore(store)
+
+	// A failing LAN view does not keep the public record from being applied
+	results := u.Update(context.Background(), Request{Hostname: "nas.example.com", Domain: "example.com", Address: "203.0.113.7", Client: "192.168.1.2"})
+	assert.Equal(t, []string{"public=A 203.0.113.7", "lan=error"}, summary(results))
+	assert.True(t, results[0].Changed)
+	assert.Contains(t, results[1].Err.Error(), "pihole unreachable")
+
+	_, ok := store.Get("lan", "nas.example.com", "A")
+	assert.False(t, ok)
+	stored, ok := store.Get("public", "nas.example.com", "A")
+	assert.True(t, ok)
+	assert.Equal(t, "203.0.113.7", stored.Value)
+}
+
+func TestUpdater_Update_CanonicalAddresses(t *testing.T) {
+	public := newViewProvider("netcup")
+	u := New(60, View{Name: "public", Provider: public})
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.json"), 0)
+	assert.NoError(t, err)
+	u.UseStore(store)
+
+	results := u.Update(context.Background(), Request{Hostname: "nas.example.com", Domain: "example.com", Address: "2001:DB8:0::1"})
+	assert.Equal(t, []string{"public=AAAA 2001:db8::1"}, summary(results))
+	assert.True(t, results[0].Changed)
+
+	// The same address in another notation is no change
+	results = u.Update(context.Background(), Request{Hostname: "nas.example.com", Domain: "example.com", Address: "2001:db8:0:0::1"})
+	assert.False(t, results[0].Changed)
+
+	// IPv4-mapped addresses are A records
+	results = u.Update(context.Background(), Request{Hostname: "nas.example.com", Domain: "example.com", Address: "::ffff:192.0.2.1"})
+	assert.Equal(t, []string{"public=A 192.0.2.1"}, summary(results))
+}
+
+func TestUpdater_Delete(t *testing.T) {
+	public, lan := newViewProvider("netcup"), newViewProvider("pihole")
+	u := New(60, View{Name: "public", Provider: public}, View{Name: "lan", Provider: lan, Source: SourceClient})
+	u.Update(context.Background(), Request{Hostname: "nas.example.com", Domain: "example.com", Address: "2001:db8::1", Client: "192.168.1.2"})
+
+	results := u.Delete(context.Background(), Request{Hostname: "nas.example.com", Domain: "example.com"})
+	assert.Equal(t, 4, len(results))
+	for _, result := range results {
+		assert.NoError(t, result.Err)
+	}
+	assert.Equal(t, 0, len(public.records))
+	assert.Equal(t, 0, len(lan.records))
+}
+
+func TestRecordType(t *testing.T) {
+	assert.Equal(t, "A", RecordType("192.0.2.1"))
+	assert.Equal(t, "AAAA", RecordType("2001:db8::1"))
+}
+
+func TestZoneOf(t *testing.T) {
+	zones := []string{"example.com", "Lan.Example.com."}
+	zone, ok := ZoneOf(zones, "nas.lan.example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "lan.example.com", zone)
+	zone, ok = ZoneOf(zones, "example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "example.com", zone)
+	_, ok = ZoneOf(zones, "badexample.com")
+	assert.False(t, ok)
+}
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+// keyValuePatterns match key=value and key: value pairs. Quoted values may
+// contain spaces. "=" pairs are matched first so that "var: KEY=value"
+// is recognized by its inner pair.
+var keyValuePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_.-]*)(=)("[^"]*"|'[^']*'|[^\s,;&)]+)`),
+	regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_.-]*)(: ?)("[^"]*"|'[^']*'|[^\s,;&)]+)`),
+}
+
+// RedactKeyValues replaces the values of key=value pairs in text whose key
+// is sensitive (see IsSensitiveKey) with Redacted
+func RedactKeyValues(text string) string {
+	if !strings.ContainsAny(text, "=:") {
+		return text
+	}
+	for _, pattern := range keyValuePatterns {
+		text = pattern.ReplaceAllStringFunc(text, func(pair string) string {
+			m := pattern.FindStringSubmatch(pair)
+			if !IsSensitiveKey(m[1]) || m[3] == Redacted {
+				return pair
+			}
+			return m[1] + m[2] + Redacted
+		})
+	}
+	return text
+}
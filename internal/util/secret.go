@@ -0,0 +1,83 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Redacted replaces secrets in log output
+const Redacted = "[REDACTED]"
+
+// Secret is a string that is redacted when printed, formatted, logged or
+// marshalled to JSON. Use Value to get the plain text.
+type Secret string
+
+// Value returns the plain text of the secret
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String returns Redacted, or "" for an empty secret
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// GoString redacts the secret for %#v
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+// Format redacts the secret for every fmt verb
+func (s Secret) Format(f fmt.State, verb rune) {
+	_, _ = io.WriteString(f, s.String())
+}
+
+// MarshalJSON redacts the secret in JSON output
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// LogValue redacts the secret in slog attributes
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+// maxSecretFileSize bounds the size of a secret file
+const maxSecretFileSize = 64 << 10
+
+// ReadSecretFile reads a secret from a file, such as a Docker or Kubernetes
+// secret, and trims surrounding whitespace. The file must be a regular file
+// (symlinks are followed) that is not writable by group or others, so that
+// no other user can replace the secret.
+func ReadSecretFile(path string) (Secret, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("secret file %s is not a regular file", path)
+	}
+	if info.Mode().Perm()&0o022 != 0 {
+		return "", fmt.Errorf("secret file %s is writable by group or others (mode %s)", path, info.Mode().Perm())
+	}
+	if info.Size() > maxSecretFileSize {
+		return "", fmt.Errorf("secret file %s is larger than %d bytes", path, maxSecretFileSize)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return Secret(secret), nil
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSecret(t *testing.T) {
+	secret := Secret("hunter2")
+	config := struct {
+		Username string
+		Password Secret
+	}{"dyndns", secret}
+
+	assert.Equal(t, "hunter2", secret.Value())
+	for _, format := range []string{"%s", "%v", "%q", "%x", "%#v", "%+v"} {
+		assert.NotContains(t, fmt.Sprintf(format, secret), "hunter2")
+		assert.NotContains(t, fmt.Sprintf(format, config), "hunter2")
+	}
+	assert.Equal(t, "{dyndns [REDACTED]}", fmt.Sprintf("%v", config))
+
+	data, err := json.Marshal(config)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Username":"dyndns","Password":"[REDACTED]"}`, string(data))
+
+	assert.Equal(t, "", Secret("").String())
+}
+
+func TestRedactKeyValues(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"hostname=home.example.com myip=192.0.2.1", "hostname=home.example.com myip=192.0.2.1"},
+		{"Query params: hostname=a.example.com&password=hunter2", "Query params: hostname=a.example.com&password=[REDACTED]"},
+		{"Setting env var: NETCUP_API_KEY=abcd...wxyz", "Setting env var: NETCUP_API_KEY=[REDACTED]"},
+		{`auth_password: "two words" done`, `auth_password: [REDACTED] done`},
+		{"token=abc, value=1", "token=[REDACTED], value=1"},
+		{"started at 12:00:00", "started at 12:00:00"},
+	} {
+		assert.Equal(t, tc.want, RedactKeyValues(tc.in))
+	}
+}
+
+func TestReadSecretFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, mode os.FileMode) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		assert.NoError(t, os.Chmod(path, mode))
+		return path
+	}
+
+	secret, err := ReadSecretFile(write("password", "hunter2\n", 0o400))
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", secret.Value())
+
+	// Docker and Kubernetes mount secrets readable by everyone
+	secret, err = ReadSecretFile(write("mounted", "  hunter2  ", 0o444))
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", secret.Value())
+
+	for _, path := range []string{
+		write("writable", "hunter2", 0o666),
+		write("group-writable", "hunter2", 0o620),
+		write("empty", "\n", 0o600),
+		filepath.Join(dir, "missing"),
+		dir,
+	} {
+		_, err := ReadSecretFile(path)
+		assert.Error(t, err, path)
+	}
+}
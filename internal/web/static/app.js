@@ -0,0 +1,163 @@
+"use strict";
+
+// All URLs are relative to <base>, which is the ingress path when served
+// through Home Assistant.
+
+const refreshInterval = 30000;
+
+function cell(text, className) {
+  const td = document.createElement("td");
+  td.textContent = text === undefined || text === "" ? "-" : text;
+  if (className) {
+    td.className = className;
+  }
+  return td;
+}
+
+function formatTime(value) {
+  if (!value || value.startsWith("0001-")) {
+    return "";
+  }
+  return new Date(value).toLocaleString();
+}
+
+function source(entry) {
+  return [entry.user, entry.client].filter(Boolean).join(" @ ");
+}
+
+function showMessage(text, isError) {
+  const message = document.getElementById("message");
+  message.textContent = text;
+  message.className = isError ? "error" : "";
+  message.hidden = !text;
+}
+
+function replaceRows(id, rows, columns) {
+  const body = document.getElementById(id);
+  if (rows.length === 0) {
+    const tr = document.createElement("tr");
+    const td = cell("Nothing yet", "empty");
+    td.colSpan = columns;
+    tr.append(td);
+    rows = [tr];
+  }
+  body.replaceChildren(...rows);
+}
+
+async function post(path, body) {
+  const response = await fetch(path, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(body),
+  });
+  if (!response.ok) {
+    throw new Error((await response.text()).trim() || response.statusText);
+  }
+  return response.json();
+}
+
+async function update(hostname) {
+  showMessage("Updating " + hostname + "…");
+  try {
+    const result = await post("api/update", { hostname: hostname });
+    showMessage("Update of " + hostname + ": " + result.status, result.status !== "good");
+  } catch (err) {
+    showMessage("Update of " + hostname + " failed: " + err.message, true);
+  }
+  refresh();
+}
+
+async function remove(hostname, type) {
+  if (!confirm("Delete the " + type + " record of " + hostname + " from all views?")) {
+    return;
+  }
+  showMessage("Deleting " + hostname + "…");
+  try {
+    const result = await post("api/delete", { hostname: hostname, type: type });
+    const failed = result.results.filter((r) => r.error);
+    if (failed.length > 0) {
+      showMessage("Deletion of " + hostname + " failed: " +
+        failed.map((r) => r.view + ": " + r.error).join("; "), true);
+    } else {
+      showMessage("Deleted " + type + " record of " + hostname);
+    }
+  } catch (err) {
+    showMessage("Deletion of " + hostname + " failed: " + err.message, true);
+  }
+  refresh();
+}
+
+function button(label, onClick, disabled) {
+  const b = document.createElement("button");
+  b.type = "button";
+  b.textContent = label;
+  b.disabled = disabled;
+  b.addEventListener("click", onClick);
+  return b;
+}
+
+function renderHosts(status) {
+  replaceRows("hosts", status.hosts.map((host) => {
+    const tr = document.createElement("tr");
+    let current = cell(host.current);
+    if (host.current_error) {
+      current = cell("unknown", "muted");
+      current.title = host.current_error;
+    } else if (host.current !== host.value) {
+      current.className = "drift";
+    }
+    const actions = document.createElement("td");
+    actions.append(
+      button("Update", () => update(host.hostname), !status.can_update),
+      button("Delete", () => remove(host.hostname, host.type), false),
+    );
+    tr.append(
+      cell(host.hostname), cell(host.type), cell(host.view), cell(host.value), current,
+      cell(formatTime(host.changed)), cell(formatTime(host.last_seen)), cell(source(host)), actions,
+    );
+    return tr;
+  }), 9);
+}
+
+function renderProviders(status) {
+  const providers = status.health ? status.health.providers : [];
+  replaceRows("providers", providers.map((p) => {
+    const tr = document.createElement("tr");
+    tr.append(
+      cell(p.view), cell(p.provider), cell(p.status, p.status === "error" ? "error" : "ok"),
+      cell(p.latency), cell(p.error, "wrap"),
+    );
+    return tr;
+  }), 5);
+}
+
+function renderAudit(status) {
+  replaceRows("audit", status.audit.map((entry) => {
+    const tr = document.createElement("tr");
+    tr.append(
+      cell(formatTime(entry.time)), cell(entry.action), cell(entry.hostname), cell(entry.type),
+      cell(entry.view), cell(entry.previous), cell(entry.action === "delete" ? "(deleted)" : entry.value),
+      cell(source(entry)),
+    );
+    return tr;
+  }), 8);
+}
+
+async function refresh() {
+  try {
+    const response = await fetch("api/status");
+    if (!response.ok) {
+      throw new Error(response.statusText);
+    }
+    const status = await response.json();
+    renderHosts(status);
+    renderProviders(status);
+    renderAudit(status);
+  } catch (err) {
+    showMessage("Failed to load status: " + err.message, true);
+  }
+}
+
+document.getElementById("refresh").addEventListener("click", refresh);
+refresh();
+setInterval(refresh, refreshInterval);
@@ -0,0 +1,413 @@
+// Package web serves the status UI, either through Home Assistant ingress or
+// below a path prefix of the DynDNS server.
+package web
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/markussiebert/homeddns/internal/audit"
+	"github.com/markussiebert/homeddns/internal/auth"
+	"github.com/markussiebert/homeddns/internal/health"
+	"github.com/markussiebert/homeddns/internal/logger"
+	"github.com/markussiebert/homeddns/internal/updater"
+)
+
+// IngressProxy is the address from which the Home Assistant supervisor
+// proxies ingress requests. Only its X-Ingress-Path headers are trusted.
+const IngressProxy = "172.30.32.2"
+
+//go:embed static
+var static embed.FS
+
+var indexTemplate = template.Must(template.ParseFS(static, "static/index.html"))
+
+// Config configures the UI
+type Config struct {
+	Updater *updater.Updater
+	// Health, if set, is reported with the status
+	Health *health.Checker
+	// AuditLog is the path of the audit log; if empty, no entries are shown
+	AuditLog string
+	// AuditEntries is the number of recent audit entries shown (default 50)
+	AuditEntries int
+	Version      string
+	// Domain is the zone of hostnames below it that are deleted without a
+	// stored record
+	Domain string
+	// Zones, if set, are the only zones whose hostnames can be updated or
+	// deleted, as for DynDNS updates
+	Zones []string
+	// Ingress serves requests of the Home Assistant ingress proxy without
+	// further authentication. Only set it when running as the add-on.
+	Ingress bool
+	// Prefix is the path the UI is mounted at outside of ingress, e.g. "/ui"
+	Prefix string
+	// Update forces an update of a hostname and returns its DynDNS status.
+	// If nil, the update button is disabled.
+	Update func(ctx context.Context, hostname, client, user string) string
+	// LookupTimeout bounds the provider lookups of the current values
+	// (default 5s)
+	LookupTimeout time.Duration
+}
+
+// Host is one managed record with its last applied and current value
+type Host struct {
+	Hostname     string    `json:"hostname"`
+	Domain       string    `json:"domain"`
+	Type         string    `json:"type"`
+	View         string    `json:"view"`
+	Provider     string    `json:"provider,omitempty"`
+	Value        string    `json:"value"`
+	Current      string    `json:"current,omitempty"`
+	CurrentError string    `json:"current_error,omitempty"`
+	Changed      time.Time `json:"changed"`
+	LastSeen     time.Time `json:"last_seen"`
+	Client       string    `json:"client,omitempty"`
+	User         string    `json:"user,omitempty"`
+}
+
+// Status is the document behind the UI
+type Status struct {
+	Version   string         `json:"version"`
+	CanUpdate bool           `json:"can_update"`
+	Hosts     []Host         `json:"hosts"`
+	Health    *health.Report `json:"health,omitempty"`
+	Audit     []audit.Entry  `json:"audit"`
+}
+
+// DeleteResult is the outcome of a deletion in one view
+type DeleteResult struct {
+	View     string `json:"view"`
+	Provider string `json:"provider"`
+	Type     string `json:"type"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Handler serves the UI and its API
+type Handler struct {
+	config Config
+	mux    *http.ServeMux
+}
+
+// New creates the UI handler. It serves paths relative to the UI root, so
+// outside of ingress it must be mounted with http.StripPrefix.
+func New(config Config) *Handler {
+	if config.AuditEntries <= 0 {
+		config.AuditEntries = 50
+	}
+	if config.LookupTimeout <= 0 {
+		config.LookupTimeout = 5 * time.Second
+	}
+	config.Prefix = strings.TrimSuffix(config.Prefix, "/")
+
+	h := &Handler{config: config, mux: http.NewServeMux()}
+	assets, _ := fs.Sub(static, "static")
+	h.mux.HandleFunc("GET /{$}", h.index)
+	h.mux.Handle("GET /static/", http.StripPrefix("/static", http.FileServer(http.FS(assets))))
+	h.mux.HandleFunc("GET /api/status", h.status)
+	h.mux.HandleFunc("POST /api/update", h.update)
+	h.mux.HandleFunc("POST /api/delete", h.delete)
+	return h
+}
+
+// ServeHTTP handles HTTP requests
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", "default-src 'self'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	h.mux.ServeHTTP(w, r)
+}
+
+// ingressKey is the context key of an ingress request
+type ingressKey struct{}
+
+// ingress describes a request proxied by Home Assistant
+type ingress struct {
+	path string
+	user string
+}
+
+// Ingress serves ui for requests proxied by Home Assistant ingress, which
+// Home Assistant has already authenticated, and next for all others. Unless
+// ingress is enabled in the configuration of ui, all requests go to next.
+func Ingress(ui *Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.Header.Get("X-Ingress-Path")
+		if !ui.config.Ingress || path == "" || remoteIP(r) != IngressProxy {
+			next.ServeHTTP(w, r)
+			return
+		}
+		in := ingress{path: strings.TrimSuffix(path, "/"), user: r.Header.Get("X-Remote-User-Name")}
+		ui.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ingressKey{}, in)))
+	})
+}
+
+// base returns the path the browser sees as the UI root, without trailing
+// slash
+func (h *Handler) base(r *http.Request) string {
+	if in, ok := r.Context().Value(ingressKey{}).(ingress); ok {
+		return in.path
+	}
+	return h.config.Prefix
+}
+
+// user returns the name recorded for actions of a request
+func (h *Handler) user(r *http.Request) string {
+	if in, ok := r.Context().Value(ingressKey{}).(ingress); ok && in.user != "" {
+		return in.user
+	}
+	if user := auth.UserFromContext(r.Context()); user != "" {
+		return user
+	}
+	return "web"
+}
+
+// index serves the page with the base path set
+func (h *Handler) index(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	err := indexTemplate.Execute(w, map[string]string{
+		"Base":    h.base(r),
+		"Version": h.config.Version,
+	})
+	if err != nil {
+		logger.WarnContext(r.Context(), "Failed to render web UI: %v", err)
+	}
+}
+
+// status reports hosts, provider health and recent audit entries
+func (h *Handler) status(w http.ResponseWriter, r *http.Request) {
+	status := Status{
+		Version:   h.config.Version,
+		CanUpdate: h.config.Update != nil,
+		Hosts:     h.hosts(r.Context()),
+		Audit:     []audit.Entry{},
+	}
+	if h.config.Health != nil {
+		report := h.config.Health.Check(r.Context())
+		status.Health = &report
+	}
+	if h.config.AuditLog != "" {
+		entries, err := audit.Read(h.config.AuditLog, audit.Filter{})
+		if err != nil {
+			logger.WarnContext(r.Context(), "Failed to read audit log: %v", err)
+		}
+		if len(entries) > h.config.AuditEntries {
+			entries = entries[len(entries)-h.config.AuditEntries:]
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			status.Audit = append(status.Audit, entries[i])
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// hosts returns the stored records, looking up their current values at the
+// providers concurrently
+func (h *Handler) hosts(ctx context.Context) []Host {
+	hosts := []Host{}
+	store := h.config.Updater.Store()
+	if store == nil {
+		return hosts
+	}
+	for _, record := range store.Records() {
+		hosts = append(hosts, Host{
+			Hostname: record.Hostname,
+			Domain:   record.Domain,
+			Type:     record.Type,
+			View:     record.View,
+			Provider: record.Provider,
+			Value:    record.Value,
+			Changed:  record.Changed,
+			LastSeen: record.LastSeen,
+			Client:   record.Client,
+			User:     record.User,
+		})
+	}
+	sort.SliceStable(hosts, func(i, j int) bool {
+		if hosts[i].Hostname != hosts[j].Hostname {
+			return hosts[i].Hostname < hosts[j].Hostname
+		}
+		return hosts[i].View < hosts[j].View
+	})
+
+	views := make(map[string]updater.View)
+	for _, view := range h.config.Updater.Views() {
+		views[view.Name] = view
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.config.LookupTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := range hosts {
+		host := &hosts[i]
+		view, ok := views[host.View]
+		if !ok {
+			host.CurrentError = "view not configured"
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			record, err := view.Provider.GetRecord(ctx, host.Domain, host.Hostname, host.Type)
+			if err != nil {
+				host.CurrentError = err.Error()
+				return
+			}
+			host.Current = record.Value
+		}()
+	}
+	wg.Wait()
+	return hosts
+}
+
+// actionRequest is the body of an update or delete request
+type actionRequest struct {
+	Hostname string `json:"hostname"`
+	Type     string `json:"type"`
+}
+
+// update forces an update of a hostname
+func (h *Handler) update(w http.ResponseWriter, r *http.Request) {
+	req, ok := readAction(w, r)
+	if !ok {
+		return
+	}
+	if !auth.HostAllowed(r.Context(), req.Hostname) {
+		http.Error(w, h.user(r)+" may not change "+req.Hostname, http.StatusForbidden)
+		return
+	}
+	if !h.inZones(w, req.Hostname) {
+		return
+	}
+	if h.config.Update == nil {
+		http.Error(w, "Manual updates are not available", http.StatusNotImplemented)
+		return
+	}
+	logger.InfoContext(r.Context(), "Update of %s requested via web UI by %s", req.Hostname, h.user(r))
+	status := h.config.Update(r.Context(), req.Hostname, remoteIP(r), h.user(r))
+	writeJSON(w, http.StatusOK, map[string]string{"hostname": req.Hostname, "status": status})
+}
+
+// delete removes the records of a hostname from all views
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	req, ok := readAction(w, r)
+	if !ok {
+		return
+	}
+	if !auth.HostAllowed(r.Context(), req.Hostname) {
+		http.Error(w, h.user(r)+" may not change "+req.Hostname, http.StatusForbidden)
+		return
+	}
+	if !h.inZones(w, req.Hostname) {
+		return
+	}
+	domain := ""
+	if store := h.config.Updater.Store(); store != nil {
+		for _, record := range store.Records() {
+			if record.Hostname == req.Hostname && record.Domain != "" {
+				domain = record.Domain
+				break
+			}
+		}
+	}
+	if domain == "" && len(h.config.Zones) > 0 {
+		domain, _ = updater.ZoneOf(h.config.Zones, req.Hostname)
+	} else if domain == "" && inDomain(req.Hostname, h.config.Domain) {
+		domain = h.config.Domain
+	}
+	if domain == "" {
+		http.Error(w, "Unknown domain of "+req.Hostname, http.StatusBadRequest)
+		return
+	}
+
+	logger.InfoContext(r.Context(), "Deletion of %s requested via web UI by %s", req.Hostname, h.user(r))
+	results := h.config.Updater.Delete(r.Context(), updater.Request{
+		Hostname: req.Hostname,
+		Domain:   domain,
+		Type:     req.Type,
+		Client:   remoteIP(r),
+		User:     h.user(r),
+	})
+	response := make([]DeleteResult, 0, len(results))
+	for _, result := range results {
+		res := DeleteResult{View: result.View, Provider: result.Provider, Type: result.Record.Type}
+		if result.Err != nil {
+			logger.ErrorContext(r.Context(), "Deletion of %s from view %s failed: %v", req.Hostname, result.View, result.Err)
+			res.Error = result.Err.Error()
+		}
+		response = append(response, res)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"hostname": req.Hostname, "results": response})
+}
+
+// inZones reports whether hostname is in a configured zone, or writes an
+// error. Without configured zones all hostnames are.
+func (h *Handler) inZones(w http.ResponseWriter, hostname string) bool {
+	if len(h.config.Zones) == 0 {
+		return true
+	}
+	if _, ok := updater.ZoneOf(h.config.Zones, hostname); !ok {
+		http.Error(w, hostname+" is not in a configured zone", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// inDomain reports whether hostname is domain or one of its subdomains
+func inDomain(hostname, domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	return domain != "" && (hostname == domain || strings.HasSuffix(hostname, "."+domain))
+}
+
+// readAction decodes an action request. Requiring a JSON content type keeps
+// other sites from submitting forms to the API.
+func readAction(w http.ResponseWriter, r *http.Request) (actionRequest, bool) {
+	var req actionRequest
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return req, false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return req, false
+	}
+	req.Hostname = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(req.Hostname)), ".")
+	req.Type = strings.ToUpper(req.Type)
+	if req.Hostname == "" {
+		http.Error(w, "Missing hostname", http.StatusBadRequest)
+		return req, false
+	}
+	if req.Type != "" && req.Type != "A" && req.Type != "AAAA" {
+		http.Error(w, "Type must be A or AAAA", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// remoteIP returns the address of the direct peer
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,243 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/markussiebert/homeddns/internal/audit"
+	"github.com/markussiebert/homeddns/internal/health"
+	"github.com/markussiebert/homeddns/internal/provider"
+	"github.com/markussiebert/homeddns/internal/state"
+	"github.com/markussiebert/homeddns/internal/updater"
+)
+
+// memProvider keeps records in memory
+type memProvider struct {
+	mu      sync.Mutex
+	records map[string]string
+}
+
+func (p *memProvider) Name() string { return "mem" }
+
+func (p *memProvider) GetRecord(ctx context.Context, domain, hostname, recordType string) (*provider.DNSRecord, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	value, ok := p.records[hostname+"/"+recordType]
+	if !ok {
+		return nil, fmt.Errorf("record not found")
+	}
+	return &provider.DNSRecord{Name: hostname, Type: recordType, Value: value}, nil
+}
+
+func (p *memProvider) UpdateRecord(ctx context.Context, domain string, record *provider.DNSRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records[record.Name+"/"+record.Type] = record.Value
+	return nil
+}
+
+func (p *memProvider) DeleteRecord(ctx context.Context, domain string, record *provider.DNSRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.records, record.Name+"/"+record.Type)
+	return nil
+}
+
+func (p *memProvider) HealthCheck(ctx context.Context) error { return nil }
+
+func (p *memProvider) Close(ctx context.Context) error { return nil }
+
+// newTestHandler returns a UI for one public view with nas.example.com
+// stored as 192.0.2.1 and served as 192.0.2.9
+func newTestHandler(t *testing.T, config Config) (*Handler, *memProvider) {
+	t.Helper()
+	dir := t.TempDir()
+	p := &memProvider{records: map[string]string{"nas.example.com/A": "192.0.2.9"}}
+	upd := updater.New(60, updater.View{Name: "public", Provider: p, Source: updater.SourceRequest})
+
+	store, err := state.Open(filepath.Join(dir, "state.json"), 0)
+	assert.NoError(t, err)
+	_, err = store.Apply(state.Change{Hostname: "nas.example.com", Domain: "example.com", Type: "A", Value: "192.0.2.1", View: "public", User: "router"})
+	assert.NoError(t, err)
+	upd.UseStore(store)
+
+	config.AuditLog = filepath.Join(dir, "audit.log")
+	log, err := audit.Open(config.AuditLog, 0, 0)
+	assert.NoError(t, err)
+	upd.UseAudit(log)
+
+	config.Updater = upd
+	config.Health = health.New(0, health.Target{View: "public", Provider: p})
+	return New(config), p
+}
+
+func post(t *testing.T, h http.Handler, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_Status(t *testing.T) {
+	h, _ := newTestHandler(t, Config{Version: "1.2.3"})
+	log, err := audit.Open(h.config.AuditLog, 0, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, log.Write(audit.Entry{Hostname: "first.example.com", Type: "A", Value: "192.0.2.1"}))
+	assert.NoError(t, log.Write(audit.Entry{Hostname: "second.example.com", Type: "A", Value: "192.0.2.2"}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var status Status
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert.Equal(t, "1.2.3", status.Version)
+	assert.False(t, status.CanUpdate)
+	assert.Equal(t, 1, len(status.Hosts))
+	assert.Equal(t, "192.0.2.1", status.Hosts[0].Value)
+	assert.Equal(t, "192.0.2.9", status.Hosts[0].Current)
+	assert.Equal(t, "router", status.Hosts[0].User)
+	assert.Equal(t, health.StatusOK, status.Health.Status)
+	// Newest first
+	assert.Equal(t, 2, len(status.Audit))
+	assert.Equal(t, "second.example.com", status.Audit[0].Hostname)
+}
+
+func TestHandler_Index(t *testing.T) {
+	h, _ := newTestHandler(t, Config{Prefix: "/ui/"})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<base href="/ui/">`)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/static/app.js", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "api/status")
+}
+
+func TestIngress(t *testing.T) {
+	var user string
+	h, _ := newTestHandler(t, Config{
+		Prefix:  "/ui",
+		Ingress: true,
+		Update: func(ctx context.Context, hostname, client, u string) string {
+			user = u
+			return "good"
+		},
+	})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := Ingress(h, next)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = IngressProxy + ":41234"
+	req.Header.Set("X-Ingress-Path", "/api/hassio_ingress/abc")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<base href="/api/hassio_ingress/abc/">`)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/update", strings.NewReader(`{"hostname":"nas.example.com"}`))
+	req.RemoteAddr = IngressProxy + ":41234"
+	req.Header.Set("X-Ingress-Path", "/api/hassio_ingress/abc")
+	req.Header.Set("X-Remote-User-Name", "alice")
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "alice", user)
+
+	// The header is ignored from anywhere else
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.50:41234"
+	req.Header.Set("X-Ingress-Path", "/api/hassio_ingress/abc")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+
+	// Outside the add-on the ingress proxy address is not trusted
+	h.config.Ingress = false
+	req = httptest.NewRequest(http.MethodPost, "/api/delete", strings.NewReader(`{"hostname":"nas.example.com"}`))
+	req.RemoteAddr = IngressProxy + ":41234"
+	req.Header.Set("X-Ingress-Path", "/api/hassio_ingress/abc")
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+}
+
+func TestHandler_Delete(t *testing.T) {
+	h, p := newTestHandler(t, Config{})
+
+	rec := post(t, h, "/api/delete", `{"hostname":"NAS.example.com.","type":"A"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"view":"public"`)
+	assert.NotContains(t, rec.Body.String(), `"error"`)
+
+	_, ok := p.records["nas.example.com/A"]
+	assert.False(t, ok)
+	assert.Equal(t, 0, len(h.config.Updater.Store().Records()))
+
+	entries, err := audit.Read(h.config.AuditLog, audit.Filter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, audit.ActionDelete, entries[0].Action)
+	assert.Equal(t, "192.0.2.1", entries[0].Previous)
+	assert.Equal(t, "web", entries[0].User)
+
+	// Without a stored record only names in the configured domain are deleted
+	h.config.Domain = "example.com"
+	assert.Equal(t, http.StatusOK, post(t, h, "/api/delete", `{"hostname":"old.example.com"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(t, h, "/api/delete", `{"hostname":"foo.other.org"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(t, h, "/api/delete", `{"hostname":"badexample.com"}`).Code)
+}
+
+func TestHandler_Zones(t *testing.T) {
+	var updated []string
+	h, p := newTestHandler(t, Config{
+		Zones: []string{"lan.example.com"},
+		Update: func(ctx context.Context, hostname, client, user string) string {
+			updated = append(updated, hostname)
+			return "good"
+		},
+	})
+
+	// Hostnames outside the configured zones cannot be changed, even with
+	// a stored record
+	assert.Equal(t, http.StatusForbidden, post(t, h, "/api/update", `{"hostname":"nas.example.com"}`).Code)
+	assert.Equal(t, http.StatusForbidden, post(t, h, "/api/delete", `{"hostname":"nas.example.com"}`).Code)
+	assert.Equal(t, 0, len(updated))
+	assert.Equal(t, "192.0.2.9", p.records["nas.example.com/A"])
+
+	// Hostnames inside are deleted from their zone without a stored record
+	assert.Equal(t, http.StatusOK, post(t, h, "/api/update", `{"hostname":"nas.lan.example.com"}`).Code)
+	assert.Equal(t, []string{"nas.lan.example.com"}, updated)
+	assert.Equal(t, http.StatusOK, post(t, h, "/api/delete", `{"hostname":"nas.lan.example.com"}`).Code)
+}
+
+func TestHandler_RejectsInvalidActions(t *testing.T) {
+	h, _ := newTestHandler(t, Config{})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/delete", strings.NewReader(`{"hostname":"nas.example.com"}`))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	assert.Equal(t, http.StatusBadRequest, post(t, h, "/api/delete", `{"hostname":""}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(t, h, "/api/delete", `{"hostname":"nas.example.com","type":"MX"}`).Code)
+	assert.Equal(t, http.StatusNotImplemented, post(t, h, "/api/update", `{"hostname":"nas.example.com"}`).Code)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/markussiebert/homeddns/cmd"
@@ -13,15 +14,38 @@ import (
 
 // CLI holds the command-line interface structure.
 type CLI struct {
+	Config string `help:"Configuration file (YAML or TOML); environment variables override its settings." type:"existingfile" env:"CONFIG_FILE"`
+
 	Server struct {
-		Port int `help:"Port to listen on." default:"8053"`
+		Port int `help:"Port to listen on (default PORT or 8053)."`
 	} `cmd:"" help:"Run as a web server."`
 
 	Update struct {
-		Hostname string `arg:"" help:"Hostname to update (e.g., sub.domain.com)."`
-		Type     string `help:"Record type (A or AAAA)." default:"A" enum:"A,AAAA"`
+		Hostname    string        `arg:"" help:"Hostname to update (e.g., sub.domain.com)."`
+		Type        string        `help:"Record type (A or AAAA)." default:"A" enum:"A,AAAA"`
+		Wait        bool          `help:"Wait until the record is served by the provider's nameservers."`
+		WaitTimeout time.Duration `help:"Maximum time to wait (default WAIT_TIMEOUT or 2m)."`
 	} `cmd:"" help:"Update a DNS record with the current public IP."`
 
+	History struct {
+		Hostname string `arg:"" optional:"" help:"Only show changes of this hostname."`
+		Limit    int    `help:"Maximum number of changes to show (0 for all)." default:"20"`
+	} `cmd:"" help:"Show recent DNS record changes from the state file."`
+
+	Audit struct {
+		Hostname string `arg:"" optional:"" help:"Only show updates of this hostname."`
+		Since    string `help:"Only show updates at or after this time (e.g. 2024-05-01, 2024-05-01T12:00:00Z or 24h for the last day)."`
+		Until    string `help:"Only show updates before this time."`
+		Limit    int    `help:"Maximum number of updates to show, most recent last (0 for all)."`
+		JSON     bool   `help:"Print JSON lines instead of a table."`
+	} `cmd:"" help:"Show the audit log of DNS record updates."`
+
+	ConfigCmd struct {
+		Validate struct{} `cmd:"" help:"Check the configuration and report all problems with their source."`
+	} `cmd:"" name:"config" help:"Inspect the configuration."`
+
+	Doctor struct{} `cmd:"" help:"Check provider credentials, zones, public IP detection and the TLS certificate."`
+
 	Version struct{} `cmd:"" help:"Print the current version."`
 
 	ListProviders bool `help:"List available DNS providers."`
@@ -63,7 +87,7 @@ func isRunningInContainer() bool {
 
 func main() {
 	// Initialize logger at INFO level by default
-	// Will be re-initialized after loading Home Assistant config
+	// Will be re-initialized after loading the configuration
 	logger.SetLevel(logger.LevelInfo)
 
 	ensureServerDefaultForContainer()
@@ -84,21 +108,67 @@ func main() {
 		return
 	}
 
-	config, err := cmd.LoadConfig()
+	// History only needs the state file (STATE_FILE), not the full server
+	// configuration
+	if strings.HasPrefix(ctx.Command(), "history") {
+		ctx.FatalIfErrorf(cmd.RunHistory(os.Stdout, cli.History.Hostname, cli.History.Limit))
+		return
+	}
+
+	// Audit only needs the audit log (AUDIT_LOG)
+	if strings.HasPrefix(ctx.Command(), "audit") {
+		ctx.FatalIfErrorf(cmd.RunAudit(os.Stdout, cmd.AuditOptions{
+			Hostname: cli.Audit.Hostname,
+			Since:    cli.Audit.Since,
+			Until:    cli.Audit.Until,
+			Limit:    cli.Audit.Limit,
+			JSON:     cli.Audit.JSON,
+		}))
+		return
+	}
+
+	// Diagnostics report problems themselves instead of failing on the first
+	switch ctx.Command() {
+	case "config validate":
+		logger.SetLevel(logger.LevelError)
+		ctx.FatalIfErrorf(cmd.RunValidate(os.Stdout, cli.Config))
+		return
+	case "doctor":
+		logger.SetLevel(logger.LevelError)
+		ctx.FatalIfErrorf(cmd.RunDoctor(os.Stdout, cli.Config))
+		return
+	}
+
+	config, err := cmd.LoadConfig(cli.Config)
 	if err != nil {
 		ctx.FatalIfErrorf(fmt.Errorf("failed to load configuration: %w", err))
 	}
 
-	// Re-initialize logger with LOG_LEVEL from environment (set by Home Assistant config)
-	logger.SetLevelFromString(os.Getenv("LOG_LEVEL"))
+	// Re-initialize logger with LOG_LEVEL and LOG_FORMAT from the environment, the Home Assistant options or the config file
+	logger.SetFormat(config.LogFormat)
+	logger.SetLevelFromString(config.LogLevel)
 	logger.Debug("Logger re-initialized with level: %s", logger.GetLevel())
 	logger.Debug("Configuration loaded: provider=%s, ttl=%d", config.Provider, config.DefaultTTL)
 
+	cmd.Version = versionString()
 	switch ctx.Command() {
 	case "server":
-		err = cmd.RunServer(cli.Server.Port, config)
+		port := cli.Server.Port
+		if port == 0 {
+			port = config.Port
+		}
+		err = cmd.RunServer(port, config, func() (*cmd.Config, error) {
+			return cmd.LoadConfig(cli.Config)
+		})
 	case "update <hostname>":
-		err = cmd.RunUpdate(cli.Update.Hostname, cli.Update.Type, config)
+		var wait time.Duration
+		if cli.Update.Wait {
+			wait = cli.Update.WaitTimeout
+			if wait == 0 {
+				wait = config.WaitTimeout
+			}
+		}
+		err = cmd.RunUpdate(cli.Update.Hostname, cli.Update.Type, wait, config)
 	default:
 		err = fmt.Errorf("unknown command: %s", ctx.Command())
 	}